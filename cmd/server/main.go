@@ -1,28 +1,88 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"log"
 	"net/http"
+	"net/netip"
+	"strings"
+	"time"
+	_ "time/tzdata"
 
+	"bankapp-microservices/internal/autopay"
 	"bankapp-microservices/internal/handlers"
+	"bankapp-microservices/internal/jwt"
 	"bankapp-microservices/internal/middleware"
+	"bankapp-microservices/internal/rewards"
+	"bankapp-microservices/internal/statement"
 	"bankapp-microservices/internal/store"
 
 	"github.com/gorilla/mux"
 )
 
 func main() {
+	storeBackend := flag.String("store", "memory", "persistence backend: memory or file")
+	storePath := flag.String("store-path", "bankapp.db", "data file used by the file backend")
+	tokenMode := flag.String("token-mode", "opaque", "access token format: opaque or jwt")
+	jwtKeyFile := flag.String("jwt-keys", "", "JSON key file for jwt mode (an ephemeral Ed25519 key is generated if empty)")
+	jwtCheckSession := flag.Bool("jwt-check-session", false, "also reject JWTs whose session was revoked (needs a store shared by every replica)")
+	limitsTimezone := flag.String("limits-timezone", "Asia/Kolkata", "time zone whose calendar days and months reset limit usage")
+	billingTimezone := flag.String("billing-timezone", "Asia/Kolkata", "time zone whose midnight closes credit card billing cycles")
+	settlementKey := flag.String("settlement-key", "", "shared key the merchant settlement system sends to post refunds (settlement routes are off if empty)")
+	trustedProxies := flag.String("trusted-proxies", "", "comma-separated addresses or CIDR ranges of reverse proxies whose X-Forwarded-For is believed")
+	flag.Parse()
+
 	// Initialize store
-	store := store.NewStore()
+	dataStore, err := openStore(*storeBackend, *storePath)
+	if err != nil {
+		log.Fatal("Failed to open store:", err)
+	}
+
+	keys, err := openKeySet(*tokenMode, *jwtKeyFile)
+	if err != nil {
+		log.Fatal("Failed to load JWT keys:", err)
+	}
+
+	limitsLocation, err := time.LoadLocation(*limitsTimezone)
+	if err != nil {
+		log.Fatal("Invalid limits time zone:", err)
+	}
+
+	billingLocation, err := time.LoadLocation(*billingTimezone)
+	if err != nil {
+		log.Fatal("Invalid billing time zone:", err)
+	}
+
+	proxies, err := parseTrustedProxies(*trustedProxies)
+	if err != nil {
+		log.Fatal("Invalid trusted proxies:", err)
+	}
+
+	// Purge expired tokens, close billing cycles, run autopay and expire rewards points in the background
+	go store.SweepExpiredTokens(dataStore, time.Minute, nil)
+	go statement.Schedule(dataStore, time.Minute, billingLocation, nil)
+	go autopay.Schedule(dataStore, time.Minute, billingLocation, nil)
+	go rewards.Schedule(dataStore, time.Minute, nil)
 
 	// Initialize handlers
-	authHandler := handlers.NewAuthHandler(store)
-	creditHandler := handlers.NewCreditCardHandler(store)
-	debitHandler := handlers.NewDebitCardHandler(store)
-	virtualHandler := handlers.NewVirtualCardHandler(store)
-	settingsHandler := handlers.NewSettingsHandler(store)
-	limitsHandler := handlers.NewLimitsHandler(store)
+	authHandler := handlers.NewAuthHandler(dataStore, keys, proxies)
+	creditHandler := handlers.NewCreditCardHandler(dataStore, billingLocation)
+	debitHandler := handlers.NewDebitCardHandler(dataStore)
+	virtualHandler := handlers.NewVirtualCardHandler(dataStore)
+	settingsHandler := handlers.NewSettingsHandler(dataStore)
+	limitsHandler := handlers.NewLimitsHandler(dataStore, limitsLocation)
+	sessionHandler := handlers.NewSessionHandler(dataStore)
+	twoFactorHandler := handlers.NewTwoFactorHandler(dataStore)
+	profileHandler := handlers.NewProfileHandler(dataStore)
+	authorizationHandler := handlers.NewAuthorizationHandler(dataStore, limitsLocation)
+	ledgerHandler := handlers.NewLedgerHandler(dataStore)
+	transactionHandler := handlers.NewTransactionHandler(dataStore)
+	statementHandler := handlers.NewStatementHandler(dataStore, billingLocation)
+	rewardsHandler := handlers.NewRewardsHandler(dataStore)
+	emiHandler := handlers.NewEMIHandler(dataStore, billingLocation)
+	addonHandler := handlers.NewAddonHandler(dataStore, limitsLocation)
+	settlementHandler := handlers.NewSettlementHandler(dataStore)
 
 	// Setup router
 	r := mux.NewRouter()
@@ -31,8 +91,8 @@ func main() {
 	r.Use(func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
 			w.Header().Set("Access-Control-Allow-Origin", "*")
-			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, Idempotency-Key")
 
 			if req.Method == "OPTIONS" {
 				w.WriteHeader(http.StatusOK)
@@ -44,11 +104,33 @@ func main() {
 	})
 
 	// Public routes
+	r.HandleFunc("/.well-known/jwks.json", authHandler.JWKS).Methods("GET")
+	r.HandleFunc("/auth/register", authHandler.Register).Methods("POST", "OPTIONS")
 	r.HandleFunc("/auth/login", authHandler.Login).Methods("POST", "OPTIONS")
+	r.HandleFunc("/auth/refresh", authHandler.Refresh).Methods("POST", "OPTIONS")
+	r.HandleFunc("/auth/verify-otp", authHandler.VerifyOTP).Methods("POST", "OPTIONS")
+	r.HandleFunc("/auth/verify-pin", authHandler.VerifyPIN).Methods("POST", "OPTIONS")
+
+	// Authenticated auth routes
+	r.Handle("/auth/logout", middleware.AuthMiddleware(dataStore, keys, *jwtCheckSession)(http.HandlerFunc(authHandler.Logout))).Methods("POST", "OPTIONS")
 
 	// Protected routes
 	api := r.PathPrefix("/api").Subrouter()
-	api.Use(middleware.AuthMiddleware(store))
+	api.Use(middleware.AuthMiddleware(dataStore, keys, *jwtCheckSession))
+
+	// Session routes
+	api.HandleFunc("/sessions", sessionHandler.GetSessions).Methods("GET")
+	api.HandleFunc("/sessions/{sessionId}", sessionHandler.RevokeSession).Methods("DELETE")
+
+	// Profile routes
+	api.HandleFunc("/profile", profileHandler.GetProfile).Methods("GET")
+	api.HandleFunc("/profile", profileHandler.UpdateProfile).Methods("PUT")
+	api.HandleFunc("/profile/password", profileHandler.ChangePassword).Methods("POST")
+
+	// Second factor enrollment routes
+	api.HandleFunc("/2fa/otp/enroll", twoFactorHandler.EnrollOTP).Methods("POST")
+	api.HandleFunc("/2fa/otp/confirm", twoFactorHandler.ConfirmOTP).Methods("POST")
+	api.HandleFunc("/2fa/pin", twoFactorHandler.SetLoginPIN).Methods("PUT")
 
 	// Credit card routes
 	creditRouter := api.PathPrefix("/cards/credit").Subrouter()
@@ -56,17 +138,46 @@ func main() {
 	creditRouter.HandleFunc("/{cardId}", creditHandler.GetCreditCard).Methods("GET")
 	creditRouter.HandleFunc("/{cardId}/limits", creditHandler.UpdateLimits).Methods("PUT")
 	creditRouter.HandleFunc("/{cardId}/autopay", creditHandler.EnableAutopay).Methods("POST")
-	creditRouter.HandleFunc("/{cardId}/autopay", creditHandler.UpdateAutopay).Methods("PUT")
+	creditRouter.HandleFunc("/{cardId}/autopay", creditHandler.UpdateAutopay).Methods("PUT", "PATCH")
 	creditRouter.HandleFunc("/{cardId}/autopay", creditHandler.DisableAutopay).Methods("DELETE")
+	creditRouter.HandleFunc("/{cardId}/autopay/history", creditHandler.GetAutopayHistory).Methods("GET")
+	creditRouter.HandleFunc("/{cardId}/payments", creditHandler.MakePayment).Methods("POST")
+	creditRouter.HandleFunc("/{cardId}/payments", creditHandler.GetPayments).Methods("GET")
+	creditRouter.HandleFunc("/{cardId}/status", creditHandler.GetStatus).Methods("GET")
+	creditRouter.HandleFunc("/{cardId}/status", creditHandler.UpdateStatus).Methods("PUT")
+	creditRouter.HandleFunc("/{cardId}/replace", creditHandler.ReplaceCard).Methods("POST")
+	creditRouter.HandleFunc("/{cardId}/dispatch", creditHandler.GetDispatch).Methods("GET")
+	creditRouter.HandleFunc("/{cardId}/activate", creditHandler.Activate).Methods("POST")
 	creditRouter.HandleFunc("/{cardId}/pin", creditHandler.UpdatePIN).Methods("POST")
-	creditRouter.HandleFunc("/{cardId}/addon", creditHandler.RequestAddonCard).Methods("POST")
+	creditRouter.HandleFunc("/{cardId}/addon", addonHandler.RequestAddon).Methods("POST")
+	creditRouter.HandleFunc("/{cardId}/addons", addonHandler.GetAddons).Methods("GET")
+	creditRouter.HandleFunc("/{cardId}/addons/{addonId}", addonHandler.GetAddon).Methods("GET")
+	creditRouter.HandleFunc("/{cardId}/addons/{addonId}/cap", addonHandler.UpdateCap).Methods("PUT")
+	creditRouter.HandleFunc("/{cardId}/addons/{addonId}/status", addonHandler.UpdateStatus).Methods("PUT")
+	creditRouter.HandleFunc("/{cardId}/transactions", creditHandler.GetTransactions).Methods("GET")
+	creditRouter.HandleFunc("/{cardId}/transactions/{transactionId}/emi-offers", emiHandler.GetOffers).Methods("GET")
+	creditRouter.HandleFunc("/{cardId}/transactions/{transactionId}/emi", emiHandler.Convert).Methods("POST")
+	creditRouter.HandleFunc("/{cardId}/emi", emiHandler.GetPlans).Methods("GET")
+	creditRouter.HandleFunc("/{cardId}/emi/{planId}/foreclose", emiHandler.Foreclose).Methods("POST")
+	creditRouter.HandleFunc("/{cardId}/rewards", rewardsHandler.GetRewards).Methods("GET")
+	creditRouter.HandleFunc("/{cardId}/rewards/ledger", rewardsHandler.GetLedger).Methods("GET")
+	creditRouter.HandleFunc("/{cardId}/rewards/redeem", rewardsHandler.Redeem).Methods("POST")
+	creditRouter.HandleFunc("/{cardId}/statements", statementHandler.GetStatements).Methods("GET")
+	creditRouter.HandleFunc("/{cardId}/statements/{statementId}", statementHandler.GetStatement).Methods("GET")
+	creditRouter.HandleFunc("/{cardId}/statements/{statementId}/download", statementHandler.DownloadStatement).Methods("GET")
 
 	// Debit card routes
 	debitRouter := api.PathPrefix("/cards/debit").Subrouter()
 	debitRouter.HandleFunc("", debitHandler.GetDebitCards).Methods("GET")
 	debitRouter.HandleFunc("/{cardId}", debitHandler.GetDebitCard).Methods("GET")
 	debitRouter.HandleFunc("/{cardId}/limits", debitHandler.UpdateLimits).Methods("PUT")
+	debitRouter.HandleFunc("/{cardId}/status", debitHandler.GetStatus).Methods("GET")
+	debitRouter.HandleFunc("/{cardId}/status", debitHandler.UpdateStatus).Methods("PUT")
+	debitRouter.HandleFunc("/{cardId}/replace", debitHandler.ReplaceCard).Methods("POST")
+	debitRouter.HandleFunc("/{cardId}/dispatch", debitHandler.GetDispatch).Methods("GET")
+	debitRouter.HandleFunc("/{cardId}/activate", debitHandler.Activate).Methods("POST")
 	debitRouter.HandleFunc("/{cardId}/pin", debitHandler.UpdatePIN).Methods("POST")
+	debitRouter.HandleFunc("/{cardId}/transactions", debitHandler.GetTransactions).Methods("GET")
 
 	// Virtual card routes
 	virtualRouter := api.PathPrefix("/cards/virtual").Subrouter()
@@ -76,6 +187,7 @@ func main() {
 	virtualRouter.HandleFunc("/{cardId}", virtualHandler.UpdateVirtualCard).Methods("PUT")
 	virtualRouter.HandleFunc("/{cardId}", virtualHandler.DeleteVirtualCard).Methods("DELETE")
 	virtualRouter.HandleFunc("/{cardId}/spending-limit", virtualHandler.UpdateSpendingLimit).Methods("PUT")
+	virtualRouter.HandleFunc("/{cardId}/status", virtualHandler.GetStatus).Methods("GET")
 	virtualRouter.HandleFunc("/{cardId}/status", virtualHandler.UpdateStatus).Methods("PUT")
 	virtualRouter.HandleFunc("/{cardId}/regenerate", virtualHandler.RegenerateCard).Methods("POST")
 	virtualRouter.HandleFunc("/{cardId}/transactions", virtualHandler.GetTransactions).Methods("GET")
@@ -97,11 +209,32 @@ func main() {
 	limitsRouter.HandleFunc("/domestic", limitsHandler.UpdateDomesticLimits).Methods("PUT")
 	limitsRouter.HandleFunc("/international", limitsHandler.UpdateInternationalLimits).Methods("PUT")
 
+	// Card transaction authorization (works for any card type)
+	api.HandleFunc("/cards/{cardId}/authorize", authorizationHandler.Authorize).Methods("POST")
+	api.HandleFunc("/cards/{cardId}/pin/verify", authorizationHandler.VerifyPIN).Methods("POST")
+
+	// Transaction history across all of the user's cards
+	api.HandleFunc("/transactions", transactionHandler.GetTransactions).Methods("GET")
+
+	// Ledger accounts and journal entries behind card balances
+	api.HandleFunc("/ledger/accounts", ledgerHandler.GetAccounts).Methods("GET")
+	api.HandleFunc("/ledger/accounts/{accountId}/entries", ledgerHandler.GetEntries).Methods("GET")
+
+	// Merchant settlement routes, authenticated with the settlement key
+	if *settlementKey != "" {
+		settlement := r.PathPrefix("/settlement").Subrouter()
+		settlement.Use(middleware.SettlementMiddleware(*settlementKey))
+		settlement.HandleFunc("/cards/{cardId}/transactions/{transactionId}/refund", settlementHandler.Refund).Methods("POST")
+	}
+
 	// Start server
 	port := ":8080"
 	fmt.Printf("Server starting on http://localhost%s\n", port)
 	fmt.Println("API endpoints available at:")
+	fmt.Println("  POST   /auth/register")
 	fmt.Println("  POST   /auth/login")
+	fmt.Println("  POST   /auth/refresh")
+	fmt.Println("  POST   /auth/logout")
 	fmt.Println("  GET    /api/cards/credit")
 	fmt.Println("  GET    /api/cards/debit")
 	fmt.Println("  GET    /api/cards/virtual")
@@ -111,3 +244,56 @@ func main() {
 		log.Fatal("Server failed to start:", err)
 	}
 }
+
+// openStore creates the persistence backend selected on the command line
+func openStore(backend, path string) (store.Store, error) {
+	switch backend {
+	case "memory":
+		return store.NewMemoryStore(), nil
+	case "file":
+		return store.NewFileStore(path)
+	default:
+		return nil, fmt.Errorf("unknown store backend %q", backend)
+	}
+}
+
+// openKeySet returns the JWT signing keys for jwt token mode, or nil for opaque tokens
+func openKeySet(mode, keyFile string) (*jwt.KeySet, error) {
+	switch mode {
+	case "opaque":
+		return nil, nil
+	case "jwt":
+		if keyFile == "" {
+			log.Println("No JWT key file given, generating an ephemeral Ed25519 key")
+			return jwt.GenerateKeySet()
+		}
+		return jwt.LoadKeySet(keyFile)
+	default:
+		return nil, fmt.Errorf("unknown token mode %q", mode)
+	}
+}
+
+// parseTrustedProxies parses a comma-separated list of addresses and CIDR ranges
+func parseTrustedProxies(list string) ([]netip.Prefix, error) {
+	var proxies []netip.Prefix
+	for _, item := range strings.Split(list, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if !strings.Contains(item, "/") {
+			addr, err := netip.ParseAddr(item)
+			if err != nil {
+				return nil, err
+			}
+			proxies = append(proxies, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(item)
+		if err != nil {
+			return nil, err
+		}
+		proxies = append(proxies, prefix.Masked())
+	}
+	return proxies, nil
+}
@@ -0,0 +1,151 @@
+// Package activation activates new physical credit and debit cards. A card
+// is issued Inactive and declined until the cardholder activates it with the
+// last four digits and expiry printed on it, choosing its first PIN. Every
+// attempt is recorded on the card, and repeated failures lock activation for
+// a while.
+package activation
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"bankapp-microservices/internal/cardpin"
+	"bankapp-microservices/internal/cardstatus"
+	"bankapp-microservices/internal/models"
+	"bankapp-microservices/internal/store"
+)
+
+// Activation is locked for Lockout after MaxFailedAttempts failures in a row
+const (
+	MaxFailedAttempts = 3
+	Lockout           = 30 * time.Minute
+)
+
+var (
+	ErrAlreadyActive   = errors.New("card is already active")
+	ErrNotInactive     = errors.New("card is not awaiting activation")
+	ErrDetailsMismatch = errors.New("card details do not match")
+)
+
+// LockedError is returned while activation is locked after too many failures
+type LockedError struct {
+	Until time.Time
+}
+
+func (e *LockedError) Error() string {
+	return fmt.Sprintf("activation is locked until %s", e.Until.Format(time.RFC3339))
+}
+
+// activating serializes activations so failed attempts are counted exactly
+var activating sync.Mutex
+
+// ActivateCreditCard activates card and sets its PIN
+func ActivateCreditCard(s store.Store, card *models.CreditCard, req *models.ActivateCardRequest, now time.Time) (*models.CardActivation, error) {
+	return activate(s, &target{card.ID, card.UserID, card.CardNumber, card.ExpiryMonth, card.ExpiryYear, &card.Status, &card.Activation, &card.PIN, func() {
+		// Save onto the stored card, whose status may have been changed since
+		if stored, exists := s.GetCreditCardByID(card.ID); exists {
+			stored.Activation, stored.PIN = card.Activation, card.PIN
+			s.UpdateCreditCard(stored)
+		}
+	}}, req, now)
+}
+
+// ActivateDebitCard activates card and sets its PIN
+func ActivateDebitCard(s store.Store, card *models.DebitCard, req *models.ActivateCardRequest, now time.Time) (*models.CardActivation, error) {
+	return activate(s, &target{card.ID, card.UserID, card.CardNumber, card.ExpiryMonth, card.ExpiryYear, &card.Status, &card.Activation, &card.PIN, func() {
+		if stored, exists := s.GetDebitCardByID(card.ID); exists {
+			stored.Activation, stored.PIN = card.Activation, card.PIN
+			s.UpdateDebitCard(stored)
+		}
+	}}, req, now)
+}
+
+// target gives access to the activation fields of any type of physical card
+type target struct {
+	id, userID, cardNumber  string
+	expiryMonth, expiryYear int
+	status                  *string
+	activation              **models.CardActivation
+	pin                     **models.CardPIN
+	// save stores the activation and PIN fields
+	save func()
+}
+
+func activate(s store.Store, t *target, req *models.ActivateCardRequest, now time.Time) (*models.CardActivation, error) {
+	activating.Lock()
+	defer activating.Unlock()
+
+	switch cardstatus.Current(*t.status, t.expiryMonth, t.expiryYear, now) {
+	case models.CardStatusInactive:
+	case models.CardStatusActive, models.CardStatusTemporarilyBlocked:
+		return nil, ErrAlreadyActive
+	default:
+		return nil, ErrNotInactive
+	}
+
+	if *t.activation == nil {
+		*t.activation = &models.CardActivation{}
+	}
+	a := *t.activation
+	if now.Before(a.LockedUntil) {
+		return nil, &LockedError{Until: a.LockedUntil}
+	}
+	var dateOfBirth string
+	if user, exists := s.GetUserByID(t.userID); exists {
+		dateOfBirth = user.DateOfBirth
+	}
+	if err := cardpin.Check(&req.PINUpdateRequest, dateOfBirth); err != nil {
+		return nil, err
+	}
+
+	if !matches(t, req) {
+		a.Attempts = append(a.Attempts, models.ActivationAttempt{At: now, Failure: "Card details do not match"})
+		a.FailedAttempts++
+		if a.FailedAttempts >= MaxFailedAttempts {
+			a.FailedAttempts = 0
+			a.LockedUntil = now.Add(Lockout)
+			t.save()
+			return nil, &LockedError{Until: a.LockedUntil}
+		}
+		t.save()
+		return nil, ErrDetailsMismatch
+	}
+
+	pin, err := cardpin.New(req.NewPIN, now)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := cardstatus.Activate(s, t.id, now); err != nil {
+		return nil, err
+	}
+	*t.status = models.CardStatusActive
+	*t.pin = pin
+	a.ActivatedAt = &now
+	a.FailedAttempts = 0
+	a.Attempts = append(a.Attempts, models.ActivationAttempt{At: now, Succeeded: true})
+	t.save()
+
+	if d, exists := s.GetCardDispatch(t.id); exists {
+		updated := *d
+		updated.ActivatedAt = &now
+		updated.Status = models.DispatchActivated
+		s.SetCardDispatch(&updated)
+	}
+	return a, nil
+}
+
+// matches reports whether the details in req are the ones printed on the
+// card. The expiry year may be given as two digits, as it is printed.
+func matches(t *target, req *models.ActivateCardRequest) bool {
+	lastFour := t.cardNumber[len(t.cardNumber)-4:]
+	year := req.ExpiryYear
+	if year < 100 {
+		year += 2000
+	}
+	return subtle.ConstantTimeCompare([]byte(strings.TrimSpace(req.LastFour)), []byte(lastFour)) == 1 &&
+		req.ExpiryMonth == t.expiryMonth && year == t.expiryYear
+}
@@ -0,0 +1,103 @@
+package activation
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"bankapp-microservices/internal/cardpin"
+	"bankapp-microservices/internal/cardstatus"
+	"bankapp-microservices/internal/models"
+	"bankapp-microservices/internal/store"
+)
+
+// newCard issues an inactive credit card to testuser
+func newCard(s store.Store, now time.Time) *models.CreditCard {
+	card := &models.CreditCard{ID: models.GenerateID(), UserID: "testuser", CardNumber: "4111111111114821", ExpiryMonth: 8, ExpiryYear: now.Year() + 5, Status: models.CardStatusInactive}
+	s.UpdateCreditCard(card)
+	return card
+}
+
+func activationRequest(lastFour string, month, year int) *models.ActivateCardRequest {
+	return &models.ActivateCardRequest{
+		LastFour:         lastFour,
+		ExpiryMonth:      month,
+		ExpiryYear:       year,
+		PINUpdateRequest: models.PINUpdateRequest{NewPIN: "5832", ConfirmPIN: "5832", TermsAccepted: true},
+	}
+}
+
+func TestActivate(t *testing.T) {
+	s := store.NewMemoryStore()
+	now := time.Now()
+	card := newCard(s, now)
+
+	weak := activationRequest("4821", 8, card.ExpiryYear)
+	weak.NewPIN, weak.ConfirmPIN = "1111", "1111"
+	if _, err := ActivateCreditCard(s, card, weak, now); !errors.Is(err, cardpin.ErrWeak) {
+		t.Errorf("weak PIN = %v, want ErrWeak", err)
+	}
+	if _, err := ActivateCreditCard(s, card, activationRequest("4822", 8, card.ExpiryYear), now); !errors.Is(err, ErrDetailsMismatch) {
+		t.Errorf("wrong last four = %v, want ErrDetailsMismatch", err)
+	}
+
+	// The expiry year may be given as printed, with two digits
+	a, err := ActivateCreditCard(s, card, activationRequest("4821", 8, card.ExpiryYear%100), now)
+	if err != nil || a.ActivatedAt == nil || len(a.Attempts) != 2 || !a.Attempts[1].Succeeded {
+		t.Fatalf("activation = %+v, %v", a, err)
+	}
+	stored, _ := s.GetCreditCardByID(card.ID)
+	if stored.Status != models.CardStatusActive || stored.PIN == nil {
+		t.Fatalf("activated card = %s with PIN %v", stored.Status, stored.PIN)
+	}
+	if _, err := cardpin.Verify(s, card.ID, "5832", now); err != nil {
+		t.Errorf("chosen PIN does not verify: %v", err)
+	}
+	if changes := s.GetCardStatusChangesByCardID(card.ID); len(changes) != 1 || changes[0].To != models.CardStatusActive {
+		t.Errorf("status history = %+v", changes)
+	}
+
+	if _, err := ActivateCreditCard(s, stored, activationRequest("4821", 8, card.ExpiryYear), now); !errors.Is(err, ErrAlreadyActive) {
+		t.Errorf("activating twice = %v, want ErrAlreadyActive", err)
+	}
+}
+
+func TestActivationLocksAfterFailures(t *testing.T) {
+	s := store.NewMemoryStore()
+	now := time.Now()
+	card := newCard(s, now)
+	wrong := activationRequest("4821", 9, card.ExpiryYear)
+
+	for i := 1; i < MaxFailedAttempts; i++ {
+		if _, err := ActivateCreditCard(s, card, wrong, now); !errors.Is(err, ErrDetailsMismatch) {
+			t.Fatalf("attempt %d = %v, want ErrDetailsMismatch", i, err)
+		}
+	}
+	var locked *LockedError
+	if _, err := ActivateCreditCard(s, card, wrong, now); !errors.As(err, &locked) || !locked.Until.Equal(now.Add(Lockout)) {
+		t.Fatalf("last attempt = %v, want a lockout until %v", err, now.Add(Lockout))
+	}
+
+	// Even the right details are refused until the lockout ends
+	right := activationRequest("4821", 8, card.ExpiryYear)
+	stored, _ := s.GetCreditCardByID(card.ID)
+	if _, err := ActivateCreditCard(s, stored, right, now.Add(Lockout/2)); !errors.As(err, &locked) {
+		t.Errorf("right details while locked = %v, want LockedError", err)
+	}
+	if _, err := ActivateCreditCard(s, stored, right, now.Add(Lockout)); err != nil {
+		t.Errorf("right details after the lockout = %v", err)
+	}
+}
+
+func TestActivateRefusesClosedCards(t *testing.T) {
+	s := store.NewMemoryStore()
+	now := time.Now()
+	card := newCard(s, now)
+	if _, err := cardstatus.Change(s, card.ID, &models.StatusRequest{Status: models.CardStatusClosed, Reason: "Not wanted"}, now); err != nil {
+		t.Fatal(err)
+	}
+	closed, _ := s.GetCreditCardByID(card.ID)
+	if _, err := ActivateCreditCard(s, closed, activationRequest("4821", 8, card.ExpiryYear), now); !errors.Is(err, ErrNotInactive) {
+		t.Errorf("activating a closed card = %v, want ErrNotInactive", err)
+	}
+}
@@ -0,0 +1,185 @@
+// Package addon issues add-on credit cards to family members of the primary
+// cardholder. An add-on shares its primary card's credit line: its purchases
+// are billed on the primary's statements and earn the primary's rewards
+// points. Each add-on has its own holder, status, channel limits and an
+// optional monthly cap, and is delivered and activated like any new card.
+package addon
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"bankapp-microservices/internal/cardstatus"
+	"bankapp-microservices/internal/issuance"
+	"bankapp-microservices/internal/models"
+	"bankapp-microservices/internal/store"
+)
+
+const (
+	// MaxPerCard is how many add-ons a primary card can have open at once
+	MaxPerCard = 3
+	// MinimumAge is the youngest an add-on cardholder can be
+	MinimumAge = 18
+	// MaxNameLength is the most characters that fit on the card
+	MaxNameLength = 26
+)
+
+var (
+	ErrAddonOfAddon        = errors.New("add-on cards cannot have add-ons")
+	ErrPrimaryUnavailable  = errors.New("primary card cannot take add-ons in its current status")
+	ErrTooMany             = fmt.Errorf("a card can have at most %d add-ons", MaxPerCard)
+	ErrInvalidName         = fmt.Errorf("name on card must be 1 to %d letters", MaxNameLength)
+	ErrInvalidDateOfBirth  = errors.New("date of birth must be a past date in YYYY-MM-DD format")
+	ErrUnderage            = fmt.Errorf("add-on cardholders must be at least %d years old", MinimumAge)
+	ErrInvalidRelationship = errors.New("relationship must be SPOUSE, PARENT, CHILD or SIBLING")
+	ErrInvalidCap          = errors.New("monthly cap must be between 0 and the credit limit")
+)
+
+var relationships = map[string]bool{
+	models.RelationshipSpouse:  true,
+	models.RelationshipParent:  true,
+	models.RelationshipChild:   true,
+	models.RelationshipSibling: true,
+}
+
+// issuing serializes requests so a card never goes over MaxPerCard add-ons
+var issuing sync.Mutex
+
+// Issue requests an add-on of primary for the holder in req. The add-on is
+// issued Inactive and its dispatch starts now.
+func Issue(s store.Store, primary *models.CreditCard, req *models.AddonCardRequest, now time.Time) (*models.CreditCard, *models.CardDispatch, error) {
+	issuing.Lock()
+	defer issuing.Unlock()
+
+	if primary.PrimaryCardID != "" {
+		return nil, nil, ErrAddonOfAddon
+	}
+	switch cardstatus.Current(primary.Status, primary.ExpiryMonth, primary.ExpiryYear, now) {
+	case models.CardStatusActive, models.CardStatusInactive:
+	default:
+		return nil, nil, ErrPrimaryUnavailable
+	}
+	open := 0
+	for _, addon := range List(s, primary) {
+		if cardstatus.Current(addon.Status, addon.ExpiryMonth, addon.ExpiryYear, now) != models.CardStatusClosed {
+			open++
+		}
+	}
+	if open >= MaxPerCard {
+		return nil, nil, ErrTooMany
+	}
+
+	name := strings.Join(strings.Fields(req.NameOnCard), " ")
+	if !validName(name) {
+		return nil, nil, ErrInvalidName
+	}
+	born, err := time.Parse("2006-01-02", strings.TrimSpace(req.DateOfBirth))
+	if err != nil || !born.Before(now) {
+		return nil, nil, ErrInvalidDateOfBirth
+	}
+	if born.AddDate(MinimumAge, 0, 0).After(now) {
+		return nil, nil, ErrUnderage
+	}
+	relationship := strings.ToUpper(strings.TrimSpace(req.Relationship))
+	if !relationships[relationship] {
+		return nil, nil, ErrInvalidRelationship
+	}
+	if err := checkCap(primary, req.MonthlyCap); err != nil {
+		return nil, nil, err
+	}
+
+	card := &models.CreditCard{
+		ID:                 models.GenerateID(),
+		CardNumber:         issuance.CardNumber(primary.CardNumber),
+		CVV:                issuance.CVV(),
+		CardholderName:     name,
+		CardType:           primary.CardType,
+		AvailableCredit:    primary.AvailableCredit,
+		TotalCredit:        primary.TotalCredit,
+		OutstandingBalance: primary.OutstandingBalance,
+		EMIOutstanding:     primary.EMIOutstanding,
+		UserID:             primary.UserID,
+		LedgerAccountID:    primary.LedgerAccountID,
+		EMIAccountID:       primary.EMIAccountID,
+		StatementDay:       primary.StatementDay,
+		OpenedAt:           now,
+		Status:             models.CardStatusInactive,
+		PrimaryCardID:      primary.ID,
+		Addon: &models.AddonDetails{
+			CustomerID:   strings.TrimSpace(req.CustomerID),
+			DateOfBirth:  born.Format("2006-01-02"),
+			Relationship: relationship,
+			MonthlyCap:   req.MonthlyCap,
+			RequestedAt:  now,
+		},
+	}
+	card.ExpiryMonth, card.ExpiryYear = issuance.Expiry(now)
+	s.UpdateCreditCard(card)
+
+	dispatch := issuance.NewDispatch(card.ID, card.UserID, now)
+	s.SetCardDispatch(dispatch)
+	return card, dispatch, nil
+}
+
+func validName(name string) bool {
+	if name == "" || len(name) > MaxNameLength {
+		return false
+	}
+	for _, c := range name {
+		if !unicode.IsLetter(c) && !strings.ContainsRune(" .'-", c) {
+			return false
+		}
+	}
+	return true
+}
+
+// List returns the add-ons of primary, oldest first
+func List(s store.Store, primary *models.CreditCard) []*models.CreditCard {
+	var addons []*models.CreditCard
+	for _, card := range s.GetCreditCardsByUserID(primary.UserID) {
+		if card.PrimaryCardID == primary.ID {
+			addons = append(addons, card)
+		}
+	}
+	sort.Slice(addons, func(i, j int) bool {
+		return addons[i].OpenedAt.Before(addons[j].OpenedAt)
+	})
+	return addons
+}
+
+// SetCap changes the monthly cap of an add-on of primary. A cap of 0 removes it.
+func SetCap(s store.Store, primary, addon *models.CreditCard, monthlyCap float64) error {
+	if err := checkCap(primary, monthlyCap); err != nil {
+		return err
+	}
+	addon.Addon.MonthlyCap = monthlyCap
+	s.UpdateCreditCard(addon)
+	return nil
+}
+
+func checkCap(primary *models.CreditCard, monthlyCap float64) error {
+	if monthlyCap < 0 || monthlyCap > primary.TotalCredit {
+		return ErrInvalidCap
+	}
+	return nil
+}
+
+// Status returns the status card is used with as of now. An add-on cannot be
+// used while its primary card is blocked or closed, whatever its own status.
+func Status(s store.Store, card *models.CreditCard, now time.Time) string {
+	status := cardstatus.Current(card.Status, card.ExpiryMonth, card.ExpiryYear, now)
+	primary, exists := s.GetCreditCardByID(card.PrimaryCardID)
+	if !exists || status != models.CardStatusActive {
+		return status
+	}
+	switch primaryStatus := cardstatus.Current(primary.Status, primary.ExpiryMonth, primary.ExpiryYear, now); primaryStatus {
+	case models.CardStatusTemporarilyBlocked, models.CardStatusPermanentlyBlocked, models.CardStatusClosed:
+		return primaryStatus
+	}
+	return status
+}
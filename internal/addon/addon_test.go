@@ -0,0 +1,181 @@
+package addon
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"bankapp-microservices/internal/models"
+	"bankapp-microservices/internal/store"
+)
+
+var now = time.Date(2025, 6, 15, 10, 0, 0, 0, time.UTC)
+
+// primaryCard returns the seeded card ending 9012
+func primaryCard(t *testing.T, s store.Store) *models.CreditCard {
+	t.Helper()
+	for _, card := range s.GetCreditCardsByUserID("testuser") {
+		if card.CardNumber == "4532123456789012" {
+			return card
+		}
+	}
+	t.Fatal("seeded credit card not found")
+	return nil
+}
+
+func request() *models.AddonCardRequest {
+	return &models.AddonCardRequest{
+		NameOnCard:   "  Asha   Rao ",
+		DateOfBirth:  "1990-04-12",
+		Relationship: "spouse",
+		MonthlyCap:   20000,
+	}
+}
+
+func TestIssue(t *testing.T) {
+	s := store.NewMemoryStore()
+	primary := primaryCard(t, s)
+
+	card, dispatch, err := Issue(s, primary, request(), now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if card.Status != models.CardStatusInactive || card.PrimaryCardID != primary.ID || card.LedgerAccountID != primary.LedgerAccountID {
+		t.Errorf("add-on = %+v, want an Inactive card on the primary's credit line", card)
+	}
+	if !strings.HasPrefix(card.CardNumber, "453212") || card.CardNumber == primary.CardNumber {
+		t.Errorf("card number = %s, want a new number on the primary's BIN", card.CardNumber)
+	}
+	if card.CardholderName != "Asha Rao" || card.Addon.Relationship != models.RelationshipSpouse || card.Addon.MonthlyCap != 20000 {
+		t.Errorf("holder = %q %+v", card.CardholderName, card.Addon)
+	}
+	if saved, exists := s.GetCardDispatch(card.ID); !exists || saved.ID != dispatch.ID {
+		t.Error("dispatch was not saved")
+	}
+	if addons := List(s, primary); len(addons) != 1 || addons[0].ID != card.ID {
+		t.Errorf("List = %v, want the new add-on", addons)
+	}
+
+	if _, _, err := Issue(s, card, request(), now); !errors.Is(err, ErrAddonOfAddon) {
+		t.Errorf("add-on of an add-on: err = %v, want %v", err, ErrAddonOfAddon)
+	}
+}
+
+func TestIssueRejects(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(*models.AddonCardRequest)
+		want   error
+	}{
+		{"empty name", func(r *models.AddonCardRequest) { r.NameOnCard = "  " }, ErrInvalidName},
+		{"long name", func(r *models.AddonCardRequest) { r.NameOnCard = strings.Repeat("A", MaxNameLength+1) }, ErrInvalidName},
+		{"digits in name", func(r *models.AddonCardRequest) { r.NameOnCard = "Asha 2" }, ErrInvalidName},
+		{"bad date of birth", func(r *models.AddonCardRequest) { r.DateOfBirth = "12/04/1990" }, ErrInvalidDateOfBirth},
+		{"future date of birth", func(r *models.AddonCardRequest) { r.DateOfBirth = "2030-01-01" }, ErrInvalidDateOfBirth},
+		{"underage", func(r *models.AddonCardRequest) { r.DateOfBirth = "2007-06-16" }, ErrUnderage},
+		{"relationship", func(r *models.AddonCardRequest) { r.Relationship = "FRIEND" }, ErrInvalidRelationship},
+		{"negative cap", func(r *models.AddonCardRequest) { r.MonthlyCap = -1 }, ErrInvalidCap},
+		{"cap over the limit", func(r *models.AddonCardRequest) { r.MonthlyCap = 1000001 }, ErrInvalidCap},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := store.NewMemoryStore()
+			req := request()
+			tt.change(req)
+			if _, _, err := Issue(s, primaryCard(t, s), req, now); !errors.Is(err, tt.want) {
+				t.Errorf("err = %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	// Turning 18 today is old enough
+	s := store.NewMemoryStore()
+	req := request()
+	req.DateOfBirth = "2007-06-15"
+	if _, _, err := Issue(s, primaryCard(t, s), req, now); err != nil {
+		t.Errorf("18th birthday: err = %v", err)
+	}
+}
+
+func TestIssueLimits(t *testing.T) {
+	s := store.NewMemoryStore()
+	primary := primaryCard(t, s)
+
+	var first *models.CreditCard
+	for i := 0; i < MaxPerCard; i++ {
+		card, _, err := Issue(s, primary, request(), now.Add(time.Duration(i)*time.Minute))
+		if err != nil {
+			t.Fatalf("add-on %d: %v", i+1, err)
+		}
+		if first == nil {
+			first = card
+		}
+	}
+	if _, _, err := Issue(s, primary, request(), now); !errors.Is(err, ErrTooMany) {
+		t.Fatalf("add-on %d: err = %v, want %v", MaxPerCard+1, err, ErrTooMany)
+	}
+
+	// Closed add-ons do not count
+	first.Status = models.CardStatusClosed
+	s.UpdateCreditCard(first)
+	if _, _, err := Issue(s, primary, request(), now); err != nil {
+		t.Errorf("after closing one: err = %v", err)
+	}
+
+	primary.Status = models.CardStatusTemporarilyBlocked
+	s.UpdateCreditCard(primary)
+	for _, addon := range List(s, primary) {
+		addon.Status = models.CardStatusClosed
+		s.UpdateCreditCard(addon)
+	}
+	if _, _, err := Issue(s, primary, request(), now); !errors.Is(err, ErrPrimaryUnavailable) {
+		t.Errorf("blocked primary: err = %v, want %v", err, ErrPrimaryUnavailable)
+	}
+}
+
+func TestSetCap(t *testing.T) {
+	s := store.NewMemoryStore()
+	primary := primaryCard(t, s)
+	card, _, err := Issue(s, primary, request(), now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := SetCap(s, primary, card, primary.TotalCredit+1); !errors.Is(err, ErrInvalidCap) {
+		t.Errorf("cap over the limit: err = %v, want %v", err, ErrInvalidCap)
+	}
+	if err := SetCap(s, primary, card, 0); err != nil {
+		t.Fatal(err)
+	}
+	if saved, _ := s.GetCreditCardByID(card.ID); saved.Addon.MonthlyCap != 0 {
+		t.Errorf("cap = %v, want it removed", saved.Addon.MonthlyCap)
+	}
+}
+
+func TestStatusFollowsPrimary(t *testing.T) {
+	s := store.NewMemoryStore()
+	primary := primaryCard(t, s)
+	card, _, err := Issue(s, primary, request(), now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	card.Status = models.CardStatusActive
+	s.UpdateCreditCard(card)
+
+	if got := Status(s, card, now); got != models.CardStatusActive {
+		t.Errorf("Status = %s, want Active", got)
+	}
+	primary.Status = models.CardStatusTemporarilyBlocked
+	s.UpdateCreditCard(primary)
+	if got := Status(s, card, now); got != models.CardStatusTemporarilyBlocked {
+		t.Errorf("Status with a blocked primary = %s, want TemporarilyBlocked", got)
+	}
+
+	// The add-on's own status wins when it is not Active
+	card.Status = models.CardStatusPermanentlyBlocked
+	s.UpdateCreditCard(card)
+	if got := Status(s, card, now); got != models.CardStatusPermanentlyBlocked {
+		t.Errorf("Status of a hotlisted add-on = %s, want PermanentlyBlocked", got)
+	}
+}
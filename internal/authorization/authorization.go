@@ -0,0 +1,232 @@
+// Package authorization decides whether a card transaction may go through
+// based on card state, the user's card settings and the card's channel limits.
+package authorization
+
+import (
+	"fmt"
+	"time"
+
+	"bankapp-microservices/internal/ledger"
+	"bankapp-microservices/internal/models"
+	"bankapp-microservices/internal/usage"
+)
+
+// HomeCountry is the ISO 3166 country code of domestic transactions
+const HomeCountry = "IN"
+
+// Card kinds
+const (
+	KindCredit  = "credit"
+	KindDebit   = "debit"
+	KindVirtual = "virtual"
+)
+
+// Machine-readable decline reasons
+const (
+	ReasonCardInactive          = "CARD_INACTIVE"
+	ReasonCardBlocked           = "CARD_BLOCKED"
+	ReasonCardHotlisted         = "CARD_HOTLISTED"
+	ReasonCardClosed            = "CARD_CLOSED"
+	ReasonCardExpired           = "CARD_EXPIRED"
+	ReasonChannelNotSupported   = "CHANNEL_NOT_SUPPORTED"
+	ReasonChannelDisabled       = "CHANNEL_DISABLED"
+	ReasonInternationalDisabled = "INTERNATIONAL_DISABLED"
+	ReasonLimitDisabled         = "LIMIT_DISABLED"
+	ReasonLimitExceeded         = "LIMIT_EXCEEDED"
+	ReasonDailyLimitExceeded    = "DAILY_LIMIT_EXCEEDED"
+	ReasonMonthlyLimitExceeded  = "MONTHLY_LIMIT_EXCEEDED"
+	ReasonAddonCapExceeded      = "ADDON_CAP_EXCEEDED"
+	ReasonInsufficientFunds     = "INSUFFICIENT_FUNDS"
+	ReasonCurrencyNotSupported  = "CURRENCY_NOT_SUPPORTED"
+	ReasonPINBlocked            = "PIN_BLOCKED"
+)
+
+// Card is the card state the engine needs, independent of card type
+type Card struct {
+	Kind        string
+	Status      string
+	ExpiryMonth int
+	ExpiryYear  int
+	// Available is the available credit, account balance or remaining virtual card balance
+	Available float64
+	// MonthlyCap caps an add-on card's spend per calendar month; 0 means no cap
+	MonthlyCap float64
+	// PINBlocked is set when the card's PIN is blocked after wrong attempts
+	PINBlocked bool
+}
+
+// Decision is the outcome of an authorization
+type Decision struct {
+	Approved bool
+	Reason   string
+	Message  string
+}
+
+func approve() Decision {
+	return Decision{Approved: true, Message: "Transaction approved"}
+}
+
+func decline(reason, format string, args ...interface{}) Decision {
+	return Decision{Reason: reason, Message: fmt.Sprintf(format, args...)}
+}
+
+// limitTypes maps channels to the transaction limit that governs them
+var limitTypes = map[string]string{
+	models.ChannelATM:         models.LimitTypeATM,
+	models.ChannelOnline:      models.LimitTypeOnline,
+	models.ChannelPOS:         models.LimitTypePOS,
+	models.ChannelContactless: models.LimitTypeContactless,
+}
+
+// LimitType returns the limit type governing channel
+func LimitType(channel string) (string, bool) {
+	limitType, ok := limitTypes[channel]
+	return limitType, ok
+}
+
+// IsInternational reports whether the request happens outside the home country
+func IsInternational(req *models.AuthorizationRequest) bool {
+	return req.Country != HomeCountry
+}
+
+// Input is everything a decision is based on
+type Input struct {
+	Card Card
+	// Settings may be nil, in which case no channel is switched off
+	Settings *models.CardSettings
+	// Limits are the card's channel limits; Defaults supply limits for channels missing from them
+	Limits   *models.LimitsRequest
+	Defaults *models.LimitsRequest
+	// Usage holds the card's consumption in the current day and month
+	Usage   *models.CardUsage
+	Request *models.AuthorizationRequest
+	Now     time.Time
+}
+
+// Evaluate runs every check against the request and returns the first decline,
+// or an approval. Channel limits apply to the amount spent on that channel
+// today; the settings' default daily and monthly limits apply to the card's
+// total spend, if set.
+func Evaluate(in Input) Decision {
+	card, settings, req := in.Card, in.Settings, in.Request
+
+	switch card.Status {
+	case models.CardStatusActive, models.CardStatusExpired:
+		// Expiry is checked against the card's dates below
+	case models.CardStatusTemporarilyBlocked:
+		return decline(ReasonCardBlocked, "Card is temporarily blocked")
+	case models.CardStatusPermanentlyBlocked:
+		return decline(ReasonCardHotlisted, "Card is permanently blocked")
+	case models.CardStatusClosed:
+		return decline(ReasonCardClosed, "Card is closed")
+	case models.CardStatusInactive:
+		return decline(ReasonCardInactive, "Card has not been activated")
+	default:
+		return decline(ReasonCardInactive, "Card is not active")
+	}
+
+	if IsExpired(card.ExpiryMonth, card.ExpiryYear, in.Now) {
+		return decline(ReasonCardExpired, "Card expired in %02d/%d", card.ExpiryMonth, card.ExpiryYear)
+	}
+
+	// Virtual cards only exist online
+	if card.Kind == KindVirtual && req.Channel != models.ChannelOnline {
+		return decline(ReasonChannelNotSupported, "Virtual cards can only be used online")
+	}
+
+	// ATM and POS transactions are confirmed with the card's PIN
+	if card.PINBlocked && (req.Channel == models.ChannelATM || req.Channel == models.ChannelPOS) {
+		return decline(ReasonPINBlocked, "PIN is blocked after too many wrong attempts")
+	}
+
+	// Cards are settled in the ledger currency and there is no conversion
+	if req.Currency != ledger.Currency {
+		return decline(ReasonCurrencyNotSupported, "Transactions in %s are not supported, only %s", req.Currency, ledger.Currency)
+	}
+
+	if settings != nil {
+		if !channelEnabled(settings, req.Channel) {
+			return decline(ReasonChannelDisabled, "%s transactions are disabled in card settings", limitTypes[req.Channel])
+		}
+		if IsInternational(req) && !settings.InternationalUsageEnabled {
+			return decline(ReasonInternationalDisabled, "International usage is disabled in card settings")
+		}
+	}
+
+	limit := findLimit(in.Limits, in.Defaults, req)
+	if limit != nil {
+		if !limit.IsEnabled {
+			return decline(ReasonLimitDisabled, "%s limit is disabled", limit.Type)
+		}
+		used := in.Usage.Daily[usage.Key(limit.Type, IsInternational(req))]
+		if used+req.Amount > limit.CurrentLimit {
+			return decline(ReasonLimitExceeded, "Amount exceeds the remaining %s limit of %.2f for today",
+				limit.Type, usage.Remaining(limit.CurrentLimit, used))
+		}
+	}
+
+	if settings != nil {
+		if used := usage.DailyTotal(in.Usage); settings.DefaultDailyLimit > 0 && used+req.Amount > settings.DefaultDailyLimit {
+			return decline(ReasonDailyLimitExceeded, "Amount exceeds the remaining daily limit of %.2f",
+				usage.Remaining(settings.DefaultDailyLimit, used))
+		}
+		if used := usage.MonthlyTotal(in.Usage); settings.DefaultMonthlyLimit > 0 && used+req.Amount > settings.DefaultMonthlyLimit {
+			return decline(ReasonMonthlyLimitExceeded, "Amount exceeds the remaining monthly limit of %.2f",
+				usage.Remaining(settings.DefaultMonthlyLimit, used))
+		}
+	}
+
+	if used := usage.MonthlyTotal(in.Usage); card.MonthlyCap > 0 && used+req.Amount > card.MonthlyCap {
+		return decline(ReasonAddonCapExceeded, "Amount exceeds the add-on card's remaining monthly cap of %.2f",
+			usage.Remaining(card.MonthlyCap, used))
+	}
+
+	if req.Amount > card.Available {
+		return decline(ReasonInsufficientFunds, "Insufficient funds")
+	}
+
+	return approve()
+}
+
+// IsExpired reports whether a card is past the last day of its expiry month
+func IsExpired(month, year int, now time.Time) bool {
+	if month < 1 || month > 12 {
+		return false
+	}
+	firstInvalid := time.Date(year, time.Month(month)+1, 1, 0, 0, 0, 0, now.Location())
+	return !now.Before(firstInvalid)
+}
+
+func channelEnabled(settings *models.CardSettings, channel string) bool {
+	switch channel {
+	case models.ChannelOnline:
+		return settings.OnlineTransactionsEnabled
+	case models.ChannelATM:
+		return settings.ATMWithdrawalsEnabled
+	case models.ChannelContactless:
+		return settings.ContactlessPaymentsEnabled
+	default:
+		return true
+	}
+}
+
+// findLimit returns the domestic or international limit for the request's
+// channel, falling back to defaults when the card has no such limit configured
+func findLimit(limits, defaults *models.LimitsRequest, req *models.AuthorizationRequest) *models.TransactionLimit {
+	limitType := limitTypes[req.Channel]
+	for _, set := range []*models.LimitsRequest{limits, defaults} {
+		if set == nil {
+			continue
+		}
+		list := set.DomesticLimits
+		if IsInternational(req) {
+			list = set.InternationalLimits
+		}
+		for i := range list {
+			if list[i].Type == limitType {
+				return &list[i]
+			}
+		}
+	}
+	return nil
+}
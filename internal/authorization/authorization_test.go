@@ -0,0 +1,72 @@
+package authorization
+
+import (
+	"testing"
+	"time"
+
+	"bankapp-microservices/internal/models"
+	"bankapp-microservices/internal/usage"
+)
+
+func TestEvaluate(t *testing.T) {
+	now := time.Date(2026, 3, 15, 12, 0, 0, 0, time.UTC)
+	active := Card{Kind: KindDebit, Status: models.CardStatusActive, ExpiryMonth: 12, ExpiryYear: 2028, Available: 5000}
+	pinBlocked := active
+	pinBlocked.PINBlocked = true
+	settings := &models.CardSettings{OnlineTransactionsEnabled: true, ATMWithdrawalsEnabled: false, ContactlessPaymentsEnabled: true}
+	limits := &models.LimitsRequest{DomesticLimits: []models.TransactionLimit{
+		{Type: models.LimitTypeOnline, CurrentLimit: 2000, IsEnabled: true},
+		{Type: models.LimitTypePOS, CurrentLimit: 2000, IsEnabled: false},
+	}}
+	request := func(channel string, amount float64) *models.AuthorizationRequest {
+		return &models.AuthorizationRequest{Channel: channel, Amount: amount, Currency: "INR", Country: HomeCountry}
+	}
+
+	tests := []struct {
+		name   string
+		card   Card
+		req    *models.AuthorizationRequest
+		usage  map[string]float64
+		reason string
+	}{
+		{"approved", active, request(models.ChannelOnline, 1500), nil, ""},
+		{"blocked", Card{Kind: KindDebit, Status: models.CardStatusTemporarilyBlocked, ExpiryMonth: 12, ExpiryYear: 2028}, request(models.ChannelOnline, 10), nil, ReasonCardBlocked},
+		{"expired", Card{Kind: KindDebit, Status: models.CardStatusActive, ExpiryMonth: 2, ExpiryYear: 2026, Available: 5000}, request(models.ChannelOnline, 10), nil, ReasonCardExpired},
+		{"virtual at POS", Card{Kind: KindVirtual, Status: models.CardStatusActive, ExpiryMonth: 12, ExpiryYear: 2028, Available: 5000}, request(models.ChannelPOS, 10), nil, ReasonChannelNotSupported},
+		{"PIN blocked at an ATM", pinBlocked, request(models.ChannelATM, 10), nil, ReasonPINBlocked},
+		{"PIN blocked at POS", pinBlocked, request(models.ChannelPOS, 10), nil, ReasonPINBlocked},
+		{"PIN blocked online", pinBlocked, request(models.ChannelOnline, 10), nil, ""},
+		{"foreign currency", active, &models.AuthorizationRequest{Channel: models.ChannelOnline, Amount: 10, Currency: "USD", Country: HomeCountry}, nil, ReasonCurrencyNotSupported},
+		{"channel switched off", active, request(models.ChannelATM, 10), nil, ReasonChannelDisabled},
+		{"international switched off", active, &models.AuthorizationRequest{Channel: models.ChannelOnline, Amount: 10, Currency: "INR", Country: "US"}, nil, ReasonInternationalDisabled},
+		{"limit disabled", active, request(models.ChannelPOS, 10), nil, ReasonLimitDisabled},
+		{"over the limit", active, request(models.ChannelOnline, 2100), nil, ReasonLimitExceeded},
+		{"limit used up today", active, request(models.ChannelOnline, 600), map[string]float64{usage.Key(models.LimitTypeOnline, false): 1500}, ReasonLimitExceeded},
+		{"add-on cap", Card{Kind: KindCredit, Status: models.CardStatusActive, ExpiryMonth: 12, ExpiryYear: 2028, Available: 5000, MonthlyCap: 1000}, request(models.ChannelOnline, 1200), nil, ReasonAddonCapExceeded},
+		{"insufficient funds", Card{Kind: KindDebit, Status: models.CardStatusActive, ExpiryMonth: 12, ExpiryYear: 2028, Available: 100}, request(models.ChannelOnline, 150), nil, ReasonInsufficientFunds},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decision := Evaluate(Input{
+				Card:     tt.card,
+				Settings: settings,
+				Limits:   limits,
+				Usage:    &models.CardUsage{Daily: tt.usage, Monthly: tt.usage},
+				Request:  tt.req,
+				Now:      now,
+			})
+			if decision.Reason != tt.reason || decision.Approved != (tt.reason == "") {
+				t.Errorf("Evaluate = %+v, want reason %q", decision, tt.reason)
+			}
+		})
+	}
+}
+
+func TestIsExpired(t *testing.T) {
+	if IsExpired(3, 2026, time.Date(2026, 3, 31, 23, 59, 0, 0, time.UTC)) {
+		t.Error("card is expired before the end of its expiry month")
+	}
+	if !IsExpired(3, 2026, time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Error("card is still valid after its expiry month")
+	}
+}
@@ -0,0 +1,249 @@
+// Package autopay pays credit card statements from the linked bank account.
+// From the start of a statement's due date, or the autopay's execution day
+// if that comes first, the configured amount is moved from the linked
+// deposit account to the card's credit line. A payment that
+// fails, for example for insufficient funds, is retried a few times before
+// it is given up on; every attempt is recorded.
+package autopay
+
+import (
+	"errors"
+	"log"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"bankapp-microservices/internal/ledger"
+	"bankapp-microservices/internal/models"
+	"bankapp-microservices/internal/pricing"
+	"bankapp-microservices/internal/statement"
+	"bankapp-microservices/internal/store"
+)
+
+// legacyOptions maps the display names earlier clients sent to amount options
+var legacyOptions = map[string]string{
+	"minimum due":  models.AutopayMinimumDue,
+	"total due":    models.AutopayTotalDue,
+	"fixed amount": models.AutopayFixed,
+	"percentage":   models.AutopayPercent,
+}
+
+const (
+	// MaxAttempts is how often a statement's payment is tried
+	MaxAttempts = 3
+	// RetryInterval is the wait between attempts
+	RetryInterval = 4 * time.Hour
+)
+
+// Failure reasons
+const (
+	ReasonInsufficientFunds     = "INSUFFICIENT_FUNDS"
+	ReasonLinkedAccountNotFound = "LINKED_ACCOUNT_NOT_FOUND"
+	ReasonInvalidAmountOption   = "INVALID_AMOUNT_OPTION"
+	ReasonPostingFailed         = "POSTING_FAILED"
+)
+
+// running serializes runs so a statement is never paid twice
+var running sync.Mutex
+
+// Run executes every autopay that is due and returns the number of attempts
+// made. Execution days are calendar days in loc.
+func Run(s store.Store, now time.Time, loc *time.Location) int {
+	running.Lock()
+	defer running.Unlock()
+
+	attempts := 0
+	for _, autopay := range s.GetAllAutopays() {
+		if !autopay.AutoPayEnabled {
+			continue
+		}
+		card, exists := s.GetCreditCardByID(autopay.CardID)
+		if !exists {
+			continue
+		}
+		stmt, exists := statement.Latest(s, card)
+		if !exists || now.Before(ExecutionDate(autopay, stmt, loc)) || stmt.TotalDue <= 0 {
+			continue
+		}
+		if execution := execute(s, autopay, card, stmt, now); execution != nil {
+			s.AddAutopayExecution(execution)
+			attempts++
+		}
+	}
+	return attempts
+}
+
+// execute makes the next attempt to pay stmt, or returns nil if none is due
+func execute(s store.Store, autopay *models.Autopay, card *models.CreditCard, stmt *models.Statement, now time.Time) *models.AutopayExecution {
+	// Only the latest attempt for the statement matters: it either settled it
+	// or says when to try again
+	var last *models.AutopayExecution
+	for _, previous := range s.GetAutopayExecutionsByCardID(card.ID) {
+		if previous.StatementID == stmt.ID {
+			last = previous
+		}
+	}
+	attempt := 1
+	if last != nil {
+		if last.Status != models.AutopayStatusFailed || last.NextRetryAt == nil || now.Before(*last.NextRetryAt) {
+			return nil
+		}
+		attempt = last.Attempt + 1
+	}
+
+	execution := &models.AutopayExecution{
+		ID:              models.GenerateID(),
+		CardID:          card.ID,
+		UserID:          card.UserID,
+		StatementID:     stmt.ID,
+		Attempt:         attempt,
+		ExecutedAt:      now,
+		AmountOption:    autopay.AmountOption,
+		LinkedAccountID: autopay.LinkedAccountID,
+	}
+
+	// Payments the customer already made since the statement count towards it
+	paid := pricing.Credits(card.LedgerAccountID, s.GetJournalEntriesByAccountID(card.LedgerAccountID), stmt.PeriodEnd, now.Add(time.Nanosecond))
+	amount, ok := Amount(autopay, stmt, paid)
+	if !ok {
+		return fail(execution, ReasonInvalidAmountOption, now)
+	}
+	execution.Amount = ledger.ToMajor(amount)
+	if amount <= 0 {
+		execution.Status = models.AutopayStatusSkipped
+		return execution
+	}
+
+	account, found := LinkedAccount(s, card.UserID, autopay.LinkedAccountID)
+	if !found {
+		return fail(execution, ReasonLinkedAccountNotFound, now)
+	}
+	if s.GetAccountBalance(account.LedgerAccountID) < amount {
+		return fail(execution, ReasonInsufficientFunds, now)
+	}
+
+	entry := ledger.Transfer(account.LedgerAccountID, card.LedgerAccountID, amount, "Autopay payment", "autopay:"+stmt.ID, now)
+	if err := s.PostJournalEntry(entry); err != nil {
+		if errors.Is(err, ledger.ErrInsufficientFunds) {
+			return fail(execution, ReasonInsufficientFunds, now)
+		}
+		log.Printf("autopay: failed to post payment for card %s: %v", card.ID, err)
+		return fail(execution, ReasonPostingFailed, now)
+	}
+	execution.Status = models.AutopayStatusSuccess
+	execution.JournalEntryID = entry.ID
+	return execution
+}
+
+// fail marks an execution failed, scheduling a retry if attempts remain
+func fail(execution *models.AutopayExecution, reason string, now time.Time) *models.AutopayExecution {
+	execution.Status = models.AutopayStatusFailed
+	execution.FailureReason = reason
+	if execution.Attempt < MaxAttempts {
+		retryAt := now.Add(RetryInterval)
+		execution.NextRetryAt = &retryAt
+	}
+	return execution
+}
+
+// ExecutionDate is when autopay first tries to pay stmt: the first execution
+// day after the statement date, or the due date if that is sooner
+func ExecutionDate(autopay *models.Autopay, stmt *models.Statement, loc *time.Location) time.Time {
+	if autopay.ExecutionDay < 1 {
+		return stmt.DueDate
+	}
+	issued := stmt.PeriodEnd.In(loc)
+	date := time.Date(issued.Year(), issued.Month(), autopay.ExecutionDay, 0, 0, 0, 0, loc)
+	if date.Before(issued) {
+		date = date.AddDate(0, 1, 0)
+	}
+	if date.After(stmt.DueDate) {
+		return stmt.DueDate
+	}
+	return date
+}
+
+// Amount returns how much autopay should pay towards stmt in minor units,
+// given what was already paid since it was issued. It reports false for an
+// unknown amount option.
+func Amount(autopay *models.Autopay, stmt *models.Statement, paid int64) (int64, bool) {
+	option, ok := ParseOption(autopay.AmountOption)
+	if !ok {
+		return 0, false
+	}
+	remaining := max(ledger.ToMinor(stmt.TotalDue)-paid, 0)
+	switch option {
+	case models.AutopayMinimumDue:
+		return max(ledger.ToMinor(stmt.MinimumDue)-paid, 0), true
+	case models.AutopayTotalDue:
+		return remaining, true
+	case models.AutopayFixed:
+		return min(ledger.ToMinor(autopay.Amount), remaining), autopay.Amount > 0
+	default:
+		target := int64(math.Round(float64(ledger.ToMinor(stmt.TotalDue)) * autopay.Percent / 100))
+		return min(max(target-paid, 0), remaining), autopay.Percent > 0
+	}
+}
+
+// ParseOption returns the amount option named by s, accepting the display
+// names ("Total Due") older clients send as well as the option constants
+func ParseOption(s string) (string, bool) {
+	switch option := strings.ToUpper(strings.TrimSpace(s)); option {
+	case models.AutopayMinimumDue, models.AutopayTotalDue, models.AutopayFixed, models.AutopayPercent:
+		return option, true
+	}
+	option, ok := legacyOptions[strings.ToLower(strings.TrimSpace(s))]
+	return option, ok
+}
+
+// Validate checks a complete autopay configuration, returning a message
+// describing the first problem found
+func Validate(s store.Store, autopay *models.Autopay) string {
+	option, ok := ParseOption(autopay.AmountOption)
+	if !ok {
+		return "Invalid amountOption. Must be MINIMUM_DUE, TOTAL_DUE, FIXED or PERCENT"
+	}
+	if option == models.AutopayFixed && autopay.Amount <= 0 {
+		return "amount must be greater than zero for FIXED autopay"
+	}
+	if option == models.AutopayPercent && (autopay.Percent <= 0 || autopay.Percent > 100) {
+		return "percent must be between 0 and 100 for PERCENT autopay"
+	}
+	if autopay.ExecutionDay != 0 && (autopay.ExecutionDay < 1 || autopay.ExecutionDay > 28) {
+		return "executionDay must be between 1 and 28"
+	}
+	if _, found := LinkedAccount(s, autopay.UserID, autopay.LinkedAccountID); !found {
+		return "linkedAccountId must be one of your debit card accounts"
+	}
+	return ""
+}
+
+// LinkedAccount finds the user's debit card whose bank account autopay draws
+// from. The linked account may be given as the account number or the debit
+// card ID.
+func LinkedAccount(s store.Store, userID, linkedAccountID string) (*models.DebitCard, bool) {
+	for _, card := range s.GetDebitCardsByUserID(userID) {
+		if card.AccountNumber == linkedAccountID || card.ID == linkedAccountID {
+			return card, true
+		}
+	}
+	return nil, false
+}
+
+// Schedule runs due autopays now and then every interval until stop is closed
+func Schedule(s store.Store, interval time.Duration, loc *time.Location, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if attempts := Run(s, time.Now(), loc); attempts > 0 {
+			log.Printf("autopay: made %d payment attempts", attempts)
+		}
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package autopay
+
+import (
+	"testing"
+	"time"
+
+	"bankapp-microservices/internal/ledger"
+	"bankapp-microservices/internal/models"
+	"bankapp-microservices/internal/store"
+)
+
+func TestAmount(t *testing.T) {
+	stmt := &models.Statement{TotalDue: 10000, MinimumDue: 500}
+	tests := []struct {
+		autopay models.Autopay
+		paid    int64
+		want    int64
+		ok      bool
+	}{
+		{models.Autopay{AmountOption: models.AutopayTotalDue}, 0, 1000000, true},
+		{models.Autopay{AmountOption: "Total Due"}, 250000, 750000, true},
+		{models.Autopay{AmountOption: models.AutopayMinimumDue}, 20000, 30000, true},
+		{models.Autopay{AmountOption: models.AutopayMinimumDue}, 60000, 0, true},
+		{models.Autopay{AmountOption: models.AutopayFixed, Amount: 2000}, 0, 200000, true},
+		{models.Autopay{AmountOption: models.AutopayFixed, Amount: 20000}, 0, 1000000, true},
+		{models.Autopay{AmountOption: models.AutopayPercent, Percent: 25}, 100000, 150000, true},
+		{models.Autopay{AmountOption: "WHATEVER"}, 0, 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := Amount(&tt.autopay, stmt, tt.paid)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("Amount(%+v, paid %d) = %d, %v; want %d, %v", tt.autopay, tt.paid, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestExecutionDate(t *testing.T) {
+	stmt := &models.Statement{PeriodEnd: time.Date(2026, 1, 5, 0, 0, 0, 0, time.UTC), DueDate: time.Date(2026, 1, 25, 0, 0, 0, 0, time.UTC)}
+	tests := []struct {
+		day  int
+		want time.Time
+	}{
+		{0, stmt.DueDate},
+		{10, time.Date(2026, 1, 10, 0, 0, 0, 0, time.UTC)},
+		// The 3rd comes after the statement date only next month, past the due date
+		{3, stmt.DueDate},
+	}
+	for _, tt := range tests {
+		if got := ExecutionDate(&models.Autopay{ExecutionDay: tt.day}, stmt, time.UTC); !got.Equal(tt.want) {
+			t.Errorf("ExecutionDate(day %d) = %v, want %v", tt.day, got, tt.want)
+		}
+	}
+}
+
+func TestRunRetriesInsufficientFunds(t *testing.T) {
+	s := store.NewMemoryStore()
+	debit := s.GetDebitCardsByUserID("testuser")[0]
+	available := s.GetAccountBalance(debit.LedgerAccountID)
+
+	card := &models.CreditCard{ID: models.GenerateID(), UserID: "testuser", TotalCredit: ledger.ToMajor(available) * 2, Status: models.CardStatusActive}
+	card.LedgerAccountID = ledger.CreditCardAccountID(card.ID)
+	s.CreateLedgerAccount(&models.LedgerAccount{ID: card.LedgerAccountID, Type: ledger.TypeCreditLine, Currency: ledger.Currency, UserID: card.UserID})
+	s.UpdateCreditCard(card)
+
+	due := available + 100
+	statementDate := time.Now().Add(-48 * time.Hour)
+	if err := s.PostJournalEntry(ledger.Transfer(card.LedgerAccountID, ledger.AccountMerchantSettlement, due, "Purchase", "", statementDate.Add(-time.Hour))); err != nil {
+		t.Fatal(err)
+	}
+	stmt := &models.Statement{ID: "stmt", CardID: card.ID, UserID: card.UserID, PeriodEnd: statementDate, DueDate: statementDate.Add(24 * time.Hour), TotalDue: ledger.ToMajor(due), MinimumDue: 200}
+	s.AddStatement(stmt)
+	s.SetAutopay(&models.Autopay{CardID: card.ID, UserID: card.UserID, AmountOption: models.AutopayTotalDue, LinkedAccountID: debit.AccountNumber, AutoPayEnabled: true})
+
+	now := time.Now()
+	if attempts := Run(s, now, time.UTC); attempts != 1 {
+		t.Fatalf("Run made %d attempts, want 1", attempts)
+	}
+	executions := s.GetAutopayExecutionsByCardID(card.ID)
+	first := executions[len(executions)-1]
+	if first.Status != models.AutopayStatusFailed || first.FailureReason != ReasonInsufficientFunds || first.NextRetryAt == nil {
+		t.Fatalf("first attempt = %+v, want a failure with a retry", first)
+	}
+	if attempts := Run(s, now, time.UTC); attempts != 0 {
+		t.Errorf("Run retried %d times before the retry time", attempts)
+	}
+
+	if err := s.PostJournalEntry(ledger.Transfer(ledger.AccountFunding, debit.LedgerAccountID, 100, "Deposit", "", now)); err != nil {
+		t.Fatal(err)
+	}
+	if attempts := Run(s, *first.NextRetryAt, time.UTC); attempts != 1 {
+		t.Fatalf("retry made %d attempts, want 1", attempts)
+	}
+	executions = s.GetAutopayExecutionsByCardID(card.ID)
+	if retry := executions[len(executions)-1]; retry.Status != models.AutopayStatusSuccess || retry.Attempt != 2 {
+		t.Errorf("retry = %+v, want the second attempt to succeed", retry)
+	}
+	if balance := s.GetAccountBalance(debit.LedgerAccountID); balance != 0 {
+		t.Errorf("linked account balance = %d, want 0", balance)
+	}
+	if attempts := Run(s, first.NextRetryAt.Add(RetryInterval), time.UTC); attempts != 0 {
+		t.Errorf("a paid statement was attempted %d more times", attempts)
+	}
+}
@@ -0,0 +1,190 @@
+// Package cardpin sets and verifies the PINs of physical cards. PINs are
+// stored as salted hashes and PINs that are easy to guess are refused. A PIN
+// is blocked after MaxFailedAttempts wrong attempts in a row until the
+// cardholder re-authenticates and sets a new one.
+package cardpin
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"bankapp-microservices/internal/models"
+	"bankapp-microservices/internal/password"
+	"bankapp-microservices/internal/store"
+)
+
+const (
+	// Length is the number of digits in a card PIN
+	Length            = 4
+	MaxFailedAttempts = 3
+)
+
+var (
+	ErrMismatch         = errors.New("PINs do not match")
+	ErrFormat           = errors.New("PIN must be 4 digits")
+	ErrWeak             = errors.New("PIN is too easy to guess")
+	ErrTermsNotAccepted = errors.New("terms must be accepted")
+	ErrUnchanged        = errors.New("new PIN must be different from the current PIN")
+	ErrNotSet           = errors.New("no PIN has been set for this card")
+	ErrIncorrect        = errors.New("incorrect PIN")
+	ErrBlocked          = errors.New("PIN is blocked")
+	ErrOldPINRequired   = errors.New("the current PIN is required to change it")
+	ErrStepUpRequired   = errors.New("a blocked PIN can only be reset after re-authenticating")
+	ErrNoCard           = errors.New("no credit or debit card with this ID")
+)
+
+// Check returns why req does not set an acceptable PIN for a cardholder born
+// on dateOfBirth (YYYY-MM-DD, or empty if not known), or nil if it does
+func Check(req *models.PINUpdateRequest, dateOfBirth string) error {
+	if req.NewPIN != req.ConfirmPIN {
+		return ErrMismatch
+	}
+	if len(req.NewPIN) != Length {
+		return ErrFormat
+	}
+	for _, c := range req.NewPIN {
+		if c < '0' || c > '9' {
+			return ErrFormat
+		}
+	}
+	if err := Weak(req.NewPIN, dateOfBirth); err != nil {
+		return err
+	}
+	if !req.TermsAccepted {
+		return ErrTermsNotAccepted
+	}
+	return nil
+}
+
+// Weak returns why the all-digit pin is easy to guess for someone born on
+// dateOfBirth (YYYY-MM-DD, or empty if not known), or nil. It is also used
+// for login PINs, which may be longer than card PINs.
+func Weak(pin, dateOfBirth string) error {
+	if strings.Count(pin, pin[:1]) == len(pin) {
+		return fmt.Errorf("%w: all its digits are the same", ErrWeak)
+	}
+	for size := 2; size <= len(pin)/2; size++ {
+		if len(pin)%size == 0 && strings.Repeat(pin[:size], len(pin)/size) == pin {
+			return fmt.Errorf("%w: it repeats a group of digits", ErrWeak)
+		}
+	}
+
+	// Ascending or descending runs, wrapping from 9 to 0 as on a keypad
+	ascending, descending := true, true
+	for i := 1; i < len(pin); i++ {
+		step := (int(pin[i]) - int(pin[i-1]) + 10) % 10
+		ascending = ascending && step == 1
+		descending = descending && step == 9
+	}
+	if ascending || descending {
+		return fmt.Errorf("%w: its digits are in sequence", ErrWeak)
+	}
+
+	if born, err := time.Parse("2006-01-02", dateOfBirth); err == nil {
+		for _, layout := range []string{"2006", "0201", "0102", "020106", "010206", "060102"} {
+			if pin == born.Format(layout) {
+				return fmt.Errorf("%w: it is your birth year or birthday", ErrWeak)
+			}
+		}
+	}
+	return nil
+}
+
+// New returns a PIN set to plain as of now
+func New(plain string, now time.Time) (*models.CardPIN, error) {
+	hash, err := password.Hash(plain)
+	if err != nil {
+		return nil, err
+	}
+	return &models.CardPIN{Hash: hash, ChangedAt: now}, nil
+}
+
+// Set replaces the PIN of the credit or debit card cardID with the one
+// requested and returns the card's PIN as it was left. A PIN in use can only
+// be changed with the old PIN, and a wrong one counts as a failed attempt. A
+// blocked PIN can only be replaced once the cardholder has re-authenticated
+// with their password or an OTP, which steppedUp reports.
+func Set(s store.Store, cardID string, req *models.PINUpdateRequest, dateOfBirth string, steppedUp bool, now time.Time) (*models.CardPIN, error) {
+	if err := Check(req, dateOfBirth); err != nil {
+		return nil, err
+	}
+	updated, err := New(req.NewPIN, now)
+	if err != nil {
+		return nil, err
+	}
+
+	var result *models.CardPIN
+	found := s.UpdateCardPIN(cardID, func(pin **models.CardPIN) {
+		defer func() { result = *pin }()
+		current := *pin
+		switch {
+		case current == nil || current.Hash == "":
+			// The first PIN
+		case current.BlockedAt != nil:
+			if !steppedUp {
+				err = ErrStepUpRequired
+				return
+			}
+		case req.OldPIN == "":
+			err = ErrOldPINRequired
+			return
+		default:
+			if err = verify(current, req.OldPIN, now); err != nil {
+				return
+			}
+		}
+		if current != nil && current.BlockedAt == nil && password.Verify(current.Hash, req.NewPIN) {
+			err = ErrUnchanged
+			return
+		}
+		*pin = updated
+	})
+	if !found {
+		return nil, ErrNoCard
+	}
+	return result, err
+}
+
+// Verify checks plain against the PIN of the credit or debit card cardID,
+// counting wrong attempts, and returns the PIN as it was left
+func Verify(s store.Store, cardID, plain string, now time.Time) (*models.CardPIN, error) {
+	var result *models.CardPIN
+	var err error
+	found := s.UpdateCardPIN(cardID, func(pin **models.CardPIN) {
+		err = verify(*pin, plain, now)
+		result = *pin
+	})
+	if !found {
+		return nil, ErrNoCard
+	}
+	return result, err
+}
+
+// AttemptsRemaining returns how many wrong attempts pin has left before it is blocked
+func AttemptsRemaining(pin *models.CardPIN) int {
+	if pin == nil || pin.BlockedAt != nil {
+		return 0
+	}
+	return MaxFailedAttempts - pin.FailedAttempts
+}
+
+func verify(pin *models.CardPIN, plain string, now time.Time) error {
+	if pin == nil || pin.Hash == "" {
+		return ErrNotSet
+	}
+	if pin.BlockedAt != nil {
+		return ErrBlocked
+	}
+	if password.Verify(pin.Hash, plain) {
+		pin.FailedAttempts = 0
+		return nil
+	}
+	pin.FailedAttempts++
+	if pin.FailedAttempts >= MaxFailedAttempts {
+		pin.BlockedAt = &now
+		return ErrBlocked
+	}
+	return ErrIncorrect
+}
@@ -0,0 +1,217 @@
+package cardpin
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"bankapp-microservices/internal/models"
+	"bankapp-microservices/internal/store"
+)
+
+func request(pin string) *models.PINUpdateRequest {
+	return &models.PINUpdateRequest{NewPIN: pin, ConfirmPIN: pin, TermsAccepted: true}
+}
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		req  *models.PINUpdateRequest
+		want error
+	}{
+		{request("4821"), nil},
+		{&models.PINUpdateRequest{NewPIN: "4821", ConfirmPIN: "4822", TermsAccepted: true}, ErrMismatch},
+		{request("482"), ErrFormat},
+		{request("48a1"), ErrFormat},
+		{request("7777"), ErrWeak},
+		{request("1212"), ErrWeak},
+		{request("7890"), ErrWeak},
+		{request("3210"), ErrWeak},
+		{request("1985"), ErrWeak},
+		{request("1407"), ErrWeak},
+		{request("0714"), ErrWeak},
+		{&models.PINUpdateRequest{NewPIN: "4821", ConfirmPIN: "4821"}, ErrTermsNotAccepted},
+	}
+	for _, tt := range tests {
+		if err := Check(tt.req, "1985-07-14"); !errors.Is(err, tt.want) {
+			t.Errorf("Check(%s) = %v, want %v", tt.req.NewPIN, err, tt.want)
+		}
+	}
+	if err := Check(request("1985"), ""); err != nil {
+		t.Errorf("Check without a date of birth = %v", err)
+	}
+}
+
+// withPIN returns a store whose seeded debit card has the PIN plain, or no
+// PIN if plain is empty, and the card's ID
+func withPIN(t *testing.T, plain string) (*store.MemoryStore, string) {
+	t.Helper()
+	s := store.NewMemoryStore()
+	card := s.GetDebitCardsByUserID("testuser")[0]
+	card.PIN = nil
+	if plain != "" {
+		pin, err := New(plain, time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+		card.PIN = pin
+	}
+	s.UpdateDebitCard(card)
+	return s, card.ID
+}
+
+func storedPIN(s store.Store, cardID string) *models.CardPIN {
+	card, _ := s.GetDebitCardByID(cardID)
+	return card.PIN
+}
+
+func TestVerifyBlocksAfterFailedAttempts(t *testing.T) {
+	now := time.Now()
+	s, cardID := withPIN(t, "4821")
+
+	if pin, err := Verify(s, cardID, "1111", now); !errors.Is(err, ErrIncorrect) || AttemptsRemaining(pin) != MaxFailedAttempts-1 {
+		t.Fatalf("wrong PIN = %v with %d attempts left", err, AttemptsRemaining(pin))
+	}
+	if got := storedPIN(s, cardID).FailedAttempts; got != 1 {
+		t.Errorf("stored failed attempts = %d, want 1", got)
+	}
+	// A right PIN resets the count
+	if pin, err := Verify(s, cardID, "4821", now); err != nil || AttemptsRemaining(pin) != MaxFailedAttempts {
+		t.Fatalf("right PIN = %v with %d attempts left", err, AttemptsRemaining(pin))
+	}
+	for i := 1; i < MaxFailedAttempts; i++ {
+		Verify(s, cardID, "1111", now)
+	}
+	if _, err := Verify(s, cardID, "1111", now); !errors.Is(err, ErrBlocked) || storedPIN(s, cardID).BlockedAt == nil {
+		t.Fatalf("last attempt = %v, want ErrBlocked", err)
+	}
+	if _, err := Verify(s, cardID, "4821", now); !errors.Is(err, ErrBlocked) {
+		t.Errorf("right PIN once blocked = %v, want ErrBlocked", err)
+	}
+
+	s, cardID = withPIN(t, "")
+	if _, err := Verify(s, cardID, "4821", now); !errors.Is(err, ErrNotSet) {
+		t.Errorf("Verify without a PIN = %v, want ErrNotSet", err)
+	}
+	if _, err := Verify(s, "missing", "4821", now); !errors.Is(err, ErrNoCard) {
+		t.Errorf("Verify of an unknown card = %v, want ErrNoCard", err)
+	}
+}
+
+func TestConcurrentWrongPINsBlockAfterMaxAttempts(t *testing.T) {
+	now := time.Now()
+	s, cardID := withPIN(t, "4821")
+
+	const guesses = 10
+	errs := make(chan error, guesses)
+	var wg sync.WaitGroup
+	for i := 0; i < guesses; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, err := Verify(s, cardID, fmt.Sprintf("%04d", 5000+i), now)
+			errs <- err
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+
+	incorrect, blocked := 0, 0
+	for err := range errs {
+		switch {
+		case errors.Is(err, ErrIncorrect):
+			incorrect++
+		case errors.Is(err, ErrBlocked):
+			blocked++
+		default:
+			t.Errorf("unexpected error %v", err)
+		}
+	}
+	if incorrect != MaxFailedAttempts-1 || blocked != guesses-incorrect {
+		t.Errorf("%d incorrect and %d blocked, want the PIN blocked on attempt %d", incorrect, blocked, MaxFailedAttempts)
+	}
+	if pin := storedPIN(s, cardID); pin.BlockedAt == nil || pin.FailedAttempts != MaxFailedAttempts {
+		t.Errorf("stored PIN has %d failed attempts, blocked at %v", pin.FailedAttempts, pin.BlockedAt)
+	}
+	if _, err := Verify(s, cardID, "4821", now); !errors.Is(err, ErrBlocked) {
+		t.Errorf("right PIN after the guesses = %v, want ErrBlocked", err)
+	}
+}
+
+func TestVerifyLeavesTheRestOfTheCard(t *testing.T) {
+	s, cardID := withPIN(t, "4821")
+	card, _ := s.GetDebitCardByID(cardID)
+	card.Status = models.CardStatusTemporarilyBlocked
+	s.UpdateDebitCard(card)
+
+	Verify(s, cardID, "1111", time.Now())
+	if card, _ := s.GetDebitCardByID(cardID); card.Status != models.CardStatusTemporarilyBlocked || card.PIN.FailedAttempts != 1 {
+		t.Errorf("card status %s with %d failed attempts, want the status kept and 1 attempt", card.Status, card.PIN.FailedAttempts)
+	}
+}
+
+func TestSet(t *testing.T) {
+	now := time.Now()
+	s, cardID := withPIN(t, "")
+
+	if pin, err := Set(s, cardID, request("4821"), "", false, now); err != nil || pin == nil || storedPIN(s, cardID) == nil {
+		t.Fatalf("first PIN = %v", err)
+	}
+
+	// Once set, the PIN only changes with the old PIN; re-authenticating is
+	// no substitute while the PIN is not blocked
+	if _, err := Set(s, cardID, request("5932"), "", true, now); !errors.Is(err, ErrOldPINRequired) {
+		t.Errorf("change without the old PIN = %v, want ErrOldPINRequired", err)
+	}
+	req := request("4821")
+	req.OldPIN = "4821"
+	if _, err := Set(s, cardID, req, "", false, now); !errors.Is(err, ErrUnchanged) {
+		t.Errorf("same PIN = %v, want ErrUnchanged", err)
+	}
+	req = request("5932")
+	req.OldPIN = "1111"
+	if pin, err := Set(s, cardID, req, "", false, now); !errors.Is(err, ErrIncorrect) || pin.FailedAttempts != 1 || storedPIN(s, cardID).FailedAttempts != 1 {
+		t.Errorf("wrong old PIN = %v, want ErrIncorrect and one stored failure", err)
+	}
+	req.OldPIN = "4821"
+	if _, err := Set(s, cardID, req, "", false, now); err != nil {
+		t.Fatalf("right old PIN = %v", err)
+	}
+	if _, err := Verify(s, cardID, "5932", now); err != nil {
+		t.Errorf("new PIN does not verify: %v", err)
+	}
+	if pin := storedPIN(s, cardID); pin.FailedAttempts != 0 {
+		t.Errorf("new PIN starts with %d failed attempts", pin.FailedAttempts)
+	}
+	if _, err := Set(s, "missing", request("4821"), "", false, now); !errors.Is(err, ErrNoCard) {
+		t.Errorf("Set on an unknown card = %v, want ErrNoCard", err)
+	}
+}
+
+func TestSetBlockedPINRequiresStepUp(t *testing.T) {
+	now := time.Now()
+	s, cardID := withPIN(t, "4821")
+	for i := 0; i < MaxFailedAttempts; i++ {
+		Verify(s, cardID, "1111", now)
+	}
+
+	// Neither the old PIN nor an empty request unblocks it
+	for _, oldPIN := range []string{"", "4821"} {
+		req := request("5932")
+		req.OldPIN = oldPIN
+		if _, err := Set(s, cardID, req, "", false, now); !errors.Is(err, ErrStepUpRequired) {
+			t.Errorf("reset with old PIN %q = %v, want ErrStepUpRequired", oldPIN, err)
+		}
+	}
+	if storedPIN(s, cardID).BlockedAt == nil {
+		t.Fatal("a refused reset unblocked the PIN")
+	}
+
+	if _, err := Set(s, cardID, request("5932"), "", true, now); err != nil {
+		t.Fatalf("reset after stepping up = %v", err)
+	}
+	if pin := storedPIN(s, cardID); pin.BlockedAt != nil || AttemptsRemaining(pin) != MaxFailedAttempts {
+		t.Errorf("reset PIN is still blocked")
+	}
+}
@@ -0,0 +1,247 @@
+// Package cardstatus is the status state machine shared by credit, debit and
+// virtual cards. Existing cards are Active; new physical cards start Inactive
+// and become Active only when the cardholder activates them. An Active card
+// can be temporarily blocked and unblocked, or permanently blocked
+// (hotlisted) when it is lost or stolen.
+// A card past its expiry date is Expired. Closed is final. Every change is
+// recorded with its reason.
+package cardstatus
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"bankapp-microservices/internal/authorization"
+	"bankapp-microservices/internal/models"
+	"bankapp-microservices/internal/store"
+)
+
+// MaxReasonLength is the longest reason recorded with a change
+const MaxReasonLength = 200
+
+var (
+	ErrUnknownStatus  = errors.New("unknown card status")
+	ErrUnchanged      = errors.New("card already has this status")
+	ErrReasonRequired = errors.New("a reason is required")
+	ErrReasonTooLong  = fmt.Errorf("reason must be at most %d characters", MaxReasonLength)
+	ErrCardNotFound   = errors.New("card not found")
+	// A credit card cannot be closed while the customer still owes on it
+	ErrOutstandingBalance = errors.New("card has an outstanding balance")
+	ErrActiveEMI          = errors.New("card has active EMI plans")
+)
+
+// TransitionError is returned for a status change the state machine does not allow
+type TransitionError struct {
+	From, To string
+}
+
+func (e *TransitionError) Error() string {
+	return fmt.Sprintf("cannot change card status from %s to %s", e.From, e.To)
+}
+
+// transitions lists the statuses each status may change to on request.
+// Cards only become Expired by passing their expiry date, and only leave
+// Inactive for Active through Activate.
+var transitions = map[string][]string{
+	models.CardStatusInactive:           {models.CardStatusPermanentlyBlocked, models.CardStatusClosed},
+	models.CardStatusActive:             {models.CardStatusTemporarilyBlocked, models.CardStatusPermanentlyBlocked, models.CardStatusClosed},
+	models.CardStatusTemporarilyBlocked: {models.CardStatusActive, models.CardStatusPermanentlyBlocked, models.CardStatusClosed},
+	models.CardStatusPermanentlyBlocked: {models.CardStatusClosed},
+	models.CardStatusExpired:            {models.CardStatusClosed},
+	models.CardStatusClosed:             {},
+}
+
+// aliases are other names accepted for statuses, including the ones virtual
+// cards used before statuses were shared
+var aliases = map[string]string{
+	"hotlisted": models.CardStatusPermanentlyBlocked,
+	"frozen":    models.CardStatusTemporarilyBlocked,
+	"cancelled": models.CardStatusClosed,
+}
+
+// virtualNames are the names virtual card responses keep using for statuses
+var virtualNames = map[string]string{
+	models.CardStatusTemporarilyBlocked: "Frozen",
+	models.CardStatusClosed:             "Cancelled",
+}
+
+// VirtualName returns the name virtual cards report status by
+func VirtualName(status string) string {
+	if name, exists := virtualNames[status]; exists {
+		return name
+	}
+	return status
+}
+
+// Normalize returns the status named by name, matched case-insensitively
+// against statuses and their aliases
+func Normalize(name string) (string, bool) {
+	name = strings.TrimSpace(name)
+	for status := range transitions {
+		if strings.EqualFold(status, name) {
+			return status, true
+		}
+	}
+	status, exists := aliases[strings.ToLower(name)]
+	return status, exists
+}
+
+// Current returns a card's status as of now: a card still in use or awaiting
+// activation after its expiry month is Expired
+func Current(status string, expiryMonth, expiryYear int, now time.Time) string {
+	if normalized, ok := Normalize(status); ok {
+		status = normalized
+	}
+	switch status {
+	case models.CardStatusInactive, models.CardStatusActive, models.CardStatusTemporarilyBlocked:
+	default:
+		return status
+	}
+	if authorization.IsExpired(expiryMonth, expiryYear, now) {
+		return models.CardStatusExpired
+	}
+	return status
+}
+
+// CanTransition reports whether a card may change from one status to another on request
+func CanTransition(from, to string) bool {
+	for _, allowed := range transitions[from] {
+		if allowed == to {
+			return true
+		}
+	}
+	return false
+}
+
+// changing serializes status changes so each one starts from the status the
+// previous one left
+var changing sync.Mutex
+
+// Change moves the credit, debit or virtual card cardID to the requested
+// status and records the change. A reason is required for every status but
+// Active. A credit card can only be closed once its balance and EMI plans
+// are paid off.
+func Change(s store.Store, cardID string, req *models.StatusRequest, now time.Time) (*models.CardStatusChange, error) {
+	return change(s, cardID, req, now, true)
+}
+
+// Retire closes cardID because it has been replaced. Its balance and EMI
+// plans carry over to the replacement, so they need not be paid off.
+func Retire(s store.Store, cardID, reason string, now time.Time) (*models.CardStatusChange, error) {
+	return change(s, cardID, &models.StatusRequest{Status: models.CardStatusClosed, Reason: reason}, now, false)
+}
+
+func change(s store.Store, cardID string, req *models.StatusRequest, now time.Time, requireSettled bool) (*models.CardStatusChange, error) {
+	to, ok := Normalize(req.Status)
+	if !ok {
+		return nil, ErrUnknownStatus
+	}
+	reason := strings.TrimSpace(req.Reason)
+	if reason == "" && to != models.CardStatusActive {
+		return nil, ErrReasonRequired
+	}
+	if len(reason) > MaxReasonLength {
+		return nil, ErrReasonTooLong
+	}
+
+	changing.Lock()
+	defer changing.Unlock()
+
+	card, exists := lookup(s, cardID)
+	if !exists {
+		return nil, ErrCardNotFound
+	}
+	from := Current(*card.status, card.expiryMonth, card.expiryYear, now)
+	if from == to {
+		return nil, ErrUnchanged
+	}
+	if !CanTransition(from, to) {
+		return nil, &TransitionError{From: from, To: to}
+	}
+	if to == models.CardStatusClosed && requireSettled {
+		if err := settled(s, cardID); err != nil {
+			return nil, err
+		}
+	}
+	return record(s, cardID, card, from, to, reason, now), nil
+}
+
+// settled checks that nothing is owed on cardID if it is a credit card.
+// Add-on cards draw on their primary card's credit line, which stays open.
+func settled(s store.Store, cardID string) error {
+	card, exists := s.GetCreditCardByID(cardID)
+	if !exists || card.PrimaryCardID != "" {
+		return nil
+	}
+	if s.GetAccountBalance(card.LedgerAccountID) < 0 {
+		return ErrOutstandingBalance
+	}
+	for _, plan := range s.GetEMIPlansByCardID(cardID) {
+		if plan.Status == models.EMIStatusActive {
+			return ErrActiveEMI
+		}
+	}
+	return nil
+}
+
+// Activate moves the Inactive card cardID to Active once the cardholder has
+// proved they hold it
+func Activate(s store.Store, cardID string, now time.Time) (*models.CardStatusChange, error) {
+	changing.Lock()
+	defer changing.Unlock()
+
+	card, exists := lookup(s, cardID)
+	if !exists {
+		return nil, ErrCardNotFound
+	}
+	from := Current(*card.status, card.expiryMonth, card.expiryYear, now)
+	if from != models.CardStatusInactive {
+		return nil, &TransitionError{From: from, To: models.CardStatusActive}
+	}
+	return record(s, cardID, card, from, models.CardStatusActive, "Activated by cardholder", now), nil
+}
+
+// record applies a status change to card and adds it to the history
+func record(s store.Store, cardID string, card *card, from, to, reason string, now time.Time) *models.CardStatusChange {
+	*card.status = to
+	*card.reason = reason
+	*card.changedAt = &now
+	card.save()
+
+	change := &models.CardStatusChange{
+		ID:        models.GenerateID(),
+		CardID:    cardID,
+		UserID:    card.userID,
+		From:      from,
+		To:        to,
+		Reason:    reason,
+		ChangedAt: now,
+	}
+	s.AddCardStatusChange(change)
+	return change
+}
+
+// card gives access to the status fields of any type of card
+type card struct {
+	userID                  string
+	expiryMonth, expiryYear int
+	status, reason          *string
+	changedAt               **time.Time
+	save                    func()
+}
+
+func lookup(s store.Store, cardID string) (*card, bool) {
+	if c, exists := s.GetCreditCardByID(cardID); exists {
+		return &card{c.UserID, c.ExpiryMonth, c.ExpiryYear, &c.Status, &c.StatusReason, &c.StatusChangedAt, func() { s.UpdateCreditCard(c) }}, true
+	}
+	if c, exists := s.GetDebitCardByID(cardID); exists {
+		return &card{c.UserID, c.ExpiryMonth, c.ExpiryYear, &c.Status, &c.StatusReason, &c.StatusChangedAt, func() { s.UpdateDebitCard(c) }}, true
+	}
+	if c, exists := s.GetVirtualCardByID(cardID); exists {
+		return &card{c.UserID, c.ExpiryMonth, c.ExpiryYear, &c.Status, &c.StatusReason, &c.StatusChangedAt, func() { s.UpdateVirtualCard(c) }}, true
+	}
+	return nil, false
+}
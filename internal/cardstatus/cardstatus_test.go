@@ -0,0 +1,135 @@
+package cardstatus
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"bankapp-microservices/internal/ledger"
+	"bankapp-microservices/internal/models"
+	"bankapp-microservices/internal/store"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := map[string]string{
+		"active":              models.CardStatusActive,
+		" TemporarilyBlocked": models.CardStatusTemporarilyBlocked,
+		"Hotlisted":           models.CardStatusPermanentlyBlocked,
+		"Frozen":              models.CardStatusTemporarilyBlocked,
+		"cancelled":           models.CardStatusClosed,
+	}
+	for name, want := range tests {
+		if got, ok := Normalize(name); !ok || got != want {
+			t.Errorf("Normalize(%q) = %q, %v; want %q", name, got, ok, want)
+		}
+	}
+	if _, ok := Normalize("Deleted"); ok {
+		t.Error("Normalize accepted an unknown status")
+	}
+}
+
+func TestVirtualName(t *testing.T) {
+	tests := map[string]string{
+		models.CardStatusActive:             "Active",
+		models.CardStatusTemporarilyBlocked: "Frozen",
+		models.CardStatusClosed:             "Cancelled",
+		models.CardStatusPermanentlyBlocked: models.CardStatusPermanentlyBlocked,
+		models.CardStatusExpired:            models.CardStatusExpired,
+	}
+	for status, want := range tests {
+		if got := VirtualName(status); got != want {
+			t.Errorf("VirtualName(%s) = %s, want %s", status, got, want)
+		}
+	}
+}
+
+func TestCurrent(t *testing.T) {
+	now := time.Date(2026, 5, 15, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		status      string
+		month, year int
+		want        string
+	}{
+		{models.CardStatusActive, 5, 2026, models.CardStatusActive},
+		{models.CardStatusActive, 4, 2026, models.CardStatusExpired},
+		{"Frozen", 4, 2026, models.CardStatusExpired},
+		{models.CardStatusInactive, 1, 2025, models.CardStatusExpired},
+		{models.CardStatusPermanentlyBlocked, 1, 2025, models.CardStatusPermanentlyBlocked},
+		{"Cancelled", 1, 2025, models.CardStatusClosed},
+	}
+	for _, tt := range tests {
+		if got := Current(tt.status, tt.month, tt.year, now); got != tt.want {
+			t.Errorf("Current(%s, %d/%d) = %s, want %s", tt.status, tt.month, tt.year, got, tt.want)
+		}
+	}
+}
+
+// newCard opens an active credit card for testuser with its own credit line
+func newCard(s store.Store, now time.Time) *models.CreditCard {
+	card := &models.CreditCard{ID: models.GenerateID(), UserID: "testuser", TotalCredit: 100000, Status: models.CardStatusActive, ExpiryMonth: 12, ExpiryYear: now.Year() + 3}
+	card.LedgerAccountID = ledger.CreditCardAccountID(card.ID)
+	s.CreateLedgerAccount(&models.LedgerAccount{ID: card.LedgerAccountID, Type: ledger.TypeCreditLine, Currency: ledger.Currency, UserID: card.UserID})
+	s.UpdateCreditCard(card)
+	return card
+}
+
+func TestChange(t *testing.T) {
+	s := store.NewMemoryStore()
+	now := time.Now()
+	card := newCard(s, now)
+
+	var transition *TransitionError
+	if _, err := Change(s, card.ID, &models.StatusRequest{Status: "Frozen"}, now); !errors.Is(err, ErrReasonRequired) {
+		t.Errorf("block without reason = %v, want ErrReasonRequired", err)
+	}
+	if _, err := Change(s, card.ID, &models.StatusRequest{Status: models.CardStatusActive}, now); !errors.Is(err, ErrUnchanged) {
+		t.Errorf("activating an active card = %v, want ErrUnchanged", err)
+	}
+	if _, err := Change(s, "missing", &models.StatusRequest{Status: models.CardStatusActive}, now); !errors.Is(err, ErrCardNotFound) {
+		t.Errorf("unknown card = %v, want ErrCardNotFound", err)
+	}
+
+	change, err := Change(s, card.ID, &models.StatusRequest{Status: "hotlisted", Reason: "Stolen"}, now)
+	if err != nil || change.From != models.CardStatusActive || change.To != models.CardStatusPermanentlyBlocked {
+		t.Fatalf("hotlisting = %+v, %v", change, err)
+	}
+	if _, err := Change(s, card.ID, &models.StatusRequest{Status: models.CardStatusActive}, now); !errors.As(err, &transition) {
+		t.Errorf("unblocking a hotlisted card = %v, want a TransitionError", err)
+	}
+	if history := s.GetCardStatusChangesByCardID(card.ID); len(history) != 1 || history[0].Reason != "Stolen" {
+		t.Errorf("history = %+v", history)
+	}
+	if stored, _ := s.GetCreditCardByID(card.ID); stored.Status != models.CardStatusPermanentlyBlocked || stored.StatusReason != "Stolen" {
+		t.Errorf("stored card = %s (%s)", stored.Status, stored.StatusReason)
+	}
+}
+
+func TestCloseRequiresSettledCard(t *testing.T) {
+	s := store.NewMemoryStore()
+	now := time.Now()
+	card := newCard(s, now)
+	closing := &models.StatusRequest{Status: models.CardStatusClosed, Reason: "No longer needed"}
+
+	if err := s.PostJournalEntry(ledger.Transfer(card.LedgerAccountID, ledger.AccountMerchantSettlement, 5000, "Purchase", "", now)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Change(s, card.ID, closing, now); !errors.Is(err, ErrOutstandingBalance) {
+		t.Errorf("closing with a balance = %v, want ErrOutstandingBalance", err)
+	}
+
+	if err := s.PostJournalEntry(ledger.Transfer(ledger.AccountFunding, card.LedgerAccountID, 5000, "Payment", "", now)); err != nil {
+		t.Fatal(err)
+	}
+	s.SetEMIPlan(&models.EMIPlan{ID: models.GenerateID(), CardID: card.ID, UserID: card.UserID, Status: models.EMIStatusActive})
+	if _, err := Change(s, card.ID, closing, now); !errors.Is(err, ErrActiveEMI) {
+		t.Errorf("closing with an EMI plan = %v, want ErrActiveEMI", err)
+	}
+	if stored, _ := s.GetCreditCardByID(card.ID); stored.Status != models.CardStatusActive {
+		t.Errorf("refused close left the card %s", stored.Status)
+	}
+
+	// A replaced card hands its balance and plans to the new card
+	if _, err := Retire(s, card.ID, "Replaced", now); err != nil {
+		t.Errorf("Retire = %v", err)
+	}
+}
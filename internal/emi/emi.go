@@ -0,0 +1,349 @@
+// Package emi converts large credit card purchases into equated monthly
+// installments. Converting moves the purchase off the card's credit line onto
+// the card's EMI loan account, where the unbilled principal keeps using up
+// the credit limit. Each time a billing cycle closes one installment, with
+// its interest, is billed back onto the credit line so it shows up on the
+// statement. A plan can be foreclosed by billing all remaining principal at
+// once.
+package emi
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"bankapp-microservices/internal/ledger"
+	"bankapp-microservices/internal/models"
+	"bankapp-microservices/internal/store"
+)
+
+// Tenure is an installment period offered with its annual interest rate
+type Tenure struct {
+	Months int
+	APR    float64
+}
+
+// Tenures are the EMI periods offered on every eligible purchase
+var Tenures = []Tenure{
+	{Months: 3, APR: 13},
+	{Months: 6, APR: 14},
+	{Months: 9, APR: 15},
+	{Months: 12, APR: 15},
+	{Months: 18, APR: 16},
+	{Months: 24, APR: 16},
+}
+
+const (
+	// MinimumAmount is the smallest purchase that can be converted
+	MinimumAmount = 2500
+	// ConversionWindow is how long after a purchase it can be converted
+	ConversionWindow = 30 * 24 * time.Hour
+	// ProcessingFeePercent of the principal is charged on conversion, at
+	// least MinimumProcessingFee
+	ProcessingFeePercent = 1
+	MinimumProcessingFee = 199
+	// ForeclosureFeePercent of the remaining principal is charged on foreclosure
+	ForeclosureFeePercent = 3
+)
+
+var (
+	ErrNotPurchase      = errors.New("only approved purchases can be converted")
+	ErrBelowMinimum     = fmt.Errorf("purchases under %d cannot be converted", MinimumAmount)
+	ErrRefunded         = errors.New("refunded purchases cannot be converted")
+	ErrAlreadyConverted = errors.New("purchase has already been converted")
+	ErrBilled           = errors.New("purchase has already been billed on a statement")
+	ErrWindowPassed     = errors.New("conversion window has passed")
+	ErrInvalidTenure    = errors.New("tenure is not offered")
+	ErrPlanNotActive    = errors.New("plan is not active")
+)
+
+// converting serializes conversions, billing and foreclosures so a purchase
+// is never converted twice and an installment never billed twice
+var converting sync.Mutex
+
+// Eligible checks whether txn, a transaction on card, can be converted now.
+// billedUntil is the end of the card's latest statement period.
+func Eligible(s store.Store, card *models.CreditCard, txn *models.Transaction, billedUntil, now time.Time) error {
+	if txn.Type != models.TransactionTypePurchase || txn.Status != models.TransactionStatusApproved {
+		return ErrNotPurchase
+	}
+	if txn.Amount < MinimumAmount {
+		return ErrBelowMinimum
+	}
+	if _, converted := PlanForTransaction(s, card.ID, txn.ID); converted {
+		return ErrAlreadyConverted
+	}
+	for _, other := range s.GetTransactionsByCardID(card.ID) {
+		if other.OriginalTransactionID == txn.ID {
+			return ErrRefunded
+		}
+	}
+	if txn.Date.Before(billedUntil) {
+		return ErrBilled
+	}
+	if now.Sub(txn.Date) > ConversionWindow {
+		return ErrWindowPassed
+	}
+	return nil
+}
+
+// PlanForTransaction finds the EMI plan a purchase was converted to
+func PlanForTransaction(s store.Store, cardID, transactionID string) (*models.EMIPlan, bool) {
+	for _, plan := range s.GetEMIPlansByCardID(cardID) {
+		if plan.TransactionID == transactionID {
+			return plan, true
+		}
+	}
+	return nil, false
+}
+
+// Offers returns every tenure's terms for converting amount
+func Offers(amount float64) []models.EMIOffer {
+	offers := make([]models.EMIOffer, 0, len(Tenures))
+	for _, tenure := range Tenures {
+		offers = append(offers, offer(ledger.ToMinor(amount), tenure))
+	}
+	return offers
+}
+
+func offer(principal int64, tenure Tenure) models.EMIOffer {
+	schedule := Schedule(principal, tenure)
+	var interest int64
+	for _, installment := range schedule {
+		interest += ledger.ToMinor(installment.Interest)
+	}
+	fee := ProcessingFee(principal)
+	return models.EMIOffer{
+		Tenure:             tenure.Months,
+		InterestRate:       tenure.APR,
+		MonthlyInstallment: schedule[0].Amount,
+		TotalInterest:      ledger.ToMajor(interest),
+		ProcessingFee:      ledger.ToMajor(fee),
+		TotalPayable:       ledger.ToMajor(principal + interest + fee),
+	}
+}
+
+// ProcessingFee returns the conversion fee for principal, in minor units
+func ProcessingFee(principal int64) int64 {
+	fee := int64(math.Round(float64(principal) * ProcessingFeePercent / 100))
+	return max(fee, ledger.ToMinor(MinimumProcessingFee))
+}
+
+// Schedule amortizes principal minor units over the tenure with equal
+// monthly installments; the last installment absorbs rounding
+func Schedule(principal int64, tenure Tenure) []models.EMIInstallment {
+	rate := tenure.APR / 12 / 100
+	n := tenure.Months
+	emi := float64(principal) / float64(n)
+	if rate > 0 {
+		growth := math.Pow(1+rate, float64(n))
+		emi = float64(principal) * rate * growth / (growth - 1)
+	}
+	amount := int64(math.Round(emi))
+
+	schedule := make([]models.EMIInstallment, 0, n)
+	balance := principal
+	for number := 1; number <= n; number++ {
+		interest := int64(math.Round(float64(balance) * rate))
+		part := amount - interest
+		if number == n {
+			part = balance
+		}
+		balance -= part
+		schedule = append(schedule, models.EMIInstallment{
+			Number:    number,
+			Principal: ledger.ToMajor(part),
+			Interest:  ledger.ToMajor(interest),
+			Amount:    ledger.ToMajor(part + interest),
+		})
+	}
+	return schedule
+}
+
+// Convert turns txn into an EMI plan over months: the purchase moves from the
+// credit line to the card's EMI loans and the processing fee is charged.
+// Eligibility must already have been checked with Eligible.
+func Convert(s store.Store, card *models.CreditCard, txn *models.Transaction, months int, now time.Time) (*models.EMIPlan, error) {
+	converting.Lock()
+	defer converting.Unlock()
+
+	var tenure *Tenure
+	for i := range Tenures {
+		if Tenures[i].Months == months {
+			tenure = &Tenures[i]
+		}
+	}
+	if tenure == nil {
+		return nil, ErrInvalidTenure
+	}
+	if _, converted := PlanForTransaction(s, card.ID, txn.ID); converted {
+		return nil, ErrAlreadyConverted
+	}
+
+	if card.EMIAccountID == "" {
+		card.EMIAccountID = ledger.EMIAccountID(card.ID)
+		s.CreateLedgerAccount(&models.LedgerAccount{
+			ID:       card.EMIAccountID,
+			Type:     ledger.TypeEMILoan,
+			Name:     card.CardType + " EMI loans",
+			Currency: ledger.Currency,
+			UserID:   card.UserID,
+		})
+		s.UpdateCreditCard(card)
+	}
+
+	principal := ledger.ToMinor(txn.Amount)
+	plan := &models.EMIPlan{
+		ID:            models.GenerateID(),
+		CardID:        card.ID,
+		UserID:        card.UserID,
+		TransactionID: txn.ID,
+		Merchant:      txn.Merchant,
+		EMIOffer:      offer(principal, *tenure),
+		Principal:     txn.Amount,
+		Status:        models.EMIStatusActive,
+		CreatedAt:     now,
+		Installments:  Schedule(principal, *tenure),
+	}
+
+	conversion := ledger.Transfer(card.EMIAccountID, card.LedgerAccountID, principal, "EMI conversion: "+describe(plan), "emi-conversion:"+plan.ID, now)
+	if err := s.PostJournalEntry(conversion); err != nil {
+		return nil, fmt.Errorf("post conversion: %w", err)
+	}
+	fee := ledger.Transfer(card.LedgerAccountID, ledger.AccountFeeIncome, ProcessingFee(principal), "EMI processing fee: "+describe(plan), "emi-fee:"+plan.ID, now)
+	if err := s.PostJournalEntry(fee); err != nil {
+		return nil, fmt.Errorf("post processing fee: %w", err)
+	}
+	s.SetEMIPlan(plan)
+	return plan, nil
+}
+
+// Bill posts the next installment of each of the card's active plans for the
+// cycle [start, end), dated at. Plans converted after the cycle closed wait
+// for the next one.
+func Bill(s store.Store, card *models.CreditCard, start, end, at time.Time) error {
+	converting.Lock()
+	defer converting.Unlock()
+
+	for _, plan := range s.GetEMIPlansByCardID(card.ID) {
+		if plan.Status != models.EMIStatusActive || !plan.CreatedAt.Before(end) {
+			continue
+		}
+		billed, last := billedInstallments(s, plan)
+		if billed >= len(plan.Installments) || (last != nil && !last.Date.Before(start)) {
+			continue
+		}
+
+		installment := plan.Installments[billed]
+		label := fmt.Sprintf("EMI %d/%d: %s", installment.Number, len(plan.Installments), describe(plan))
+		principal, interest := ledger.ToMinor(installment.Principal), ledger.ToMinor(installment.Interest)
+		// One entry per installment so it is a single statement line
+		postings := []models.Posting{{AccountID: card.EMIAccountID, Amount: principal}}
+		if interest > 0 {
+			postings = append(postings, models.Posting{AccountID: ledger.AccountInterestIncome, Amount: interest})
+		}
+		postings = append(postings, models.Posting{AccountID: card.LedgerAccountID, Amount: -(principal + interest)})
+		entry := ledger.NewEntry(label, installmentReference(plan, installment.Number), at, postings...)
+		if err := s.PostJournalEntry(entry); err != nil {
+			return fmt.Errorf("bill installment %d of plan %s: %w", installment.Number, plan.ID, err)
+		}
+
+		if installment.Number == len(plan.Installments) {
+			updated := *plan
+			updated.Status = models.EMIStatusCompleted
+			updated.ClosedAt = &at
+			s.SetEMIPlan(&updated)
+		}
+	}
+	return nil
+}
+
+// Foreclose closes an active plan by billing all of its remaining principal
+// to the credit line now, with the foreclosure fee. No further interest is
+// charged on it.
+func Foreclose(s store.Store, card *models.CreditCard, plan *models.EMIPlan, now time.Time) (*models.EMIPlan, error) {
+	converting.Lock()
+	defer converting.Unlock()
+
+	if current, exists := s.GetEMIPlan(plan.ID); exists {
+		plan = current
+	}
+	if plan.Status != models.EMIStatusActive {
+		return nil, ErrPlanNotActive
+	}
+
+	billed, _ := billedInstallments(s, plan)
+	var remaining int64
+	for _, installment := range plan.Installments[billed:] {
+		remaining += ledger.ToMinor(installment.Principal)
+	}
+	fee := int64(math.Round(float64(remaining) * ForeclosureFeePercent / 100))
+
+	if remaining > 0 {
+		entry := ledger.Transfer(card.LedgerAccountID, card.EMIAccountID, remaining, "EMI foreclosure: "+describe(plan), "emi-foreclosure:"+plan.ID, now)
+		if err := s.PostJournalEntry(entry); err != nil {
+			return nil, fmt.Errorf("post foreclosure: %w", err)
+		}
+	}
+	if fee > 0 {
+		entry := ledger.Transfer(card.LedgerAccountID, ledger.AccountFeeIncome, fee, "EMI foreclosure fee: "+describe(plan), "emi-foreclosure-fee:"+plan.ID, now)
+		if err := s.PostJournalEntry(entry); err != nil {
+			return nil, fmt.Errorf("post foreclosure fee: %w", err)
+		}
+	}
+
+	updated := *plan
+	updated.Status = models.EMIStatusForeclosed
+	updated.ClosedAt = &now
+	updated.ForeclosureFee = ledger.ToMajor(fee)
+	s.SetEMIPlan(&updated)
+	return &updated, nil
+}
+
+// WithStatus returns a copy of plan whose installments say whether they have
+// been billed
+func WithStatus(s store.Store, plan *models.EMIPlan) *models.EMIPlan {
+	reported := *plan
+	reported.Installments = append([]models.EMIInstallment(nil), plan.Installments...)
+	for i := range reported.Installments {
+		installment := &reported.Installments[i]
+		if entry, billed := s.GetJournalEntryByReference(installmentReference(plan, installment.Number)); billed {
+			installment.Status = models.InstallmentBilled
+			installment.BilledAt = &entry.Date
+		} else if plan.Status == models.EMIStatusForeclosed {
+			installment.Status = models.InstallmentForeclosed
+		} else {
+			installment.Status = models.InstallmentPending
+		}
+	}
+	return &reported
+}
+
+// billedInstallments returns how many of a plan's installments have been
+// billed and the journal entry of the last one
+func billedInstallments(s store.Store, plan *models.EMIPlan) (int, *models.JournalEntry) {
+	var last *models.JournalEntry
+	billed := 0
+	for _, installment := range plan.Installments {
+		entry, exists := s.GetJournalEntryByReference(installmentReference(plan, installment.Number))
+		if !exists {
+			break
+		}
+		billed++
+		last = entry
+	}
+	return billed, last
+}
+
+func installmentReference(plan *models.EMIPlan, number int) string {
+	return fmt.Sprintf("emi:%s:%d", plan.ID, number)
+}
+
+func describe(plan *models.EMIPlan) string {
+	if plan.Merchant != "" {
+		return plan.Merchant
+	}
+	return models.TransactionTypePurchase
+}
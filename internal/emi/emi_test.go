@@ -0,0 +1,151 @@
+package emi
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"bankapp-microservices/internal/ledger"
+	"bankapp-microservices/internal/models"
+	"bankapp-microservices/internal/store"
+)
+
+func TestSchedule(t *testing.T) {
+	schedule := Schedule(1200000, Tenure{Months: 12, APR: 15})
+	if len(schedule) != 12 || schedule[0].Amount != 1083.1 {
+		t.Fatalf("schedule = %d installments of %v, want 12 of 1083.10", len(schedule), schedule[0].Amount)
+	}
+	var principal int64
+	for _, installment := range schedule {
+		principal += ledger.ToMinor(installment.Principal)
+	}
+	if principal != 1200000 {
+		t.Errorf("installments repay %d, want 1200000", principal)
+	}
+	if schedule[0].Interest != 150 {
+		t.Errorf("first month's interest = %v, want 150", schedule[0].Interest)
+	}
+
+	for _, installment := range Schedule(300000, Tenure{Months: 3}) {
+		if installment.Interest != 0 || installment.Amount != 1000 {
+			t.Errorf("interest free installment = %+v", installment)
+		}
+	}
+}
+
+func TestProcessingFee(t *testing.T) {
+	if got := ProcessingFee(ledger.ToMinor(5000)); got != ledger.ToMinor(MinimumProcessingFee) {
+		t.Errorf("fee on 5000 = %d, want the minimum", got)
+	}
+	if got := ProcessingFee(ledger.ToMinor(50000)); got != 50000 {
+		t.Errorf("fee on 50000 = %d, want 1%%", got)
+	}
+}
+
+// setup opens a credit card for testuser with a 12000.00 purchase made now
+func setup(t *testing.T, now time.Time) (store.Store, *models.CreditCard, *models.Transaction) {
+	t.Helper()
+	s := store.NewMemoryStore()
+	card := &models.CreditCard{ID: models.GenerateID(), UserID: "testuser", CardType: "Visa Platinum", TotalCredit: 100000, Status: models.CardStatusActive}
+	card.LedgerAccountID = ledger.CreditCardAccountID(card.ID)
+	s.CreateLedgerAccount(&models.LedgerAccount{ID: card.LedgerAccountID, Type: ledger.TypeCreditLine, Currency: ledger.Currency, UserID: card.UserID})
+	s.UpdateCreditCard(card)
+
+	txn := &models.Transaction{ID: models.GenerateID(), CardID: card.ID, Amount: 12000, Merchant: "Electronics", Date: now, Type: models.TransactionTypePurchase, Status: models.TransactionStatusApproved}
+	s.AddTransaction(txn)
+	if err := s.PostJournalEntry(ledger.Transfer(card.LedgerAccountID, ledger.AccountMerchantSettlement, 1200000, txn.Merchant, txn.ID, now)); err != nil {
+		t.Fatal(err)
+	}
+	return s, card, txn
+}
+
+func TestEligible(t *testing.T) {
+	now := time.Now()
+	s, card, txn := setup(t, now)
+
+	small := *txn
+	small.Amount = MinimumAmount - 1
+	cash := *txn
+	cash.Type = models.TransactionTypeCashWithdrawal
+	tests := []struct {
+		name        string
+		txn         *models.Transaction
+		billedUntil time.Time
+		now         time.Time
+		want        error
+	}{
+		{"eligible", txn, now.Add(-time.Hour), now, nil},
+		{"cash", &cash, time.Time{}, now, ErrNotPurchase},
+		{"small", &small, time.Time{}, now, ErrBelowMinimum},
+		{"billed", txn, now.Add(time.Hour), now, ErrBilled},
+		{"too late", txn, time.Time{}, now.Add(ConversionWindow + time.Hour), ErrWindowPassed},
+	}
+	for _, tt := range tests {
+		if err := Eligible(s, card, tt.txn, tt.billedUntil, tt.now); !errors.Is(err, tt.want) {
+			t.Errorf("%s: Eligible = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+
+	s.AddTransaction(&models.Transaction{ID: models.GenerateID(), CardID: card.ID, Amount: 100, Date: now, Type: models.TransactionTypeRefund, Status: models.TransactionStatusApproved, OriginalTransactionID: txn.ID})
+	if err := Eligible(s, card, txn, time.Time{}, now); !errors.Is(err, ErrRefunded) {
+		t.Errorf("refunded purchase: Eligible = %v, want ErrRefunded", err)
+	}
+}
+
+func TestConvertBillAndForeclose(t *testing.T) {
+	now := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+	s, card, txn := setup(t, now)
+
+	if _, err := Convert(s, card, txn, 5, now); !errors.Is(err, ErrInvalidTenure) {
+		t.Errorf("5 month tenure = %v, want ErrInvalidTenure", err)
+	}
+	plan, err := Convert(s, card, txn, 12, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Convert(s, card, txn, 12, now); !errors.Is(err, ErrAlreadyConverted) {
+		t.Errorf("converting twice = %v, want ErrAlreadyConverted", err)
+	}
+	// Only the processing fee stays on the credit line; the principal moves
+	// to the EMI loan account
+	if got := s.GetAccountBalance(card.LedgerAccountID); got != -ProcessingFee(1200000) {
+		t.Errorf("credit line after conversion = %d, want -%d", got, ProcessingFee(1200000))
+	}
+	if got := s.GetAccountBalance(card.EMIAccountID); got != -1200000 {
+		t.Errorf("EMI loans after conversion = %d, want -1200000", got)
+	}
+
+	// One installment per cycle, however often the cycle is billed
+	cycleEnd := now.AddDate(0, 1, 0)
+	for i := 0; i < 2; i++ {
+		if err := Bill(s, card, now, cycleEnd, cycleEnd); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := WithStatus(s, plan).Installments; got[0].Status != models.InstallmentBilled || got[1].Status != models.InstallmentPending {
+		t.Errorf("installment statuses = %s, %s", got[0].Status, got[1].Status)
+	}
+	firstPrincipal := ledger.ToMinor(plan.Installments[0].Principal)
+	if got := s.GetAccountBalance(card.EMIAccountID); got != -(1200000 - firstPrincipal) {
+		t.Errorf("EMI loans after one installment = %d", got)
+	}
+
+	closed, err := Foreclose(s, card, plan, cycleEnd.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	remaining := 1200000 - firstPrincipal
+	if want := ledger.ToMajor(int64(math.Round(float64(remaining) * ForeclosureFeePercent / 100))); closed.Status != models.EMIStatusForeclosed || closed.ForeclosureFee != want {
+		t.Errorf("foreclosed plan = %s with fee %v, want fee %v", closed.Status, closed.ForeclosureFee, want)
+	}
+	if got := s.GetAccountBalance(card.EMIAccountID); got != 0 {
+		t.Errorf("EMI loans after foreclosure = %d, want 0", got)
+	}
+	if _, err := Foreclose(s, card, plan, cycleEnd.Add(2*time.Hour)); !errors.Is(err, ErrPlanNotActive) {
+		t.Errorf("foreclosing twice = %v, want ErrPlanNotActive", err)
+	}
+	if got := WithStatus(s, closed).Installments[1].Status; got != models.InstallmentForeclosed {
+		t.Errorf("unbilled installment after foreclosure = %s", got)
+	}
+}
@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"bankapp-microservices/internal/activation"
+	"bankapp-microservices/internal/models"
+)
+
+// respondWithActivation writes the outcome of activating a card
+func respondWithActivation(w http.ResponseWriter, cardID string, a *models.CardActivation, err error) {
+	var locked *activation.LockedError
+	switch {
+	case err == nil:
+	case errors.Is(err, activation.ErrDetailsMismatch):
+		respondWithError(w, http.StatusBadRequest, "Card details do not match")
+		return
+	case errors.As(err, &locked):
+		respondWithLocked(w, time.Until(locked.Until), "Too many failed activation attempts, try again later")
+		return
+	case errors.Is(err, activation.ErrAlreadyActive):
+		respondWithError(w, http.StatusConflict, "Card is already active")
+		return
+	case errors.Is(err, activation.ErrNotInactive):
+		respondWithError(w, http.StatusConflict, "Card is not awaiting activation")
+		return
+	default:
+		respondWithPINError(w, cardID, nil, err, "Failed to activate card")
+		return
+	}
+
+	respondWithSuccess(w, map[string]interface{}{
+		"cardId":      cardID,
+		"status":      models.CardStatusActive,
+		"activatedAt": a.ActivatedAt,
+	}, "Card activated successfully")
+}
@@ -0,0 +1,194 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"bankapp-microservices/internal/addon"
+	"bankapp-microservices/internal/cardstatus"
+	"bankapp-microservices/internal/issuance"
+	"bankapp-microservices/internal/models"
+	"bankapp-microservices/internal/store"
+	"bankapp-microservices/internal/usage"
+	"github.com/gorilla/mux"
+)
+
+type AddonHandler struct {
+	store store.Store
+	// location defines the calendar months monthly caps apply to
+	location *time.Location
+}
+
+func NewAddonHandler(store store.Store, location *time.Location) *AddonHandler {
+	return &AddonHandler{store: store, location: location}
+}
+
+// RequestAddon issues an add-on card on the caller's credit card
+func (h *AddonHandler) RequestAddon(w http.ResponseWriter, r *http.Request) {
+	primary, ok := ownedCreditCard(w, r, h.store)
+	if !ok {
+		return
+	}
+
+	var req models.AddonCardRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	now := time.Now()
+	card, dispatch, err := addon.Issue(h.store, primary, &req, now)
+	if err != nil {
+		respondWithAddonError(w, primary, err)
+		return
+	}
+
+	respondWithSuccess(w, map[string]interface{}{
+		"requestId":             dispatch.ID,
+		"estimatedDeliveryDate": dispatch.EstimatedDelivery.Format(time.RFC3339),
+		"card":                  h.describe(card, now),
+		"dispatch":              dispatch,
+	}, "Add-on card request submitted successfully")
+}
+
+// GetAddons lists the add-ons of the caller's credit card, oldest first
+func (h *AddonHandler) GetAddons(w http.ResponseWriter, r *http.Request) {
+	primary, ok := ownedCreditCard(w, r, h.store)
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+	addons := []map[string]interface{}{}
+	for _, card := range addon.List(h.store, primary) {
+		addons = append(addons, h.describe(card, now))
+	}
+	respondWithSuccess(w, map[string]interface{}{
+		"primaryCardId": primary.ID,
+		"addons":        addons,
+	})
+}
+
+// GetAddon returns an add-on card with where its delivery has got to
+func (h *AddonHandler) GetAddon(w http.ResponseWriter, r *http.Request) {
+	_, card, ok := h.ownedAddon(w, r)
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+	result := h.describe(card, now)
+	if dispatch, exists := h.store.GetCardDispatch(card.ID); exists {
+		result["dispatch"] = issuance.Track(h.store, dispatch, now)
+	}
+	respondWithSuccess(w, result)
+}
+
+// UpdateCap sets the most an add-on card may spend in a calendar month
+func (h *AddonHandler) UpdateCap(w http.ResponseWriter, r *http.Request) {
+	primary, card, ok := h.ownedAddon(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.AddonCapRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if err := addon.SetCap(h.store, primary, card, req.MonthlyCap); err != nil {
+		respondWithAddonError(w, primary, err)
+		return
+	}
+	respondWithSuccess(w, h.describe(card, time.Now()), "Monthly cap updated successfully")
+}
+
+// UpdateStatus blocks, unblocks or closes an add-on card without affecting
+// its primary card
+func (h *AddonHandler) UpdateStatus(w http.ResponseWriter, r *http.Request) {
+	_, card, ok := h.ownedAddon(w, r)
+	if !ok {
+		return
+	}
+	changeCardStatus(w, r, h.store, card.ID, false)
+}
+
+// ownedAddon loads the caller's credit card and the add-on in the path,
+// writing the error response if either is not found
+func (h *AddonHandler) ownedAddon(w http.ResponseWriter, r *http.Request) (*models.CreditCard, *models.CreditCard, bool) {
+	primary, ok := ownedCreditCard(w, r, h.store)
+	if !ok {
+		return nil, nil, false
+	}
+
+	card, exists := h.store.GetCreditCardByID(mux.Vars(r)["addonId"])
+	if !exists || card.PrimaryCardID != primary.ID {
+		respondWithError(w, http.StatusNotFound, "Add-on card not found")
+		return nil, nil, false
+	}
+	return primary, card, true
+}
+
+// describe returns an add-on card with its CVV masked and its spend against
+// its monthly cap this month
+func (h *AddonHandler) describe(card *models.CreditCard, now time.Time) map[string]interface{} {
+	status := cardstatus.Current(card.Status, card.ExpiryMonth, card.ExpiryYear, now)
+	storedUsage, _ := h.store.GetCardUsage(card.ID)
+	spent := usage.MonthlyTotal(usage.Current(storedUsage, card.ID, now, h.location))
+
+	result := map[string]interface{}{
+		"id":              card.ID,
+		"primaryCardId":   card.PrimaryCardID,
+		"cardNumber":      card.CardNumber,
+		"cvv":             "***",
+		"expiryMonth":     card.ExpiryMonth,
+		"expiryYear":      card.ExpiryYear,
+		"cardholderName":  card.CardholderName,
+		"cardType":        card.CardType,
+		"status":          status,
+		"customerId":      card.Addon.CustomerID,
+		"dateOfBirth":     card.Addon.DateOfBirth,
+		"relationship":    card.Addon.Relationship,
+		"requestedAt":     card.Addon.RequestedAt,
+		"availableCredit": card.AvailableCredit,
+		"monthlySpent":    spent,
+	}
+	if card.Addon.MonthlyCap > 0 {
+		result["monthlyCap"] = card.Addon.MonthlyCap
+		result["monthlyCapRemaining"] = usage.Remaining(card.Addon.MonthlyCap, spent)
+	}
+	// The add-on cannot be used while its primary card is blocked or closed
+	if effective := addon.Status(h.store, card, now); effective != status {
+		result["blockedByPrimary"] = true
+	}
+	return result
+}
+
+func respondWithAddonError(w http.ResponseWriter, primary *models.CreditCard, err error) {
+	switch {
+	case errors.Is(err, addon.ErrAddonOfAddon):
+		respondWithError(w, http.StatusBadRequest, "Add-on cards cannot have add-ons")
+	case errors.Is(err, addon.ErrPrimaryUnavailable):
+		respondWithError(w, http.StatusConflict, "Add-on cards can only be requested on an active card")
+	case errors.Is(err, addon.ErrTooMany):
+		respondWithError(w, http.StatusConflict, fmt.Sprintf("A card can have at most %d add-on cards", addon.MaxPerCard))
+	case errors.Is(err, addon.ErrInvalidName):
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Name on card must be 1 to %d letters", addon.MaxNameLength))
+	case errors.Is(err, addon.ErrInvalidDateOfBirth):
+		respondWithError(w, http.StatusBadRequest, "Date of birth must be a past date in YYYY-MM-DD format")
+	case errors.Is(err, addon.ErrUnderage):
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Add-on cardholders must be at least %d years old", addon.MinimumAge))
+	case errors.Is(err, addon.ErrInvalidRelationship):
+		respondWithError(w, http.StatusBadRequest, "Invalid relationship. Must be SPOUSE, PARENT, CHILD or SIBLING")
+	case errors.Is(err, addon.ErrInvalidCap):
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Monthly cap must be between 0 and the credit limit of %.2f", primary.TotalCredit))
+	default:
+		log.Printf("addon: card %s: %v", primary.ID, err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to process add-on card request")
+	}
+}
@@ -2,21 +2,72 @@ package handlers
 
 import (
 	"encoding/json"
+	"net"
 	"net/http"
+	"net/mail"
+	"net/netip"
+	"regexp"
+	"strings"
 	"time"
 
+	"bankapp-microservices/internal/jwt"
+	"bankapp-microservices/internal/middleware"
 	"bankapp-microservices/internal/models"
+	"bankapp-microservices/internal/password"
 	"bankapp-microservices/internal/store"
+	"bankapp-microservices/internal/throttle"
+	"bankapp-microservices/internal/totp"
 
 	"github.com/google/uuid"
 )
 
+const (
+	accessTokenTTL  = time.Hour
+	refreshTokenTTL = 30 * 24 * time.Hour
+	// jwtAccessTokenTTL is shorter because a JWT stays valid until it expires,
+	// even after its session is revoked, unless sessions are checked
+	jwtAccessTokenTTL = 15 * time.Minute
+
+	// Failed password attempts: a few free tries, then lockouts doubling from
+	// one second up to 15 minutes. Counters reset after a day without failures.
+	userFreeLoginAttempts = 3
+	ipFreeLoginAttempts   = 10
+	loginBaseLockout      = time.Second
+	loginMaxLockout       = 15 * time.Minute
+	loginFailureWindow    = 24 * time.Hour
+
+	maxFullNameLength = 100
+
+	// accessTokenScope is the scope claim of JWT access tokens
+	accessTokenScope = "cards settings profile sessions"
+
+	loginChallengeTTL       = 5 * time.Minute
+	maxChallengeAttempts    = 3
+	maxSecondFactorFailures = 5
+	secondFactorLockout     = 15 * time.Minute
+)
+
+var userIDPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{3,32}$`)
+
 type AuthHandler struct {
-	store *store.Store
+	store          store.Store
+	keys           *jwt.KeySet
+	trustedProxies []netip.Prefix
+	userThrottle   *throttle.Throttle
+	ipThrottle     *throttle.Throttle
 }
 
-func NewAuthHandler(store *store.Store) *AuthHandler {
-	return &AuthHandler{store: store}
+// NewAuthHandler creates the auth handler. When keys is non-nil access tokens
+// are issued as signed JWTs instead of opaque tokens stored in the store.
+// X-Forwarded-For is only believed when it is set by one of trustedProxies.
+func NewAuthHandler(store store.Store, keys *jwt.KeySet, trustedProxies []netip.Prefix) *AuthHandler {
+	return &AuthHandler{
+		store:          store,
+		keys:           keys,
+		trustedProxies: trustedProxies,
+		userThrottle:   throttle.New(userFreeLoginAttempts, loginBaseLockout, loginMaxLockout, loginFailureWindow),
+		ipThrottle:     throttle.New(ipFreeLoginAttempts, loginBaseLockout, loginMaxLockout, loginFailureWindow),
+	}
 }
 
 func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
@@ -31,36 +82,201 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	now := time.Now()
+	userKey := req.UserID
+	ipKey := h.clientIP(r)
+	if retryAfter := maxDuration(h.userThrottle.Check(userKey, now), h.ipThrottle.Check(ipKey, now)); retryAfter > 0 {
+		respondWithLocked(w, retryAfter, "Too many failed login attempts, try again later")
+		return
+	}
+
 	user, exists := h.store.GetUserByID(req.UserID)
-	if !exists || user.Password != req.Password {
+	var passwordHash string
+	if exists {
+		passwordHash = user.PasswordHash
+	}
+	if !password.Verify(passwordHash, req.Password) {
+		lockout := maxDuration(h.userThrottle.Fail(userKey, now), h.ipThrottle.Fail(ipKey, now))
+		if lockout > 0 {
+			respondWithLocked(w, lockout, "Too many failed login attempts, try again later")
+			return
+		}
 		respondWithError(w, http.StatusUnauthorized, "Invalid credentials")
 		return
 	}
+	h.userThrottle.Reset(userKey)
+
+	if methods, required := h.secondFactorMethods(user); required {
+		// Never fall back to the password alone when a second factor is required
+		if len(methods) == 0 {
+			respondWithError(w, http.StatusForbidden, "Second factor enrollment required")
+			return
+		}
+		if isSecondFactorLocked(user) {
+			respondWithLocked(w, time.Until(user.SecondFactorLockedUntil), "Too many failed verification attempts, try again later")
+			return
+		}
+
+		challenge := &models.LoginChallenge{
+			ID:         uuid.New().String(),
+			UserID:     user.UserID,
+			Methods:    methods,
+			DeviceName: deviceName(r, req.DeviceName),
+			IPAddress:  h.clientIP(r),
+			ExpiresAt:  time.Now().Add(loginChallengeTTL),
+		}
+		h.store.SetLoginChallenge(challenge)
+
+		respondWithSuccess(w, map[string]interface{}{
+			"requiresSecondFactor": true,
+			"challengeId":          challenge.ID,
+			"methods":              challenge.Methods,
+			"expiresIn":            int(loginChallengeTTL.Seconds()),
+		}, "Second factor verification required")
+		return
+	}
+
+	h.completeLogin(w, user, deviceName(r, req.DeviceName), h.clientIP(r))
+}
+
+// VerifyOTP completes a login challenge with a TOTP code
+func (h *AuthHandler) VerifyOTP(w http.ResponseWriter, r *http.Request) {
+	var req models.VerifyOTPRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
 
-	// Generate token
-	token := uuid.New().String()
-	user.Token = token
-	user.ExpiryDate = time.Now().Add(24 * time.Hour)
-	h.store.SetToken(token, user.UserID)
+	h.verifySecondFactor(w, req.ChallengeID, models.SecondFactorOTP, func(user *models.User) bool {
+		counter, valid := totp.Validate(user.OTPSecret, req.Code, time.Now())
+		if !valid || counter <= user.LastOTPCounter {
+			return false
+		}
+		user.LastOTPCounter = counter
+		return true
+	})
+}
+
+// VerifyPIN completes a login challenge with the user's login PIN
+func (h *AuthHandler) VerifyPIN(w http.ResponseWriter, r *http.Request) {
+	var req models.VerifyPINRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	h.verifySecondFactor(w, req.ChallengeID, models.SecondFactorPIN, func(user *models.User) bool {
+		return password.Verify(user.PINHash, req.PIN)
+	})
+}
+
+// verifySecondFactor checks a login challenge with the given method, counting
+// failed attempts per challenge and per user, and completes the login on success
+func (h *AuthHandler) verifySecondFactor(w http.ResponseWriter, challengeID, method string, check func(user *models.User) bool) {
+	challenge, exists := h.store.GetLoginChallenge(challengeID)
+	if !exists || !time.Now().Before(challenge.ExpiresAt) {
+		respondWithError(w, http.StatusUnauthorized, "Invalid or expired challenge")
+		return
+	}
+
+	if !containsString(challenge.Methods, method) {
+		respondWithError(w, http.StatusBadRequest, "Verification method not allowed for this challenge")
+		return
+	}
+
+	user, exists := h.store.GetUserByID(challenge.UserID)
+	if !exists {
+		respondWithError(w, http.StatusUnauthorized, "Invalid or expired challenge")
+		return
+	}
+
+	if isSecondFactorLocked(user) {
+		h.store.DeleteLoginChallenge(challenge.ID)
+		respondWithLocked(w, time.Until(user.SecondFactorLockedUntil), "Too many failed verification attempts, try again later")
+		return
+	}
+
+	if !check(user) {
+		challenge.Attempts++
+		user.SecondFactorFailures++
+
+		if user.SecondFactorFailures >= maxSecondFactorFailures {
+			user.SecondFactorFailures = 0
+			user.SecondFactorLockedUntil = time.Now().Add(secondFactorLockout)
+			h.store.UpdateUser(user)
+			h.store.DeleteLoginChallenge(challenge.ID)
+			respondWithLocked(w, secondFactorLockout, "Too many failed verification attempts, try again later")
+			return
+		}
+		h.store.UpdateUser(user)
+
+		if challenge.Attempts >= maxChallengeAttempts {
+			h.store.DeleteLoginChallenge(challenge.ID)
+			respondWithError(w, http.StatusUnauthorized, "Too many failed attempts, please login again")
+			return
+		}
+		h.store.SetLoginChallenge(challenge)
+
+		respondWithError(w, http.StatusUnauthorized, "Invalid verification code")
+		return
+	}
+
+	user.SecondFactorFailures = 0
+	h.store.UpdateUser(user)
+	h.store.DeleteLoginChallenge(challenge.ID)
+
+	h.completeLogin(w, user, challenge.DeviceName, challenge.IPAddress)
+}
+
+// secondFactorMethods reports whether the user needs a second factor to log
+// in and which enrolled factors they can choose from
+func (h *AuthHandler) secondFactorMethods(user *models.User) ([]string, bool) {
+	required := user.RequiresOTP || user.RequiresPIN
+	if settings, exists := h.store.GetCardSettings(user.UserID); exists && settings.TwoFactorAuthenticationEnabled {
+		required = true
+	}
+	if !required {
+		return nil, false
+	}
+
+	var methods []string
+	if user.OTPSecret != "" {
+		methods = append(methods, models.SecondFactorOTP)
+	}
+	if user.PINHash != "" {
+		methods = append(methods, models.SecondFactorPIN)
+	}
+	return methods, true
+}
+
+// hasSecondFactor reports whether the user has enrolled a second factor
+func hasSecondFactor(user *models.User) bool {
+	return user.OTPSecret != "" || user.PINHash != ""
+}
+
+// completeLogin starts a new session for the user and writes the login response
+func (h *AuthHandler) completeLogin(w http.ResponseWriter, user *models.User, deviceName, ipAddress string) {
+	now := time.Now()
+	session := &models.Session{
+		ID:         uuid.New().String(),
+		UserID:     user.UserID,
+		DeviceName: deviceName,
+		IPAddress:  ipAddress,
+		IssuedAt:   now,
+		LastUsedAt: now,
+	}
+	accessToken, refreshToken, err := h.issueTokens(session)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to issue tokens")
+		return
+	}
+	user.Token = accessToken.Token
+	user.ExpiryDate = accessToken.ExpiresAt
 
 	// Format response to match Android expectations: { "user": { ... }, "tokens": { ... } }
 	loginResponse := map[string]interface{}{
-		"user": map[string]interface{}{
-			"id":              user.UserID,
-			"email":           user.Email,
-			"name":            user.FullName,
-			"createdAt":       time.Now().UnixMilli(),
-			"accountStatus":   "ACTIVE",
-			"isEmailVerified": true,
-			"isPhoneVerified": true,
-		},
-		"tokens": map[string]interface{}{
-			"accessToken":  token,
-			"refreshToken": "dummy_refresh_token",
-			"tokenType":    "Bearer",
-			"expiresIn":    86400, // 24 hours in seconds
-			"issuedAt":     time.Now().UnixMilli(),
-		},
+		"user":   userResponse(user),
+		"tokens": tokensResponse(accessToken, refreshToken),
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -68,3 +284,279 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 		respondWithError(w, http.StatusInternalServerError, "Failed to encode response")
 	}
 }
+
+// Register creates a new user account
+func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
+	var req models.RegisterRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	req.UserID = strings.TrimSpace(req.UserID)
+	req.FullName = strings.TrimSpace(req.FullName)
+	if !userIDPattern.MatchString(req.UserID) {
+		respondWithError(w, http.StatusBadRequest, "User ID must be 3 to 32 letters, digits, '.', '_' or '-'")
+		return
+	}
+
+	email, ok := normalizeEmail(req.Email)
+	if !ok {
+		respondWithError(w, http.StatusBadRequest, "Invalid email address")
+		return
+	}
+
+	if req.FullName == "" || len(req.FullName) > maxFullNameLength {
+		respondWithError(w, http.StatusBadRequest, "Full name is required and must be at most 100 characters")
+		return
+	}
+
+	req.DateOfBirth = strings.TrimSpace(req.DateOfBirth)
+	if req.DateOfBirth != "" && !validDateOfBirth(req.DateOfBirth) {
+		respondWithError(w, http.StatusBadRequest, "Date of birth must be a past date in YYYY-MM-DD format")
+		return
+	}
+
+	if err := password.CheckPolicy(req.Password, req.UserID); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid password: "+err.Error())
+		return
+	}
+
+	if _, taken := h.store.GetUserByEmail(email); taken {
+		respondWithError(w, http.StatusConflict, "Email is already registered")
+		return
+	}
+
+	passwordHash, err := password.Hash(req.Password)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to create user")
+		return
+	}
+
+	user := &models.User{
+		UserID:       req.UserID,
+		PasswordHash: passwordHash,
+		FullName:     req.FullName,
+		Email:        email,
+		PhoneNumber:  strings.TrimSpace(req.PhoneNumber),
+		DateOfBirth:  req.DateOfBirth,
+		CreatedAt:    time.Now(),
+	}
+	if !h.store.CreateUser(user) {
+		respondWithError(w, http.StatusConflict, "User ID is already taken")
+		return
+	}
+
+	respondWithSuccess(w, userResponse(user), "User registered successfully")
+}
+
+// Refresh exchanges a one-time refresh token for a new token pair. Presenting
+// a refresh token that was already used revokes the whole session.
+func (h *AuthHandler) Refresh(w http.ResponseWriter, r *http.Request) {
+	var req models.RefreshRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	refreshToken, exists := h.store.UseRefreshToken(req.RefreshToken)
+	if !exists || !time.Now().Before(refreshToken.ExpiresAt) {
+		respondWithError(w, http.StatusUnauthorized, "Invalid or expired refresh token")
+		return
+	}
+
+	if refreshToken.Used {
+		// A rotated token was replayed; assume it leaked and kill the session
+		h.store.DeleteSession(refreshToken.SessionID)
+		respondWithError(w, http.StatusUnauthorized, "Refresh token reuse detected, session revoked")
+		return
+	}
+
+	session, exists := h.store.GetSessionByID(refreshToken.SessionID)
+	if !exists {
+		respondWithError(w, http.StatusUnauthorized, "Session has been revoked")
+		return
+	}
+
+	accessToken, newRefreshToken, err := h.issueTokens(session)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to issue tokens")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{
+		"tokens": tokensResponse(accessToken, newRefreshToken),
+	}); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to encode response")
+	}
+}
+
+// Logout revokes the session the request was authenticated with
+func (h *AuthHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	sessionID := r.Context().Value(middleware.SessionIDKey).(string)
+	h.store.DeleteSession(sessionID)
+
+	respondWithSuccess(w, nil, "Logged out successfully")
+}
+
+// JWKS publishes the public keys used to sign JWT access tokens
+func (h *AuthHandler) JWKS(w http.ResponseWriter, r *http.Request) {
+	if h.keys == nil {
+		respondWithError(w, http.StatusNotFound, "JWT access tokens are not enabled")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.keys.JWKS())
+}
+
+// issueTokens creates a new access/refresh token pair for a session and extends
+// the session to the lifetime of the refresh token. Opaque access tokens are
+// stored; JWT access tokens are self-contained and never touch the store.
+func (h *AuthHandler) issueTokens(session *models.Session) (*models.AccessToken, *models.RefreshToken, error) {
+	now := time.Now()
+
+	accessToken := &models.AccessToken{
+		Token:     uuid.New().String(),
+		UserID:    session.UserID,
+		SessionID: session.ID,
+		IssuedAt:  now,
+		ExpiresAt: now.Add(accessTokenTTL),
+	}
+	if h.keys != nil {
+		accessToken.ExpiresAt = now.Add(jwtAccessTokenTTL)
+		signed, err := h.keys.Sign(&jwt.Claims{
+			ID:        accessToken.Token,
+			Issuer:    jwt.Issuer,
+			Subject:   session.UserID,
+			SessionID: session.ID,
+			Scope:     accessTokenScope,
+			IssuedAt:  now.Unix(),
+			ExpiresAt: accessToken.ExpiresAt.Unix(),
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+		accessToken.Token = signed
+	}
+	refreshToken := &models.RefreshToken{
+		Token:     uuid.New().String(),
+		UserID:    session.UserID,
+		SessionID: session.ID,
+		IssuedAt:  now,
+		ExpiresAt: now.Add(refreshTokenTTL),
+	}
+
+	session.ExpiresAt = refreshToken.ExpiresAt
+	h.store.SetSession(session)
+	if h.keys == nil {
+		h.store.SetAccessToken(accessToken)
+	}
+	h.store.SetRefreshToken(refreshToken)
+	return accessToken, refreshToken, nil
+}
+
+// userResponse formats a user the way the Android client expects
+func userResponse(user *models.User) map[string]interface{} {
+	return map[string]interface{}{
+		"id":              user.UserID,
+		"email":           user.Email,
+		"name":            user.FullName,
+		"phoneNumber":     user.PhoneNumber,
+		"dateOfBirth":     user.DateOfBirth,
+		"createdAt":       user.CreatedAt.UnixMilli(),
+		"accountStatus":   "ACTIVE",
+		"isEmailVerified": true,
+		"isPhoneVerified": true,
+		"requiresPIN":     user.RequiresPIN,
+		"requiresOTP":     user.RequiresOTP,
+	}
+}
+
+func tokensResponse(accessToken *models.AccessToken, refreshToken *models.RefreshToken) map[string]interface{} {
+	return map[string]interface{}{
+		"accessToken":  accessToken.Token,
+		"refreshToken": refreshToken.Token,
+		"tokenType":    "Bearer",
+		"expiresIn":    int(accessToken.ExpiresAt.Sub(accessToken.IssuedAt).Seconds()),
+		"issuedAt":     accessToken.IssuedAt.UnixMilli(),
+	}
+}
+
+// clientIP returns the originating client address. X-Forwarded-For is
+// honoured only when the request comes from a trusted proxy, and then the
+// address is the last hop that was not itself added by a trusted proxy, so a
+// client cannot pick its own address by sending the header.
+func (h *AuthHandler) clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if !h.trustedProxy(host) {
+		return host
+	}
+
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if _, err := netip.ParseAddr(hop); err != nil {
+			break
+		}
+		host = hop
+		if !h.trustedProxy(hop) {
+			break
+		}
+	}
+	return host
+}
+
+// trustedProxy reports whether ip belongs to one of the trusted proxies
+func (h *AuthHandler) trustedProxy(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range h.trustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// deviceName returns the device name sent by the client, falling back to its User-Agent
+func deviceName(r *http.Request, requested string) string {
+	if requested != "" {
+		return requested
+	}
+	return r.UserAgent()
+}
+
+func isSecondFactorLocked(user *models.User) bool {
+	return time.Now().Before(user.SecondFactorLockedUntil)
+}
+
+func maxDuration(a, b time.Duration) time.Duration {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// normalizeEmail validates a bare email address and returns it trimmed
+func normalizeEmail(email string) (string, bool) {
+	email = strings.TrimSpace(email)
+	address, err := mail.ParseAddress(email)
+	if err != nil || address.Address != email {
+		return "", false
+	}
+	return email, true
+}
+
+// validDateOfBirth reports whether dateOfBirth is a past date in YYYY-MM-DD format
+func validDateOfBirth(dateOfBirth string) bool {
+	born, err := time.Parse("2006-01-02", dateOfBirth)
+	return err == nil && born.Year() >= 1900 && born.Before(time.Now())
+}
@@ -0,0 +1,174 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	"bankapp-microservices/internal/middleware"
+	"bankapp-microservices/internal/models"
+	"bankapp-microservices/internal/store"
+)
+
+// call sends body as JSON to handler, authenticated as userID unless it is
+// empty, and decodes the JSON response
+func call(t *testing.T, handler http.HandlerFunc, body interface{}, userID string) (int, map[string]interface{}) {
+	t.Helper()
+	payload, err := json.Marshal(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(payload))
+	r.RemoteAddr = "192.0.2.1:1234"
+	if userID != "" {
+		r = r.WithContext(context.WithValue(r.Context(), middleware.UserIDKey, userID))
+	}
+	w := httptest.NewRecorder()
+	handler(w, r)
+
+	var response map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("response is not JSON: %s", w.Body.String())
+	}
+	return w.Code, response
+}
+
+// field walks nested JSON objects along path
+func field(response map[string]interface{}, path ...string) interface{} {
+	var value interface{} = response
+	for _, key := range path {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		value = object[key]
+	}
+	return value
+}
+
+func login(t *testing.T, h *AuthHandler) (int, map[string]interface{}) {
+	t.Helper()
+	return call(t, h.Login, models.LoginRequest{UserID: "testuser", Password: "password123"}, "")
+}
+
+func TestLoginRefusesUnenrolledSecondFactor(t *testing.T) {
+	s := store.NewMemoryStore()
+	settings, _ := s.GetCardSettings("testuser")
+	settings.TwoFactorAuthenticationEnabled = true
+	s.UpdateCardSettings(settings)
+
+	code, response := login(t, NewAuthHandler(s, nil, nil))
+	if code != http.StatusForbidden {
+		t.Fatalf("login = %d %v, want 403", code, response)
+	}
+	if field(response, "tokens") != nil {
+		t.Error("login issued tokens without a second factor")
+	}
+}
+
+func TestSettingsRefuseTwoFactorWithoutEnrollment(t *testing.T) {
+	s := store.NewMemoryStore()
+	enabled := true
+	code, _ := call(t, NewSettingsHandler(s).UpdateAuthenticationSettings, models.AuthenticationSettingsRequest{TwoFactorAuthenticationEnabled: &enabled}, "testuser")
+	if code != http.StatusConflict {
+		t.Errorf("enabling two-factor without a factor = %d, want 409", code)
+	}
+}
+
+func TestLoginPIN(t *testing.T) {
+	s := store.NewMemoryStore()
+	auth := NewAuthHandler(s, nil, nil)
+	twoFactor := NewTwoFactorHandler(s)
+
+	for _, weak := range []string{"1234", "0000", "121212", "1972", "190272"} {
+		if code, _ := call(t, twoFactor.SetLoginPIN, models.LoginPINRequest{PIN: weak, ConfirmPIN: weak}, "testuser"); code != http.StatusBadRequest {
+			t.Errorf("SetLoginPIN(%s) = %d, want 400", weak, code)
+		}
+	}
+	if code, response := call(t, twoFactor.SetLoginPIN, models.LoginPINRequest{PIN: "48213", ConfirmPIN: "48213"}, "testuser"); code != http.StatusOK {
+		t.Fatalf("SetLoginPIN = %d %v", code, response)
+	}
+	user, _ := s.GetUserByID("testuser")
+	if user.PINHash == "" || user.PINHash == "48213" {
+		t.Fatalf("PIN is stored as %q, want a hash", user.PINHash)
+	}
+
+	code, response := login(t, auth)
+	challengeID, _ := field(response, "data", "challengeId").(string)
+	if code != http.StatusOK || challengeID == "" {
+		t.Fatalf("login = %d %v, want a challenge", code, response)
+	}
+	if code, _ := call(t, auth.VerifyPIN, models.VerifyPINRequest{ChallengeID: challengeID, PIN: "48214"}, ""); code != http.StatusUnauthorized {
+		t.Errorf("wrong PIN = %d, want 401", code)
+	}
+	code, response = call(t, auth.VerifyPIN, models.VerifyPINRequest{ChallengeID: challengeID, PIN: "48213"}, "")
+	if code != http.StatusOK || field(response, "tokens", "accessToken") == nil {
+		t.Errorf("right PIN = %d %v, want tokens", code, response)
+	}
+}
+
+func TestRefreshTokenRotation(t *testing.T) {
+	s := store.NewMemoryStore()
+	auth := NewAuthHandler(s, nil, nil)
+
+	code, response := login(t, auth)
+	first, _ := field(response, "tokens", "refreshToken").(string)
+	if code != http.StatusOK || first == "" {
+		t.Fatalf("login = %d %v", code, response)
+	}
+
+	code, response = call(t, auth.Refresh, models.RefreshRequest{RefreshToken: first}, "")
+	second, _ := field(response, "tokens", "refreshToken").(string)
+	if code != http.StatusOK || second == "" || second == first {
+		t.Fatalf("refresh = %d %v, want a new refresh token", code, response)
+	}
+	access, _ := field(response, "tokens", "accessToken").(string)
+	if _, exists := s.GetUserByToken(access); !exists {
+		t.Error("rotated access token does not authenticate")
+	}
+
+	// Replaying the first token revokes the session and every token in it
+	if code, _ := call(t, auth.Refresh, models.RefreshRequest{RefreshToken: first}, ""); code != http.StatusUnauthorized {
+		t.Errorf("replayed refresh = %d, want 401", code)
+	}
+	if code, _ := call(t, auth.Refresh, models.RefreshRequest{RefreshToken: second}, ""); code != http.StatusUnauthorized {
+		t.Errorf("refresh after reuse = %d, want 401", code)
+	}
+	if _, exists := s.GetUserByToken(access); exists {
+		t.Error("access token survived refresh token reuse")
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	h := NewAuthHandler(store.NewMemoryStore(), nil, []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")})
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  string
+		want       string
+	}{
+		{"direct", "192.0.2.1:1234", "", "192.0.2.1"},
+		{"spoofed header from client", "192.0.2.1:1234", "203.0.113.9", "192.0.2.1"},
+		{"trusted proxy", "10.0.0.1:1234", "203.0.113.9", "203.0.113.9"},
+		{"client-supplied hop before proxy", "10.0.0.1:1234", "198.51.100.7, 203.0.113.9", "203.0.113.9"},
+		{"chain of trusted proxies", "10.0.0.1:1234", "203.0.113.9, 10.0.0.2", "203.0.113.9"},
+		{"garbage hop", "10.0.0.1:1234", "not-an-ip", "10.0.0.1"},
+		{"trusted proxy without header", "10.0.0.1:1234", "", "10.0.0.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			if tt.forwarded != "" {
+				r.Header.Set("X-Forwarded-For", tt.forwarded)
+			}
+			if got := h.clientIP(r); got != tt.want {
+				t.Errorf("clientIP = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
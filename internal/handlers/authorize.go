@@ -0,0 +1,281 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"bankapp-microservices/internal/addon"
+	"bankapp-microservices/internal/authorization"
+	"bankapp-microservices/internal/cardpin"
+	"bankapp-microservices/internal/cardstatus"
+	"bankapp-microservices/internal/ledger"
+	"bankapp-microservices/internal/middleware"
+	"bankapp-microservices/internal/models"
+	"bankapp-microservices/internal/rewards"
+	"bankapp-microservices/internal/store"
+	"bankapp-microservices/internal/usage"
+	"github.com/gorilla/mux"
+)
+
+var (
+	currencyPattern = regexp.MustCompile(`^[A-Z]{3}$`)
+	countryPattern  = regexp.MustCompile(`^[A-Z]{2}$`)
+)
+
+type AuthorizationHandler struct {
+	store store.Store
+	// location defines the calendar days and months limit usage resets on
+	location *time.Location
+	// mu serializes authorizations so concurrent requests cannot overspend a card
+	mu sync.Mutex
+}
+
+func NewAuthorizationHandler(store store.Store, location *time.Location) *AuthorizationHandler {
+	return &AuthorizationHandler{store: store, location: location}
+}
+
+// Authorize approves or declines a card transaction and records the outcome
+func (h *AuthorizationHandler) Authorize(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	cardID := vars["cardId"]
+
+	var req models.AuthorizationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	req.Channel = strings.ToUpper(strings.TrimSpace(req.Channel))
+	req.Currency = strings.ToUpper(strings.TrimSpace(req.Currency))
+	req.Country = strings.ToUpper(strings.TrimSpace(req.Country))
+	req.Category = strings.ToUpper(strings.TrimSpace(req.Category))
+	if req.Currency == "" {
+		req.Currency = "INR"
+	}
+	if req.Country == "" {
+		req.Country = authorization.HomeCountry
+	}
+
+	if _, ok := authorization.LimitType(req.Channel); !ok {
+		respondWithError(w, http.StatusBadRequest, "Invalid channel. Must be ONLINE, ATM, POS or CONTACTLESS")
+		return
+	}
+	// Amounts that round to nothing in paise cannot be posted to the ledger
+	if ledger.ToMinor(req.Amount) <= 0 {
+		respondWithError(w, http.StatusBadRequest, "Amount must be at least 0.01")
+		return
+	}
+	if !currencyPattern.MatchString(req.Currency) {
+		respondWithError(w, http.StatusBadRequest, "Currency must be an ISO 4217 code")
+		return
+	}
+	if !countryPattern.MatchString(req.Country) {
+		respondWithError(w, http.StatusBadRequest, "Country must be an ISO 3166 alpha-2 code")
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	card, cardUserID, exists := h.lookupCard(cardID)
+	if !exists {
+		respondWithError(w, http.StatusNotFound, "Card not found")
+		return
+	}
+
+	userID := r.Context().Value(middleware.UserIDKey).(string)
+	if cardUserID != userID {
+		respondWithError(w, http.StatusForbidden, "Access denied")
+		return
+	}
+
+	settings, _ := h.store.GetCardSettings(userID)
+	limits, _ := h.store.GetCardLimits(cardID)
+	storedUsage, _ := h.store.GetCardUsage(cardID)
+	now := time.Now()
+	cardUsage := usage.Current(storedUsage, cardID, now, h.location)
+	decision := authorization.Evaluate(authorization.Input{
+		Card:     card,
+		Settings: settings,
+		Limits:   limits,
+		Defaults: defaultLimits(),
+		Usage:    cardUsage,
+		Request:  &req,
+		Now:      now,
+	})
+
+	txn := &models.Transaction{
+		ID:            models.GenerateID(),
+		CardID:        cardID,
+		Amount:        req.Amount,
+		Merchant:      req.Merchant,
+		Date:          now,
+		Status:        models.TransactionStatusDeclined,
+		Type:          models.TransactionTypePurchase,
+		Channel:       req.Channel,
+		Currency:      req.Currency,
+		Country:       req.Country,
+		DeclineReason: decision.Reason,
+		Category:      req.Category,
+	}
+	if req.Channel == models.ChannelATM {
+		txn.Type = models.TransactionTypeCashWithdrawal
+	}
+	if decision.Approved {
+		// The ledger has the last word on funds, as other requests may have
+		// drawn on the account since the card was looked up
+		err := h.debitCard(cardID, card.Kind, txn)
+		if errors.Is(err, ledger.ErrInsufficientFunds) {
+			decision = authorization.Decision{Reason: authorization.ReasonInsufficientFunds, Message: "Insufficient funds"}
+			txn.DeclineReason = decision.Reason
+		} else if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Failed to post transaction")
+			return
+		}
+	}
+	if decision.Approved {
+		txn.Status = models.TransactionStatusApproved
+
+		// Posting settles the transaction, so it earns points now
+		if creditCard, exists := h.rewardsCard(cardID); exists {
+			rewards.Accrue(h.store, creditCard, txn)
+		}
+
+		limitType, _ := authorization.LimitType(req.Channel)
+		usage.Record(cardUsage, usage.Key(limitType, authorization.IsInternational(&req)), req.Amount)
+		h.store.SetCardUsage(cardUsage)
+	}
+	h.store.AddTransaction(txn)
+
+	respondWithSuccess(w, models.AuthorizationResult{
+		TransactionID: txn.ID,
+		CardID:        cardID,
+		Approved:      decision.Approved,
+		DeclineReason: decision.Reason,
+		Message:       decision.Message,
+		Amount:        req.Amount,
+		Currency:      req.Currency,
+	}, decision.Message)
+}
+
+// VerifyPIN checks the PIN of a credit or debit card, as a terminal does
+// before a PIN transaction. Wrong attempts count towards blocking the PIN.
+func (h *AuthorizationHandler) VerifyPIN(w http.ResponseWriter, r *http.Request) {
+	cardID := mux.Vars(r)["cardId"]
+
+	var req models.VerifyCardPINRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	card, cardUserID, exists := h.lookupCard(cardID)
+	if !exists {
+		respondWithError(w, http.StatusNotFound, "Card not found")
+		return
+	}
+
+	userID := r.Context().Value(middleware.UserIDKey).(string)
+	if cardUserID != userID {
+		respondWithError(w, http.StatusForbidden, "Access denied")
+		return
+	}
+
+	if card.Kind == authorization.KindVirtual {
+		respondWithError(w, http.StatusBadRequest, "Virtual cards do not have a PIN")
+		return
+	}
+
+	if pin, err := cardpin.Verify(h.store, cardID, req.PIN, time.Now()); err != nil {
+		respondWithPINError(w, cardID, pin, err, "Failed to verify PIN")
+		return
+	}
+	respondWithSuccess(w, map[string]interface{}{
+		"cardId":   cardID,
+		"verified": true,
+	}, "PIN verified")
+}
+
+// lookupCard finds a credit, debit or virtual card and returns its state and owner
+func (h *AuthorizationHandler) lookupCard(cardID string) (authorization.Card, string, bool) {
+	if card, exists := h.store.GetCreditCardByID(cardID); exists {
+		var monthlyCap float64
+		if card.Addon != nil {
+			monthlyCap = card.Addon.MonthlyCap
+		}
+		return authorization.Card{
+			Kind:        authorization.KindCredit,
+			Status:      addon.Status(h.store, card, time.Now()),
+			ExpiryMonth: card.ExpiryMonth,
+			ExpiryYear:  card.ExpiryYear,
+			Available:   card.AvailableCredit,
+			MonthlyCap:  monthlyCap,
+			PINBlocked:  card.PIN != nil && card.PIN.BlockedAt != nil,
+		}, card.UserID, true
+	}
+	if card, exists := h.store.GetDebitCardByID(cardID); exists {
+		return authorization.Card{
+			Kind:        authorization.KindDebit,
+			Status:      cardstatus.Current(card.Status, card.ExpiryMonth, card.ExpiryYear, time.Now()),
+			ExpiryMonth: card.ExpiryMonth,
+			ExpiryYear:  card.ExpiryYear,
+			Available:   card.AccountBalance,
+			PINBlocked:  card.PIN != nil && card.PIN.BlockedAt != nil,
+		}, card.UserID, true
+	}
+	if card, exists := h.store.GetVirtualCardByID(cardID); exists {
+		return authorization.Card{
+			Kind:        authorization.KindVirtual,
+			Status:      cardstatus.Current(card.Status, card.ExpiryMonth, card.ExpiryYear, time.Now()),
+			ExpiryMonth: card.ExpiryMonth,
+			ExpiryYear:  card.ExpiryYear,
+			Available:   card.RemainingBalance,
+		}, card.UserID, true
+	}
+	return authorization.Card{}, "", false
+}
+
+// rewardsCard returns the credit card that earns points for transactions on
+// cardID: the card itself, or an add-on's primary card
+func (h *AuthorizationHandler) rewardsCard(cardID string) (*models.CreditCard, bool) {
+	card, exists := h.store.GetCreditCardByID(cardID)
+	if exists && card.PrimaryCardID != "" {
+		return h.store.GetCreditCardByID(card.PrimaryCardID)
+	}
+	return card, exists
+}
+
+// ledgerAccount returns the ledger account behind a card of the given kind
+func (h *AuthorizationHandler) ledgerAccount(cardID, kind string) string {
+	switch kind {
+	case authorization.KindCredit:
+		card, _ := h.store.GetCreditCardByID(cardID)
+		return card.LedgerAccountID
+	case authorization.KindDebit:
+		card, _ := h.store.GetDebitCardByID(cardID)
+		return card.LedgerAccountID
+	default:
+		card, _ := h.store.GetVirtualCardByID(cardID)
+		return card.LedgerAccountID
+	}
+}
+
+// debitCard posts an approved transaction to the card's ledger account. Cash
+// withdrawals settle against the ATM cash account, everything else against
+// merchant settlement.
+func (h *AuthorizationHandler) debitCard(cardID, kind string, txn *models.Transaction) error {
+	settlement := ledger.AccountMerchantSettlement
+	if txn.Channel == models.ChannelATM {
+		settlement = ledger.AccountATMCash
+	}
+	description := txn.Merchant
+	if description == "" {
+		description = txn.Type
+	}
+	return h.store.PostJournalEntry(ledger.Transfer(h.ledgerAccount(cardID, kind), settlement, ledger.ToMinor(txn.Amount), description, txn.ID, txn.Date))
+}
@@ -0,0 +1,26 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"bankapp-microservices/internal/models"
+	"bankapp-microservices/internal/store"
+)
+
+func TestAuthorizeRejectsAmountsBelowOnePaisa(t *testing.T) {
+	s := store.NewMemoryStore()
+	card := s.GetDebitCardsByUserID("testuser")[0]
+	authorize := withVars(NewAuthorizationHandler(s, time.UTC).Authorize, map[string]string{"cardId": card.ID})
+
+	for _, amount := range []float64{0, -5, 0.004} {
+		req := models.AuthorizationRequest{Channel: models.ChannelOnline, Amount: amount, Merchant: "Shop"}
+		if code, response := call(t, authorize, req, "testuser"); code != http.StatusBadRequest {
+			t.Errorf("amount %v = %d %v, want 400", amount, code, response)
+		}
+	}
+	if txns := s.GetTransactionsByCardID(card.ID); len(txns) != 0 {
+		t.Errorf("rejected requests recorded %d transactions", len(txns))
+	}
+}
@@ -2,9 +2,15 @@ package handlers
 
 import (
 	"encoding/json"
+	"math"
 	"net/http"
+	"strconv"
+	"time"
 
+	"bankapp-microservices/internal/middleware"
 	"bankapp-microservices/internal/models"
+	"bankapp-microservices/internal/store"
+	"github.com/gorilla/mux"
 )
 
 func respondWithSuccess(w http.ResponseWriter, data interface{}, message ...string) {
@@ -27,3 +33,65 @@ func respondWithError(w http.ResponseWriter, code int, message string) {
 		Message: message,
 	})
 }
+
+// respondWithLocked writes a 423 Locked response telling the client when it may retry
+func respondWithLocked(w http.ResponseWriter, retryAfter time.Duration, message string) {
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	w.WriteHeader(http.StatusLocked)
+	json.NewEncoder(w).Encode(models.Response{
+		Success: false,
+		Message: message,
+		Data: map[string]interface{}{
+			"retryAfter":  seconds,
+			"lockedUntil": time.Now().Add(retryAfter).UnixMilli(),
+		},
+	})
+}
+
+// ownedCreditCard loads the credit card in the path and checks it belongs to
+// the caller, writing the error response if not
+func ownedCreditCard(w http.ResponseWriter, r *http.Request, s store.Store) (*models.CreditCard, bool) {
+	card, exists := s.GetCreditCardByID(mux.Vars(r)["cardId"])
+	if !exists {
+		respondWithError(w, http.StatusNotFound, "Credit card not found")
+		return nil, false
+	}
+
+	userID := r.Context().Value(middleware.UserIDKey).(string)
+	if card.UserID != userID {
+		respondWithError(w, http.StatusForbidden, "Access denied")
+		return nil, false
+	}
+	return card, true
+}
+
+// billedCreditCard is ownedCreditCard for the billing endpoints, which
+// add-on cards leave to their primary card
+func billedCreditCard(w http.ResponseWriter, r *http.Request, s store.Store) (*models.CreditCard, bool) {
+	card, ok := ownedCreditCard(w, r, s)
+	if !ok || rejectAddon(w, card) {
+		return nil, false
+	}
+	return card, true
+}
+
+// rejectAddon writes an error and returns true if card is an add-on, whose
+// statements, payments, autopay, EMI and rewards belong to its primary card
+func rejectAddon(w http.ResponseWriter, card *models.CreditCard) bool {
+	if card.PrimaryCardID == "" {
+		return false
+	}
+	respondWithError(w, http.StatusBadRequest, "Add-on cards are billed through their primary card")
+	return true
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -2,21 +2,32 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
+	"log"
 	"net/http"
+	"strings"
 	"time"
 
+	"bankapp-microservices/internal/activation"
+	autopayment "bankapp-microservices/internal/autopay"
+	"bankapp-microservices/internal/cardstatus"
 	"bankapp-microservices/internal/middleware"
 	"bankapp-microservices/internal/models"
+	"bankapp-microservices/internal/payment"
+	"bankapp-microservices/internal/pricing"
+	"bankapp-microservices/internal/replacement"
+	"bankapp-microservices/internal/statement"
 	"bankapp-microservices/internal/store"
-	"github.com/gorilla/mux"
 )
 
 type CreditCardHandler struct {
-	store *store.Store
+	store store.Store
+	// location defines the midnight billing cycles close at
+	location *time.Location
 }
 
-func NewCreditCardHandler(store *store.Store) *CreditCardHandler {
-	return &CreditCardHandler{store: store}
+func NewCreditCardHandler(store store.Store, location *time.Location) *CreditCardHandler {
+	return &CreditCardHandler{store: store, location: location}
 }
 
 func (h *CreditCardHandler) GetCreditCards(w http.ResponseWriter, r *http.Request) {
@@ -24,8 +35,13 @@ func (h *CreditCardHandler) GetCreditCards(w http.ResponseWriter, r *http.Reques
 	cards := h.store.GetCreditCardsByUserID(userID)
 
 	// Mask CVV and card number
+	now := time.Now()
 	var maskedCards []interface{}
 	for _, card := range cards {
+		// Add-ons are listed under their primary card
+		if card.PrimaryCardID != "" {
+			continue
+		}
 		maskedCard := map[string]interface{}{
 			"id":             card.ID,
 			"cardNumber":     card.CardNumber,
@@ -35,6 +51,7 @@ func (h *CreditCardHandler) GetCreditCards(w http.ResponseWriter, r *http.Reques
 			"cardholderName": card.CardholderName,
 			"cardType":       card.CardType,
 			"rewardsPoints":  card.RewardsPoints,
+			"status":         cardstatus.Current(card.Status, card.ExpiryMonth, card.ExpiryYear, now),
 		}
 		maskedCards = append(maskedCards, maskedCard)
 	}
@@ -43,40 +60,29 @@ func (h *CreditCardHandler) GetCreditCards(w http.ResponseWriter, r *http.Reques
 }
 
 func (h *CreditCardHandler) GetCreditCard(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	cardID := vars["cardId"]
-
-	card, exists := h.store.GetCreditCardByID(cardID)
-	if !exists {
-		respondWithError(w, http.StatusNotFound, "Credit card not found")
-		return
-	}
-
-	userID := r.Context().Value(middleware.UserIDKey).(string)
-	if card.UserID != userID {
-		respondWithError(w, http.StatusForbidden, "Access denied")
+	card, ok := ownedCreditCard(w, r, h.store)
+	if !ok {
 		return
 	}
 
+	// Reads never post charges; due cycles are closed by the scheduler and
+	// before payments
+	now := time.Now()
 	card.CVV = "***"
-	respondWithSuccess(w, card)
+	card.Status = cardstatus.Current(card.Status, card.ExpiryMonth, card.ExpiryYear, now)
+	respondWithSuccess(w, models.CreditCardDetail{
+		CreditCard: card,
+		Pricing:    pricing.ForCard(card),
+		Billing:    statement.Summary(h.store, card, now, h.location),
+	})
 }
 
 func (h *CreditCardHandler) UpdateLimits(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	cardID := vars["cardId"]
-
-	card, exists := h.store.GetCreditCardByID(cardID)
-	if !exists {
-		respondWithError(w, http.StatusNotFound, "Credit card not found")
-		return
-	}
-
-	userID := r.Context().Value(middleware.UserIDKey).(string)
-	if card.UserID != userID {
-		respondWithError(w, http.StatusForbidden, "Access denied")
+	card, ok := ownedCreditCard(w, r, h.store)
+	if !ok {
 		return
 	}
+	cardID := card.ID
 
 	var req models.LimitsRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -93,35 +99,33 @@ func (h *CreditCardHandler) UpdateLimits(w http.ResponseWriter, r *http.Request)
 }
 
 func (h *CreditCardHandler) EnableAutopay(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	cardID := vars["cardId"]
-
-	card, exists := h.store.GetCreditCardByID(cardID)
-	if !exists {
-		respondWithError(w, http.StatusNotFound, "Credit card not found")
-		return
-	}
-
-	userID := r.Context().Value(middleware.UserIDKey).(string)
-	if card.UserID != userID {
-		respondWithError(w, http.StatusForbidden, "Access denied")
+	card, ok := billedCreditCard(w, r, h.store)
+	if !ok {
 		return
 	}
+	cardID := card.ID
 
 	var req models.AutopayRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		respondWithError(w, http.StatusBadRequest, "Invalid request body")
 		return
 	}
+	if req.AmountOption == nil || req.LinkedAccountID == nil {
+		respondWithError(w, http.StatusBadRequest, "amountOption and linkedAccountId are required")
+		return
+	}
 
 	autopay := &models.Autopay{
-		ID:              models.GenerateID(),
-		CardID:          cardID,
-		AmountOption:    req.AmountOption,
-		LinkedAccountID: req.LinkedAccountID,
-		AutoPayEnabled:  req.AutoPayEnabled,
-		ActivationDate:  time.Now(),
-		UserID:          userID,
+		ID:             models.GenerateID(),
+		CardID:         cardID,
+		AutoPayEnabled: true,
+		ActivationDate: time.Now(),
+		UserID:         card.UserID,
+	}
+	applyAutopayRequest(autopay, &req)
+	if msg := autopayment.Validate(h.store, autopay); msg != "" {
+		respondWithError(w, http.StatusBadRequest, msg)
+		return
 	}
 
 	h.store.SetAutopay(autopay)
@@ -129,23 +133,15 @@ func (h *CreditCardHandler) EnableAutopay(w http.ResponseWriter, r *http.Request
 	respondWithSuccess(w, autopay, "Autopay enabled successfully")
 }
 
+// UpdateAutopay changes only the fields present in the request
 func (h *CreditCardHandler) UpdateAutopay(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	cardID := vars["cardId"]
-
-	card, exists := h.store.GetCreditCardByID(cardID)
-	if !exists {
-		respondWithError(w, http.StatusNotFound, "Credit card not found")
+	card, ok := billedCreditCard(w, r, h.store)
+	if !ok {
 		return
 	}
+	cardID := card.ID
 
-	userID := r.Context().Value(middleware.UserIDKey).(string)
-	if card.UserID != userID {
-		respondWithError(w, http.StatusForbidden, "Access denied")
-		return
-	}
-
-	autopay, exists := h.store.GetAutopayByCardID(cardID)
+	existing, exists := h.store.GetAutopayByCardID(cardID)
 	if !exists {
 		respondWithError(w, http.StatusNotFound, "Autopay not found")
 		return
@@ -157,100 +153,263 @@ func (h *CreditCardHandler) UpdateAutopay(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	autopay.AmountOption = req.AmountOption
-	autopay.LinkedAccountID = req.LinkedAccountID
-	if req.AutoPayEnabled {
-		autopay.AutoPayEnabled = req.AutoPayEnabled
+	// Work on a copy so a rejected update leaves the stored settings alone
+	autopay := *existing
+	applyAutopayRequest(&autopay, &req)
+	if msg := autopayment.Validate(h.store, &autopay); msg != "" {
+		respondWithError(w, http.StatusBadRequest, msg)
+		return
 	}
 
-	h.store.SetAutopay(autopay)
+	h.store.SetAutopay(&autopay)
 
-	respondWithSuccess(w, nil, "Autopay settings updated successfully")
+	respondWithSuccess(w, &autopay, "Autopay settings updated successfully")
 }
 
-func (h *CreditCardHandler) DisableAutopay(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	cardID := vars["cardId"]
+// applyAutopayRequest copies the fields present in req onto autopay. Amount
+// and percent are dropped when the option no longer uses them.
+func applyAutopayRequest(autopay *models.Autopay, req *models.AutopayRequest) {
+	if req.AmountOption != nil {
+		autopay.AmountOption = *req.AmountOption
+		if option, ok := autopayment.ParseOption(*req.AmountOption); ok {
+			autopay.AmountOption = option
+		}
+	}
+	if req.Amount != nil {
+		autopay.Amount = *req.Amount
+	}
+	if req.Percent != nil {
+		autopay.Percent = *req.Percent
+	}
+	if req.LinkedAccountID != nil {
+		autopay.LinkedAccountID = *req.LinkedAccountID
+	}
+	if req.AutoPayEnabled != nil {
+		autopay.AutoPayEnabled = *req.AutoPayEnabled
+	}
+	if req.ExecutionDay != nil {
+		autopay.ExecutionDay = *req.ExecutionDay
+	}
 
-	card, exists := h.store.GetCreditCardByID(cardID)
-	if !exists {
-		respondWithError(w, http.StatusNotFound, "Credit card not found")
-		return
+	if autopay.AmountOption != models.AutopayFixed {
+		autopay.Amount = 0
+	}
+	if autopay.AmountOption != models.AutopayPercent {
+		autopay.Percent = 0
 	}
+}
 
-	userID := r.Context().Value(middleware.UserIDKey).(string)
-	if card.UserID != userID {
-		respondWithError(w, http.StatusForbidden, "Access denied")
+func (h *CreditCardHandler) DisableAutopay(w http.ResponseWriter, r *http.Request) {
+	card, ok := billedCreditCard(w, r, h.store)
+	if !ok {
 		return
 	}
+	cardID := card.ID
 
 	h.store.DeleteAutopay(cardID)
 
 	respondWithSuccess(w, nil, "Autopay disabled successfully")
 }
 
-func (h *CreditCardHandler) UpdatePIN(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	cardID := vars["cardId"]
+// GetAutopayHistory lists the card's autopay attempts, newest first
+func (h *CreditCardHandler) GetAutopayHistory(w http.ResponseWriter, r *http.Request) {
+	card, ok := billedCreditCard(w, r, h.store)
+	if !ok {
+		return
+	}
+	cardID := card.ID
 
-	card, exists := h.store.GetCreditCardByID(cardID)
-	if !exists {
-		respondWithError(w, http.StatusNotFound, "Credit card not found")
+	executions := h.store.GetAutopayExecutionsByCardID(cardID)
+	history := make([]*models.AutopayExecution, 0, len(executions))
+	for i := len(executions) - 1; i >= 0; i-- {
+		history = append(history, executions[i])
+	}
+
+	respondWithSuccess(w, map[string]interface{}{
+		"cardId":  cardID,
+		"history": history,
+	})
+}
+
+// MakePayment pays the card's bill from one of the user's debit accounts.
+// Requests must carry an Idempotency-Key header; retrying with the same key
+// returns the original receipt without paying again.
+func (h *CreditCardHandler) MakePayment(w http.ResponseWriter, r *http.Request) {
+	card, ok := billedCreditCard(w, r, h.store)
+	if !ok {
 		return
 	}
+	cardID := card.ID
 
-	userID := r.Context().Value(middleware.UserIDKey).(string)
-	if card.UserID != userID {
-		respondWithError(w, http.StatusForbidden, "Access denied")
+	key := strings.TrimSpace(r.Header.Get("Idempotency-Key"))
+	if key == "" || len(key) > 255 {
+		respondWithError(w, http.StatusBadRequest, "Idempotency-Key header is required (at most 255 characters)")
 		return
 	}
 
-	var req models.PINUpdateRequest
+	var req models.PaymentRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		respondWithError(w, http.StatusBadRequest, "Invalid request body")
 		return
 	}
+	if req.FromAccountID == "" {
+		respondWithError(w, http.StatusBadRequest, "fromAccountId is required")
+		return
+	}
 
-	if req.NewPIN != req.ConfirmPIN {
-		respondWithError(w, http.StatusBadRequest, "PINs do not match")
+	// Post any interest and fees due so the payment is applied to them
+	now := time.Now()
+	statement.CloseCycles(h.store, card, now, h.location)
+
+	receipt, replayed, err := payment.Pay(h.store, card, &req, key, now)
+	switch {
+	case err == nil:
+	case errors.Is(err, payment.ErrKeyReused):
+		respondWithError(w, http.StatusConflict, "Idempotency-Key was already used for a different payment")
+		return
+	case errors.Is(err, payment.ErrInvalidType):
+		respondWithError(w, http.StatusBadRequest, "Invalid paymentType. Must be FULL or PARTIAL")
+		return
+	case errors.Is(err, payment.ErrInvalidAmount):
+		respondWithError(w, http.StatusBadRequest, "Amount must be greater than zero")
+		return
+	case errors.Is(err, payment.ErrNothingOwed):
+		respondWithError(w, http.StatusBadRequest, "Card has no outstanding balance")
+		return
+	case errors.Is(err, payment.ErrExceedsBalance):
+		respondWithError(w, http.StatusBadRequest, "Amount exceeds the outstanding balance")
+		return
+	case errors.Is(err, payment.ErrAccountNotFound):
+		respondWithError(w, http.StatusBadRequest, "fromAccountId must be one of your debit card accounts")
+		return
+	case errors.Is(err, payment.ErrInsufficientFunds):
+		respondWithError(w, http.StatusBadRequest, "Insufficient funds in the debit account")
+		return
+	default:
+		log.Printf("payment: card %s: %v", cardID, err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to post payment")
 		return
 	}
 
-	if !req.TermsAccepted {
-		respondWithError(w, http.StatusBadRequest, "Terms must be accepted")
+	if replayed {
+		w.Header().Set("Idempotent-Replayed", "true")
+		respondWithSuccess(w, receipt, "Payment already processed")
 		return
 	}
+	respondWithSuccess(w, receipt, "Payment successful")
+}
 
-	respondWithSuccess(w, nil, "PIN updated successfully")
+// GetPayments lists the payments made towards the card, newest first
+func (h *CreditCardHandler) GetPayments(w http.ResponseWriter, r *http.Request) {
+	card, ok := billedCreditCard(w, r, h.store)
+	if !ok {
+		return
+	}
+	cardID := card.ID
+
+	payments := h.store.GetCardPaymentsByCardID(cardID)
+	history := make([]*models.CardPayment, 0, len(payments))
+	for i := len(payments) - 1; i >= 0; i-- {
+		history = append(history, payments[i])
+	}
+
+	respondWithSuccess(w, map[string]interface{}{
+		"cardId":   cardID,
+		"payments": history,
+	})
 }
 
-func (h *CreditCardHandler) RequestAddonCard(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	cardID := vars["cardId"]
+// GetStatus returns the card's status with the history of its changes
+func (h *CreditCardHandler) GetStatus(w http.ResponseWriter, r *http.Request) {
+	card, ok := ownedCreditCard(w, r, h.store)
+	if !ok {
+		return
+	}
+	respondWithCardStatus(w, h.store, card.ID, cardstatus.Current(card.Status, card.ExpiryMonth, card.ExpiryYear, time.Now()), false)
+}
 
-	card, exists := h.store.GetCreditCardByID(cardID)
-	if !exists {
-		respondWithError(w, http.StatusNotFound, "Credit card not found")
+// UpdateStatus blocks, unblocks, hotlists or closes the card
+func (h *CreditCardHandler) UpdateStatus(w http.ResponseWriter, r *http.Request) {
+	card, ok := ownedCreditCard(w, r, h.store)
+	if !ok {
 		return
 	}
+	changeCardStatus(w, r, h.store, card.ID, false)
+}
 
-	userID := r.Context().Value(middleware.UserIDKey).(string)
-	if card.UserID != userID {
-		respondWithError(w, http.StatusForbidden, "Access denied")
+// ReplaceCard retires a lost, stolen or damaged card and issues a new one on
+// the same credit line
+func (h *CreditCardHandler) ReplaceCard(w http.ResponseWriter, r *http.Request) {
+	card, ok := ownedCreditCard(w, r, h.store)
+	if !ok {
 		return
 	}
 
-	var req models.AddonCardRequest
+	var req models.ReplaceCardRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		respondWithError(w, http.StatusBadRequest, "Invalid request body")
 		return
 	}
 
-	// Calculate estimated delivery date (2 weeks from now)
-	estimatedDelivery := time.Now().Add(14 * 24 * time.Hour)
+	// Post what is due on the old card before its billing moves over
+	now := time.Now()
+	statement.CloseCycles(h.store, card, now, h.location)
 
-	respondWithSuccess(w, map[string]interface{}{
-		"requestId":            models.GenerateID(),
-		"estimatedDeliveryDate": estimatedDelivery.Format(time.RFC3339),
-	}, "Add-on card request submitted successfully")
+	issued, dispatch, err := replacement.ReplaceCreditCard(h.store, card, &req, now)
+	if err != nil {
+		respondWithReplacement(w, card.ID, nil, nil, err)
+		return
+	}
+	masked := *issued
+	masked.CVV = "***"
+	respondWithReplacement(w, card.ID, &masked, dispatch, nil)
+}
+
+// GetDispatch tracks the delivery of a replacement card
+func (h *CreditCardHandler) GetDispatch(w http.ResponseWriter, r *http.Request) {
+	card, ok := ownedCreditCard(w, r, h.store)
+	if !ok {
+		return
+	}
+	respondWithDispatch(w, h.store, card.ID)
+}
+
+// Activate activates a new card once the caller confirms the details printed
+// on it, and sets its first PIN
+func (h *CreditCardHandler) Activate(w http.ResponseWriter, r *http.Request) {
+	card, ok := ownedCreditCard(w, r, h.store)
+	if !ok {
+		return
+	}
+
+	var req models.ActivateCardRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	a, err := activation.ActivateCreditCard(h.store, card, &req, time.Now())
+	respondWithActivation(w, card.ID, a, err)
+}
+
+// UpdatePIN changes the card's PIN given the old one, or resets a blocked PIN
+// once the cardholder re-authenticates
+func (h *CreditCardHandler) UpdatePIN(w http.ResponseWriter, r *http.Request) {
+	card, ok := ownedCreditCard(w, r, h.store)
+	if !ok {
+		return
+	}
+
+	status := cardstatus.Current(card.Status, card.ExpiryMonth, card.ExpiryYear, time.Now())
+	updateCardPIN(w, r, h.store, card.ID, card.UserID, status)
+}
+
+func (h *CreditCardHandler) GetTransactions(w http.ResponseWriter, r *http.Request) {
+	card, ok := ownedCreditCard(w, r, h.store)
+	if !ok {
+		return
+	}
+	cardID := card.ID
+
+	respondWithTransactions(w, r, h.store, cardID)
 }
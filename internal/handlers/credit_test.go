@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"bankapp-microservices/internal/models"
+	"bankapp-microservices/internal/store"
+	"github.com/gorilla/mux"
+)
+
+// withVars wraps handler so it sees the route variables vars
+func withVars(handler http.HandlerFunc, vars map[string]string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		handler(w, mux.SetURLVars(r, vars))
+	}
+}
+
+func TestAutopaySettings(t *testing.T) {
+	s := store.NewMemoryStore()
+	card := s.GetCreditCardsByUserID("testuser")[0]
+	account := s.GetDebitCardsByUserID("testuser")[0].AccountNumber
+	h := NewCreditCardHandler(s, time.UTC)
+	vars := map[string]string{"cardId": card.ID}
+
+	str := func(v string) *string { return &v }
+	num := func(v float64) *float64 { return &v }
+
+	rejected := []models.AutopayRequest{
+		{AmountOption: str("EVERYTHING"), LinkedAccountID: &account},
+		{AmountOption: str("FIXED"), LinkedAccountID: &account},
+		{AmountOption: str("PERCENT"), Percent: num(150), LinkedAccountID: &account},
+		{AmountOption: str("MINIMUM_DUE"), LinkedAccountID: str("someone-elses-account")},
+	}
+	for _, req := range rejected {
+		if code, _ := call(t, withVars(h.EnableAutopay, vars), req, "testuser"); code != http.StatusBadRequest {
+			t.Errorf("EnableAutopay(%s) = %d, want 400", *req.AmountOption, code)
+		}
+	}
+	if _, exists := s.GetAutopayByCardID(card.ID); exists {
+		t.Fatal("a rejected request enabled autopay")
+	}
+
+	req := models.AutopayRequest{AmountOption: str("FIXED"), Amount: num(5000), LinkedAccountID: &account}
+	if code, response := call(t, withVars(h.EnableAutopay, vars), req, "testuser"); code != http.StatusOK {
+		t.Fatalf("EnableAutopay = %d %v", code, response)
+	}
+
+	// A rejected update leaves the stored settings alone
+	if code, _ := call(t, withVars(h.UpdateAutopay, vars), models.AutopayRequest{ExecutionDay: new(int)}, "testuser"); code != http.StatusOK {
+		t.Errorf("UpdateAutopay with executionDay 0 = %d, want 200", code)
+	}
+	day := 31
+	if code, _ := call(t, withVars(h.UpdateAutopay, vars), models.AutopayRequest{ExecutionDay: &day, AmountOption: str("TOTAL_DUE")}, "testuser"); code != http.StatusBadRequest {
+		t.Errorf("UpdateAutopay with executionDay 31 = %d, want 400", code)
+	}
+	if autopay, _ := s.GetAutopayByCardID(card.ID); autopay.AmountOption != models.AutopayFixed || autopay.Amount != 5000 {
+		t.Errorf("autopay after a rejected update = %s %v, want FIXED 5000", autopay.AmountOption, autopay.Amount)
+	}
+
+	// Only the fields present change, and false is a value like any other
+	disabled := false
+	code, response := call(t, withVars(h.UpdateAutopay, vars), models.AutopayRequest{AutoPayEnabled: &disabled}, "testuser")
+	if code != http.StatusOK {
+		t.Fatalf("UpdateAutopay = %d %v", code, response)
+	}
+	autopay, _ := s.GetAutopayByCardID(card.ID)
+	if autopay.AutoPayEnabled || autopay.AmountOption != models.AutopayFixed || autopay.Amount != 5000 || autopay.LinkedAccountID != account {
+		t.Errorf("autopay after disabling = %+v", autopay)
+	}
+
+	// Switching away from FIXED drops the stale amount
+	if code, _ := call(t, withVars(h.UpdateAutopay, vars), models.AutopayRequest{AmountOption: str("minimum_due")}, "testuser"); code != http.StatusOK {
+		t.Fatalf("UpdateAutopay to MINIMUM_DUE = %d", code)
+	}
+	if autopay, _ := s.GetAutopayByCardID(card.ID); autopay.AmountOption != models.AutopayMinimumDue || autopay.Amount != 0 {
+		t.Errorf("autopay after switching option = %s %v", autopay.AmountOption, autopay.Amount)
+	}
+}
@@ -3,18 +3,22 @@ package handlers
 import (
 	"encoding/json"
 	"net/http"
+	"time"
 
+	"bankapp-microservices/internal/activation"
+	"bankapp-microservices/internal/cardstatus"
 	"bankapp-microservices/internal/middleware"
 	"bankapp-microservices/internal/models"
+	"bankapp-microservices/internal/replacement"
 	"bankapp-microservices/internal/store"
 	"github.com/gorilla/mux"
 )
 
 type DebitCardHandler struct {
-	store *store.Store
+	store store.Store
 }
 
-func NewDebitCardHandler(store *store.Store) *DebitCardHandler {
+func NewDebitCardHandler(store store.Store) *DebitCardHandler {
 	return &DebitCardHandler{store: store}
 }
 
@@ -22,6 +26,7 @@ func (h *DebitCardHandler) GetDebitCards(w http.ResponseWriter, r *http.Request)
 	userID := r.Context().Value(middleware.UserIDKey).(string)
 	cards := h.store.GetDebitCardsByUserID(userID)
 
+	now := time.Now()
 	var maskedCards []interface{}
 	for _, card := range cards {
 		maskedCard := map[string]interface{}{
@@ -34,6 +39,7 @@ func (h *DebitCardHandler) GetDebitCards(w http.ResponseWriter, r *http.Request)
 			"cardType":       card.CardType,
 			"accountNumber":  card.AccountNumber,
 			"bankName":       card.BankName,
+			"status":         cardstatus.Current(card.Status, card.ExpiryMonth, card.ExpiryYear, now),
 		}
 		maskedCards = append(maskedCards, maskedCard)
 	}
@@ -58,6 +64,7 @@ func (h *DebitCardHandler) GetDebitCard(w http.ResponseWriter, r *http.Request)
 	}
 
 	card.CVV = "***"
+	card.Status = cardstatus.Current(card.Status, card.ExpiryMonth, card.ExpiryYear, time.Now())
 	respondWithSuccess(w, card)
 }
 
@@ -91,37 +98,119 @@ func (h *DebitCardHandler) UpdateLimits(w http.ResponseWriter, r *http.Request)
 	}, "Debit card limits updated successfully")
 }
 
-func (h *DebitCardHandler) UpdatePIN(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	cardID := vars["cardId"]
+// GetStatus returns the card's status with the history of its changes
+func (h *DebitCardHandler) GetStatus(w http.ResponseWriter, r *http.Request) {
+	card, ok := h.ownedDebitCard(w, r)
+	if !ok {
+		return
+	}
+	respondWithCardStatus(w, h.store, card.ID, cardstatus.Current(card.Status, card.ExpiryMonth, card.ExpiryYear, time.Now()), false)
+}
 
-	card, exists := h.store.GetDebitCardByID(cardID)
+// UpdateStatus blocks, unblocks, hotlists or closes the card
+func (h *DebitCardHandler) UpdateStatus(w http.ResponseWriter, r *http.Request) {
+	card, ok := h.ownedDebitCard(w, r)
+	if !ok {
+		return
+	}
+	changeCardStatus(w, r, h.store, card.ID, false)
+}
+
+// ReplaceCard retires a lost, stolen or damaged card and issues a new one on
+// the same bank account
+func (h *DebitCardHandler) ReplaceCard(w http.ResponseWriter, r *http.Request) {
+	card, ok := h.ownedDebitCard(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.ReplaceCardRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	issued, dispatch, err := replacement.ReplaceDebitCard(h.store, card, &req, time.Now())
+	if err != nil {
+		respondWithReplacement(w, card.ID, nil, nil, err)
+		return
+	}
+	masked := *issued
+	masked.CVV = "***"
+	respondWithReplacement(w, card.ID, &masked, dispatch, nil)
+}
+
+// GetDispatch tracks the delivery of a replacement card
+func (h *DebitCardHandler) GetDispatch(w http.ResponseWriter, r *http.Request) {
+	card, ok := h.ownedDebitCard(w, r)
+	if !ok {
+		return
+	}
+	respondWithDispatch(w, h.store, card.ID)
+}
+
+// Activate activates a new card once the caller confirms the details printed
+// on it, and sets its first PIN
+func (h *DebitCardHandler) Activate(w http.ResponseWriter, r *http.Request) {
+	card, ok := h.ownedDebitCard(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.ActivateCardRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	a, err := activation.ActivateDebitCard(h.store, card, &req, time.Now())
+	respondWithActivation(w, card.ID, a, err)
+}
+
+// ownedDebitCard loads the debit card in the path and checks it belongs to
+// the caller, writing the error response if not
+func (h *DebitCardHandler) ownedDebitCard(w http.ResponseWriter, r *http.Request) (*models.DebitCard, bool) {
+	card, exists := h.store.GetDebitCardByID(mux.Vars(r)["cardId"])
 	if !exists {
 		respondWithError(w, http.StatusNotFound, "Debit card not found")
-		return
+		return nil, false
 	}
 
 	userID := r.Context().Value(middleware.UserIDKey).(string)
 	if card.UserID != userID {
 		respondWithError(w, http.StatusForbidden, "Access denied")
-		return
+		return nil, false
 	}
+	return card, true
+}
 
-	var req models.PINUpdateRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+// UpdatePIN changes the card's PIN given the old one, or resets a blocked PIN
+// once the cardholder re-authenticates
+func (h *DebitCardHandler) UpdatePIN(w http.ResponseWriter, r *http.Request) {
+	card, ok := h.ownedDebitCard(w, r)
+	if !ok {
 		return
 	}
 
-	if req.NewPIN != req.ConfirmPIN {
-		respondWithError(w, http.StatusBadRequest, "PINs do not match")
+	status := cardstatus.Current(card.Status, card.ExpiryMonth, card.ExpiryYear, time.Now())
+	updateCardPIN(w, r, h.store, card.ID, card.UserID, status)
+}
+
+func (h *DebitCardHandler) GetTransactions(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	cardID := vars["cardId"]
+
+	card, exists := h.store.GetDebitCardByID(cardID)
+	if !exists {
+		respondWithError(w, http.StatusNotFound, "Debit card not found")
 		return
 	}
 
-	if !req.TermsAccepted {
-		respondWithError(w, http.StatusBadRequest, "Terms must be accepted")
+	userID := r.Context().Value(middleware.UserIDKey).(string)
+	if card.UserID != userID {
+		respondWithError(w, http.StatusForbidden, "Access denied")
 		return
 	}
 
-	respondWithSuccess(w, nil, "PIN updated successfully")
+	respondWithTransactions(w, r, h.store, cardID)
 }
@@ -0,0 +1,186 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"bankapp-microservices/internal/emi"
+	"bankapp-microservices/internal/models"
+	"bankapp-microservices/internal/statement"
+	"bankapp-microservices/internal/store"
+	"github.com/gorilla/mux"
+)
+
+type EMIHandler struct {
+	store store.Store
+	// location defines the midnight billing cycles close at
+	location *time.Location
+}
+
+func NewEMIHandler(store store.Store, location *time.Location) *EMIHandler {
+	return &EMIHandler{store: store, location: location}
+}
+
+// GetOffers returns the EMI terms a purchase can be converted on
+func (h *EMIHandler) GetOffers(w http.ResponseWriter, r *http.Request) {
+	card, txn, ok := h.eligiblePurchase(w, r, false)
+	if !ok {
+		return
+	}
+
+	respondWithSuccess(w, map[string]interface{}{
+		"transactionId":        txn.ID,
+		"amount":               txn.Amount,
+		"merchant":             txn.Merchant,
+		"availableCredit":      card.AvailableCredit,
+		"convertBefore":        txn.Date.Add(emi.ConversionWindow),
+		"processingFeePercent": emi.ProcessingFeePercent,
+		"offers":               emi.Offers(txn.Amount),
+	})
+}
+
+// Convert turns a purchase into an EMI plan on the requested tenure
+func (h *EMIHandler) Convert(w http.ResponseWriter, r *http.Request) {
+	var req models.EMIRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	card, txn, ok := h.eligiblePurchase(w, r, true)
+	if !ok {
+		return
+	}
+
+	plan, err := emi.Convert(h.store, card, txn, req.Tenure, time.Now())
+	if err != nil {
+		respondWithEMIError(w, card, err)
+		return
+	}
+	card, _ = h.store.GetCreditCardByID(card.ID)
+
+	respondWithSuccess(w, map[string]interface{}{
+		"plan":            emi.WithStatus(h.store, plan),
+		"emiOutstanding":  card.EMIOutstanding,
+		"availableCredit": card.AvailableCredit,
+	}, "Purchase converted to EMI")
+}
+
+// GetPlans lists the card's EMI plans, newest first
+func (h *EMIHandler) GetPlans(w http.ResponseWriter, r *http.Request) {
+	card, ok := billedCreditCard(w, r, h.store)
+	if !ok {
+		return
+	}
+
+	plans := h.store.GetEMIPlansByCardID(card.ID)
+	result := []*models.EMIPlan{}
+	for i := len(plans) - 1; i >= 0; i-- {
+		result = append(result, emi.WithStatus(h.store, plans[i]))
+	}
+
+	card, _ = h.store.GetCreditCardByID(card.ID)
+	respondWithSuccess(w, map[string]interface{}{
+		"cardId":         card.ID,
+		"emiOutstanding": card.EMIOutstanding,
+		"plans":          result,
+	})
+}
+
+// Foreclose closes an EMI plan early, billing its remaining principal and
+// the foreclosure fee to the next statement
+func (h *EMIHandler) Foreclose(w http.ResponseWriter, r *http.Request) {
+	card, ok := billedCreditCard(w, r, h.store)
+	if !ok {
+		return
+	}
+
+	plan, exists := h.store.GetEMIPlan(mux.Vars(r)["planId"])
+	if !exists || plan.CardID != card.ID {
+		respondWithError(w, http.StatusNotFound, "EMI plan not found")
+		return
+	}
+
+	// Bill any installment already due before working out what is left
+	statement.CloseCycles(h.store, card, time.Now(), h.location)
+
+	plan, err := emi.Foreclose(h.store, card, plan, time.Now())
+	if err != nil {
+		respondWithEMIError(w, card, err)
+		return
+	}
+	card, _ = h.store.GetCreditCardByID(card.ID)
+
+	respondWithSuccess(w, map[string]interface{}{
+		"plan":               emi.WithStatus(h.store, plan),
+		"outstandingBalance": card.OutstandingBalance,
+		"availableCredit":    card.AvailableCredit,
+	}, "EMI plan foreclosed")
+}
+
+// eligiblePurchase loads the caller's card and the purchase in the path and
+// checks the purchase can be converted, writing the error response if not.
+// Conversions set closeDue to close any cycle that is due first, since a
+// purchase on a closed statement can no longer be converted; reads leave
+// closing to the scheduler.
+func (h *EMIHandler) eligiblePurchase(w http.ResponseWriter, r *http.Request, closeDue bool) (*models.CreditCard, *models.Transaction, bool) {
+	card, ok := billedCreditCard(w, r, h.store)
+	if !ok {
+		return nil, nil, false
+	}
+
+	now := time.Now()
+	if closeDue {
+		statement.CloseCycles(h.store, card, now, h.location)
+		card, _ = h.store.GetCreditCardByID(card.ID)
+	}
+
+	var txn *models.Transaction
+	for _, t := range h.store.GetTransactionsByCardID(card.ID) {
+		if t.ID == mux.Vars(r)["transactionId"] {
+			txn = t
+		}
+	}
+	if txn == nil {
+		respondWithError(w, http.StatusNotFound, "Transaction not found")
+		return nil, nil, false
+	}
+
+	var billedUntil time.Time
+	if latest, exists := statement.Latest(h.store, card); exists {
+		billedUntil = latest.PeriodEnd
+	}
+	if err := emi.Eligible(h.store, card, txn, billedUntil, now); err != nil {
+		respondWithEMIError(w, card, err)
+		return nil, nil, false
+	}
+	return card, txn, true
+}
+
+func respondWithEMIError(w http.ResponseWriter, card *models.CreditCard, err error) {
+	switch {
+	case errors.Is(err, emi.ErrNotPurchase):
+		respondWithError(w, http.StatusBadRequest, "Only approved purchases can be converted to EMI")
+	case errors.Is(err, emi.ErrBelowMinimum):
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Purchases under %d cannot be converted to EMI", emi.MinimumAmount))
+	case errors.Is(err, emi.ErrRefunded):
+		respondWithError(w, http.StatusBadRequest, "Refunded purchases cannot be converted to EMI")
+	case errors.Is(err, emi.ErrAlreadyConverted):
+		respondWithError(w, http.StatusConflict, "Purchase has already been converted to EMI")
+	case errors.Is(err, emi.ErrBilled):
+		respondWithError(w, http.StatusBadRequest, "Purchase has already been billed on a statement")
+	case errors.Is(err, emi.ErrWindowPassed):
+		respondWithError(w, http.StatusBadRequest, "Purchases can only be converted within 30 days")
+	case errors.Is(err, emi.ErrInvalidTenure):
+		respondWithError(w, http.StatusBadRequest, "Invalid tenure. Must be 3, 6, 9, 12, 18 or 24 months")
+	case errors.Is(err, emi.ErrPlanNotActive):
+		respondWithError(w, http.StatusBadRequest, "EMI plan is not active")
+	default:
+		log.Printf("emi: card %s: %v", card.ID, err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to process EMI request")
+	}
+}
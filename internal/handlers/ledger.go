@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"net/http"
+	"sort"
+
+	"bankapp-microservices/internal/ledger"
+	"bankapp-microservices/internal/middleware"
+	"bankapp-microservices/internal/store"
+	"github.com/gorilla/mux"
+)
+
+type LedgerHandler struct {
+	store store.Store
+}
+
+func NewLedgerHandler(store store.Store) *LedgerHandler {
+	return &LedgerHandler{store: store}
+}
+
+// GetAccounts lists the user's ledger accounts with their derived balances
+func (h *LedgerHandler) GetAccounts(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middleware.UserIDKey).(string)
+
+	accounts := h.store.GetLedgerAccountsByUserID(userID)
+	sort.Slice(accounts, func(i, j int) bool {
+		return accounts[i].ID < accounts[j].ID
+	})
+
+	result := []interface{}{}
+	for _, account := range accounts {
+		balance := h.store.GetAccountBalance(account.ID)
+		result = append(result, map[string]interface{}{
+			"id":           account.ID,
+			"type":         account.Type,
+			"name":         account.Name,
+			"currency":     account.Currency,
+			"balanceMinor": balance,
+			"balance":      ledger.ToMajor(balance),
+		})
+	}
+
+	respondWithSuccess(w, result)
+}
+
+// GetEntries lists the journal entries posted to one of the user's accounts
+// with the running balance after each entry
+func (h *LedgerHandler) GetEntries(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	accountID := vars["accountId"]
+
+	account, exists := h.store.GetLedgerAccount(accountID)
+	if !exists {
+		respondWithError(w, http.StatusNotFound, "Ledger account not found")
+		return
+	}
+
+	userID := r.Context().Value(middleware.UserIDKey).(string)
+	if account.UserID != userID {
+		respondWithError(w, http.StatusForbidden, "Access denied")
+		return
+	}
+
+	var running int64
+	result := []interface{}{}
+	for _, entry := range h.store.GetJournalEntriesByAccountID(accountID) {
+		var amount int64
+		for _, posting := range entry.Postings {
+			if posting.AccountID == accountID {
+				amount += posting.Amount
+			}
+		}
+		running += amount
+		result = append(result, map[string]interface{}{
+			"id":                entry.ID,
+			"date":              entry.Date,
+			"description":       entry.Description,
+			"reference":         entry.Reference,
+			"amountMinor":       amount,
+			"balanceAfterMinor": running,
+			"postings":          entry.Postings,
+		})
+	}
+
+	respondWithSuccess(w, map[string]interface{}{
+		"account":      account,
+		"balanceMinor": h.store.GetAccountBalance(accountID),
+		"entries":      result,
+	})
+}
@@ -3,19 +3,23 @@ package handlers
 import (
 	"encoding/json"
 	"net/http"
+	"time"
 
 	"bankapp-microservices/internal/middleware"
 	"bankapp-microservices/internal/models"
 	"bankapp-microservices/internal/store"
+	"bankapp-microservices/internal/usage"
 	"github.com/gorilla/mux"
 )
 
 type LimitsHandler struct {
-	store *store.Store
+	store store.Store
+	// location defines the calendar days and months limit usage resets on
+	location *time.Location
 }
 
-func NewLimitsHandler(store *store.Store) *LimitsHandler {
-	return &LimitsHandler{store: store}
+func NewLimitsHandler(store store.Store, location *time.Location) *LimitsHandler {
+	return &LimitsHandler{store: store, location: location}
 }
 
 func (h *LimitsHandler) GetLimits(w http.ResponseWriter, r *http.Request) {
@@ -50,20 +54,7 @@ func (h *LimitsHandler) GetLimits(w http.ResponseWriter, r *http.Request) {
 	limits, exists := h.store.GetCardLimits(cardID)
 	if !exists {
 		// Return default limits structure
-		limits = &models.LimitsRequest{
-			DomesticLimits: []models.TransactionLimit{
-				{Type: "ATM Cash Withdrawal", IsEnabled: true, CurrentLimit: 50000, MaxLimit: 100000, CanSetLimit: true},
-				{Type: "Online", IsEnabled: true, CurrentLimit: 200000, MaxLimit: 500000, CanSetLimit: true},
-				{Type: "Merchant Outlets (POS)", IsEnabled: true, CurrentLimit: 150000, MaxLimit: 300000, CanSetLimit: true},
-				{Type: "Contactless", IsEnabled: true, CurrentLimit: 5000, MaxLimit: 10000, CanSetLimit: true},
-			},
-			InternationalLimits: []models.TransactionLimit{
-				{Type: "ATM Cash Withdrawal", IsEnabled: false, CurrentLimit: 0, MaxLimit: 50000, CanSetLimit: true},
-				{Type: "Online", IsEnabled: true, CurrentLimit: 100000, MaxLimit: 200000, CanSetLimit: true},
-				{Type: "Merchant Outlets (POS)", IsEnabled: false, CurrentLimit: 0, MaxLimit: 100000, CanSetLimit: true},
-				{Type: "Contactless", IsEnabled: false, CurrentLimit: 0, MaxLimit: 5000, CanSetLimit: true},
-			},
-		}
+		limits = defaultLimits()
 	}
 
 	// Add IDs and max limits
@@ -86,11 +77,42 @@ func (h *LimitsHandler) GetLimits(w http.ResponseWriter, r *http.Request) {
 		limits.InternationalLimits[i].CanSetLimit = true
 	}
 
-	respondWithSuccess(w, models.LimitsResponse{
+	// Report today's consumption against each limit
+	storedUsage, _ := h.store.GetCardUsage(cardID)
+	cardUsage := usage.Current(storedUsage, cardID, time.Now(), h.location)
+	response := models.LimitsResponse{
 		CardID:              cardID,
-		DomesticLimits:      limits.DomesticLimits,
-		InternationalLimits: limits.InternationalLimits,
-	})
+		DomesticLimits:      withUsage(limits.DomesticLimits, cardUsage, false),
+		InternationalLimits: withUsage(limits.InternationalLimits, cardUsage, true),
+	}
+	if settings, exists := h.store.GetCardSettings(userID); exists {
+		response.Daily = usageSummary(cardUsage.Day, settings.DefaultDailyLimit, usage.DailyTotal(cardUsage))
+		response.Monthly = usageSummary(cardUsage.Month, settings.DefaultMonthlyLimit, usage.MonthlyTotal(cardUsage))
+	}
+
+	respondWithSuccess(w, response)
+}
+
+// withUsage returns a copy of limits annotated with today's used and remaining amounts
+func withUsage(limits []models.TransactionLimit, cardUsage *models.CardUsage, international bool) []models.TransactionLimit {
+	result := make([]models.TransactionLimit, len(limits))
+	for i, limit := range limits {
+		used := cardUsage.Daily[usage.Key(limit.Type, international)]
+		remaining := usage.Remaining(limit.CurrentLimit, used)
+		limit.Used = &used
+		limit.Remaining = &remaining
+		result[i] = limit
+	}
+	return result
+}
+
+func usageSummary(period string, limit, used float64) *models.UsageSummary {
+	return &models.UsageSummary{
+		Period:    period,
+		Limit:     limit,
+		Used:      used,
+		Remaining: usage.Remaining(limit, used),
+	}
 }
 
 func (h *LimitsHandler) UpdateDomesticLimits(w http.ResponseWriter, r *http.Request) {
@@ -192,3 +214,21 @@ func (h *LimitsHandler) UpdateInternationalLimits(w http.ResponseWriter, r *http
 		"internationalLimits": limits.InternationalLimits,
 	}, "International limits updated successfully")
 }
+
+// defaultLimits returns the limits that apply to a card until the user changes them
+func defaultLimits() *models.LimitsRequest {
+	return &models.LimitsRequest{
+		DomesticLimits: []models.TransactionLimit{
+			{Type: models.LimitTypeATM, IsEnabled: true, CurrentLimit: 50000, MaxLimit: 100000, CanSetLimit: true},
+			{Type: models.LimitTypeOnline, IsEnabled: true, CurrentLimit: 200000, MaxLimit: 500000, CanSetLimit: true},
+			{Type: models.LimitTypePOS, IsEnabled: true, CurrentLimit: 150000, MaxLimit: 300000, CanSetLimit: true},
+			{Type: models.LimitTypeContactless, IsEnabled: true, CurrentLimit: 5000, MaxLimit: 10000, CanSetLimit: true},
+		},
+		InternationalLimits: []models.TransactionLimit{
+			{Type: models.LimitTypeATM, IsEnabled: false, CurrentLimit: 0, MaxLimit: 50000, CanSetLimit: true},
+			{Type: models.LimitTypeOnline, IsEnabled: true, CurrentLimit: 100000, MaxLimit: 200000, CanSetLimit: true},
+			{Type: models.LimitTypePOS, IsEnabled: false, CurrentLimit: 0, MaxLimit: 100000, CanSetLimit: true},
+			{Type: models.LimitTypeContactless, IsEnabled: false, CurrentLimit: 0, MaxLimit: 5000, CanSetLimit: true},
+		},
+	}
+}
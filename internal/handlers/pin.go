@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"bankapp-microservices/internal/cardpin"
+	"bankapp-microservices/internal/models"
+	"bankapp-microservices/internal/password"
+	"bankapp-microservices/internal/store"
+	"bankapp-microservices/internal/throttle"
+	"bankapp-microservices/internal/totp"
+)
+
+// stepUpThrottle limits wrong passwords and OTPs sent to reset a blocked PIN,
+// per user, on the same terms as failed logins
+var stepUpThrottle = throttle.New(userFreeLoginAttempts, loginBaseLockout, loginMaxLockout, loginFailureWindow)
+
+// updateCardPIN sets the PIN of a credit or debit card from the request body
+// and writes the response. status is the card's current status.
+func updateCardPIN(w http.ResponseWriter, r *http.Request, s store.Store, cardID, userID, status string) {
+	var req models.PINUpdateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	switch status {
+	case models.CardStatusInactive:
+		respondWithError(w, http.StatusConflict, "New cards must be activated before their PIN can be changed")
+		return
+	case models.CardStatusClosed:
+		respondWithError(w, http.StatusConflict, "Card is closed")
+		return
+	}
+
+	user, exists := s.GetUserByID(userID)
+	if !exists {
+		respondWithError(w, http.StatusNotFound, "User not found")
+		return
+	}
+
+	now := time.Now()
+	steppedUp := false
+	if req.Password != "" || req.OTP != "" {
+		if retryAfter := stepUpThrottle.Check(userID, now); retryAfter > 0 {
+			respondWithLocked(w, retryAfter, "Too many failed attempts, try again later")
+			return
+		}
+		if !reauthenticate(s, user, &req, now) {
+			if lockout := stepUpThrottle.Fail(userID, now); lockout > 0 {
+				respondWithLocked(w, lockout, "Too many failed attempts, try again later")
+				return
+			}
+			respondWithError(w, http.StatusUnauthorized, "Incorrect password or OTP")
+			return
+		}
+		stepUpThrottle.Reset(userID)
+		steppedUp = true
+	}
+
+	if pin, err := cardpin.Set(s, cardID, &req, user.DateOfBirth, steppedUp, now); err != nil {
+		respondWithPINError(w, cardID, pin, err, "Failed to update PIN")
+		return
+	}
+
+	respondWithSuccess(w, nil, "PIN updated successfully")
+}
+
+// reauthenticate checks the password or OTP in req against user. An OTP is
+// only accepted once.
+func reauthenticate(s store.Store, user *models.User, req *models.PINUpdateRequest, now time.Time) bool {
+	if req.Password != "" {
+		return password.Verify(user.PasswordHash, req.Password)
+	}
+	if user.OTPSecret == "" {
+		return false
+	}
+	counter, valid := totp.Validate(user.OTPSecret, req.OTP, now)
+	if !valid || counter <= user.LastOTPCounter {
+		return false
+	}
+	user.LastOTPCounter = counter
+	s.UpdateUser(user)
+	return true
+}
+
+// respondWithPINError writes the response for an error from setting or
+// checking a card PIN, or a 500 with failure for any other error
+func respondWithPINError(w http.ResponseWriter, cardID string, pin *models.CardPIN, err error, failure string) {
+	switch {
+	case errors.Is(err, cardpin.ErrMismatch):
+		respondWithError(w, http.StatusBadRequest, "PINs do not match")
+	case errors.Is(err, cardpin.ErrFormat):
+		respondWithError(w, http.StatusBadRequest, "PIN must be 4 digits")
+	case errors.Is(err, cardpin.ErrWeak):
+		respondWithError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, cardpin.ErrTermsNotAccepted):
+		respondWithError(w, http.StatusBadRequest, "Terms must be accepted")
+	case errors.Is(err, cardpin.ErrUnchanged):
+		respondWithError(w, http.StatusBadRequest, "New PIN must be different from the current PIN")
+	case errors.Is(err, cardpin.ErrOldPINRequired):
+		respondWithError(w, http.StatusBadRequest, "oldPIN is required to change the PIN")
+	case errors.Is(err, cardpin.ErrStepUpRequired):
+		respondWithError(w, http.StatusForbidden, "PIN is blocked. Send your password or an OTP with the new PIN to reset it")
+	case errors.Is(err, cardpin.ErrNotSet):
+		respondWithError(w, http.StatusBadRequest, "No PIN has been set for this card")
+	case errors.Is(err, cardpin.ErrIncorrect):
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(models.Response{
+			Success: false,
+			Message: "Incorrect PIN",
+			Data:    map[string]int{"attemptsRemaining": cardpin.AttemptsRemaining(pin)},
+		})
+	case errors.Is(err, cardpin.ErrBlocked):
+		respondWithError(w, http.StatusLocked, "PIN is blocked after too many wrong attempts. Set a new PIN with your password or an OTP to unblock it")
+	default:
+		log.Printf("pin: card %s: %v", cardID, err)
+		respondWithError(w, http.StatusInternalServerError, failure)
+	}
+}
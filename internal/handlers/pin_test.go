@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"bankapp-microservices/internal/cardpin"
+	"bankapp-microservices/internal/models"
+	"bankapp-microservices/internal/store"
+)
+
+func TestBlockedPINResetNeedsPassword(t *testing.T) {
+	s := store.NewMemoryStore()
+	card := s.GetDebitCardsByUserID("testuser")[0]
+	card.ExpiryYear = time.Now().Year() + 2
+	pin, err := cardpin.New("4821", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	blockedAt := time.Now()
+	pin.BlockedAt = &blockedAt
+	card.PIN = pin
+	s.UpdateDebitCard(card)
+	update := withVars(NewDebitCardHandler(s).UpdatePIN, map[string]string{"cardId": card.ID})
+	req := models.PINUpdateRequest{NewPIN: "5937", ConfirmPIN: "5937", TermsAccepted: true}
+
+	if code, response := call(t, update, req, "testuser"); code != http.StatusForbidden {
+		t.Errorf("reset without re-authenticating = %d %v, want 403", code, response)
+	}
+	req.OldPIN = "4821"
+	if code, response := call(t, update, req, "testuser"); code != http.StatusForbidden {
+		t.Errorf("reset with the old PIN = %d %v, want 403", code, response)
+	}
+	req.OldPIN = ""
+	req.Password = "wrong-password"
+	if code, response := call(t, update, req, "testuser"); code != http.StatusUnauthorized {
+		t.Errorf("reset with a wrong password = %d %v, want 401", code, response)
+	}
+	req.Password = "password123"
+	if code, response := call(t, update, req, "testuser"); code != http.StatusOK {
+		t.Fatalf("reset with the password = %d %v", code, response)
+	}
+
+	card, _ = s.GetDebitCardByID(card.ID)
+	if card.PIN.BlockedAt != nil {
+		t.Error("PIN is still blocked after the reset")
+	}
+	if _, err := cardpin.Verify(s, card.ID, "5937", time.Now()); err != nil {
+		t.Errorf("new PIN does not verify: %v", err)
+	}
+
+	// Once unblocked, changing the PIN needs the old one again
+	req = models.PINUpdateRequest{NewPIN: "2468", ConfirmPIN: "2468", TermsAccepted: true}
+	if code, response := call(t, update, req, "testuser"); code != http.StatusBadRequest {
+		t.Errorf("change without oldPIN = %d %v, want 400", code, response)
+	}
+}
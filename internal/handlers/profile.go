@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"bankapp-microservices/internal/middleware"
+	"bankapp-microservices/internal/models"
+	"bankapp-microservices/internal/password"
+	"bankapp-microservices/internal/store"
+)
+
+type ProfileHandler struct {
+	store store.Store
+}
+
+func NewProfileHandler(store store.Store) *ProfileHandler {
+	return &ProfileHandler{store: store}
+}
+
+func (h *ProfileHandler) GetProfile(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middleware.UserIDKey).(string)
+	user, exists := h.store.GetUserByID(userID)
+	if !exists {
+		respondWithError(w, http.StatusNotFound, "User not found")
+		return
+	}
+
+	respondWithSuccess(w, userResponse(user))
+}
+
+func (h *ProfileHandler) UpdateProfile(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middleware.UserIDKey).(string)
+	user, exists := h.store.GetUserByID(userID)
+	if !exists {
+		respondWithError(w, http.StatusNotFound, "User not found")
+		return
+	}
+
+	var req models.ProfileUpdateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	// Validate every field before changing anything, so a rejected request
+	// leaves the profile exactly as it was
+	var fullName, email, dateOfBirth string
+	if req.FullName != nil {
+		fullName = strings.TrimSpace(*req.FullName)
+		if fullName == "" || len(fullName) > maxFullNameLength {
+			respondWithError(w, http.StatusBadRequest, "Full name is required and must be at most 100 characters")
+			return
+		}
+	}
+	if req.Email != nil {
+		var ok bool
+		if email, ok = normalizeEmail(*req.Email); !ok {
+			respondWithError(w, http.StatusBadRequest, "Invalid email address")
+			return
+		}
+		if other, taken := h.store.GetUserByEmail(email); taken && other.UserID != userID {
+			respondWithError(w, http.StatusConflict, "Email is already registered")
+			return
+		}
+	}
+	if req.DateOfBirth != nil {
+		dateOfBirth = strings.TrimSpace(*req.DateOfBirth)
+		if dateOfBirth != "" && !validDateOfBirth(dateOfBirth) {
+			respondWithError(w, http.StatusBadRequest, "Date of birth must be a past date in YYYY-MM-DD format")
+			return
+		}
+	}
+
+	updated := *user
+	if req.FullName != nil {
+		updated.FullName = fullName
+	}
+	if req.Email != nil {
+		updated.Email = email
+	}
+	if req.PhoneNumber != nil {
+		updated.PhoneNumber = strings.TrimSpace(*req.PhoneNumber)
+	}
+	if req.DateOfBirth != nil {
+		updated.DateOfBirth = dateOfBirth
+	}
+	h.store.UpdateUser(&updated)
+
+	respondWithSuccess(w, userResponse(&updated), "Profile updated successfully")
+}
+
+// ChangePassword replaces the user's password and signs out every other session
+func (h *ProfileHandler) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middleware.UserIDKey).(string)
+	sessionID := r.Context().Value(middleware.SessionIDKey).(string)
+	user, exists := h.store.GetUserByID(userID)
+	if !exists {
+		respondWithError(w, http.StatusNotFound, "User not found")
+		return
+	}
+
+	var req models.PasswordChangeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if !password.Verify(user.PasswordHash, req.CurrentPassword) {
+		respondWithError(w, http.StatusUnauthorized, "Current password is incorrect")
+		return
+	}
+
+	if req.NewPassword != req.ConfirmPassword {
+		respondWithError(w, http.StatusBadRequest, "Passwords do not match")
+		return
+	}
+
+	if req.NewPassword == req.CurrentPassword {
+		respondWithError(w, http.StatusBadRequest, "New password must be different from the current password")
+		return
+	}
+
+	if err := password.CheckPolicy(req.NewPassword, userID); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid password: "+err.Error())
+		return
+	}
+
+	passwordHash, err := password.Hash(req.NewPassword)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to update password")
+		return
+	}
+
+	user.PasswordHash = passwordHash
+	h.store.UpdateUser(user)
+
+	for _, session := range h.store.GetSessionsByUserID(userID) {
+		if session.ID != sessionID {
+			h.store.DeleteSession(session.ID)
+		}
+	}
+
+	respondWithSuccess(w, nil, "Password changed successfully")
+}
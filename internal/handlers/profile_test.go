@@ -0,0 +1,35 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+
+	"bankapp-microservices/internal/models"
+	"bankapp-microservices/internal/store"
+)
+
+func TestUpdateProfileIsAllOrNothing(t *testing.T) {
+	s := store.NewMemoryStore()
+	h := NewProfileHandler(s)
+	before, _ := s.GetUserByID("testuser")
+
+	name, phone, email := "Someone Else", "+91 98765 43210", "not an email"
+	code, _ := call(t, h.UpdateProfile, models.ProfileUpdateRequest{FullName: &name, PhoneNumber: &phone, Email: &email}, "testuser")
+	if code != http.StatusBadRequest {
+		t.Fatalf("UpdateProfile with a bad email = %d, want 400", code)
+	}
+	after, _ := s.GetUserByID("testuser")
+	if after.FullName != before.FullName || after.PhoneNumber != before.PhoneNumber {
+		t.Errorf("rejected update changed the profile to %q %q", after.FullName, after.PhoneNumber)
+	}
+
+	email = "someone.else@example.com"
+	code, response := call(t, h.UpdateProfile, models.ProfileUpdateRequest{FullName: &name, Email: &email}, "testuser")
+	if code != http.StatusOK {
+		t.Fatalf("UpdateProfile = %d %v", code, response)
+	}
+	after, _ = s.GetUserByID("testuser")
+	if after.FullName != name || after.Email != "someone.else@example.com" || after.PhoneNumber != before.PhoneNumber {
+		t.Errorf("profile = %q %q %q after update", after.FullName, after.Email, after.PhoneNumber)
+	}
+}
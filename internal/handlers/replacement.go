@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"bankapp-microservices/internal/issuance"
+	"bankapp-microservices/internal/models"
+	"bankapp-microservices/internal/replacement"
+	"bankapp-microservices/internal/store"
+)
+
+// respondWithReplacement writes the outcome of replacing a card: the new
+// card, with its CVV masked, and its dispatch
+func respondWithReplacement(w http.ResponseWriter, oldCardID string, card interface{}, dispatch *models.CardDispatch, err error) {
+	switch {
+	case err == nil:
+	case errors.Is(err, replacement.ErrInvalidReason):
+		respondWithError(w, http.StatusBadRequest, "Invalid reason. Must be LOST, STOLEN or DAMAGED")
+		return
+	case errors.Is(err, replacement.ErrCardClosed):
+		respondWithError(w, http.StatusConflict, "Card is closed and cannot be replaced")
+		return
+	default:
+		respondWithError(w, http.StatusInternalServerError, "Failed to replace card")
+		return
+	}
+
+	respondWithSuccess(w, map[string]interface{}{
+		"replacedCardId": oldCardID,
+		"card":           card,
+		"dispatch":       dispatch,
+	}, "Replacement card requested")
+}
+
+// respondWithDispatch writes where a card's physical delivery has got to
+func respondWithDispatch(w http.ResponseWriter, s store.Store, cardID string) {
+	dispatch, exists := s.GetCardDispatch(cardID)
+	if !exists {
+		respondWithError(w, http.StatusNotFound, "No dispatch found for this card")
+		return
+	}
+	respondWithSuccess(w, issuance.Track(s, dispatch, time.Now()))
+}
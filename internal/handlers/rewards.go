@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"bankapp-microservices/internal/models"
+	"bankapp-microservices/internal/rewards"
+	"bankapp-microservices/internal/store"
+)
+
+// expiringWindow is how far ahead the rewards summary warns about expiring points
+const expiringWindow = 30 * 24 * time.Hour
+
+type RewardsHandler struct {
+	store store.Store
+}
+
+func NewRewardsHandler(store store.Store) *RewardsHandler {
+	return &RewardsHandler{store: store}
+}
+
+// GetRewards returns the card's points balance, how it earns points and what
+// they can be redeemed for
+func (h *RewardsHandler) GetRewards(w http.ResponseWriter, r *http.Request) {
+	card, ok := billedCreditCard(w, r, h.store)
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+	rewards.Expire(h.store, card, now)
+	entries := h.store.GetRewardsEntriesByCardID(card.ID)
+
+	respondWithSuccess(w, map[string]interface{}{
+		"cardId":            card.ID,
+		"pointsBalance":     rewards.Balance(entries),
+		"expiringPoints":    rewards.Expiring(entries, now.Add(expiringWindow)),
+		"expiringBefore":    now.Add(expiringWindow),
+		"program":           rewards.ForCard(card),
+		"minimumRedemption": rewards.MinimumRedemption,
+		"catalog":           rewards.Catalog,
+	})
+}
+
+// GetLedger lists the card's rewards points entries with the running balance
+// after each entry
+func (h *RewardsHandler) GetLedger(w http.ResponseWriter, r *http.Request) {
+	card, ok := billedCreditCard(w, r, h.store)
+	if !ok {
+		return
+	}
+
+	rewards.Expire(h.store, card, time.Now())
+
+	running := 0
+	result := []interface{}{}
+	for _, entry := range h.store.GetRewardsEntriesByCardID(card.ID) {
+		running += entry.Points
+		result = append(result, map[string]interface{}{
+			"entry":        entry,
+			"balanceAfter": running,
+		})
+	}
+
+	respondWithSuccess(w, map[string]interface{}{
+		"cardId":        card.ID,
+		"pointsBalance": running,
+		"entries":       result,
+	})
+}
+
+// Redeem spends the card's points on statement credit or a catalog voucher
+func (h *RewardsHandler) Redeem(w http.ResponseWriter, r *http.Request) {
+	card, ok := billedCreditCard(w, r, h.store)
+	if !ok {
+		return
+	}
+
+	var req models.RedeemRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	entry, err := rewards.Redeem(h.store, card, &req, time.Now())
+	switch {
+	case err == nil:
+	case errors.Is(err, rewards.ErrInvalidType):
+		respondWithError(w, http.StatusBadRequest, "Invalid type. Must be STATEMENT_CREDIT or VOUCHER")
+		return
+	case errors.Is(err, rewards.ErrBelowMinimum):
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("At least %d points must be redeemed", rewards.MinimumRedemption))
+		return
+	case errors.Is(err, rewards.ErrUnknownVoucher):
+		respondWithError(w, http.StatusBadRequest, "Unknown voucherId")
+		return
+	case errors.Is(err, rewards.ErrInsufficientPoints):
+		respondWithError(w, http.StatusBadRequest, "Not enough points")
+		return
+	default:
+		log.Printf("rewards: redeem on card %s: %v", card.ID, err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to redeem points")
+		return
+	}
+
+	respondWithSuccess(w, map[string]interface{}{
+		"redemption":    entry,
+		"pointsBalance": rewards.Balance(h.store.GetRewardsEntriesByCardID(card.ID)),
+	}, "Points redeemed successfully")
+}
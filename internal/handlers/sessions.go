@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"net/http"
+	"sort"
+
+	"bankapp-microservices/internal/middleware"
+	"bankapp-microservices/internal/store"
+	"github.com/gorilla/mux"
+)
+
+type SessionHandler struct {
+	store store.Store
+}
+
+func NewSessionHandler(store store.Store) *SessionHandler {
+	return &SessionHandler{store: store}
+}
+
+func (h *SessionHandler) GetSessions(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middleware.UserIDKey).(string)
+	currentSessionID := r.Context().Value(middleware.SessionIDKey).(string)
+
+	sessions := h.store.GetSessionsByUserID(userID)
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].LastUsedAt.After(sessions[j].LastUsedAt)
+	})
+
+	result := []interface{}{}
+	for _, session := range sessions {
+		result = append(result, map[string]interface{}{
+			"id":         session.ID,
+			"deviceName": session.DeviceName,
+			"ipAddress":  session.IPAddress,
+			"issuedAt":   session.IssuedAt,
+			"lastUsedAt": session.LastUsedAt,
+			"current":    session.ID == currentSessionID,
+		})
+	}
+
+	respondWithSuccess(w, map[string]interface{}{
+		"sessions": result,
+	})
+}
+
+// RevokeSession revokes a single session, or every session except the
+// current one when the ID is "others"
+func (h *SessionHandler) RevokeSession(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	sessionID := vars["sessionId"]
+
+	userID := r.Context().Value(middleware.UserIDKey).(string)
+	currentSessionID := r.Context().Value(middleware.SessionIDKey).(string)
+
+	if sessionID == "others" {
+		revoked := 0
+		for _, session := range h.store.GetSessionsByUserID(userID) {
+			if session.ID != currentSessionID {
+				h.store.DeleteSession(session.ID)
+				revoked++
+			}
+		}
+		respondWithSuccess(w, map[string]interface{}{
+			"revoked": revoked,
+		}, "Other sessions revoked successfully")
+		return
+	}
+
+	session, exists := h.store.GetSessionByID(sessionID)
+	if !exists {
+		respondWithError(w, http.StatusNotFound, "Session not found")
+		return
+	}
+
+	if session.UserID != userID {
+		respondWithError(w, http.StatusForbidden, "Access denied")
+		return
+	}
+
+	h.store.DeleteSession(sessionID)
+
+	respondWithSuccess(w, map[string]interface{}{
+		"revoked": 1,
+	}, "Session revoked successfully")
+}
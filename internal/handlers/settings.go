@@ -10,10 +10,10 @@ import (
 )
 
 type SettingsHandler struct {
-	store *store.Store
+	store store.Store
 }
 
-func NewSettingsHandler(store *store.Store) *SettingsHandler {
+func NewSettingsHandler(store store.Store) *SettingsHandler {
 	return &SettingsHandler{store: store}
 }
 
@@ -207,6 +207,11 @@ func (h *SettingsHandler) UpdateAuthenticationSettings(w http.ResponseWriter, r
 		settings.BiometricAuthenticationEnabled = *req.BiometricAuthenticationEnabled
 	}
 	if req.TwoFactorAuthenticationEnabled != nil {
+		// Requiring a second factor nobody can give would lock the user out
+		if user, exists := h.store.GetUserByID(userID); *req.TwoFactorAuthenticationEnabled && (!exists || !hasSecondFactor(user)) {
+			respondWithError(w, http.StatusConflict, "Set up an authenticator app or a login PIN before enabling two-factor authentication")
+			return
+		}
 		settings.TwoFactorAuthenticationEnabled = *req.TwoFactorAuthenticationEnabled
 	}
 	if req.TransactionAuthenticationRequired != nil {
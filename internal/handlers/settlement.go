@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"bankapp-microservices/internal/models"
+	"bankapp-microservices/internal/refund"
+	"bankapp-microservices/internal/store"
+	"github.com/gorilla/mux"
+)
+
+// SettlementHandler serves the routes the merchant settlement system calls
+type SettlementHandler struct {
+	store store.Store
+}
+
+func NewSettlementHandler(store store.Store) *SettlementHandler {
+	return &SettlementHandler{store: store}
+}
+
+// Refund settles a merchant refund of all or part of an approved purchase
+func (h *SettlementHandler) Refund(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	var req models.RefundRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	txn, err := refund.Settle(h.store, vars["cardId"], vars["transactionId"], req.Amount, time.Now())
+	switch {
+	case err == nil:
+		respondWithSuccess(w, txn, "Refund processed")
+	case errors.Is(err, refund.ErrCardNotFound):
+		respondWithError(w, http.StatusNotFound, "Card not found")
+	case errors.Is(err, refund.ErrTransactionNotFound):
+		respondWithError(w, http.StatusNotFound, "Transaction not found")
+	case errors.Is(err, refund.ErrNotRefundable):
+		respondWithError(w, http.StatusBadRequest, "Only approved purchases can be refunded")
+	case errors.Is(err, refund.ErrConvertedToEMI):
+		respondWithError(w, http.StatusBadRequest, "Purchases converted to EMI cannot be refunded")
+	case errors.Is(err, refund.ErrFullyRefunded):
+		respondWithError(w, http.StatusBadRequest, "Transaction has already been fully refunded")
+	case errors.Is(err, refund.ErrInvalidAmount):
+		respondWithError(w, http.StatusBadRequest, "Amount must be at least 0.01")
+	case errors.Is(err, refund.ErrExceedsRemaining):
+		respondWithError(w, http.StatusBadRequest, "Amount exceeds what is left to refund")
+	default:
+		log.Printf("refund: card %s transaction %s: %v", vars["cardId"], vars["transactionId"], err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to post refund")
+	}
+}
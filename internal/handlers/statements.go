@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"errors"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"bankapp-microservices/internal/models"
+	"bankapp-microservices/internal/statement"
+	"bankapp-microservices/internal/store"
+	"github.com/gorilla/mux"
+)
+
+type StatementHandler struct {
+	store store.Store
+	// location defines the midnight billing cycles close at
+	location *time.Location
+}
+
+func NewStatementHandler(store store.Store, location *time.Location) *StatementHandler {
+	return &StatementHandler{store: store, location: location}
+}
+
+// GetStatements lists a credit card's statements, newest first, without their lines
+func (h *StatementHandler) GetStatements(w http.ResponseWriter, r *http.Request) {
+	card, ok := billedCreditCard(w, r, h.store)
+	if !ok {
+		return
+	}
+
+	statements := statement.History(h.store, card)
+	result := []models.Statement{}
+	for i := len(statements) - 1; i >= 0; i-- {
+		summary := *statements[i]
+		summary.Lines = nil
+		result = append(result, summary)
+	}
+
+	respondWithSuccess(w, map[string]interface{}{
+		"cardId":       card.ID,
+		"statementDay": statement.StatementDay(card),
+		"statements":   result,
+	})
+}
+
+// GetStatement returns one statement with its lines
+func (h *StatementHandler) GetStatement(w http.ResponseWriter, r *http.Request) {
+	card, ok := billedCreditCard(w, r, h.store)
+	if !ok {
+		return
+	}
+
+	stmt, exists := h.store.GetStatementByID(mux.Vars(r)["statementId"])
+	if !exists || !statement.IssuedTo(h.store, stmt, card) {
+		respondWithError(w, http.StatusNotFound, "Statement not found")
+		return
+	}
+
+	respondWithSuccess(w, stmt)
+}
+
+// DownloadStatement returns a statement as a PDF, CSV, OFX or QIF file
+func (h *StatementHandler) DownloadStatement(w http.ResponseWriter, r *http.Request) {
+	card, ok := billedCreditCard(w, r, h.store)
+	if !ok {
+		return
+	}
+
+	stmt, exists := h.store.GetStatementByID(mux.Vars(r)["statementId"])
+	if !exists || !statement.IssuedTo(h.store, stmt, card) {
+		respondWithError(w, http.StatusNotFound, "Statement not found")
+		return
+	}
+
+	format := strings.ToLower(r.URL.Query().Get("format"))
+	if format == "" {
+		format = statement.FormatPDF
+	}
+	file, err := statement.Export(stmt, card, format, h.location)
+	if errors.Is(err, statement.ErrUnknownFormat) {
+		respondWithError(w, http.StatusBadRequest, "Invalid format. Must be pdf, csv, ofx or qif")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to render statement")
+		return
+	}
+
+	w.Header().Set("Content-Type", file.ContentType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": file.Name}))
+	w.Header().Set("Content-Length", strconv.Itoa(len(file.Data)))
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	w.Write(file.Data)
+}
@@ -0,0 +1,29 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"bankapp-microservices/internal/store"
+)
+
+func TestReadsDoNotCloseCycles(t *testing.T) {
+	s := store.NewMemoryStore()
+	card := s.GetCreditCardsByUserID("testuser")[0]
+	vars := map[string]string{"cardId": card.ID}
+
+	statements := NewStatementHandler(s, time.UTC)
+	if code, response := get(t, statements.GetStatements, "/", vars, "testuser"); code != http.StatusOK {
+		t.Fatalf("GetStatements = %d %v", code, response)
+	}
+	if code, response := get(t, NewCreditCardHandler(s, time.UTC).GetCreditCard, "/", vars, "testuser"); code != http.StatusOK {
+		t.Fatalf("GetCreditCard = %d %v", code, response)
+	}
+	if code, response := get(t, NewEMIHandler(s, time.UTC).GetPlans, "/", vars, "testuser"); code != http.StatusOK {
+		t.Fatalf("GetPlans = %d %v", code, response)
+	}
+	if generated := s.GetStatementsByCardID(card.ID); len(generated) != 0 {
+		t.Errorf("reads generated %d statements", len(generated))
+	}
+}
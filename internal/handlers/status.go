@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"bankapp-microservices/internal/cardstatus"
+	"bankapp-microservices/internal/models"
+	"bankapp-microservices/internal/store"
+)
+
+// changeCardStatus applies the status change in the request body to a card
+// the caller owns and writes the response. It serves the status endpoints of
+// every card type; virtual cards report statuses by their own names.
+func changeCardStatus(w http.ResponseWriter, r *http.Request, s store.Store, cardID string, virtual bool) {
+	var req models.StatusRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	name := func(status string) string { return status }
+	if virtual {
+		name = cardstatus.VirtualName
+	}
+
+	change, err := cardstatus.Change(s, cardID, &req, time.Now())
+	var transition *cardstatus.TransitionError
+	switch {
+	case err == nil:
+	case errors.Is(err, cardstatus.ErrUnknownStatus) && virtual:
+		respondWithError(w, http.StatusBadRequest, "Invalid status. Must be Active, Frozen, PermanentlyBlocked or Cancelled")
+		return
+	case errors.Is(err, cardstatus.ErrUnknownStatus):
+		respondWithError(w, http.StatusBadRequest, "Invalid status. Must be Active, TemporarilyBlocked, PermanentlyBlocked or Closed")
+		return
+	case errors.Is(err, cardstatus.ErrReasonRequired):
+		respondWithError(w, http.StatusBadRequest, "Reason is required")
+		return
+	case errors.Is(err, cardstatus.ErrReasonTooLong):
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Reason must be at most %d characters", cardstatus.MaxReasonLength))
+		return
+	case errors.Is(err, cardstatus.ErrUnchanged):
+		respondWithError(w, http.StatusBadRequest, "Card already has this status")
+		return
+	case errors.As(err, &transition) && transition.From == models.CardStatusInactive && transition.To == models.CardStatusActive:
+		respondWithError(w, http.StatusConflict, "New cards must be activated with their card details and a PIN")
+		return
+	case errors.As(err, &transition):
+		respondWithError(w, http.StatusConflict, fmt.Sprintf("Card status cannot change from %s to %s", name(transition.From), name(transition.To)))
+		return
+	case errors.Is(err, cardstatus.ErrOutstandingBalance):
+		respondWithError(w, http.StatusConflict, "Card cannot be closed until its outstanding balance is paid")
+		return
+	case errors.Is(err, cardstatus.ErrActiveEMI):
+		respondWithError(w, http.StatusConflict, "Card cannot be closed while it has active EMI plans")
+		return
+	case errors.Is(err, cardstatus.ErrCardNotFound):
+		respondWithError(w, http.StatusNotFound, "Card not found")
+		return
+	default:
+		respondWithError(w, http.StatusInternalServerError, "Failed to update card status")
+		return
+	}
+
+	respondWithSuccess(w, map[string]interface{}{
+		"cardId":         cardID,
+		"status":         name(change.To),
+		"previousStatus": name(change.From),
+		"reason":         change.Reason,
+		"changedAt":      change.ChangedAt,
+	}, "Card status updated successfully")
+}
+
+// respondWithCardStatus writes a card's current status with its change
+// history, newest first
+func respondWithCardStatus(w http.ResponseWriter, s store.Store, cardID, status string, virtual bool) {
+	changes := s.GetCardStatusChangesByCardID(cardID)
+	history := []*models.CardStatusChange{}
+	for i := len(changes) - 1; i >= 0; i-- {
+		change := changes[i]
+		if virtual {
+			change.From, change.To = cardstatus.VirtualName(change.From), cardstatus.VirtualName(change.To)
+		}
+		history = append(history, change)
+	}
+	if virtual {
+		status = cardstatus.VirtualName(status)
+	}
+
+	respondWithSuccess(w, map[string]interface{}{
+		"cardId":  cardID,
+		"status":  status,
+		"history": history,
+	})
+}
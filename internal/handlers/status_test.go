@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"bankapp-microservices/internal/ledger"
+	"bankapp-microservices/internal/models"
+	"bankapp-microservices/internal/store"
+)
+
+func TestVirtualCardsKeepTheirStatusNames(t *testing.T) {
+	s := store.NewMemoryStore()
+	card := s.GetVirtualCardsByUserID("testuser")[0]
+	card.ExpiryYear = time.Now().Year() + 2
+	s.UpdateVirtualCard(card)
+	h := NewVirtualCardHandler(s)
+	vars := map[string]string{"cardId": card.ID}
+
+	code, response := call(t, withVars(h.UpdateStatus, vars), models.StatusRequest{Status: "Frozen", Reason: "Paused"}, "testuser")
+	if code != http.StatusOK || field(response, "data", "status") != "Frozen" || field(response, "data", "previousStatus") != "Active" {
+		t.Fatalf("freezing = %d %v", code, response)
+	}
+	if code, response := get(t, h.GetVirtualCard, "/", vars, "testuser"); code != http.StatusOK || field(response, "data", "status") != "Frozen" {
+		t.Errorf("card = %d %v, want Frozen", code, field(response, "data", "status"))
+	}
+	code, response = get(t, h.GetStatus, "/", vars, "testuser")
+	history, _ := field(response, "data", "history").([]interface{})
+	if code != http.StatusOK || field(response, "data", "status") != "Frozen" || len(history) != 1 || history[0].(map[string]interface{})["to"] != "Frozen" {
+		t.Errorf("status = %d %v", code, response)
+	}
+
+	if code, response := call(t, withVars(h.UpdateStatus, vars), models.StatusRequest{Status: "Cancelled", Reason: "Done"}, "testuser"); code != http.StatusOK || field(response, "data", "status") != "Cancelled" {
+		t.Fatalf("cancelling = %d %v", code, response)
+	}
+	_, response = get(t, h.GetVirtualCards, "/", nil, "testuser")
+	cards, _ := field(response, "data", "cards").([]interface{})
+	if len(cards) != 1 || cards[0].(map[string]interface{})["status"] != "Cancelled" {
+		t.Errorf("virtual cards = %v, want one Cancelled card", cards)
+	}
+}
+
+func TestCardListsShowExpiry(t *testing.T) {
+	s := store.NewMemoryStore()
+	card := s.GetCreditCardsByUserID("testuser")[0]
+	card.ExpiryMonth, card.ExpiryYear = 1, 2020
+	s.UpdateCreditCard(card)
+
+	_, response := get(t, NewCreditCardHandler(s, time.UTC).GetCreditCards, "/", nil, "testuser")
+	cards, _ := field(response, "data", "cards").([]interface{})
+	for _, listed := range cards {
+		listed := listed.(map[string]interface{})
+		if listed["id"] == card.ID && listed["status"] != models.CardStatusExpired {
+			t.Errorf("expired card listed as %v", listed["status"])
+		}
+	}
+}
+
+func TestCloseCreditCardWithBalance(t *testing.T) {
+	s := store.NewMemoryStore()
+	card := s.GetCreditCardsByUserID("testuser")[0]
+	if err := s.PostJournalEntry(ledger.Transfer(card.LedgerAccountID, ledger.AccountMerchantSettlement, 10000, "Purchase", "", time.Now())); err != nil {
+		t.Fatal(err)
+	}
+
+	h := NewCreditCardHandler(s, time.UTC)
+	code, _ := call(t, withVars(h.UpdateStatus, map[string]string{"cardId": card.ID}), models.StatusRequest{Status: models.CardStatusClosed, Reason: "Moving banks"}, "testuser")
+	if code != http.StatusConflict {
+		t.Errorf("closing a card with a balance = %d, want 409", code)
+	}
+}
@@ -0,0 +1,364 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"bankapp-microservices/internal/middleware"
+	"bankapp-microservices/internal/models"
+	"bankapp-microservices/internal/store"
+)
+
+// Transaction history sort orders
+const (
+	sortDateDesc   = "date_desc"
+	sortDateAsc    = "date_asc"
+	sortAmountDesc = "amount_desc"
+	sortAmountAsc  = "amount_asc"
+)
+
+// Card kinds accepted by the cardType filter of the unified history
+const (
+	cardKindCredit  = "credit"
+	cardKindDebit   = "debit"
+	cardKindVirtual = "virtual"
+)
+
+// transactionQuery holds the pagination, filter and sort parameters shared by
+// every transaction history endpoint
+type transactionQuery struct {
+	page      int
+	limit     int
+	startDate *time.Time
+	endDate   *time.Time
+	minAmount *float64
+	maxAmount *float64
+	merchant  string
+	status    string
+	txnType   string
+	sort      string
+	cursor    *transactionCursor
+	// offset is set when the client asked for a page number
+	offset bool
+	// cursorRequested is set when the client sent a cursor or
+	// pagination=cursor; everything else stays offset paginated
+	cursorRequested bool
+}
+
+// Transaction history page sizes. Only cursor pages are capped; offset pages
+// take any limit, as they always have.
+const (
+	defaultTransactionLimit = 20
+	maxTransactionLimit     = 100
+)
+
+// Transaction history pagination modes
+const (
+	paginationOffset = "offset"
+	paginationCursor = "cursor"
+)
+
+type TransactionHandler struct {
+	store store.Store
+}
+
+func NewTransactionHandler(store store.Store) *TransactionHandler {
+	return &TransactionHandler{store: store}
+}
+
+// GetTransactions returns the history of every card the user holds, optionally
+// narrowed to one card type
+func (h *TransactionHandler) GetTransactions(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middleware.UserIDKey).(string)
+
+	cardType := strings.ToLower(r.URL.Query().Get("cardType"))
+	if cardType != "" && cardType != cardKindCredit && cardType != cardKindDebit && cardType != cardKindVirtual {
+		respondWithError(w, http.StatusBadRequest, "Invalid cardType. Must be credit, debit or virtual")
+		return
+	}
+
+	var cardIDs []string
+	if cardType == "" || cardType == cardKindCredit {
+		for _, card := range h.store.GetCreditCardsByUserID(userID) {
+			cardIDs = append(cardIDs, card.ID)
+		}
+	}
+	if cardType == "" || cardType == cardKindDebit {
+		for _, card := range h.store.GetDebitCardsByUserID(userID) {
+			cardIDs = append(cardIDs, card.ID)
+		}
+	}
+	if cardType == "" || cardType == cardKindVirtual {
+		for _, card := range h.store.GetVirtualCardsByUserID(userID) {
+			cardIDs = append(cardIDs, card.ID)
+		}
+	}
+
+	respondWithTransactions(w, r, h.store, cardIDs...)
+}
+
+// respondWithTransactions writes one page of the given cards' transactions,
+// filtered and sorted according to the request's query parameters. History is
+// offset paginated unless the client sends a cursor or pagination=cursor on a
+// date ordered list, which is then cursor paginated from the store's index.
+func respondWithTransactions(w http.ResponseWriter, r *http.Request, s store.Store, cardIDs ...string) {
+	query, msg := parseTransactionQuery(r)
+	if msg != "" {
+		respondWithError(w, http.StatusBadRequest, msg)
+		return
+	}
+
+	if query.cursorRequested && (query.offset || query.sort == sortAmountDesc || query.sort == sortAmountAsc) {
+		respondWithError(w, http.StatusBadRequest, "Cursor pagination cannot be combined with page or an amount sort")
+		return
+	}
+	if !query.cursorRequested {
+		var transactions []*models.Transaction
+		for _, cardID := range cardIDs {
+			transactions = append(transactions, s.GetTransactionsByCardID(cardID)...)
+		}
+		respondWithTransactionPage(w, query, transactions)
+		return
+	}
+
+	storeQuery := store.TransactionQuery{
+		CardIDs:    cardIDs,
+		Descending: query.sort == sortDateDesc,
+		Match:      query.matches,
+		Limit:      query.limit,
+	}
+	if query.startDate != nil {
+		storeQuery.From = *query.startDate
+	}
+	if query.endDate != nil {
+		storeQuery.To = *query.endDate
+	}
+	if query.cursor != nil {
+		key := query.cursor.key()
+		if query.cursor.Before {
+			storeQuery.Before = &key
+		} else {
+			storeQuery.After = &key
+		}
+	}
+	transactions, more := s.ListTransactions(storeQuery)
+
+	// Coming back from a later page there is always a next page, and coming
+	// from an earlier one there is always a previous page
+	pagination := &models.CursorPagination{Limit: query.limit}
+	hasNext := more
+	hasPrev := query.cursor != nil && !query.cursor.Before
+	if query.cursor != nil && query.cursor.Before {
+		hasNext, hasPrev = true, more
+	}
+	if len(transactions) > 0 {
+		if hasNext {
+			pagination.NextCursor = encodeCursor(store.KeyOf(transactions[len(transactions)-1]), query.sort, false)
+		}
+		if hasPrev {
+			pagination.PrevCursor = encodeCursor(store.KeyOf(transactions[0]), query.sort, true)
+		}
+	}
+
+	page := []models.Transaction{}
+	for _, txn := range transactions {
+		page = append(page, *txn)
+	}
+	respondWithSuccess(w, models.TransactionsResponse{
+		Transactions: page,
+		Cursor:       pagination,
+	})
+}
+
+// respondWithTransactionPage filters, sorts and offset paginates transactions
+func respondWithTransactionPage(w http.ResponseWriter, query transactionQuery, transactions []*models.Transaction) {
+	var filtered []*models.Transaction
+	for _, txn := range transactions {
+		if query.matches(txn) {
+			filtered = append(filtered, txn)
+		}
+	}
+	sortTransactions(filtered, query.sort)
+
+	// Paginate
+	total := len(filtered)
+	totalPages := (total + query.limit - 1) / query.limit
+	start := (query.page - 1) * query.limit
+	end := start + query.limit
+	if end > total {
+		end = total
+	}
+
+	paginated := []models.Transaction{}
+	if start < total {
+		for _, txn := range filtered[start:end] {
+			paginated = append(paginated, *txn)
+		}
+	}
+
+	respondWithSuccess(w, models.TransactionsResponse{
+		Transactions: paginated,
+		Pagination: &models.Pagination{
+			Page:       query.page,
+			Limit:      query.limit,
+			Total:      total,
+			TotalPages: totalPages,
+		},
+	})
+}
+
+// transactionCursor is the decoded form of an opaque page cursor. It records
+// the sort order it was issued for so it cannot be replayed against another.
+type transactionCursor struct {
+	Date   int64  `json:"d"`
+	ID     string `json:"i"`
+	Sort   string `json:"s"`
+	Before bool   `json:"b,omitempty"`
+}
+
+func encodeCursor(key store.TransactionKey, sort string, before bool) string {
+	data, _ := json.Marshal(transactionCursor{Date: key.Date.UnixNano(), ID: key.ID, Sort: sort, Before: before})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(value string) (*transactionCursor, bool) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, false
+	}
+	var c transactionCursor
+	if err := json.Unmarshal(data, &c); err != nil || c.ID == "" {
+		return nil, false
+	}
+	return &c, true
+}
+
+func (c *transactionCursor) key() store.TransactionKey {
+	return store.TransactionKey{Date: time.Unix(0, c.Date), ID: c.ID}
+}
+
+// parseTransactionQuery reads the history query parameters. Bad page, limit
+// and date values fall back to their defaults as they always have; the other
+// parameters return a message describing the problem.
+func parseTransactionQuery(r *http.Request) (transactionQuery, string) {
+	params := r.URL.Query()
+	query := transactionQuery{page: 1, limit: defaultTransactionLimit, sort: sortDateDesc}
+
+	if p := params.Get("page"); p != "" {
+		query.offset = true
+		if parsed, err := strconv.Atoi(p); err == nil && parsed > 0 {
+			query.page = parsed
+		}
+	}
+	if l := params.Get("limit"); l != "" {
+		if parsed, err := strconv.Atoi(l); err == nil && parsed > 0 {
+			query.limit = parsed
+		}
+	}
+	if s := params.Get("startDate"); s != "" {
+		if startDate, err := time.Parse("2006-01-02", s); err == nil {
+			query.startDate = &startDate
+		}
+	}
+	if e := params.Get("endDate"); e != "" {
+		if endDate, err := time.Parse("2006-01-02", e); err == nil {
+			endDate = endDate.Add(24 * time.Hour)
+			query.endDate = &endDate
+		}
+	}
+
+	for name, target := range map[string]**float64{"minAmount": &query.minAmount, "maxAmount": &query.maxAmount} {
+		if v := params.Get(name); v != "" {
+			parsed, err := strconv.ParseFloat(v, 64)
+			if err != nil || parsed < 0 {
+				return query, name + " must be a non-negative number"
+			}
+			*target = &parsed
+		}
+	}
+	if query.minAmount != nil && query.maxAmount != nil && *query.minAmount > *query.maxAmount {
+		return query, "minAmount cannot be greater than maxAmount"
+	}
+
+	query.merchant = strings.ToLower(strings.TrimSpace(params.Get("merchant")))
+	query.status = strings.TrimSpace(params.Get("status"))
+	query.txnType = strings.TrimSpace(params.Get("type"))
+
+	if s := params.Get("sort"); s != "" {
+		switch s {
+		case sortDateDesc, sortDateAsc, sortAmountDesc, sortAmountAsc:
+			query.sort = s
+		default:
+			return query, "Invalid sort. Must be date_desc, date_asc, amount_desc or amount_asc"
+		}
+	}
+
+	if c := params.Get("cursor"); c != "" {
+		cursor, ok := decodeCursor(c)
+		if !ok || cursor.Sort != query.sort {
+			return query, "Invalid cursor"
+		}
+		query.cursor = cursor
+		query.cursorRequested = true
+	}
+
+	switch params.Get("pagination") {
+	case "", paginationOffset:
+	case paginationCursor:
+		query.cursorRequested = true
+	default:
+		return query, "Invalid pagination. Must be offset or cursor"
+	}
+	if query.cursorRequested {
+		query.limit = min(query.limit, maxTransactionLimit)
+	}
+	return query, ""
+}
+
+// matches reports whether txn passes every filter of the query
+func (q *transactionQuery) matches(txn *models.Transaction) bool {
+	if q.startDate != nil && txn.Date.Before(*q.startDate) {
+		return false
+	}
+	if q.endDate != nil && !txn.Date.Before(*q.endDate) {
+		return false
+	}
+	if q.minAmount != nil && txn.Amount < *q.minAmount {
+		return false
+	}
+	if q.maxAmount != nil && txn.Amount > *q.maxAmount {
+		return false
+	}
+	if q.merchant != "" && !strings.Contains(strings.ToLower(txn.Merchant), q.merchant) {
+		return false
+	}
+	if q.status != "" && !strings.EqualFold(txn.Status, q.status) {
+		return false
+	}
+	if q.txnType != "" && !strings.EqualFold(txn.Type, q.txnType) {
+		return false
+	}
+	return true
+}
+
+// sortTransactions orders transactions in place. Ties keep their recorded order.
+func sortTransactions(transactions []*models.Transaction, order string) {
+	sort.SliceStable(transactions, func(i, j int) bool {
+		a, b := transactions[i], transactions[j]
+		switch order {
+		case sortDateAsc:
+			return a.Date.Before(b.Date)
+		case sortAmountDesc:
+			return a.Amount > b.Amount
+		case sortAmountAsc:
+			return a.Amount < b.Amount
+		default:
+			return a.Date.After(b.Date)
+		}
+	})
+}
@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"bankapp-microservices/internal/middleware"
+	"bankapp-microservices/internal/models"
+	"bankapp-microservices/internal/store"
+	"github.com/gorilla/mux"
+)
+
+// get sends a GET request for target with the route variables vars to handler
+// as userID and decodes the JSON response
+func get(t *testing.T, handler http.HandlerFunc, target string, vars map[string]string, userID string) (int, map[string]interface{}) {
+	t.Helper()
+	r := httptest.NewRequest(http.MethodGet, target, nil)
+	r = mux.SetURLVars(r, vars)
+	r = r.WithContext(context.WithValue(r.Context(), middleware.UserIDKey, userID))
+	w := httptest.NewRecorder()
+	handler(w, r)
+
+	var response map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("response is not JSON: %s", w.Body.String())
+	}
+	return w.Code, response
+}
+
+func TestTransactionPagination(t *testing.T) {
+	s := store.NewMemoryStore()
+	card := s.GetCreditCardsByUserID("testuser")[0]
+	start := time.Now().Add(-time.Hour)
+	for i := 0; i < 150; i++ {
+		s.AddTransaction(&models.Transaction{ID: fmt.Sprintf("pagination-%03d", i), CardID: card.ID, Amount: 10, Date: start.Add(time.Duration(i) * time.Second), Status: models.TransactionStatusApproved})
+	}
+	h := NewTransactionHandler(s)
+
+	code, response := get(t, h.GetTransactions, "/api/transactions?cardType=credit", nil, "testuser")
+	if code != http.StatusOK || field(response, "data", "pagination") == nil || field(response, "data", "cursor") != nil {
+		t.Fatalf("default request = %d %v, want offset pagination", code, field(response, "data", "pagination"))
+	}
+	if limit := field(response, "data", "pagination", "limit"); limit != float64(defaultTransactionLimit) {
+		t.Errorf("default limit = %v", limit)
+	}
+
+	// A limit alone keeps the offset shape and is not capped
+	code, response = get(t, h.GetTransactions, "/api/transactions?cardType=credit&limit=500", nil, "testuser")
+	if code != http.StatusOK || field(response, "data", "cursor") != nil || field(response, "data", "pagination", "limit") != float64(500) {
+		t.Errorf("limit without page = %d %v, want offset pagination with limit 500", code, field(response, "data", "pagination"))
+	}
+	if txns, _ := field(response, "data", "transactions").([]interface{}); len(txns) != 150 {
+		t.Errorf("offset page with limit 500 has %d transactions, want 150", len(txns))
+	}
+
+	code, response = get(t, h.GetTransactions, "/api/transactions?cardType=credit&pagination=cursor&limit=500", nil, "testuser")
+	next, _ := field(response, "data", "cursor", "nextCursor").(string)
+	if code != http.StatusOK || next == "" || field(response, "data", "pagination") != nil {
+		t.Fatalf("pagination=cursor = %d %v, want cursor pagination", code, field(response, "data", "cursor"))
+	}
+	if txns, _ := field(response, "data", "transactions").([]interface{}); len(txns) != maxTransactionLimit {
+		t.Errorf("cursor page has %d transactions, want %d", len(txns), maxTransactionLimit)
+	}
+
+	code, response = get(t, h.GetTransactions, "/api/transactions?cardType=credit&cursor="+next, nil, "testuser")
+	if code != http.StatusOK || field(response, "data", "cursor") == nil {
+		t.Errorf("cursor request = %d %v, want cursor pagination", code, response)
+	}
+
+	if code, _ := get(t, h.GetTransactions, "/api/transactions?page=1&cursor="+next, nil, "testuser"); code != http.StatusBadRequest {
+		t.Errorf("cursor with page = %d, want 400", code)
+	}
+	if code, _ := get(t, h.GetTransactions, "/api/transactions?pagination=cursor&sort=amount_desc", nil, "testuser"); code != http.StatusBadRequest {
+		t.Errorf("cursor pagination with an amount sort = %d, want 400", code)
+	}
+	if code, _ := get(t, h.GetTransactions, "/api/transactions?pagination=keyset", nil, "testuser"); code != http.StatusBadRequest {
+		t.Errorf("unknown pagination = %d, want 400", code)
+	}
+}
+
+func TestCardTransactionHistory(t *testing.T) {
+	s := store.NewMemoryStore()
+	card := s.GetDebitCardsByUserID("testuser")[0]
+	now := time.Now()
+	s.AddTransaction(&models.Transaction{ID: "history-1", CardID: card.ID, Amount: 40, Merchant: "Corner Cafe", Type: models.TransactionTypePurchase, Status: models.TransactionStatusApproved, Date: now.Add(-2 * time.Minute)})
+	s.AddTransaction(&models.Transaction{ID: "history-2", CardID: card.ID, Amount: 2000, Merchant: "City ATM", Type: models.TransactionTypeCashWithdrawal, Status: models.TransactionStatusApproved, Date: now.Add(-time.Minute)})
+	h := NewDebitCardHandler(s)
+	vars := map[string]string{"cardId": card.ID}
+
+	code, response := get(t, h.GetTransactions, "/?merchant=cafe", vars, "testuser")
+	txns, _ := field(response, "data", "transactions").([]interface{})
+	if code != http.StatusOK || len(txns) != 1 || field(txns[0].(map[string]interface{}), "id") != "history-1" {
+		t.Errorf("merchant filter = %d %v, want only history-1", code, txns)
+	}
+
+	if code, _ := get(t, h.GetTransactions, "/?sort=price", vars, "testuser"); code != http.StatusBadRequest {
+		t.Errorf("invalid sort = %d, want 400", code)
+	}
+	if code, _ := get(t, h.GetTransactions, "/", vars, "someone-else"); code != http.StatusForbidden {
+		t.Errorf("another user's card = %d, want 403", code)
+	}
+	if code, _ := get(t, h.GetTransactions, "/", map[string]string{"cardId": "missing"}, "testuser"); code != http.StatusNotFound {
+		t.Errorf("unknown card = %d, want 404", code)
+	}
+}
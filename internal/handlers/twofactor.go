@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"bankapp-microservices/internal/cardpin"
+	"bankapp-microservices/internal/middleware"
+	"bankapp-microservices/internal/models"
+	"bankapp-microservices/internal/password"
+	"bankapp-microservices/internal/store"
+	"bankapp-microservices/internal/totp"
+)
+
+const otpIssuer = "BankApp"
+
+type TwoFactorHandler struct {
+	store store.Store
+}
+
+func NewTwoFactorHandler(store store.Store) *TwoFactorHandler {
+	return &TwoFactorHandler{store: store}
+}
+
+// EnrollOTP generates a new TOTP secret. It only becomes active once a code
+// generated from it is confirmed.
+func (h *TwoFactorHandler) EnrollOTP(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middleware.UserIDKey).(string)
+	user, exists := h.store.GetUserByID(userID)
+	if !exists {
+		respondWithError(w, http.StatusNotFound, "User not found")
+		return
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to generate secret")
+		return
+	}
+
+	user.PendingOTPSecret = secret
+	h.store.UpdateUser(user)
+
+	respondWithSuccess(w, map[string]interface{}{
+		"secret":     secret,
+		"otpauthUri": totp.URI(otpIssuer, user.Email, secret),
+		"digits":     totp.Digits,
+		"period":     totp.Period,
+	}, "Scan the code with your authenticator app and confirm it")
+}
+
+// ConfirmOTP activates the pending TOTP secret if the code matches
+func (h *TwoFactorHandler) ConfirmOTP(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middleware.UserIDKey).(string)
+	user, exists := h.store.GetUserByID(userID)
+	if !exists {
+		respondWithError(w, http.StatusNotFound, "User not found")
+		return
+	}
+
+	var req models.OTPConfirmRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if user.PendingOTPSecret == "" {
+		respondWithError(w, http.StatusBadRequest, "No OTP enrollment in progress")
+		return
+	}
+
+	counter, valid := totp.Validate(user.PendingOTPSecret, req.Code, time.Now())
+	if !valid {
+		respondWithError(w, http.StatusBadRequest, "Invalid verification code")
+		return
+	}
+
+	user.OTPSecret = user.PendingOTPSecret
+	user.PendingOTPSecret = ""
+	user.LastOTPCounter = counter
+	user.RequiresOTP = true
+	h.store.UpdateUser(user)
+
+	respondWithSuccess(w, nil, "OTP enabled successfully")
+}
+
+// SetLoginPIN sets the PIN used as a second login factor
+func (h *TwoFactorHandler) SetLoginPIN(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middleware.UserIDKey).(string)
+	user, exists := h.store.GetUserByID(userID)
+	if !exists {
+		respondWithError(w, http.StatusNotFound, "User not found")
+		return
+	}
+
+	var req models.LoginPINRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if req.PIN != req.ConfirmPIN {
+		respondWithError(w, http.StatusBadRequest, "PINs do not match")
+		return
+	}
+
+	if !isNumeric(req.PIN) || len(req.PIN) < 4 || len(req.PIN) > 6 {
+		respondWithError(w, http.StatusBadRequest, "PIN must be 4 to 6 digits")
+		return
+	}
+
+	if err := cardpin.Weak(req.PIN, user.DateOfBirth); err != nil {
+		respondWithError(w, http.StatusBadRequest, "PIN is too easy to guess")
+		return
+	}
+
+	pinHash, err := password.Hash(req.PIN)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to set PIN")
+		return
+	}
+
+	user.PINHash = pinHash
+	user.RequiresPIN = true
+	h.store.UpdateUser(user)
+
+	respondWithSuccess(w, nil, "Login PIN set successfully")
+}
+
+func isNumeric(value string) bool {
+	if value == "" {
+		return false
+	}
+	for _, c := range value {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
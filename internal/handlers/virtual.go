@@ -2,11 +2,14 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"math/rand"
 	"net/http"
 	"strconv"
 	"time"
 
+	"bankapp-microservices/internal/cardstatus"
+	"bankapp-microservices/internal/ledger"
 	"bankapp-microservices/internal/middleware"
 	"bankapp-microservices/internal/models"
 	"bankapp-microservices/internal/store"
@@ -14,10 +17,10 @@ import (
 )
 
 type VirtualCardHandler struct {
-	store *store.Store
+	store store.Store
 }
 
-func NewVirtualCardHandler(store *store.Store) *VirtualCardHandler {
+func NewVirtualCardHandler(store store.Store) *VirtualCardHandler {
 	return &VirtualCardHandler{store: store}
 }
 
@@ -39,7 +42,7 @@ func (h *VirtualCardHandler) GetVirtualCards(w http.ResponseWriter, r *http.Requ
 			"spendingLimit":    card.SpendingLimit,
 			"remainingBalance": card.RemainingBalance,
 			"createdAt":        card.CreatedAt.Format(time.RFC3339),
-			"status":           card.Status,
+			"status":           virtualStatus(card),
 			"linkedAccountId":  card.LinkedAccountID,
 		}
 		maskedCards = append(maskedCards, maskedCard)
@@ -65,6 +68,7 @@ func (h *VirtualCardHandler) GetVirtualCard(w http.ResponseWriter, r *http.Reque
 	}
 
 	card.CVV = "***"
+	card.Status = virtualStatus(card)
 	respondWithSuccess(w, card)
 }
 
@@ -98,23 +102,37 @@ func (h *VirtualCardHandler) CreateVirtualCard(w http.ResponseWriter, r *http.Re
 	}
 
 	card := &models.VirtualCard{
-		ID:               models.GenerateID(),
-		CardNumber:       generateCardNumber(),
-		CVV:              generateCVV(),
-		ExpiryMonth:      int(expiryDate.Month()),
-		ExpiryYear:       expiryDate.Year(),
-		CardholderName:   "John Doe", // Get from user
-		CardType:         req.CardType,
-		Nickname:         req.Nickname,
-		SpendingLimit:    req.SpendingLimit,
-		RemainingBalance: req.SpendingLimit,
-		CreatedAt:        now,
-		Status:           "Active",
-		LinkedAccountID:  req.LinkedAccountID,
-		UserID:           userID,
+		ID:              models.GenerateID(),
+		CardNumber:      generateCardNumber(),
+		CVV:             generateCVV(),
+		ExpiryMonth:     int(expiryDate.Month()),
+		ExpiryYear:      expiryDate.Year(),
+		CardholderName:  "John Doe", // Get from user
+		CardType:        req.CardType,
+		Nickname:        req.Nickname,
+		SpendingLimit:   req.SpendingLimit,
+		CreatedAt:       now,
+		Status:          models.CardStatusActive,
+		LinkedAccountID: req.LinkedAccountID,
+		UserID:          userID,
 	}
-
+	card.LedgerAccountID = ledger.VirtualCardAccountID(card.ID)
+
+	h.store.CreateLedgerAccount(&models.LedgerAccount{
+		ID:       card.LedgerAccountID,
+		Type:     ledger.TypeAllowance,
+		Name:     card.Nickname + " allowance",
+		Currency: ledger.Currency,
+		UserID:   userID,
+	})
 	h.store.CreateVirtualCard(card)
+	if req.SpendingLimit > 0 {
+		entry := ledger.Transfer(ledger.AccountVirtualAllowance, card.LedgerAccountID, ledger.ToMinor(req.SpendingLimit), "Spending limit", card.ID, now)
+		if err := h.store.PostJournalEntry(entry); err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Failed to fund virtual card")
+			return
+		}
+	}
 
 	respondWithSuccess(w, card, "Virtual card created successfully")
 }
@@ -147,6 +165,7 @@ func (h *VirtualCardHandler) UpdateVirtualCard(w http.ResponseWriter, r *http.Re
 
 	h.store.UpdateVirtualCard(card)
 
+	card.Status = virtualStatus(card)
 	respondWithSuccess(w, card, "Virtual card updated successfully")
 }
 
@@ -172,22 +191,46 @@ func (h *VirtualCardHandler) UpdateSpendingLimit(w http.ResponseWriter, r *http.
 		return
 	}
 
-	card.SpendingLimit = req.SpendingLimit
-	// Adjust remaining balance proportionally
-	if card.SpendingLimit > 0 {
-		card.RemainingBalance = (card.RemainingBalance / card.SpendingLimit) * req.SpendingLimit
+	if req.SpendingLimit < 0 {
+		respondWithError(w, http.StatusBadRequest, "Spending limit cannot be negative")
+		return
+	}
+
+	// Move the difference between the old and new limit in or out of the card's
+	// allowance; what has already been spent stays spent
+	delta := ledger.ToMinor(req.SpendingLimit) - ledger.ToMinor(card.SpendingLimit)
+	if ledger.ToMinor(card.RemainingBalance)+delta < 0 {
+		respondWithError(w, http.StatusBadRequest, "Spending limit is below the amount already spent")
+		return
+	}
+	if delta != 0 {
+		from, to := ledger.AccountVirtualAllowance, card.LedgerAccountID
+		if delta < 0 {
+			from, to, delta = to, from, -delta
+		}
+		err := h.store.PostJournalEntry(ledger.Transfer(from, to, delta, "Spending limit change", card.ID, time.Now()))
+		if errors.Is(err, ledger.ErrInsufficientFunds) {
+			respondWithError(w, http.StatusBadRequest, "Spending limit is below the amount already spent")
+			return
+		}
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Failed to update spending limit")
+			return
+		}
 	}
 
+	card.SpendingLimit = req.SpendingLimit
 	h.store.UpdateVirtualCard(card)
 
 	respondWithSuccess(w, map[string]interface{}{
 		"cardId":           cardID,
 		"spendingLimit":    card.SpendingLimit,
-		"remainingBalance": card.RemainingBalance,
+		"remainingBalance": ledger.ToMajor(h.store.GetAccountBalance(card.LedgerAccountID)),
 	}, "Spending limit updated successfully")
 }
 
-func (h *VirtualCardHandler) UpdateStatus(w http.ResponseWriter, r *http.Request) {
+// GetStatus returns the card's status with the history of its changes
+func (h *VirtualCardHandler) GetStatus(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	cardID := vars["cardId"]
 
@@ -203,25 +246,27 @@ func (h *VirtualCardHandler) UpdateStatus(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	var req models.StatusRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+	respondWithCardStatus(w, h.store, card.ID, cardstatus.Current(card.Status, card.ExpiryMonth, card.ExpiryYear, time.Now()), true)
+}
+
+// UpdateStatus freezes, unfreezes, hotlists or cancels the card
+func (h *VirtualCardHandler) UpdateStatus(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	cardID := vars["cardId"]
+
+	card, exists := h.store.GetVirtualCardByID(cardID)
+	if !exists {
+		respondWithError(w, http.StatusNotFound, "Virtual card not found")
 		return
 	}
 
-	validStatuses := map[string]bool{"Active": true, "Frozen": true, "Cancelled": true}
-	if !validStatuses[req.Status] {
-		respondWithError(w, http.StatusBadRequest, "Invalid status. Must be Active, Frozen, or Cancelled")
+	userID := r.Context().Value(middleware.UserIDKey).(string)
+	if card.UserID != userID {
+		respondWithError(w, http.StatusForbidden, "Access denied")
 		return
 	}
 
-	card.Status = req.Status
-	h.store.UpdateVirtualCard(card)
-
-	respondWithSuccess(w, map[string]interface{}{
-		"cardId": cardID,
-		"status": card.Status,
-	}, "Card status updated successfully")
+	changeCardStatus(w, r, h.store, card.ID, true)
 }
 
 func (h *VirtualCardHandler) DeleteVirtualCard(w http.ResponseWriter, r *http.Request) {
@@ -240,6 +285,19 @@ func (h *VirtualCardHandler) DeleteVirtualCard(w http.ResponseWriter, r *http.Re
 		return
 	}
 
+	// Return the unspent allowance so the card's ledger account closes at zero
+	if remaining := ledger.ToMinor(card.RemainingBalance); remaining > 0 {
+		entry := ledger.Transfer(card.LedgerAccountID, ledger.AccountVirtualAllowance, remaining, "Card deleted", card.ID, time.Now())
+		err := h.store.PostJournalEntry(entry)
+		if errors.Is(err, ledger.ErrInsufficientFunds) {
+			respondWithError(w, http.StatusConflict, "Card was used while it was being deleted, try again")
+			return
+		}
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Failed to close virtual card")
+			return
+		}
+	}
 	h.store.DeleteVirtualCard(cardID)
 
 	respondWithSuccess(w, nil, "Virtual card deleted successfully")
@@ -290,71 +348,13 @@ func (h *VirtualCardHandler) GetTransactions(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	transactions := h.store.GetTransactionsByCardID(cardID)
-
-	// Parse query parameters
-	page := 1
-	limit := 20
-	if p := r.URL.Query().Get("page"); p != "" {
-		if parsed, err := strconv.Atoi(p); err == nil && parsed > 0 {
-			page = parsed
-		}
-	}
-	if l := r.URL.Query().Get("limit"); l != "" {
-		if parsed, err := strconv.Atoi(l); err == nil && parsed > 0 {
-			limit = parsed
-		}
-	}
-
-	// Filter by date if provided
-	var filtered []*models.Transaction
-	startDateStr := r.URL.Query().Get("startDate")
-	endDateStr := r.URL.Query().Get("endDate")
-
-	for _, txn := range transactions {
-		if startDateStr != "" {
-			if startDate, err := time.Parse("2006-01-02", startDateStr); err == nil {
-				if txn.Date.Before(startDate) {
-					continue
-				}
-			}
-		}
-		if endDateStr != "" {
-			if endDate, err := time.Parse("2006-01-02", endDateStr); err == nil {
-				endDate = endDate.Add(24 * time.Hour)
-				if txn.Date.After(endDate) {
-					continue
-				}
-			}
-		}
-		filtered = append(filtered, txn)
-	}
-
-	// Paginate
-	total := len(filtered)
-	totalPages := (total + limit - 1) / limit
-	start := (page - 1) * limit
-	end := start + limit
-	if end > total {
-		end = total
-	}
-
-	var paginated []models.Transaction
-	if start < total {
-		for _, txn := range filtered[start:end] {
-			paginated = append(paginated, *txn)
-		}
-	}
+	respondWithTransactions(w, r, h.store, cardID)
+}
 
-	respondWithSuccess(w, models.TransactionsResponse{
-		Transactions: paginated,
-		Pagination: models.Pagination{
-			Page:       page,
-			Limit:      limit,
-			Total:      total,
-			TotalPages: totalPages,
-		},
-	})
+// virtualStatus returns the card's status as of now by the name virtual
+// cards have always reported it with
+func virtualStatus(card *models.VirtualCard) string {
+	return cardstatus.VirtualName(cardstatus.Current(card.Status, card.ExpiryMonth, card.ExpiryYear, time.Now()))
 }
 
 func generateCardNumber() string {
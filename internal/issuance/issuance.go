@@ -0,0 +1,114 @@
+// Package issuance generates the numbers of new physical cards and tracks
+// their dispatch from request to activation.
+package issuance
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+
+	"bankapp-microservices/internal/models"
+	"bankapp-microservices/internal/store"
+)
+
+// ValidityYears is how long a new card is valid for
+const ValidityYears = 5
+
+// Time from request to each dispatch stage
+const (
+	PrintDelay    = 24 * time.Hour
+	ShipDelay     = 2 * 24 * time.Hour
+	DeliveryDelay = 7 * 24 * time.Hour
+)
+
+// CardNumber generates a card number on the same BIN as existing with a
+// valid Luhn check digit
+func CardNumber(existing string) string {
+	bin := "4532"
+	if len(existing) >= 6 {
+		bin = existing[:6]
+	}
+	number := bin + digits(15-len(bin))
+	return number + strconv.Itoa(luhnCheckDigit(number))
+}
+
+func luhnCheckDigit(number string) int {
+	sum := 0
+	for i := len(number) - 1; i >= 0; i-- {
+		d := int(number[i] - '0')
+		// Doubling starts with the digit next to the check digit
+		if (len(number)-i)%2 == 1 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+	}
+	return (10 - sum%10) % 10
+}
+
+// CVV generates a card verification value
+func CVV() string {
+	return digits(3)
+}
+
+// Expiry returns the month and year a card issued now expires
+func Expiry(now time.Time) (int, int) {
+	return int(now.Month()), now.Year() + ValidityYears
+}
+
+func digits(n int) string {
+	var b strings.Builder
+	for i := 0; i < n; i++ {
+		b.WriteString(strconv.Itoa(rand.Intn(10)))
+	}
+	return b.String()
+}
+
+// Describe names a card by the last four digits of its number
+func Describe(cardNumber string) string {
+	return fmt.Sprintf("card ending %s", cardNumber[len(cardNumber)-4:])
+}
+
+// NewDispatch returns the dispatch of a card requested now. The caller saves it.
+func NewDispatch(cardID, userID string, now time.Time) *models.CardDispatch {
+	return &models.CardDispatch{
+		ID:                models.GenerateID(),
+		CardID:            cardID,
+		UserID:            userID,
+		Status:            models.DispatchRequested,
+		TrackingNumber:    "DSP" + digits(10),
+		RequestedAt:       now,
+		EstimatedDelivery: now.Add(DeliveryDelay),
+	}
+}
+
+// Track brings a dispatch up to date as of now and returns it. Cards are
+// printed, shipped and delivered on a fixed schedule after the request.
+func Track(s store.Store, d *models.CardDispatch, now time.Time) *models.CardDispatch {
+	updated := *d
+	changed := false
+	stage := func(at **time.Time, delay time.Duration, status string) {
+		if *at != nil || now.Before(d.RequestedAt.Add(delay)) {
+			return
+		}
+		t := d.RequestedAt.Add(delay)
+		*at = &t
+		changed = true
+		// An activated card stays activated whatever the courier reports
+		if updated.ActivatedAt == nil {
+			updated.Status = status
+		}
+	}
+	stage(&updated.PrintedAt, PrintDelay, models.DispatchPrinted)
+	stage(&updated.ShippedAt, ShipDelay, models.DispatchShipped)
+	stage(&updated.DeliveredAt, DeliveryDelay, models.DispatchDelivered)
+
+	if changed {
+		s.SetCardDispatch(&updated)
+	}
+	return &updated
+}
@@ -0,0 +1,91 @@
+package issuance
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"bankapp-microservices/internal/models"
+	"bankapp-microservices/internal/store"
+)
+
+// luhnValid reports whether number passes the Luhn check
+func luhnValid(number string) bool {
+	return luhnCheckDigit(number[:len(number)-1]) == int(number[len(number)-1]-'0')
+}
+
+func TestCardNumber(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		number := CardNumber("5412751234567890")
+		if len(number) != 16 || !strings.HasPrefix(number, "541275") || !luhnValid(number) {
+			t.Fatalf("CardNumber = %s, want 16 Luhn valid digits on BIN 541275", number)
+		}
+	}
+	if number := CardNumber(""); len(number) != 16 || !strings.HasPrefix(number, "4532") || !luhnValid(number) {
+		t.Errorf("CardNumber without a BIN = %s, want 16 Luhn valid digits on 4532", number)
+	}
+}
+
+func TestLuhnCheckDigit(t *testing.T) {
+	// Well known test numbers
+	for _, number := range []string{"4111111111111111", "5500005555555559", "79927398713"} {
+		if !luhnValid(number) {
+			t.Errorf("%s failed the Luhn check", number)
+		}
+	}
+}
+
+func TestExpiryAndDescribe(t *testing.T) {
+	if month, year := Expiry(time.Date(2025, 3, 31, 0, 0, 0, 0, time.UTC)); month != 3 || year != 2030 {
+		t.Errorf("Expiry = %d/%d, want 3/2030", month, year)
+	}
+	if got := Describe("4532123456789012"); got != "card ending 9012" {
+		t.Errorf("Describe = %q", got)
+	}
+}
+
+func TestTrack(t *testing.T) {
+	s := store.NewMemoryStore()
+	requested := time.Date(2025, 6, 1, 10, 0, 0, 0, time.UTC)
+	d := NewDispatch("card-1", "testuser", requested)
+	if d.Status != models.DispatchRequested || !d.EstimatedDelivery.Equal(requested.Add(DeliveryDelay)) || !strings.HasPrefix(d.TrackingNumber, "DSP") {
+		t.Fatalf("NewDispatch = %+v", d)
+	}
+	s.SetCardDispatch(d)
+
+	tests := []struct {
+		after time.Duration
+		want  string
+	}{
+		{time.Hour, models.DispatchRequested},
+		{PrintDelay, models.DispatchPrinted},
+		{ShipDelay + time.Hour, models.DispatchShipped},
+		{DeliveryDelay, models.DispatchDelivered},
+	}
+	for _, tt := range tests {
+		d = Track(s, d, requested.Add(tt.after))
+		if d.Status != tt.want {
+			t.Errorf("after %v status = %s, want %s", tt.after, d.Status, tt.want)
+		}
+	}
+	if d.PrintedAt == nil || !d.PrintedAt.Equal(requested.Add(PrintDelay)) || d.ShippedAt == nil || d.DeliveredAt == nil {
+		t.Errorf("stage times = %v %v %v", d.PrintedAt, d.ShippedAt, d.DeliveredAt)
+	}
+	if saved, _ := s.GetCardDispatch("card-1"); saved.Status != models.DispatchDelivered {
+		t.Errorf("saved status = %s, want %s", saved.Status, models.DispatchDelivered)
+	}
+}
+
+func TestTrackKeepsActivatedCards(t *testing.T) {
+	s := store.NewMemoryStore()
+	requested := time.Date(2025, 6, 1, 10, 0, 0, 0, time.UTC)
+	d := NewDispatch("card-1", "testuser", requested)
+	activated := requested.Add(time.Hour)
+	d.ActivatedAt = &activated
+	d.Status = models.DispatchActivated
+
+	d = Track(s, d, requested.Add(DeliveryDelay))
+	if d.Status != models.DispatchActivated || d.DeliveredAt == nil {
+		t.Errorf("Track = %s delivered %v, want ACTIVATED with a delivery time", d.Status, d.DeliveredAt)
+	}
+}
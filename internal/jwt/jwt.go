@@ -0,0 +1,268 @@
+// Package jwt signs and verifies compact JSON Web Tokens with HMAC-SHA256
+// (HS256) or Ed25519 (EdDSA) keys. Keys are identified by the "kid" header so
+// they can be rotated: new tokens are signed with the current key while tokens
+// signed with older keys in the set keep verifying until they expire.
+package jwt
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// Supported signing algorithms
+const (
+	AlgHS256 = "HS256"
+	AlgEdDSA = "EdDSA"
+)
+
+// Issuer is the "iss" claim of every token
+const Issuer = "bankapp"
+
+var (
+	ErrMalformed        = errors.New("malformed token")
+	ErrUnknownKey       = errors.New("unknown signing key")
+	ErrInvalidSignature = errors.New("invalid signature")
+	ErrExpired          = errors.New("token expired")
+)
+
+var b64 = base64.RawURLEncoding
+
+// Claims are the claims carried by an access token
+type Claims struct {
+	ID        string `json:"jti"`
+	Issuer    string `json:"iss"`
+	Subject   string `json:"sub"`
+	SessionID string `json:"sid"`
+	Scope     string `json:"scope,omitempty"`
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+// Scopes returns the space separated scope claim as a slice
+func (c *Claims) Scopes() []string {
+	return strings.Fields(c.Scope)
+}
+
+type header struct {
+	Alg string `json:"alg"`
+	Typ string `json:"typ"`
+	Kid string `json:"kid"`
+}
+
+// Key is a single signing key
+type Key struct {
+	ID         string
+	Alg        string
+	secret     []byte
+	privateKey ed25519.PrivateKey
+	publicKey  ed25519.PublicKey
+}
+
+// KeySet holds the current signing key and all keys accepted for verification
+type KeySet struct {
+	current *Key
+	keys    map[string]*Key
+}
+
+// keyFile is the JSON layout read by LoadKeySet. Secrets and Ed25519 seeds are
+// standard base64 encoded; keys without private material can still verify.
+type keyFile struct {
+	Current string `json:"current"`
+	Keys    []struct {
+		ID         string `json:"kid"`
+		Alg        string `json:"alg"`
+		Secret     string `json:"secret,omitempty"`
+		PrivateKey string `json:"privateKey,omitempty"`
+		PublicKey  string `json:"publicKey,omitempty"`
+	} `json:"keys"`
+}
+
+// LoadKeySet reads a key set from a JSON key file
+func LoadKeySet(path string) (*KeySet, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var file keyFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("parse key file: %w", err)
+	}
+
+	set := &KeySet{keys: make(map[string]*Key)}
+	for _, k := range file.Keys {
+		key := &Key{ID: k.ID, Alg: k.Alg}
+		switch k.Alg {
+		case AlgHS256:
+			if key.secret, err = base64.StdEncoding.DecodeString(k.Secret); err != nil || len(key.secret) < 32 {
+				return nil, fmt.Errorf("key %s: HS256 secret must be at least 32 base64 encoded bytes", k.ID)
+			}
+		case AlgEdDSA:
+			if k.PrivateKey != "" {
+				seed, err := base64.StdEncoding.DecodeString(k.PrivateKey)
+				if err != nil || len(seed) != ed25519.SeedSize {
+					return nil, fmt.Errorf("key %s: EdDSA private key must be a base64 encoded 32 byte seed", k.ID)
+				}
+				key.privateKey = ed25519.NewKeyFromSeed(seed)
+				key.publicKey = key.privateKey.Public().(ed25519.PublicKey)
+			} else {
+				public, err := base64.StdEncoding.DecodeString(k.PublicKey)
+				if err != nil || len(public) != ed25519.PublicKeySize {
+					return nil, fmt.Errorf("key %s: EdDSA public key must be 32 base64 encoded bytes", k.ID)
+				}
+				key.publicKey = public
+			}
+		default:
+			return nil, fmt.Errorf("key %s: unsupported algorithm %q", k.ID, k.Alg)
+		}
+		if _, exists := set.keys[key.ID]; exists || key.ID == "" {
+			return nil, fmt.Errorf("key IDs must be unique and non-empty: %q", key.ID)
+		}
+		set.keys[key.ID] = key
+	}
+
+	current, exists := set.keys[file.Current]
+	if !exists || !current.canSign() {
+		return nil, fmt.Errorf("current key %q not found or has no private material", file.Current)
+	}
+	set.current = current
+	return set, nil
+}
+
+// GenerateKeySet returns a key set with a single fresh Ed25519 key. Tokens it
+// signs do not survive a restart.
+func GenerateKeySet() (*KeySet, error) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+
+	key := &Key{ID: b64.EncodeToString(id), Alg: AlgEdDSA, privateKey: private, publicKey: public}
+	return &KeySet{current: key, keys: map[string]*Key{key.ID: key}}, nil
+}
+
+func (k *Key) canSign() bool {
+	return k.secret != nil || k.privateKey != nil
+}
+
+// Sign encodes and signs claims with the current key
+func (s *KeySet) Sign(claims *Claims) (string, error) {
+	h, err := json.Marshal(header{Alg: s.current.Alg, Typ: "JWT", Kid: s.current.ID})
+	if err != nil {
+		return "", err
+	}
+	c, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	signingInput := b64.EncodeToString(h) + "." + b64.EncodeToString(c)
+	return signingInput + "." + b64.EncodeToString(s.current.sign([]byte(signingInput))), nil
+}
+
+// Verify checks the signature and expiry of token and returns its claims
+func (s *KeySet) Verify(token string, now time.Time) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrMalformed
+	}
+
+	headerJSON, err := b64.DecodeString(parts[0])
+	if err != nil {
+		return nil, ErrMalformed
+	}
+	var h header
+	if err := json.Unmarshal(headerJSON, &h); err != nil {
+		return nil, ErrMalformed
+	}
+
+	key, exists := s.keys[h.Kid]
+	if !exists {
+		return nil, ErrUnknownKey
+	}
+	// The algorithm is fixed by the key, never chosen by the token
+	if h.Alg != key.Alg {
+		return nil, ErrInvalidSignature
+	}
+
+	signature, err := b64.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrMalformed
+	}
+	if !key.verify([]byte(parts[0]+"."+parts[1]), signature) {
+		return nil, ErrInvalidSignature
+	}
+
+	claimsJSON, err := b64.DecodeString(parts[1])
+	if err != nil {
+		return nil, ErrMalformed
+	}
+	var claims Claims
+	if err := json.Unmarshal(claimsJSON, &claims); err != nil {
+		return nil, ErrMalformed
+	}
+	if claims.Issuer != Issuer {
+		return nil, ErrMalformed
+	}
+	if now.Unix() >= claims.ExpiresAt {
+		return nil, ErrExpired
+	}
+	return &claims, nil
+}
+
+// JWKS returns the public keys of the set as a JSON Web Key Set. HMAC keys are
+// symmetric and therefore never published.
+func (s *KeySet) JWKS() map[string]interface{} {
+	keys := []interface{}{}
+	for _, key := range s.keys {
+		if key.Alg != AlgEdDSA {
+			continue
+		}
+		keys = append(keys, map[string]interface{}{
+			"kty": "OKP",
+			"crv": "Ed25519",
+			"kid": key.ID,
+			"alg": key.Alg,
+			"use": "sig",
+			"x":   b64.EncodeToString(key.publicKey),
+		})
+	}
+	return map[string]interface{}{"keys": keys}
+}
+
+func (k *Key) sign(input []byte) []byte {
+	if k.Alg == AlgHS256 {
+		mac := hmac.New(sha256.New, k.secret)
+		mac.Write(input)
+		return mac.Sum(nil)
+	}
+	return ed25519.Sign(k.privateKey, input)
+}
+
+func (k *Key) verify(input, signature []byte) bool {
+	if k.Alg == AlgHS256 {
+		if k.secret == nil {
+			return false
+		}
+		return hmac.Equal(k.sign(input), signature)
+	}
+	return len(signature) == ed25519.SignatureSize && ed25519.Verify(k.publicKey, input, signature)
+}
+
+// IsJWT reports whether token has the shape of a compact JWT
+func IsJWT(token string) bool {
+	return strings.Count(token, ".") == 2
+}
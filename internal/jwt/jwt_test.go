@@ -0,0 +1,113 @@
+package jwt
+
+import (
+	"encoding/base64"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var now = time.Unix(1700000000, 0)
+
+func claims() *Claims {
+	return &Claims{ID: "t1", Issuer: Issuer, Subject: "testuser", SessionID: "s1", Scope: "cards profile", IssuedAt: now.Unix(), ExpiresAt: now.Add(time.Hour).Unix()}
+}
+
+// writeKeys writes a key file with an HS256 key "old" and an Ed25519 key "new"
+// and returns its path
+func writeKeys(t *testing.T, current string) string {
+	t.Helper()
+	secret := base64.StdEncoding.EncodeToString([]byte(strings.Repeat("s", 32)))
+	seed := base64.StdEncoding.EncodeToString([]byte(strings.Repeat("e", 32)))
+	path := filepath.Join(t.TempDir(), "keys.json")
+	data := `{"current": "` + current + `", "keys": [
+		{"kid": "old", "alg": "HS256", "secret": "` + secret + `"},
+		{"kid": "new", "alg": "EdDSA", "privateKey": "` + seed + `"}]}`
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestSignVerify(t *testing.T) {
+	keys, err := GenerateKeySet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := keys.Sign(claims())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsJWT(token) {
+		t.Fatalf("%q does not look like a JWT", token)
+	}
+
+	got, err := keys.Verify(token, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *got != *claims() {
+		t.Errorf("claims = %+v, want %+v", got, claims())
+	}
+
+	if _, err := keys.Verify(token, now.Add(time.Hour)); !errors.Is(err, ErrExpired) {
+		t.Errorf("expired token: %v, want ErrExpired", err)
+	}
+
+	parts := strings.Split(token, ".")
+	forged := *claims()
+	forged.Subject = "someone else"
+	other, _ := keys.Sign(&forged)
+	tampered := parts[0] + "." + strings.Split(other, ".")[1] + "." + parts[2]
+	if _, err := keys.Verify(tampered, now); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("tampered token: %v, want ErrInvalidSignature", err)
+	}
+
+	stranger, _ := GenerateKeySet()
+	if _, err := stranger.Verify(token, now); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("token from another key set: %v, want ErrUnknownKey", err)
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	before, err := LoadKeySet(writeKeys(t, "old"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	after, err := LoadKeySet(writeKeys(t, "new"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	oldToken, _ := before.Sign(claims())
+	if _, err := after.Verify(oldToken, now); err != nil {
+		t.Errorf("token signed with the previous key: %v", err)
+	}
+	newToken, _ := after.Sign(claims())
+	if _, err := before.Verify(newToken, now); err != nil {
+		t.Errorf("token signed with the new key: %v", err)
+	}
+
+	if jwks := after.JWKS()["keys"].([]interface{}); len(jwks) != 1 {
+		t.Errorf("JWKS publishes %d keys, want only the Ed25519 key", len(jwks))
+	}
+}
+
+func TestAlgorithmIsFixedByKey(t *testing.T) {
+	keys, err := LoadKeySet(writeKeys(t, "new"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, _ := keys.Sign(claims())
+	parts := strings.Split(token, ".")
+
+	for _, header := range []string{`{"alg":"HS256","typ":"JWT","kid":"new"}`, `{"alg":"none","typ":"JWT","kid":"new"}`} {
+		forged := base64.RawURLEncoding.EncodeToString([]byte(header)) + "." + parts[1] + "." + parts[2]
+		if _, err := keys.Verify(forged, now); err == nil {
+			t.Errorf("token with header %s verified", header)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+// Package ledger defines the double-entry bookkeeping rules behind every card
+// balance. Amounts are integer minor units (paise); each journal entry's
+// postings sum to zero, and an account's balance is the sum of its postings.
+// Positive amounts are debits and negative amounts are credits.
+package ledger
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"bankapp-microservices/internal/models"
+)
+
+// Account types
+const (
+	// TypeDeposit is a customer bank account behind debit cards; its balance is the money available
+	TypeDeposit = "deposit"
+	// TypeCreditLine is a credit card account; its balance is minus the outstanding amount
+	TypeCreditLine = "credit_line"
+	// TypeAllowance is a virtual card spending allowance; its balance is what is left to spend
+	TypeAllowance = "allowance"
+	// TypeEMILoan holds a credit card's purchases converted to EMI; its balance
+	// is minus the principal not yet billed
+	TypeEMILoan = "emi_loan"
+	// TypeSystem accounts are the bank's side of every entry
+	TypeSystem = "system"
+)
+
+// System accounts
+const (
+	// Funding is the source of opening balances, deposits and credit line repayments
+	AccountFunding = "system:funding"
+	// MerchantSettlement receives card purchases
+	AccountMerchantSettlement = "system:merchant-settlement"
+	// ATMCash receives cash withdrawals
+	AccountATMCash = "system:atm-cash"
+	// VirtualAllowance funds virtual card spending limits
+	AccountVirtualAllowance = "system:virtual-allowance"
+	// InterestIncome receives interest charged on credit lines
+	AccountInterestIncome = "system:interest-income"
+	// FeeIncome receives late, over-limit and annual fees
+	AccountFeeIncome = "system:fee-income"
+	// Rewards funds rewards points redeemed as statement credit
+	AccountRewards = "system:rewards"
+)
+
+// SystemAccounts are created in every store
+var SystemAccounts = []*models.LedgerAccount{
+	{ID: AccountFunding, Type: TypeSystem, Name: "Funding", Currency: Currency},
+	{ID: AccountMerchantSettlement, Type: TypeSystem, Name: "Merchant settlement", Currency: Currency},
+	{ID: AccountATMCash, Type: TypeSystem, Name: "ATM cash", Currency: Currency},
+	{ID: AccountVirtualAllowance, Type: TypeSystem, Name: "Virtual card allowance", Currency: Currency},
+	{ID: AccountInterestIncome, Type: TypeSystem, Name: "Interest income", Currency: Currency},
+	{ID: AccountFeeIncome, Type: TypeSystem, Name: "Fee income", Currency: Currency},
+	{ID: AccountRewards, Type: TypeSystem, Name: "Rewards", Currency: Currency},
+}
+
+// Currency of every ledger account
+const Currency = "INR"
+
+var (
+	ErrUnbalanced     = errors.New("journal entry postings do not sum to zero")
+	ErrEmptyEntry     = errors.New("journal entry needs at least two postings")
+	ErrZeroPosting    = errors.New("journal entry contains a zero posting")
+	ErrUnknownAccount = errors.New("unknown ledger account")
+	// ErrInsufficientFunds is returned for entries that would overdraw a
+	// deposit or allowance account or take a credit line past its limit
+	ErrInsufficientFunds = errors.New("insufficient funds")
+)
+
+// ToMinor converts a major unit amount to minor units, rounding to the nearest paisa
+func ToMinor(amount float64) int64 {
+	return int64(math.Round(amount * 100))
+}
+
+// ToMajor converts minor units to a major unit amount
+func ToMajor(amount int64) float64 {
+	return float64(amount) / 100
+}
+
+// CreditCardAccountID returns the ledger account of a credit card's credit line
+func CreditCardAccountID(cardID string) string {
+	return "credit:" + cardID
+}
+
+// EMIAccountID returns the ledger account of a credit card's EMI loans
+func EMIAccountID(cardID string) string {
+	return emiAccountPrefix + cardID
+}
+
+// IsEMIAccount reports whether accountID is a credit card's EMI loan account
+func IsEMIAccount(accountID string) bool {
+	return strings.HasPrefix(accountID, emiAccountPrefix)
+}
+
+const emiAccountPrefix = "emi:"
+
+// DepositAccountID returns the ledger account of a bank account number
+func DepositAccountID(accountNumber string) string {
+	return "deposit:" + accountNumber
+}
+
+// VirtualCardAccountID returns the ledger account of a virtual card's allowance
+func VirtualCardAccountID(cardID string) string {
+	return "virtual:" + cardID
+}
+
+// NewEntry builds a journal entry
+func NewEntry(description, reference string, date time.Time, postings ...models.Posting) *models.JournalEntry {
+	return &models.JournalEntry{
+		ID:          models.GenerateID(),
+		Date:        date,
+		Description: description,
+		Reference:   reference,
+		Postings:    postings,
+	}
+}
+
+// Transfer builds an entry moving amount minor units from one account to another:
+// the source is credited and the destination debited
+func Transfer(from, to string, amount int64, description, reference string, date time.Time) *models.JournalEntry {
+	return NewEntry(description, reference, date,
+		models.Posting{AccountID: to, Amount: amount},
+		models.Posting{AccountID: from, Amount: -amount},
+	)
+}
+
+// Validate checks that an entry is balanced and well formed
+func Validate(entry *models.JournalEntry) error {
+	if len(entry.Postings) < 2 {
+		return ErrEmptyEntry
+	}
+	var sum int64
+	for _, posting := range entry.Postings {
+		if posting.Amount == 0 {
+			return ErrZeroPosting
+		}
+		sum += posting.Amount
+	}
+	if sum != 0 {
+		return fmt.Errorf("%w: off by %d", ErrUnbalanced, sum)
+	}
+	return nil
+}
+
+// IsCharge reports whether entry charges interest or fees. The bank charges
+// them even when they take a credit line past its limit.
+func IsCharge(entry *models.JournalEntry) bool {
+	for _, posting := range entry.Postings {
+		if posting.AccountID == AccountInterestIncome || posting.AccountID == AccountFeeIncome {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,63 @@
+package ledger
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"bankapp-microservices/internal/models"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		postings []models.Posting
+		want     error
+	}{
+		{"balanced", []models.Posting{{AccountID: "a", Amount: 100}, {AccountID: "b", Amount: -60}, {AccountID: "c", Amount: -40}}, nil},
+		{"single posting", []models.Posting{{AccountID: "a", Amount: 0}}, ErrEmptyEntry},
+		{"zero posting", []models.Posting{{AccountID: "a", Amount: 0}, {AccountID: "b", Amount: 0}}, ErrZeroPosting},
+		{"unbalanced", []models.Posting{{AccountID: "a", Amount: 100}, {AccountID: "b", Amount: -99}}, ErrUnbalanced},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Validate(NewEntry("test", "", time.Now(), tt.postings...))
+			if !errors.Is(err, tt.want) || (tt.want == nil && err != nil) {
+				t.Errorf("Validate = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestTransfer(t *testing.T) {
+	entry := Transfer("from", "to", 250, "Move", "ref", time.Now())
+	if err := Validate(entry); err != nil {
+		t.Fatal(err)
+	}
+	for _, posting := range entry.Postings {
+		want := map[string]int64{"from": -250, "to": 250}[posting.AccountID]
+		if posting.Amount != want {
+			t.Errorf("%s posted %d, want %d", posting.AccountID, posting.Amount, want)
+		}
+	}
+}
+
+func TestMinorUnits(t *testing.T) {
+	for amount, want := range map[float64]int64{0.1 + 0.2: 30, 19.999: 2000, 1234.56: 123456, -0.005: -1} {
+		if got := ToMinor(amount); got != want {
+			t.Errorf("ToMinor(%v) = %d, want %d", amount, got, want)
+		}
+	}
+	if got := ToMajor(123456); got != 1234.56 {
+		t.Errorf("ToMajor(123456) = %v", got)
+	}
+}
+
+func TestIsCharge(t *testing.T) {
+	if !IsCharge(Transfer(CreditCardAccountID("c"), AccountFeeIncome, 100, "Late fee", "", time.Now())) {
+		t.Error("late fee is not a charge")
+	}
+	if IsCharge(Transfer(CreditCardAccountID("c"), AccountMerchantSettlement, 100, "Purchase", "", time.Now())) {
+		t.Error("purchase is a charge")
+	}
+}
@@ -5,16 +5,29 @@ import (
 	"encoding/json"
 	"net/http"
 	"strings"
+	"time"
 
+	"bankapp-microservices/internal/jwt"
 	"bankapp-microservices/internal/store"
 )
 
 type contextKey string
 
-const UserIDKey contextKey = "userID"
+const (
+	UserIDKey    contextKey = "userID"
+	SessionIDKey contextKey = "sessionID"
+	ScopesKey    contextKey = "scopes"
+)
+
+// lastUsedResolution limits how often a session's last-used time is written back
+const lastUsedResolution = time.Minute
 
-// AuthMiddleware validates Bearer token
-func AuthMiddleware(store *store.Store) func(http.Handler) http.Handler {
+// AuthMiddleware validates Bearer token, its expiry and its session. When keys
+// is non-nil, JWT access tokens are verified by signature, issuer and expiry
+// alone without a store lookup, so any replica can accept them. A revoked
+// session's JWTs keep working until they expire unless checkSessions is set,
+// which also requires their session to be live in the store.
+func AuthMiddleware(store store.Store, keys *jwt.KeySet, checkSessions bool) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			authHeader := r.Header.Get("Authorization")
@@ -29,19 +42,59 @@ func AuthMiddleware(store *store.Store) func(http.Handler) http.Handler {
 				return
 			}
 
-			token := parts[1]
-			user, exists := store.GetUserByToken(token)
-			if !exists {
+			if keys != nil && jwt.IsJWT(parts[1]) {
+				claims, err := keys.Verify(parts[1], time.Now())
+				if err != nil {
+					respondWithError(w, http.StatusUnauthorized, "Invalid or expired token")
+					return
+				}
+				if checkSessions && !liveSession(w, store, claims.Subject, claims.SessionID) {
+					return
+				}
+
+				ctx := context.WithValue(r.Context(), UserIDKey, claims.Subject)
+				ctx = context.WithValue(ctx, SessionIDKey, claims.SessionID)
+				ctx = context.WithValue(ctx, ScopesKey, claims.Scopes())
+				next.ServeHTTP(w, r.WithContext(ctx))
+				return
+			}
+
+			accessToken, exists := store.GetAccessToken(parts[1])
+			if !exists || !time.Now().Before(accessToken.ExpiresAt) {
 				respondWithError(w, http.StatusUnauthorized, "Invalid or expired token")
 				return
 			}
+			if !liveSession(w, store, accessToken.UserID, accessToken.SessionID) {
+				return
+			}
 
-			ctx := context.WithValue(r.Context(), UserIDKey, user.UserID)
+			ctx := context.WithValue(r.Context(), UserIDKey, accessToken.UserID)
+			ctx = context.WithValue(ctx, SessionIDKey, accessToken.SessionID)
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
 }
 
+// liveSession checks that the session exists, belongs to an existing userID and
+// records its use. Otherwise it writes a 401 and returns false.
+func liveSession(w http.ResponseWriter, store store.Store, userID, sessionID string) bool {
+	session, exists := store.GetSessionByID(sessionID)
+	if !exists || session.UserID != userID {
+		respondWithError(w, http.StatusUnauthorized, "Session has been revoked")
+		return false
+	}
+
+	if _, exists := store.GetUserByID(userID); !exists {
+		respondWithError(w, http.StatusUnauthorized, "Invalid or expired token")
+		return false
+	}
+
+	if now := time.Now(); now.Sub(session.LastUsedAt) >= lastUsedResolution {
+		store.TouchSession(session.ID, now)
+	}
+	return true
+}
+
 func respondWithError(w http.ResponseWriter, code int, message string) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(code)
@@ -0,0 +1,97 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"bankapp-microservices/internal/jwt"
+	"bankapp-microservices/internal/models"
+	"bankapp-microservices/internal/store"
+)
+
+func TestJWT(t *testing.T) {
+	s := store.NewMemoryStore()
+	keys, err := jwt.GenerateKeySet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	s.SetSession(&models.Session{ID: "s1", UserID: "testuser", IssuedAt: now, LastUsedAt: now, ExpiresAt: now.Add(time.Hour)})
+
+	sign := func(subject, sessionID string, expiresAt time.Time) string {
+		token, err := keys.Sign(&jwt.Claims{Issuer: jwt.Issuer, Subject: subject, SessionID: sessionID, Scope: "cards profile", IssuedAt: now.Unix(), ExpiresAt: expiresAt.Unix()})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+	var scopes []string
+	serve := func(checkSessions bool, token string) int {
+		handler := AuthMiddleware(s, keys, checkSessions)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			scopes, _ = r.Context().Value(ScopesKey).([]string)
+			w.Write([]byte(r.Context().Value(UserIDKey).(string)))
+		}))
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	token := sign("testuser", "s1", now.Add(time.Hour))
+	if code := serve(false, token); code != http.StatusOK {
+		t.Fatalf("valid JWT = %d, want 200", code)
+	}
+	if len(scopes) != 2 || scopes[0] != "cards" || scopes[1] != "profile" {
+		t.Errorf("scopes = %v, want [cards profile]", scopes)
+	}
+	if code := serve(false, sign("testuser", "s1", now.Add(-time.Second))); code != http.StatusUnauthorized {
+		t.Errorf("expired JWT = %d, want 401", code)
+	}
+
+	// Without session checks a JWT is trusted on its signature alone
+	s.DeleteSession("s1")
+	if code := serve(false, token); code != http.StatusOK {
+		t.Errorf("JWT after its session was revoked = %d, want 200 until it expires", code)
+	}
+	if code := serve(true, token); code != http.StatusUnauthorized {
+		t.Errorf("JWT after its session was revoked, checking sessions = %d, want 401", code)
+	}
+
+	s.SetSession(&models.Session{ID: "s2", UserID: "testuser", IssuedAt: now, LastUsedAt: now, ExpiresAt: now.Add(time.Hour)})
+	if code := serve(true, sign("testuser", "s2", now.Add(time.Hour))); code != http.StatusOK {
+		t.Errorf("JWT with a live session = %d, want 200", code)
+	}
+	if code := serve(true, sign("someone", "s2", now.Add(time.Hour))); code != http.StatusUnauthorized {
+		t.Errorf("JWT for another user's session = %d, want 401", code)
+	}
+}
+
+func TestSettlementMiddleware(t *testing.T) {
+	handler := SettlementMiddleware("settle-key")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	status := func(key string) int {
+		r := httptest.NewRequest(http.MethodPost, "/", nil)
+		if key != "" {
+			r.Header.Set(SettlementKeyHeader, key)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w.Code
+	}
+	if code := status("settle-key"); code != http.StatusOK {
+		t.Errorf("right key = %d, want 200", code)
+	}
+	for _, key := range []string{"", "wrong", "settle-key2"} {
+		if code := status(key); code != http.StatusUnauthorized {
+			t.Errorf("key %q = %d, want 401", key, code)
+		}
+	}
+	open := SettlementMiddleware("")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	w := httptest.NewRecorder()
+	open.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", nil))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("empty configured key = %d, want 401", w.Code)
+	}
+}
@@ -0,0 +1,25 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+)
+
+// SettlementKeyHeader carries the shared key of the merchant settlement system
+const SettlementKeyHeader = "X-Settlement-Key"
+
+// SettlementMiddleware only lets through requests carrying key in the
+// SettlementKeyHeader. Settlement routes are called by the acquirer, never by
+// customers, so customer tokens are not accepted.
+func SettlementMiddleware(key string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			sent := r.Header.Get(SettlementKeyHeader)
+			if key == "" || subtle.ConstantTimeCompare([]byte(sent), []byte(key)) != 1 {
+				respondWithError(w, http.StatusUnauthorized, "Invalid settlement key")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
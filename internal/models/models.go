@@ -8,36 +8,175 @@ import (
 
 // User represents a user in the system
 type User struct {
-	UserID       string    `json:"userID"`
-	Password     string    `json:"-"`
-	FullName     string    `json:"fullName"`
-	Email        string    `json:"email"`
-	Token        string    `json:"token,omitempty"`
-	ExpiryDate   time.Time `json:"expiryDate,omitempty"`
-	RequiresPIN  bool      `json:"requiresPIN"`
-	RequiresOTP  bool      `json:"requiresOTP"`
+	UserID       string `json:"userID"`
+	PasswordHash string `json:"-"`
+	FullName     string `json:"fullName"`
+	Email        string `json:"email"`
+	PhoneNumber  string `json:"phoneNumber,omitempty"`
+	// DateOfBirth is YYYY-MM-DD, used to reject card PINs that are easy to guess
+	DateOfBirth string    `json:"dateOfBirth,omitempty"`
+	CreatedAt   time.Time `json:"createdAt"`
+	Token       string    `json:"token,omitempty"`
+	ExpiryDate  time.Time `json:"expiryDate,omitempty"`
+	RequiresPIN bool      `json:"requiresPIN"`
+	RequiresOTP bool      `json:"requiresOTP"`
+
+	// Second factor credentials and state. PINHash is a bcrypt hash of the login PIN.
+	PINHash                 string    `json:"-"`
+	OTPSecret               string    `json:"-"`
+	PendingOTPSecret        string    `json:"-"`
+	LastOTPCounter          int64     `json:"-"`
+	SecondFactorFailures    int       `json:"-"`
+	SecondFactorLockedUntil time.Time `json:"-"`
 }
 
 // LoginRequest represents login request
 type LoginRequest struct {
-	UserID   string `json:"userID"`
-	Password string `json:"password"`
+	UserID     string `json:"userID"`
+	Password   string `json:"password"`
+	DeviceName string `json:"deviceName,omitempty"`
+}
+
+// Second factor methods offered by a login challenge
+const (
+	SecondFactorOTP = "otp"
+	SecondFactorPIN = "pin"
+)
+
+// LoginChallenge represents a login that passed the password check and awaits a second factor
+type LoginChallenge struct {
+	ID         string    `json:"challengeId"`
+	UserID     string    `json:"-"`
+	Methods    []string  `json:"methods"`
+	DeviceName string    `json:"-"`
+	IPAddress  string    `json:"-"`
+	Attempts   int       `json:"-"`
+	ExpiresAt  time.Time `json:"expiresAt"`
+}
+
+// VerifyOTPRequest represents OTP verification request
+type VerifyOTPRequest struct {
+	ChallengeID string `json:"challengeId"`
+	Code        string `json:"code"`
+}
+
+// VerifyPINRequest represents PIN verification request
+type VerifyPINRequest struct {
+	ChallengeID string `json:"challengeId"`
+	PIN         string `json:"pin"`
+}
+
+// OTPConfirmRequest represents OTP enrollment confirmation request
+type OTPConfirmRequest struct {
+	Code string `json:"code"`
+}
+
+// LoginPINRequest represents login PIN setup request
+type LoginPINRequest struct {
+	PIN        string `json:"pin"`
+	ConfirmPIN string `json:"confirmPIN"`
+}
+
+// Session represents a login session on one device
+type Session struct {
+	ID         string    `json:"id"`
+	UserID     string    `json:"-"`
+	DeviceName string    `json:"deviceName"`
+	IPAddress  string    `json:"ipAddress"`
+	IssuedAt   time.Time `json:"issuedAt"`
+	LastUsedAt time.Time `json:"lastUsedAt"`
+	ExpiresAt  time.Time `json:"expiresAt"`
+}
+
+// RegisterRequest represents user registration request
+type RegisterRequest struct {
+	UserID      string `json:"userID"`
+	Email       string `json:"email"`
+	FullName    string `json:"fullName"`
+	PhoneNumber string `json:"phoneNumber,omitempty"`
+	DateOfBirth string `json:"dateOfBirth,omitempty"`
+	Password    string `json:"password"`
+}
+
+// ProfileUpdateRequest represents profile update request
+type ProfileUpdateRequest struct {
+	FullName    *string `json:"fullName,omitempty"`
+	Email       *string `json:"email,omitempty"`
+	PhoneNumber *string `json:"phoneNumber,omitempty"`
+	DateOfBirth *string `json:"dateOfBirth,omitempty"`
+}
+
+// PasswordChangeRequest represents password change request
+type PasswordChangeRequest struct {
+	CurrentPassword string `json:"currentPassword"`
+	NewPassword     string `json:"newPassword"`
+	ConfirmPassword string `json:"confirmPassword"`
+}
+
+// AccessToken represents an issued bearer token
+type AccessToken struct {
+	Token     string    `json:"-"`
+	UserID    string    `json:"-"`
+	SessionID string    `json:"-"`
+	IssuedAt  time.Time `json:"issuedAt"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// RefreshToken represents a one-time token that can be exchanged for a new token pair.
+// All tokens rotated from the same login share a SessionID.
+type RefreshToken struct {
+	Token     string    `json:"-"`
+	UserID    string    `json:"-"`
+	SessionID string    `json:"-"`
+	IssuedAt  time.Time `json:"issuedAt"`
+	ExpiresAt time.Time `json:"expiresAt"`
+	Used      bool      `json:"-"`
+}
+
+// RefreshRequest represents refresh token request
+type RefreshRequest struct {
+	RefreshToken string `json:"refreshToken"`
 }
 
 // CreditCard represents a credit card
 type CreditCard struct {
-	ID                string  `json:"id"`
-	CardNumber        string  `json:"cardNumber"`
-	CVV               string  `json:"cvv"`
-	ExpiryMonth       int     `json:"expiryMonth"`
-	ExpiryYear        int     `json:"expiryYear"`
-	CardholderName    string  `json:"cardholderName"`
-	CardType          string  `json:"cardType"`
-	RewardsPoints     int     `json:"rewardsPoints"`
-	AvailableCredit   float64 `json:"availableCredit,omitempty"`
-	TotalCredit       float64 `json:"totalCredit,omitempty"`
+	ID                 string  `json:"id"`
+	CardNumber         string  `json:"cardNumber"`
+	CVV                string  `json:"cvv"`
+	ExpiryMonth        int     `json:"expiryMonth"`
+	ExpiryYear         int     `json:"expiryYear"`
+	CardholderName     string  `json:"cardholderName"`
+	CardType           string  `json:"cardType"`
+	RewardsPoints      int     `json:"rewardsPoints"`
+	AvailableCredit    float64 `json:"availableCredit,omitempty"`
+	TotalCredit        float64 `json:"totalCredit,omitempty"`
 	OutstandingBalance float64 `json:"outstandingBalance,omitempty"`
-	UserID            string  `json:"-"`
+	UserID             string  `json:"-"`
+	// LedgerAccountID is the credit line the balances above are derived from
+	LedgerAccountID string `json:"-"`
+	// StatementDay is the day of the month the billing cycle closes on (1-28)
+	StatementDay int       `json:"statementDay,omitempty"`
+	OpenedAt     time.Time `json:"openedAt"`
+	// EMIOutstanding is the EMI principal not yet billed, which still uses
+	// up credit; it is derived from EMIAccountID
+	EMIOutstanding float64 `json:"emiOutstanding,omitempty"`
+	EMIAccountID   string  `json:"-"`
+	// Status is one of the CardStatus values, with the reason it was last changed
+	Status          string     `json:"status"`
+	StatusReason    string     `json:"statusReason,omitempty"`
+	StatusChangedAt *time.Time `json:"statusChangedAt,omitempty"`
+	// ReplacesID and ReplacedByID link a card to the card it replaced and the
+	// card that replaced it
+	ReplacesID   string `json:"replaces,omitempty"`
+	ReplacedByID string `json:"replacedBy,omitempty"`
+	// Activation is set on cards issued Inactive. PIN is set once the
+	// cardholder chooses one.
+	Activation *CardActivation `json:"activation,omitempty"`
+	PIN        *CardPIN        `json:"pin,omitempty"`
+	// PrimaryCardID is set on add-on cards, which share the primary card's
+	// credit line and are billed on its statements
+	PrimaryCardID string        `json:"primaryCardId,omitempty"`
+	Addon         *AddonDetails `json:"addon,omitempty"`
 }
 
 // DebitCard represents a debit card
@@ -53,83 +192,324 @@ type DebitCard struct {
 	BankName       string  `json:"bankName"`
 	AccountBalance float64 `json:"accountBalance,omitempty"`
 	UserID         string  `json:"-"`
+	// LedgerAccountID is the deposit account AccountBalance is derived from
+	LedgerAccountID string `json:"-"`
+	// Status is one of the CardStatus values, with the reason it was last changed
+	Status          string     `json:"status"`
+	StatusReason    string     `json:"statusReason,omitempty"`
+	StatusChangedAt *time.Time `json:"statusChangedAt,omitempty"`
+	// ReplacesID and ReplacedByID link a card to the card it replaced and the
+	// card that replaced it
+	ReplacesID   string `json:"replaces,omitempty"`
+	ReplacedByID string `json:"replacedBy,omitempty"`
+	// Activation is set on cards issued Inactive. PIN is set once the
+	// cardholder chooses one.
+	Activation *CardActivation `json:"activation,omitempty"`
+	PIN        *CardPIN        `json:"pin,omitempty"`
 }
 
 // VirtualCard represents a virtual card
 type VirtualCard struct {
-	ID              string    `json:"id"`
-	CardNumber      string    `json:"cardNumber"`
-	CVV             string    `json:"cvv"`
-	ExpiryMonth     int       `json:"expiryMonth"`
-	ExpiryYear      int       `json:"expiryYear"`
-	CardholderName  string    `json:"cardholderName"`
-	CardType        string    `json:"cardType"`
-	Nickname        string    `json:"nickname"`
-	SpendingLimit   float64   `json:"spendingLimit"`
-	RemainingBalance float64  `json:"remainingBalance"`
-	CreatedAt       time.Time `json:"createdAt"`
-	Status          string    `json:"status"`
-	LinkedAccountID string    `json:"linkedAccountId"`
-	UserID          string    `json:"-"`
+	ID               string    `json:"id"`
+	CardNumber       string    `json:"cardNumber"`
+	CVV              string    `json:"cvv"`
+	ExpiryMonth      int       `json:"expiryMonth"`
+	ExpiryYear       int       `json:"expiryYear"`
+	CardholderName   string    `json:"cardholderName"`
+	CardType         string    `json:"cardType"`
+	Nickname         string    `json:"nickname"`
+	SpendingLimit    float64   `json:"spendingLimit"`
+	RemainingBalance float64   `json:"remainingBalance"`
+	CreatedAt        time.Time `json:"createdAt"`
+	Status           string    `json:"status"`
+	LinkedAccountID  string    `json:"linkedAccountId"`
+	UserID           string    `json:"-"`
+	// LedgerAccountID is the allowance RemainingBalance is derived from
+	LedgerAccountID string     `json:"-"`
+	StatusReason    string     `json:"statusReason,omitempty"`
+	StatusChangedAt *time.Time `json:"statusChangedAt,omitempty"`
+}
+
+// Card statuses shared by every card type
+const (
+	CardStatusInactive           = "Inactive"
+	CardStatusActive             = "Active"
+	CardStatusTemporarilyBlocked = "TemporarilyBlocked"
+	CardStatusPermanentlyBlocked = "PermanentlyBlocked"
+	CardStatusExpired            = "Expired"
+	CardStatusClosed             = "Closed"
+)
+
+// ReplaceCardRequest represents a request to replace a physical card
+type ReplaceCardRequest struct {
+	Reason string `json:"reason"`
+}
+
+// Reasons a card can be replaced
+const (
+	ReplaceLost    = "LOST"
+	ReplaceStolen  = "STOLEN"
+	ReplaceDamaged = "DAMAGED"
+)
+
+// CardDispatch tracks a new physical card from request to activation
+type CardDispatch struct {
+	ID                string     `json:"id"`
+	CardID            string     `json:"cardId"`
+	UserID            string     `json:"-"`
+	ReplacesCardID    string     `json:"replacesCardId,omitempty"`
+	Reason            string     `json:"reason,omitempty"`
+	Status            string     `json:"status"`
+	TrackingNumber    string     `json:"trackingNumber"`
+	RequestedAt       time.Time  `json:"requestedAt"`
+	PrintedAt         *time.Time `json:"printedAt,omitempty"`
+	ShippedAt         *time.Time `json:"shippedAt,omitempty"`
+	DeliveredAt       *time.Time `json:"deliveredAt,omitempty"`
+	ActivatedAt       *time.Time `json:"activatedAt,omitempty"`
+	EstimatedDelivery time.Time  `json:"estimatedDelivery"`
+}
+
+// Dispatch statuses, in order
+const (
+	DispatchRequested = "REQUESTED"
+	DispatchPrinted   = "PRINTED"
+	DispatchShipped   = "SHIPPED"
+	DispatchDelivered = "DELIVERED"
+	DispatchActivated = "ACTIVATED"
+)
+
+// ActivateCardRequest represents a request to activate a new physical card.
+// The card is identified by details printed on it and the first PIN is set
+// as in PINUpdateRequest.
+type ActivateCardRequest struct {
+	LastFour    string `json:"lastFour"`
+	ExpiryMonth int    `json:"expiryMonth"`
+	ExpiryYear  int    `json:"expiryYear"`
+	PINUpdateRequest
+}
+
+// CardActivation records attempts to activate a card
+type CardActivation struct {
+	ActivatedAt *time.Time          `json:"activatedAt,omitempty"`
+	Attempts    []ActivationAttempt `json:"attempts"`
+	// FailedAttempts counts failures since the last lockout
+	FailedAttempts int       `json:"-"`
+	LockedUntil    time.Time `json:"-"`
+}
+
+// CardPIN is the PIN of a physical card, stored as a salted hash. The PIN is
+// blocked after too many wrong attempts in a row until a new one is set.
+type CardPIN struct {
+	Hash           string     `json:"-"`
+	FailedAttempts int        `json:"-"`
+	ChangedAt      time.Time  `json:"changedAt"`
+	BlockedAt      *time.Time `json:"blockedAt,omitempty"`
+}
+
+// VerifyCardPINRequest represents a request to check a card PIN
+type VerifyCardPINRequest struct {
+	PIN string `json:"pin"`
+}
+
+// ActivationAttempt is one attempt to activate a card
+type ActivationAttempt struct {
+	At        time.Time `json:"at"`
+	Succeeded bool      `json:"succeeded"`
+	Failure   string    `json:"failure,omitempty"`
+}
+
+// CardStatusChange records a card moving from one status to another
+type CardStatusChange struct {
+	ID        string    `json:"id"`
+	CardID    string    `json:"cardId"`
+	UserID    string    `json:"-"`
+	From      string    `json:"from"`
+	To        string    `json:"to"`
+	Reason    string    `json:"reason,omitempty"`
+	ChangedAt time.Time `json:"changedAt"`
 }
 
 // TransactionLimit represents a transaction limit
 type TransactionLimit struct {
-	ID          string  `json:"id,omitempty"`
-	Type        string  `json:"type"`
-	IsEnabled   bool    `json:"isEnabled"`
+	ID           string  `json:"id,omitempty"`
+	Type         string  `json:"type"`
+	IsEnabled    bool    `json:"isEnabled"`
 	CurrentLimit float64 `json:"currentLimit"`
-	MaxLimit    float64 `json:"maxLimit,omitempty"`
-	CanSetLimit bool    `json:"canSetLimit,omitempty"`
+	MaxLimit     float64 `json:"maxLimit,omitempty"`
+	CanSetLimit  bool    `json:"canSetLimit,omitempty"`
+	// Used and Remaining are only filled in when reporting limits
+	Used      *float64 `json:"used,omitempty"`
+	Remaining *float64 `json:"remaining,omitempty"`
 }
 
+// Transaction limit types, one per channel
+const (
+	LimitTypeATM         = "ATM Cash Withdrawal"
+	LimitTypeOnline      = "Online"
+	LimitTypePOS         = "Merchant Outlets (POS)"
+	LimitTypeContactless = "Contactless"
+)
+
 // LimitsRequest represents request to update limits
 type LimitsRequest struct {
-	DomesticLimits     []TransactionLimit `json:"domesticLimits"`
+	DomesticLimits      []TransactionLimit `json:"domesticLimits"`
 	InternationalLimits []TransactionLimit `json:"internationalLimits"`
 }
 
 // Autopay represents autopay settings
 type Autopay struct {
-	ID              string    `json:"autopayId,omitempty"`
-	CardID          string    `json:"cardId"`
-	AmountOption    string    `json:"amountOption"`
-	LinkedAccountID string    `json:"linkedAccountId"`
-	AutoPayEnabled  bool      `json:"autoPayEnabled,omitempty"`
-	ActivationDate  time.Time `json:"activationDate,omitempty"`
-	UserID          string    `json:"-"`
+	ID           string `json:"autopayId,omitempty"`
+	CardID       string `json:"cardId"`
+	AmountOption string `json:"amountOption"`
+	// Amount is paid each cycle with the FIXED option
+	Amount float64 `json:"amount,omitempty"`
+	// Percent of the total due is paid with the PERCENT option
+	Percent         float64 `json:"percent,omitempty"`
+	LinkedAccountID string  `json:"linkedAccountId"`
+	AutoPayEnabled  bool    `json:"autoPayEnabled"`
+	// ExecutionDay is the day of the month to pay on, if earlier than the due date
+	ExecutionDay   int       `json:"executionDay,omitempty"`
+	ActivationDate time.Time `json:"activationDate,omitempty"`
+	UserID         string    `json:"-"`
 }
 
-// AutopayRequest represents autopay request
+// Autopay amount options
+const (
+	AutopayMinimumDue = "MINIMUM_DUE"
+	AutopayTotalDue   = "TOTAL_DUE"
+	AutopayFixed      = "FIXED"
+	AutopayPercent    = "PERCENT"
+)
+
+// AutopayRequest represents an autopay request. Absent fields are left
+// unchanged by updates.
 type AutopayRequest struct {
-	AmountOption    string `json:"amountOption"`
-	LinkedAccountID string `json:"linkedAccountId"`
-	AutoPayEnabled  bool   `json:"autoPayEnabled,omitempty"`
+	AmountOption    *string  `json:"amountOption,omitempty"`
+	Amount          *float64 `json:"amount,omitempty"`
+	Percent         *float64 `json:"percent,omitempty"`
+	LinkedAccountID *string  `json:"linkedAccountId,omitempty"`
+	AutoPayEnabled  *bool    `json:"autoPayEnabled,omitempty"`
+	ExecutionDay    *int     `json:"executionDay,omitempty"`
+}
+
+// AutopayExecution records one attempt to pay a statement by autopay
+type AutopayExecution struct {
+	ID              string     `json:"id"`
+	CardID          string     `json:"cardId"`
+	UserID          string     `json:"-"`
+	StatementID     string     `json:"statementId"`
+	Attempt         int        `json:"attempt"`
+	ExecutedAt      time.Time  `json:"executedAt"`
+	AmountOption    string     `json:"amountOption"`
+	Amount          float64    `json:"amount"`
+	LinkedAccountID string     `json:"linkedAccountId"`
+	Status          string     `json:"status"`
+	FailureReason   string     `json:"failureReason,omitempty"`
+	NextRetryAt     *time.Time `json:"nextRetryAt,omitempty"`
+	JournalEntryID  string     `json:"journalEntryId,omitempty"`
+}
+
+// Autopay execution statuses
+const (
+	AutopayStatusSuccess = "SUCCESS"
+	AutopayStatusFailed  = "FAILED"
+	AutopayStatusSkipped = "SKIPPED"
+)
+
+// PaymentRequest represents a credit card bill payment request
+type PaymentRequest struct {
+	// FromAccountID is the account number or ID of the debit card paying
+	FromAccountID string  `json:"fromAccountId"`
+	PaymentType   string  `json:"paymentType,omitempty"`
+	Amount        float64 `json:"amount,omitempty"`
+}
+
+// Payment types. A FULL payment clears the outstanding balance; a PARTIAL
+// payment pays the amount requested.
+const (
+	PaymentFull    = "FULL"
+	PaymentPartial = "PARTIAL"
+)
+
+// PaymentAllocation splits a payment between the buckets it was applied to
+type PaymentAllocation struct {
+	Fees      float64 `json:"fees"`
+	Interest  float64 `json:"interest"`
+	Principal float64 `json:"principal"`
+}
+
+// CardPayment is the receipt of a payment towards a credit card bill
+type CardPayment struct {
+	ID                 string            `json:"receiptId"`
+	CardID             string            `json:"cardId"`
+	UserID             string            `json:"-"`
+	FromAccountID      string            `json:"fromAccountId"`
+	PaymentType        string            `json:"paymentType"`
+	Amount             float64           `json:"amount"`
+	Allocation         PaymentAllocation `json:"allocation"`
+	PreviousBalance    float64           `json:"previousBalance"`
+	OutstandingBalance float64           `json:"outstandingBalance"`
+	AvailableCredit    float64           `json:"availableCredit"`
+	JournalEntryID     string            `json:"journalEntryId"`
+	PaidAt             time.Time         `json:"paidAt"`
+	// IdempotencyKey and Fingerprint identify retries of the same request
+	IdempotencyKey string `json:"-"`
+	Fingerprint    string `json:"-"`
 }
 
-// PINUpdateRequest represents PIN update request
+// PINUpdateRequest represents PIN update request. OldPIN is optional; if it
+// is sent it must match the current PIN.
 type PINUpdateRequest struct {
+	OldPIN        string `json:"oldPIN,omitempty"`
 	NewPIN        string `json:"newPIN"`
 	ConfirmPIN    string `json:"confirmPIN"`
 	TermsAccepted bool   `json:"termsAccepted"`
+	// Password or OTP re-authenticates the cardholder to reset a blocked PIN
+	Password string `json:"password,omitempty"`
+	OTP      string `json:"otp,omitempty"`
 }
 
 // AddonCardRequest represents add-on card request
 type AddonCardRequest struct {
-	CustomerID   string `json:"customerID"`
-	NameOnCard   string `json:"nameOnCard"`
+	CustomerID   string  `json:"customerID"`
+	NameOnCard   string  `json:"nameOnCard"`
+	DateOfBirth  string  `json:"dateOfBirth"`
+	Relationship string  `json:"relationship"`
+	MonthlyCap   float64 `json:"monthlyCap,omitempty"`
+}
+
+// AddonCapRequest represents a request to change an add-on card's monthly cap
+type AddonCapRequest struct {
+	MonthlyCap float64 `json:"monthlyCap"`
+}
+
+// AddonDetails describes the holder of an add-on card and caps its spend
+type AddonDetails struct {
+	CustomerID   string `json:"customerId,omitempty"`
 	DateOfBirth  string `json:"dateOfBirth"`
 	Relationship string `json:"relationship"`
+	// MonthlyCap is the most the add-on may spend in a calendar month; 0 means
+	// only the shared credit line limits it
+	MonthlyCap  float64   `json:"monthlyCap,omitempty"`
+	RequestedAt time.Time `json:"requestedAt"`
 }
 
+// Relationships of an add-on cardholder to the primary cardholder
+const (
+	RelationshipSpouse  = "SPOUSE"
+	RelationshipParent  = "PARENT"
+	RelationshipChild   = "CHILD"
+	RelationshipSibling = "SIBLING"
+)
+
 // VirtualCardCreateRequest represents virtual card creation request
 type VirtualCardCreateRequest struct {
-	Nickname         string    `json:"nickname"`
-	SpendingLimit    float64   `json:"spendingLimit"`
-	CardType         string    `json:"cardType"`
-	ExpiryPeriod     string    `json:"expiryPeriod"`
+	Nickname         string     `json:"nickname"`
+	SpendingLimit    float64    `json:"spendingLimit"`
+	CardType         string     `json:"cardType"`
+	ExpiryPeriod     string     `json:"expiryPeriod"`
 	CustomExpiryDate *time.Time `json:"customExpiryDate"`
-	LinkedAccountID  string    `json:"linkedAccountId"`
+	LinkedAccountID  string     `json:"linkedAccountId"`
 }
 
 // VirtualCardUpdateRequest represents virtual card update request
@@ -145,48 +525,128 @@ type SpendingLimitRequest struct {
 // StatusRequest represents status update request
 type StatusRequest struct {
 	Status string `json:"status"`
+	Reason string `json:"reason,omitempty"`
 }
 
 // Transaction represents a card transaction
 type Transaction struct {
-	ID        string    `json:"id"`
-	CardID    string    `json:"cardId"`
-	Amount    float64   `json:"amount"`
-	Merchant  string    `json:"merchant"`
-	Date      time.Time `json:"date"`
-	Status    string    `json:"status"`
-	Type      string    `json:"type"`
+	ID       string    `json:"id"`
+	CardID   string    `json:"cardId"`
+	Amount   float64   `json:"amount"`
+	Merchant string    `json:"merchant"`
+	Date     time.Time `json:"date"`
+	Status   string    `json:"status"`
+	Type     string    `json:"type"`
+
+	Channel       string `json:"channel,omitempty"`
+	Currency      string `json:"currency,omitempty"`
+	Country       string `json:"country,omitempty"`
+	DeclineReason string `json:"declineReason,omitempty"`
+	Category      string `json:"category,omitempty"`
+	// OriginalTransactionID is the purchase a refund gives money back for
+	OriginalTransactionID string `json:"originalTransactionId,omitempty"`
+}
+
+// Transaction statuses and types recorded by card authorization
+const (
+	TransactionStatusApproved = "Approved"
+	TransactionStatusDeclined = "Declined"
+
+	TransactionTypePurchase       = "Purchase"
+	TransactionTypeCashWithdrawal = "Cash Withdrawal"
+	TransactionTypeRefund         = "Refund"
+)
+
+// RefundRequest represents a merchant refund of a purchase sent by settlement.
+// A missing amount refunds whatever has not been refunded yet.
+type RefundRequest struct {
+	Amount float64 `json:"amount,omitempty"`
+}
+
+// Authorization channels
+const (
+	ChannelOnline      = "ONLINE"
+	ChannelATM         = "ATM"
+	ChannelPOS         = "POS"
+	ChannelContactless = "CONTACTLESS"
+)
+
+// AuthorizationRequest represents a card transaction authorization request
+type AuthorizationRequest struct {
+	Channel  string  `json:"channel"`
+	Amount   float64 `json:"amount"`
+	Currency string  `json:"currency"`
+	Country  string  `json:"country"`
+	Merchant string  `json:"merchant"`
+	// Category is the merchant category, which sets the rewards earn rate
+	Category string `json:"category,omitempty"`
+}
+
+// AuthorizationResult represents the outcome of an authorization request
+type AuthorizationResult struct {
+	TransactionID string  `json:"transactionId"`
+	CardID        string  `json:"cardId"`
+	Approved      bool    `json:"approved"`
+	DeclineReason string  `json:"declineReason,omitempty"`
+	Message       string  `json:"message"`
+	Amount        float64 `json:"amount"`
+	Currency      string  `json:"currency"`
+}
+
+// LedgerAccount represents an account in the double-entry ledger
+type LedgerAccount struct {
+	ID       string `json:"id"`
+	Type     string `json:"type"`
+	Name     string `json:"name"`
+	Currency string `json:"currency"`
+	UserID   string `json:"-"`
+}
+
+// Posting is one leg of a journal entry. Amount is in minor units; positive
+// amounts are debits and negative amounts credits.
+type Posting struct {
+	AccountID string `json:"accountId"`
+	Amount    int64  `json:"amount"`
+}
+
+// JournalEntry is an immutable, balanced set of postings
+type JournalEntry struct {
+	ID          string    `json:"id"`
+	Date        time.Time `json:"date"`
+	Description string    `json:"description"`
+	Reference   string    `json:"reference,omitempty"`
+	Postings    []Posting `json:"postings"`
 }
 
 // CardSettings represents card settings
 type CardSettings struct {
-	DefaultCreditCardID            string    `json:"defaultCreditCardId"`
-	DefaultDebitCardID             string    `json:"defaultDebitCardId"`
-	DefaultVirtualCardID           string    `json:"defaultVirtualCardId"`
-	TransactionNotificationsEnabled bool     `json:"transactionNotificationsEnabled"`
-	NotificationPreferences        []string `json:"notificationPreferences"`
-	TransactionAmountThreshold     float64  `json:"transactionAmountThreshold"`
-	InternationalTransactionAlerts bool     `json:"internationalTransactionAlerts"`
-	ContactlessPaymentsEnabled     bool     `json:"contactlessPaymentsEnabled"`
-	InternationalUsageEnabled      bool     `json:"internationalUsageEnabled"`
-	OnlineTransactionsEnabled      bool     `json:"onlineTransactionsEnabled"`
-	ATMWithdrawalsEnabled          bool     `json:"atmWithdrawalsEnabled"`
-	DefaultDailyLimit              float64  `json:"defaultDailyLimit"`
-	DefaultMonthlyLimit            float64  `json:"defaultMonthlyLimit"`
-	StatementDelivery              string   `json:"statementDelivery"`
-	StatementFrequency             string   `json:"statementFrequency"`
-	EStatementEnabled              bool     `json:"eStatementEnabled"`
-	BiometricAuthenticationEnabled bool     `json:"biometricAuthenticationEnabled"`
-	TwoFactorAuthenticationEnabled bool     `json:"twoFactorAuthenticationEnabled"`
-	TransactionAuthenticationRequired bool  `json:"transactionAuthenticationRequired"`
-	PINForContactlessEnabled        bool    `json:"pinForContactlessEnabled"`
-	UserID                          string  `json:"-"`
+	DefaultCreditCardID               string   `json:"defaultCreditCardId"`
+	DefaultDebitCardID                string   `json:"defaultDebitCardId"`
+	DefaultVirtualCardID              string   `json:"defaultVirtualCardId"`
+	TransactionNotificationsEnabled   bool     `json:"transactionNotificationsEnabled"`
+	NotificationPreferences           []string `json:"notificationPreferences"`
+	TransactionAmountThreshold        float64  `json:"transactionAmountThreshold"`
+	InternationalTransactionAlerts    bool     `json:"internationalTransactionAlerts"`
+	ContactlessPaymentsEnabled        bool     `json:"contactlessPaymentsEnabled"`
+	InternationalUsageEnabled         bool     `json:"internationalUsageEnabled"`
+	OnlineTransactionsEnabled         bool     `json:"onlineTransactionsEnabled"`
+	ATMWithdrawalsEnabled             bool     `json:"atmWithdrawalsEnabled"`
+	DefaultDailyLimit                 float64  `json:"defaultDailyLimit"`
+	DefaultMonthlyLimit               float64  `json:"defaultMonthlyLimit"`
+	StatementDelivery                 string   `json:"statementDelivery"`
+	StatementFrequency                string   `json:"statementFrequency"`
+	EStatementEnabled                 bool     `json:"eStatementEnabled"`
+	BiometricAuthenticationEnabled    bool     `json:"biometricAuthenticationEnabled"`
+	TwoFactorAuthenticationEnabled    bool     `json:"twoFactorAuthenticationEnabled"`
+	TransactionAuthenticationRequired bool     `json:"transactionAuthenticationRequired"`
+	PINForContactlessEnabled          bool     `json:"pinForContactlessEnabled"`
+	UserID                            string   `json:"-"`
 }
 
 // DefaultCardsRequest represents default cards update request
 type DefaultCardsRequest struct {
 	DefaultCreditCardID  *string `json:"defaultCreditCardId,omitempty"`
-	DefaultDebitCardID    *string `json:"defaultDebitCardId,omitempty"`
+	DefaultDebitCardID   *string `json:"defaultDebitCardId,omitempty"`
 	DefaultVirtualCardID *string `json:"defaultVirtualCardId,omitempty"`
 }
 
@@ -207,9 +667,9 @@ type GlobalLimitsRequest struct {
 // NotificationSettingsRequest represents notification settings update request
 type NotificationSettingsRequest struct {
 	TransactionNotificationsEnabled *bool     `json:"transactionNotificationsEnabled,omitempty"`
-	NotificationPreferences          *[]string `json:"notificationPreferences,omitempty"`
-	TransactionAmountThreshold       *float64 `json:"transactionAmountThreshold,omitempty"`
-	InternationalTransactionAlerts   *bool     `json:"internationalTransactionAlerts,omitempty"`
+	NotificationPreferences         *[]string `json:"notificationPreferences,omitempty"`
+	TransactionAmountThreshold      *float64  `json:"transactionAmountThreshold,omitempty"`
+	InternationalTransactionAlerts  *bool     `json:"internationalTransactionAlerts,omitempty"`
 }
 
 // StatementSettingsRequest represents statement settings update request
@@ -245,9 +705,29 @@ type CardsResponse struct {
 
 // LimitsResponse represents limits response
 type LimitsResponse struct {
-	CardID              string            `json:"cardId"`
+	CardID              string             `json:"cardId"`
 	DomesticLimits      []TransactionLimit `json:"domesticLimits,omitempty"`
 	InternationalLimits []TransactionLimit `json:"internationalLimits,omitempty"`
+	Daily               *UsageSummary      `json:"daily,omitempty"`
+	Monthly             *UsageSummary      `json:"monthly,omitempty"`
+}
+
+// UsageSummary represents consumption of an overall card limit in the current period
+type UsageSummary struct {
+	Period    string  `json:"period"`
+	Limit     float64 `json:"limit"`
+	Used      float64 `json:"used"`
+	Remaining float64 `json:"remaining"`
+}
+
+// CardUsage tracks how much of a card's limits was consumed in the current
+// day and month. Counters are keyed by scope and limit type, e.g. "domestic:Online".
+type CardUsage struct {
+	CardID  string             `json:"cardId"`
+	Day     string             `json:"day"`
+	Month   string             `json:"month"`
+	Daily   map[string]float64 `json:"daily"`
+	Monthly map[string]float64 `json:"monthly"`
 }
 
 // Pagination represents pagination info
@@ -260,8 +740,206 @@ type Pagination struct {
 
 // TransactionsResponse represents transactions response
 type TransactionsResponse struct {
-	Transactions []Transaction `json:"transactions"`
-	Pagination   Pagination    `json:"pagination"`
+	Transactions []Transaction     `json:"transactions"`
+	Pagination   *Pagination       `json:"pagination,omitempty"`
+	Cursor       *CursorPagination `json:"cursor,omitempty"`
+}
+
+// CursorPagination links to the pages around a cursor paginated page
+type CursorPagination struct {
+	Limit      int    `json:"limit"`
+	NextCursor string `json:"nextCursor,omitempty"`
+	PrevCursor string `json:"prevCursor,omitempty"`
+}
+
+// CreditCardDetail is a credit card with its pricing and where it stands
+// against its latest statement
+type CreditCardDetail struct {
+	*CreditCard
+	Pricing *CardProduct    `json:"pricing"`
+	Billing *BillingSummary `json:"billing,omitempty"`
+}
+
+// CardProduct is the pricing of a credit card product. APRs are percentages
+// and fees are in major units.
+type CardProduct struct {
+	Name         string  `json:"product"`
+	PurchaseAPR  float64 `json:"purchaseApr"`
+	CashAPR      float64 `json:"cashApr"`
+	LateFee      float64 `json:"lateFee"`
+	OverLimitFee float64 `json:"overLimitFee"`
+	AnnualFee    float64 `json:"annualFee"`
+}
+
+// BillingSummary shows what is owed on the latest statement, how much has been
+// paid towards it and the interest accrued so far in the current cycle
+type BillingSummary struct {
+	StatementID        string    `json:"statementId,omitempty"`
+	StatementDate      time.Time `json:"statementDate,omitempty"`
+	DueDate            time.Time `json:"dueDate,omitempty"`
+	TotalDue           float64   `json:"totalDue"`
+	MinimumDue         float64   `json:"minimumDue"`
+	PaidSinceStatement float64   `json:"paidSinceStatement"`
+	InterestCharged    float64   `json:"interestCharged"`
+	FeesCharged        float64   `json:"feesCharged"`
+	AccruedInterest    float64   `json:"accruedInterest"`
+	InGracePeriod      bool      `json:"inGracePeriod"`
+}
+
+// RewardsProgram sets how a credit card type earns and redeems rewards points
+type RewardsProgram struct {
+	Name string `json:"name"`
+	// EarnRate is points earned per ₹100 spent; CategoryRates override it for
+	// merchant categories
+	EarnRate      float64            `json:"earnRate"`
+	CategoryRates map[string]float64 `json:"categoryRates,omitempty"`
+	// ExpiryMonths is how long points stay valid after they are earned
+	ExpiryMonths int `json:"expiryMonths"`
+	// PointValue is what a point is worth when redeemed as statement credit
+	PointValue float64 `json:"pointValue"`
+}
+
+// RewardsVoucher is a catalog voucher points can be redeemed for
+type RewardsVoucher struct {
+	ID     string  `json:"id"`
+	Name   string  `json:"name"`
+	Points int     `json:"points"`
+	Value  float64 `json:"value"`
+}
+
+// RewardsEntry is one movement in a card's rewards points ledger. Points are
+// positive when earned and negative when reversed, redeemed or expired.
+type RewardsEntry struct {
+	ID            string     `json:"id"`
+	CardID        string     `json:"cardId"`
+	UserID        string     `json:"-"`
+	Type          string     `json:"type"`
+	Points        int        `json:"points"`
+	Description   string     `json:"description"`
+	Date          time.Time  `json:"date"`
+	ExpiresAt     *time.Time `json:"expiresAt,omitempty"`
+	TransactionID string     `json:"transactionId,omitempty"`
+	// EarnEntryID is the earn entry a reversal or expiry takes points from
+	EarnEntryID string `json:"earnEntryId,omitempty"`
+	// Value, VoucherCode and JournalEntryID describe what a redemption bought
+	Value          float64 `json:"value,omitempty"`
+	VoucherCode    string  `json:"voucherCode,omitempty"`
+	JournalEntryID string  `json:"journalEntryId,omitempty"`
+	// Reference makes each entry unique to the event that caused it
+	Reference string `json:"-"`
+}
+
+// Rewards entry types
+const (
+	RewardsEarn     = "EARN"
+	RewardsReversal = "REVERSAL"
+	RewardsRedeem   = "REDEEM"
+	RewardsExpire   = "EXPIRE"
+)
+
+// RedeemRequest represents a rewards redemption request
+type RedeemRequest struct {
+	Type      string `json:"type"`
+	Points    int    `json:"points,omitempty"`
+	VoucherID string `json:"voucherId,omitempty"`
+}
+
+// Redemption types
+const (
+	RedeemStatementCredit = "STATEMENT_CREDIT"
+	RedeemVoucher         = "VOUCHER"
+)
+
+// EMIOffer is one way a purchase can be converted to monthly installments
+type EMIOffer struct {
+	Tenure             int     `json:"tenure"`
+	InterestRate       float64 `json:"interestRate"`
+	MonthlyInstallment float64 `json:"monthlyInstallment"`
+	TotalInterest      float64 `json:"totalInterest"`
+	ProcessingFee      float64 `json:"processingFee"`
+	TotalPayable       float64 `json:"totalPayable"`
+}
+
+// EMIRequest represents an EMI conversion request
+type EMIRequest struct {
+	Tenure int `json:"tenure"`
+}
+
+// EMIPlan is a purchase converted to monthly installments. One installment
+// is billed on each statement after the conversion.
+type EMIPlan struct {
+	ID            string `json:"id"`
+	CardID        string `json:"cardId"`
+	UserID        string `json:"-"`
+	TransactionID string `json:"transactionId"`
+	Merchant      string `json:"merchant"`
+	EMIOffer
+	Principal      float64          `json:"principal"`
+	Status         string           `json:"status"`
+	CreatedAt      time.Time        `json:"createdAt"`
+	ClosedAt       *time.Time       `json:"closedAt,omitempty"`
+	ForeclosureFee float64          `json:"foreclosureFee,omitempty"`
+	Installments   []EMIInstallment `json:"installments"`
+}
+
+// EMI plan statuses
+const (
+	EMIStatusActive     = "ACTIVE"
+	EMIStatusCompleted  = "COMPLETED"
+	EMIStatusForeclosed = "FORECLOSED"
+)
+
+// EMIInstallment is one month of an EMI plan's schedule
+type EMIInstallment struct {
+	Number    int     `json:"number"`
+	Principal float64 `json:"principal"`
+	Interest  float64 `json:"interest"`
+	Amount    float64 `json:"amount"`
+	// Status and BilledAt are filled in when reporting a plan
+	Status   string     `json:"status,omitempty"`
+	BilledAt *time.Time `json:"billedAt,omitempty"`
+}
+
+// EMI installment statuses
+const (
+	InstallmentPending    = "PENDING"
+	InstallmentBilled     = "BILLED"
+	InstallmentForeclosed = "FORECLOSED"
+)
+
+// Statement is an immutable credit card statement for one billing cycle.
+// Balances are the amount owed, so payments and refunds are negative lines.
+type Statement struct {
+	ID             string    `json:"id"`
+	CardID         string    `json:"cardId"`
+	UserID         string    `json:"-"`
+	PeriodStart    time.Time `json:"periodStart"`
+	PeriodEnd      time.Time `json:"periodEnd"`
+	GeneratedAt    time.Time `json:"generatedAt"`
+	OpeningBalance float64   `json:"openingBalance"`
+	TotalDebits    float64   `json:"totalDebits"`
+	TotalCredits   float64   `json:"totalCredits"`
+	// InterestCharged and FeesCharged are the part of TotalDebits that is
+	// interest and fees rather than spending
+	InterestCharged float64 `json:"interestCharged"`
+	FeesCharged     float64 `json:"feesCharged"`
+	// InstallmentsCharged is the EMI principal billed this cycle
+	InstallmentsCharged float64         `json:"installmentsCharged"`
+	ClosingBalance      float64         `json:"closingBalance"`
+	TotalDue            float64         `json:"totalDue"`
+	MinimumDue          float64         `json:"minimumDue"`
+	DueDate             time.Time       `json:"dueDate"`
+	Lines               []StatementLine `json:"lines,omitempty"`
+}
+
+// StatementLine is one ledger entry of a statement. Amount is positive for
+// charges and negative for payments and credits.
+type StatementLine struct {
+	EntryID     string    `json:"entryId"`
+	Date        time.Time `json:"date"`
+	Description string    `json:"description"`
+	Reference   string    `json:"reference,omitempty"`
+	Amount      float64   `json:"amount"`
 }
 
 // GenerateID generates a new UUID
@@ -0,0 +1,80 @@
+// Package password hashes and verifies user passwords with bcrypt.
+package password
+
+import (
+	"errors"
+	"strings"
+	"unicode"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// Cost is the bcrypt work factor used for new hashes
+	Cost = bcrypt.DefaultCost
+
+	MinLength = 8
+	// MaxLength is bcrypt's input limit
+	MaxLength = 72
+)
+
+// dummyHash is compared against when a user does not exist so that unknown
+// and known user IDs take the same time to reject
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("dummy password"), Cost)
+
+// Hash returns a salted bcrypt hash of plain
+func Hash(plain string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(plain), Cost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// MustHash is like Hash but panics on error. It is meant for seeding data.
+func MustHash(plain string) string {
+	hash, err := Hash(plain)
+	if err != nil {
+		panic(err)
+	}
+	return hash
+}
+
+// Verify reports whether plain matches hash. An empty hash never matches but
+// still costs a full bcrypt comparison.
+func Verify(hash, plain string) bool {
+	if hash == "" {
+		bcrypt.CompareHashAndPassword(dummyHash, []byte(plain))
+		return false
+	}
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(plain)) == nil
+}
+
+// CheckPolicy returns an error describing why plain is not an acceptable
+// password for the given user ID, or nil if it is
+func CheckPolicy(plain, userID string) error {
+	if len(plain) < MinLength {
+		return errors.New("password must be at least 8 characters")
+	}
+	if len(plain) > MaxLength {
+		return errors.New("password must be at most 72 characters")
+	}
+
+	var hasLetter, hasDigit bool
+	for _, c := range plain {
+		switch {
+		case unicode.IsLetter(c):
+			hasLetter = true
+		case unicode.IsDigit(c):
+			hasDigit = true
+		}
+	}
+	if !hasLetter || !hasDigit {
+		return errors.New("password must contain both letters and digits")
+	}
+
+	if userID != "" && strings.Contains(strings.ToLower(plain), strings.ToLower(userID)) {
+		return errors.New("password must not contain the user ID")
+	}
+	return nil
+}
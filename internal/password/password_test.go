@@ -0,0 +1,51 @@
+package password
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestHashAndVerify(t *testing.T) {
+	hash, err := Hash("correct horse 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hash == "correct horse 1" {
+		t.Fatal("Hash returned the password")
+	}
+	if !Verify(hash, "correct horse 1") {
+		t.Error("Verify rejected the right password")
+	}
+	if Verify(hash, "correct horse 2") {
+		t.Error("Verify accepted a wrong password")
+	}
+	if Verify("", "") {
+		t.Error("Verify accepted an empty hash")
+	}
+
+	again, _ := Hash("correct horse 1")
+	if again == hash {
+		t.Error("hashes of the same password are not salted")
+	}
+}
+
+func TestCheckPolicy(t *testing.T) {
+	tests := []struct {
+		password string
+		userID   string
+		ok       bool
+	}{
+		{"abc123", "", false},
+		{strings.Repeat("a1", 37), "", false},
+		{"onlyletters", "", false},
+		{"1234567890", "", false},
+		{"xJohnDoe42x", "johndoe", false},
+		{"password123", "testuser", true},
+		{"pässwörd123", "", true},
+	}
+	for _, tt := range tests {
+		if err := CheckPolicy(tt.password, tt.userID); (err == nil) != tt.ok {
+			t.Errorf("CheckPolicy(%q, %q) = %v, want ok %v", tt.password, tt.userID, err, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+// Package payment applies customer payments to credit card bills. Money moves
+// from one of the customer's bank accounts to the card's credit line and pays
+// off unpaid fees first, then interest, then principal. Every request carries
+// an idempotency key, so a retried request returns the original receipt
+// instead of paying twice.
+package payment
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"bankapp-microservices/internal/autopay"
+	"bankapp-microservices/internal/ledger"
+	"bankapp-microservices/internal/models"
+	"bankapp-microservices/internal/pricing"
+	"bankapp-microservices/internal/store"
+)
+
+var (
+	ErrInvalidType       = errors.New("payment type must be FULL or PARTIAL")
+	ErrInvalidAmount     = errors.New("payment amount must be greater than zero")
+	ErrNothingOwed       = errors.New("card has no outstanding balance")
+	ErrExceedsBalance    = errors.New("payment exceeds the outstanding balance")
+	ErrAccountNotFound   = errors.New("paying account is not one of the user's debit card accounts")
+	ErrInsufficientFunds = errors.New("insufficient funds in the paying account")
+	ErrKeyReused         = errors.New("idempotency key was already used for a different payment")
+)
+
+// paying serializes payments so an idempotency key only ever pays once
+var paying sync.Mutex
+
+// Pay makes the payment req describes towards card and returns its receipt.
+// If the card's owner already made a payment with key, that receipt is
+// returned instead and replayed is true.
+func Pay(s store.Store, card *models.CreditCard, req *models.PaymentRequest, key string, now time.Time) (payment *models.CardPayment, replayed bool, err error) {
+	paying.Lock()
+	defer paying.Unlock()
+
+	paymentType := strings.ToUpper(strings.TrimSpace(req.PaymentType))
+	if paymentType == "" {
+		paymentType = models.PaymentPartial
+	}
+	if paymentType != models.PaymentFull && paymentType != models.PaymentPartial {
+		return nil, false, ErrInvalidType
+	}
+
+	fingerprint := Fingerprint(card.ID, paymentType, req)
+	if previous, exists := s.GetCardPaymentByIdempotencyKey(card.UserID, key); exists {
+		if previous.Fingerprint != fingerprint {
+			return nil, false, ErrKeyReused
+		}
+		return previous, true, nil
+	}
+
+	balance := pricing.Outstanding(card.LedgerAccountID, s.GetJournalEntriesByAccountID(card.LedgerAccountID))
+	owed := balance.Total()
+	amount := owed
+	if paymentType == models.PaymentPartial {
+		amount = ledger.ToMinor(req.Amount)
+		if amount <= 0 {
+			return nil, false, ErrInvalidAmount
+		}
+	}
+	if owed <= 0 {
+		return nil, false, ErrNothingOwed
+	}
+	if amount > owed {
+		return nil, false, ErrExceedsBalance
+	}
+
+	account, found := autopay.LinkedAccount(s, card.UserID, req.FromAccountID)
+	if !found {
+		return nil, false, ErrAccountNotFound
+	}
+	if s.GetAccountBalance(account.LedgerAccountID) < amount {
+		return nil, false, ErrInsufficientFunds
+	}
+
+	payment = &models.CardPayment{
+		ID:              models.GenerateID(),
+		CardID:          card.ID,
+		UserID:          card.UserID,
+		FromAccountID:   account.AccountNumber,
+		Amount:          ledger.ToMajor(amount),
+		PreviousBalance: ledger.ToMajor(owed),
+		PaidAt:          now,
+		IdempotencyKey:  key,
+		Fingerprint:     fingerprint,
+	}
+	entry := ledger.Transfer(account.LedgerAccountID, card.LedgerAccountID, amount, "Card payment", "payment:"+payment.ID, now)
+	if err := s.PostJournalEntry(entry); err != nil {
+		// The account may have been drawn on since its balance was checked
+		if errors.Is(err, ledger.ErrInsufficientFunds) {
+			return nil, false, ErrInsufficientFunds
+		}
+		return nil, false, fmt.Errorf("post payment: %w", err)
+	}
+	payment.JournalEntryID = entry.ID
+
+	paid := balance.Apply(amount)
+	payment.Allocation = models.PaymentAllocation{
+		Fees:      ledger.ToMajor(paid.Fees),
+		Interest:  ledger.ToMajor(paid.Interest),
+		Principal: ledger.ToMajor(paid.Principal),
+	}
+	payment.PaymentType = models.PaymentPartial
+	if balance.Total() <= 0 {
+		payment.PaymentType = models.PaymentFull
+	}
+	payment.OutstandingBalance = ledger.ToMajor(balance.Total())
+	// Principal converted to EMI still uses up the credit limit
+	payment.AvailableCredit = card.TotalCredit - payment.OutstandingBalance - card.EMIOutstanding
+
+	s.AddCardPayment(payment)
+	return payment, false, nil
+}
+
+// Fingerprint identifies a payment request, so a reused idempotency key can
+// be told apart from a retry
+func Fingerprint(cardID, paymentType string, req *models.PaymentRequest) string {
+	amount := ledger.ToMinor(req.Amount)
+	if paymentType == models.PaymentFull {
+		amount = 0
+	}
+	return fmt.Sprintf("%s|%s|%s|%d", cardID, paymentType, strings.TrimSpace(req.FromAccountID), amount)
+}
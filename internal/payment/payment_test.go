@@ -0,0 +1,126 @@
+package payment
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"bankapp-microservices/internal/ledger"
+	"bankapp-microservices/internal/models"
+	"bankapp-microservices/internal/store"
+)
+
+// newCard opens a credit card for testuser owing a 500.00 purchase, 7.50 of
+// fees and 2.50 of interest
+func newCard(t *testing.T, s store.Store, now time.Time) *models.CreditCard {
+	t.Helper()
+	card := &models.CreditCard{ID: models.GenerateID(), UserID: "testuser", TotalCredit: 10000, Status: models.CardStatusActive}
+	card.LedgerAccountID = ledger.CreditCardAccountID(card.ID)
+	s.CreateLedgerAccount(&models.LedgerAccount{ID: card.LedgerAccountID, Type: ledger.TypeCreditLine, Currency: ledger.Currency, UserID: card.UserID})
+	s.UpdateCreditCard(card)
+
+	for _, entry := range []*models.JournalEntry{
+		ledger.Transfer(card.LedgerAccountID, ledger.AccountMerchantSettlement, 50000, "Purchase", "", now.Add(-3*time.Hour)),
+		ledger.Transfer(card.LedgerAccountID, ledger.AccountFeeIncome, 750, "Late fee", "", now.Add(-2*time.Hour)),
+		ledger.Transfer(card.LedgerAccountID, ledger.AccountInterestIncome, 250, "Interest", "", now.Add(-time.Hour)),
+	} {
+		if err := s.PostJournalEntry(entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return card
+}
+
+func TestPayAllocatesFeesInterestThenPrincipal(t *testing.T) {
+	s := store.NewMemoryStore()
+	now := time.Now()
+	card := newCard(t, s, now)
+	debit := s.GetDebitCardsByUserID("testuser")[0]
+	before := s.GetAccountBalance(debit.LedgerAccountID)
+
+	req := &models.PaymentRequest{PaymentType: "partial", Amount: 20, FromAccountID: debit.AccountNumber}
+	payment, replayed, err := Pay(s, card, req, "key-1", now)
+	if err != nil || replayed {
+		t.Fatalf("Pay = %v, replayed %v", err, replayed)
+	}
+	if want := (models.PaymentAllocation{Fees: 7.5, Interest: 2.5, Principal: 10}); payment.Allocation != want {
+		t.Errorf("allocation = %+v, want %+v", payment.Allocation, want)
+	}
+	if payment.PaymentType != models.PaymentPartial || payment.PreviousBalance != 510 || payment.OutstandingBalance != 490 {
+		t.Errorf("receipt = %s, previous %v, outstanding %v", payment.PaymentType, payment.PreviousBalance, payment.OutstandingBalance)
+	}
+	if got := before - s.GetAccountBalance(debit.LedgerAccountID); got != 2000 {
+		t.Errorf("paying account was charged %d, want 2000", got)
+	}
+
+	payment, _, err = Pay(s, card, &models.PaymentRequest{PaymentType: models.PaymentFull, FromAccountID: debit.AccountNumber}, "key-2", now)
+	if err != nil || payment.Amount != 490 || payment.OutstandingBalance != 0 || payment.PaymentType != models.PaymentFull {
+		t.Fatalf("full payment = %+v, %v", payment, err)
+	}
+	if _, _, err := Pay(s, card, &models.PaymentRequest{PaymentType: models.PaymentFull, FromAccountID: debit.AccountNumber}, "key-3", now); !errors.Is(err, ErrNothingOwed) {
+		t.Errorf("paying a settled card = %v, want ErrNothingOwed", err)
+	}
+}
+
+func TestPayIsIdempotent(t *testing.T) {
+	s := store.NewMemoryStore()
+	now := time.Now()
+	card := newCard(t, s, now)
+	debit := s.GetDebitCardsByUserID("testuser")[0]
+
+	req := &models.PaymentRequest{PaymentType: models.PaymentPartial, Amount: 100, FromAccountID: debit.AccountNumber}
+	first, _, err := Pay(s, card, req, "retry-me", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	balance := s.GetAccountBalance(debit.LedgerAccountID)
+
+	again, replayed, err := Pay(s, card, req, "retry-me", now.Add(time.Minute))
+	if err != nil || !replayed || again.ID != first.ID {
+		t.Errorf("retry = %v, replayed %v, same receipt %v", err, replayed, again != nil && again.ID == first.ID)
+	}
+	if s.GetAccountBalance(debit.LedgerAccountID) != balance {
+		t.Error("a retried payment moved money")
+	}
+
+	different := &models.PaymentRequest{PaymentType: models.PaymentPartial, Amount: 200, FromAccountID: debit.AccountNumber}
+	if _, _, err := Pay(s, card, different, "retry-me", now); !errors.Is(err, ErrKeyReused) {
+		t.Errorf("reused key = %v, want ErrKeyReused", err)
+	}
+}
+
+func TestPayRejects(t *testing.T) {
+	s := store.NewMemoryStore()
+	now := time.Now()
+	card := newCard(t, s, now)
+	debit := s.GetDebitCardsByUserID("testuser")[0]
+
+	tests := []struct {
+		name string
+		req  models.PaymentRequest
+		want error
+	}{
+		{"unknown type", models.PaymentRequest{PaymentType: "SOME", Amount: 10, FromAccountID: debit.AccountNumber}, ErrInvalidType},
+		{"zero amount", models.PaymentRequest{PaymentType: models.PaymentPartial, FromAccountID: debit.AccountNumber}, ErrInvalidAmount},
+		{"more than owed", models.PaymentRequest{PaymentType: models.PaymentPartial, Amount: 510.01, FromAccountID: debit.AccountNumber}, ErrExceedsBalance},
+		{"foreign account", models.PaymentRequest{PaymentType: models.PaymentPartial, Amount: 10, FromAccountID: "99999999999999"}, ErrAccountNotFound},
+	}
+	for _, tt := range tests {
+		if _, _, err := Pay(s, card, &tt.req, tt.name, now); !errors.Is(err, tt.want) {
+			t.Errorf("%s: Pay = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+
+	// Drain the paying account so it cannot cover the bill
+	available := s.GetAccountBalance(debit.LedgerAccountID)
+	if err := s.PostJournalEntry(ledger.Transfer(debit.LedgerAccountID, ledger.AccountMerchantSettlement, available-100, "Spend", "", now)); err != nil {
+		t.Fatal(err)
+	}
+	before := s.GetAccountBalance(card.LedgerAccountID)
+	if _, _, err := Pay(s, card, &models.PaymentRequest{PaymentType: models.PaymentPartial, Amount: 5, FromAccountID: debit.AccountNumber}, "broke", now); !errors.Is(err, ErrInsufficientFunds) {
+		t.Errorf("Pay from a drained account = %v, want ErrInsufficientFunds", err)
+	}
+	if s.GetAccountBalance(card.LedgerAccountID) != before {
+		t.Error("a declined payment changed the card balance")
+	}
+}
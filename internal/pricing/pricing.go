@@ -0,0 +1,249 @@
+// Package pricing holds the credit card product price list and the interest
+// and fee rules built on it. Interest accrues on the daily balance of the
+// card's credit line: cash advances always accrue at the cash APR from the
+// day they are taken, while purchases only accrue at the purchase APR when
+// the previous statement was not paid in full by its due date.
+package pricing
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"bankapp-microservices/internal/ledger"
+	"bankapp-microservices/internal/models"
+)
+
+// Products are keyed by card type
+var Products = map[string]*models.CardProduct{
+	"Visa Platinum": {
+		Name:         "Visa Platinum",
+		PurchaseAPR:  41.88,
+		CashAPR:      43.2,
+		LateFee:      750,
+		OverLimitFee: 600,
+		AnnualFee:    2500,
+	},
+	"Mastercard World": {
+		Name:         "Mastercard World",
+		PurchaseAPR:  39.0,
+		CashAPR:      42.0,
+		LateFee:      950,
+		OverLimitFee: 600,
+		AnnualFee:    5000,
+	},
+}
+
+// DefaultProduct prices card types missing from Products
+var DefaultProduct = &models.CardProduct{
+	Name:         "Standard",
+	PurchaseAPR:  42.0,
+	CashAPR:      42.0,
+	LateFee:      500,
+	OverLimitFee: 500,
+	AnnualFee:    500,
+}
+
+// ForCard returns the product pricing a card
+func ForCard(card *models.CreditCard) *models.CardProduct {
+	if product, exists := Products[card.CardType]; exists {
+		return product
+	}
+	return DefaultProduct
+}
+
+// Charge kinds, recognisable from the account their journal entries credit
+const (
+	KindInterest    = "interest"
+	KindFee         = "fee"
+	KindInstallment = "installment"
+)
+
+// ChargeKind reports whether an entry is an interest or fee charge or an EMI
+// installment billed from the card's EMI loans
+func ChargeKind(entry *models.JournalEntry) string {
+	for _, posting := range entry.Postings {
+		switch {
+		case posting.AccountID == ledger.AccountInterestIncome:
+			return KindInterest
+		case posting.AccountID == ledger.AccountFeeIncome:
+			return KindFee
+		case ledger.IsEMIAccount(posting.AccountID):
+			return KindInstallment
+		}
+	}
+	return ""
+}
+
+// isEMITransfer reports whether an entry moves money between a credit line
+// and its EMI loans. Converting a purchase credits the credit line, but it is
+// not a payment.
+func isEMITransfer(entry *models.JournalEntry) bool {
+	return ChargeKind(entry) == KindInstallment
+}
+
+// isCashAdvance reports whether an entry is an ATM withdrawal
+func isCashAdvance(entry *models.JournalEntry) bool {
+	for _, posting := range entry.Postings {
+		if posting.AccountID == ledger.AccountATMCash {
+			return true
+		}
+	}
+	return false
+}
+
+// Interest returns the interest in minor units accrued on a credit line over
+// [start, end), taking the balance at the end of each day in loc. Payments
+// and credits reduce the cash advance balance first.
+func Interest(product *models.CardProduct, accountID string, entries []*models.JournalEntry, start, end time.Time, loc *time.Location, graced bool) int64 {
+	sorted := append([]*models.JournalEntry(nil), entries...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Date.Before(sorted[j].Date) })
+
+	var owed, cash int64
+	apply := func(entry *models.JournalEntry) {
+		var amount int64
+		for _, posting := range entry.Postings {
+			if posting.AccountID == accountID {
+				amount -= posting.Amount
+			}
+		}
+		owed += amount
+		switch {
+		case amount > 0 && isCashAdvance(entry):
+			cash += amount
+		case amount < 0 && !isEMITransfer(entry):
+			cash = max(cash+amount, 0)
+		}
+	}
+
+	next := 0
+	for ; next < len(sorted) && sorted[next].Date.Before(start); next++ {
+		apply(sorted[next])
+	}
+
+	var interest float64
+	for day := start; day.Before(end); {
+		dayEnd := time.Date(day.In(loc).Year(), day.In(loc).Month(), day.In(loc).Day()+1, 0, 0, 0, 0, loc)
+		if dayEnd.After(end) {
+			dayEnd = end
+		}
+		for ; next < len(sorted) && sorted[next].Date.Before(dayEnd); next++ {
+			apply(sorted[next])
+		}
+
+		// A partial first or last day accrues for the part of it in range
+		fraction := dayEnd.Sub(day).Hours() / 24
+		cashBalance := min(cash, max(owed, 0))
+		interest += float64(cashBalance) * product.CashAPR / 100 / 365 * fraction
+		if !graced {
+			interest += float64(max(owed-cashBalance, 0)) * product.PurchaseAPR / 100 / 365 * fraction
+		}
+		day = dayEnd
+	}
+	return int64(math.Round(interest))
+}
+
+// Credits returns the payments and other credits posted to a credit line in
+// [start, end), in minor units. EMI conversions are not counted.
+func Credits(accountID string, entries []*models.JournalEntry, start, end time.Time) int64 {
+	var credits int64
+	for _, entry := range entries {
+		if entry.Date.Before(start) || !entry.Date.Before(end) || isEMITransfer(entry) {
+			continue
+		}
+		for _, posting := range entry.Postings {
+			if posting.AccountID == accountID && posting.Amount > 0 {
+				credits += posting.Amount
+			}
+		}
+	}
+	return credits
+}
+
+// Owed returns the amount owed on a credit line just before t, in minor units
+func Owed(accountID string, entries []*models.JournalEntry, t time.Time) int64 {
+	var owed int64
+	for _, entry := range entries {
+		if !entry.Date.Before(t) {
+			continue
+		}
+		for _, posting := range entry.Postings {
+			if posting.AccountID == accountID {
+				owed -= posting.Amount
+			}
+		}
+	}
+	return owed
+}
+
+// Balance splits the amount owed on a credit line, in minor units, into the
+// buckets payments are applied to
+type Balance struct {
+	Fees      int64
+	Interest  int64
+	Principal int64
+}
+
+// Total returns the whole amount owed
+func (b Balance) Total() int64 {
+	return b.Fees + b.Interest + b.Principal
+}
+
+// Apply pays amount off fees first, then interest, then principal, and
+// returns how much went to each. Anything left over is a credit balance
+// counted as negative principal.
+func (b *Balance) Apply(amount int64) Balance {
+	var paid Balance
+	paid.Fees = min(amount, max(b.Fees, 0))
+	amount -= paid.Fees
+	paid.Interest = min(amount, max(b.Interest, 0))
+	amount -= paid.Interest
+	paid.Principal = amount
+
+	b.Fees -= paid.Fees
+	b.Interest -= paid.Interest
+	b.Principal -= paid.Principal
+	return paid
+}
+
+// Outstanding returns what is owed on a credit line split into fees,
+// interest and principal. Every payment or credit on the line is applied
+// to fees first, then interest, then principal, and a credit balance is
+// used up by the next charges. Converting a purchase to EMI only takes it
+// off the principal.
+func Outstanding(accountID string, entries []*models.JournalEntry) Balance {
+	sorted := append([]*models.JournalEntry(nil), entries...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Date.Before(sorted[j].Date) })
+
+	var b Balance
+	for _, entry := range sorted {
+		var amount int64
+		for _, posting := range entry.Postings {
+			if posting.AccountID == accountID {
+				amount -= posting.Amount
+			}
+		}
+		if amount < 0 && isEMITransfer(entry) {
+			b.Principal += amount
+			continue
+		}
+		if amount < 0 {
+			b.Apply(-amount)
+			continue
+		}
+
+		// Charges first use up any credit balance
+		credit := min(amount, max(-b.Principal, 0))
+		b.Principal += credit
+		amount -= credit
+		switch ChargeKind(entry) {
+		case KindFee:
+			b.Fees += amount
+		case KindInterest:
+			b.Interest += amount
+		default:
+			b.Principal += amount
+		}
+	}
+	return b
+}
@@ -0,0 +1,90 @@
+package pricing
+
+import (
+	"testing"
+	"time"
+
+	"bankapp-microservices/internal/ledger"
+	"bankapp-microservices/internal/models"
+)
+
+const line = "credit:card"
+
+var start = time.Date(2026, 1, 5, 0, 0, 0, 0, time.UTC)
+
+func spend(to string, amount int64, at time.Time) *models.JournalEntry {
+	return ledger.Transfer(line, to, amount, "Spend", "", at)
+}
+
+func pay(amount int64, at time.Time) *models.JournalEntry {
+	return ledger.Transfer(ledger.AccountFunding, line, amount, "Payment", "", at)
+}
+
+func TestInterest(t *testing.T) {
+	product := &models.CardProduct{PurchaseAPR: 36.5, CashAPR: 73}
+	end := start.AddDate(0, 0, 10)
+	purchase := spend(ledger.AccountMerchantSettlement, 100000, start)
+	cash := spend(ledger.AccountATMCash, 100000, start)
+
+	// 1000.00 for 10 days at 36.5% is 0.1% a day
+	if got := Interest(product, line, []*models.JournalEntry{purchase}, start, end, time.UTC, false); got != 1000 {
+		t.Errorf("purchase interest = %d, want 1000", got)
+	}
+	if got := Interest(product, line, []*models.JournalEntry{purchase}, start, end, time.UTC, true); got != 0 {
+		t.Errorf("purchase interest in the grace period = %d, want 0", got)
+	}
+	// Cash accrues at the cash APR even in the grace period
+	if got := Interest(product, line, []*models.JournalEntry{cash}, start, end, time.UTC, true); got != 2000 {
+		t.Errorf("cash interest = %d, want 2000", got)
+	}
+	// Paying half on day 5 pays off cash first
+	entries := []*models.JournalEntry{cash, purchase, pay(100000, start.AddDate(0, 0, 5))}
+	if got := Interest(product, line, entries, start, end, time.UTC, true); got != 1000 {
+		t.Errorf("cash interest after a payment = %d, want 1000", got)
+	}
+	// A half day accrues half a day's interest
+	if got := Interest(product, line, []*models.JournalEntry{purchase}, start, start.Add(12*time.Hour), time.UTC, false); got != 50 {
+		t.Errorf("half day interest = %d, want 50", got)
+	}
+}
+
+func TestOutstanding(t *testing.T) {
+	entries := []*models.JournalEntry{
+		spend(ledger.AccountMerchantSettlement, 10000, start),
+		spend(ledger.AccountInterestIncome, 500, start.Add(time.Hour)),
+		spend(ledger.AccountFeeIncome, 750, start.Add(2*time.Hour)),
+		pay(1000, start.Add(3*time.Hour)),
+	}
+	got := Outstanding(line, entries)
+	if want := (Balance{Fees: 0, Interest: 250, Principal: 10000}); got != want {
+		t.Errorf("Outstanding = %+v, want %+v", got, want)
+	}
+
+	paid := got.Apply(20000)
+	if paid.Interest != 250 || paid.Principal != 19750 || got.Total() != -9750 {
+		t.Errorf("overpaying = paid %+v, left %+v", paid, got)
+	}
+}
+
+func TestCreditsAndOwed(t *testing.T) {
+	entries := []*models.JournalEntry{
+		spend(ledger.AccountMerchantSettlement, 10000, start),
+		pay(3000, start.AddDate(0, 0, 1)),
+		ledger.Transfer(ledger.EMIAccountID("card"), line, 5000, "EMI conversion", "", start.AddDate(0, 0, 2)),
+	}
+	if got := Credits(line, entries, start, start.AddDate(0, 0, 3)); got != 3000 {
+		t.Errorf("Credits = %d, want 3000 without the EMI conversion", got)
+	}
+	if got := Owed(line, entries, start.AddDate(0, 0, 2)); got != 7000 {
+		t.Errorf("Owed = %d, want 7000", got)
+	}
+}
+
+func TestForCard(t *testing.T) {
+	if got := ForCard(&models.CreditCard{CardType: "Mastercard World"}); got.Name != "Mastercard World" {
+		t.Errorf("ForCard = %s", got.Name)
+	}
+	if got := ForCard(&models.CreditCard{CardType: "Unknown"}); got != DefaultProduct {
+		t.Errorf("unknown card type priced as %s", got.Name)
+	}
+}
@@ -0,0 +1,131 @@
+// Package refund settles merchant refunds of approved card purchases. The
+// money goes back from merchant settlement to the card's ledger account and,
+// on credit cards, the rewards points the purchase earned are taken back in
+// proportion. Refunds arrive from the acquirer through settlement; customers
+// cannot refund their own purchases.
+package refund
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"bankapp-microservices/internal/emi"
+	"bankapp-microservices/internal/ledger"
+	"bankapp-microservices/internal/models"
+	"bankapp-microservices/internal/rewards"
+	"bankapp-microservices/internal/store"
+)
+
+var (
+	ErrCardNotFound        = errors.New("card not found")
+	ErrTransactionNotFound = errors.New("transaction not found")
+	ErrNotRefundable       = errors.New("only approved purchases can be refunded")
+	ErrConvertedToEMI      = errors.New("purchases converted to EMI cannot be refunded")
+	ErrFullyRefunded       = errors.New("transaction has already been fully refunded")
+	ErrInvalidAmount       = errors.New("amount must be at least 0.01")
+	ErrExceedsRemaining    = errors.New("amount exceeds what is left to refund")
+)
+
+// settling serializes refunds so a purchase is never refunded more than its amount
+var settling sync.Mutex
+
+// Settle refunds amount of the purchase transactionID made with cardID, or
+// whatever is left to refund if amount is 0, and returns the refund
+// transaction. It is linked to the purchase by OriginalTransactionID.
+func Settle(s store.Store, cardID, transactionID string, amount float64, now time.Time) (*models.Transaction, error) {
+	settling.Lock()
+	defer settling.Unlock()
+
+	account, exists := ledgerAccount(s, cardID)
+	if !exists {
+		return nil, ErrCardNotFound
+	}
+
+	var original *models.Transaction
+	var refunded int64
+	for _, txn := range s.GetTransactionsByCardID(cardID) {
+		if txn.ID == transactionID {
+			original = txn
+		}
+		if txn.OriginalTransactionID == transactionID {
+			refunded += ledger.ToMinor(txn.Amount)
+		}
+	}
+	if original == nil {
+		return nil, ErrTransactionNotFound
+	}
+	if original.Type != models.TransactionTypePurchase || original.Status != models.TransactionStatusApproved {
+		return nil, ErrNotRefundable
+	}
+	if _, converted := emi.PlanForTransaction(s, cardID, transactionID); converted {
+		return nil, ErrConvertedToEMI
+	}
+
+	remaining := ledger.ToMinor(original.Amount) - refunded
+	if remaining <= 0 {
+		return nil, ErrFullyRefunded
+	}
+	minor := remaining
+	if amount != 0 {
+		minor = ledger.ToMinor(amount)
+	}
+	if minor <= 0 {
+		return nil, ErrInvalidAmount
+	}
+	if minor > remaining {
+		return nil, ErrExceedsRemaining
+	}
+
+	refund := &models.Transaction{
+		ID:                    models.GenerateID(),
+		CardID:                cardID,
+		Amount:                ledger.ToMajor(minor),
+		Merchant:              original.Merchant,
+		Date:                  now,
+		Status:                models.TransactionStatusApproved,
+		Type:                  models.TransactionTypeRefund,
+		Channel:               original.Channel,
+		Currency:              original.Currency,
+		Country:               original.Country,
+		Category:              original.Category,
+		OriginalTransactionID: original.ID,
+	}
+	description := "Refund"
+	if original.Merchant != "" {
+		description = "Refund: " + original.Merchant
+	}
+	entry := ledger.Transfer(ledger.AccountMerchantSettlement, account, minor, description, refund.ID, now)
+	if err := s.PostJournalEntry(entry); err != nil {
+		return nil, err
+	}
+	if card, exists := rewardsCard(s, cardID); exists {
+		rewards.Reverse(s, card, original, refund, ledger.ToMajor(refunded+minor))
+	}
+	s.AddTransaction(refund)
+	return refund, nil
+}
+
+// ledgerAccount returns the ledger account behind a credit, debit or virtual card
+func ledgerAccount(s store.Store, cardID string) (string, bool) {
+	if card, exists := s.GetCreditCardByID(cardID); exists {
+		return card.LedgerAccountID, true
+	}
+	if card, exists := s.GetDebitCardByID(cardID); exists {
+		return card.LedgerAccountID, true
+	}
+	if card, exists := s.GetVirtualCardByID(cardID); exists {
+		return card.LedgerAccountID, true
+	}
+	return "", false
+}
+
+// rewardsCard returns the credit card that earns the points of cardID's
+// purchases: the card itself, or the primary card of an add-on
+func rewardsCard(s store.Store, cardID string) (*models.CreditCard, bool) {
+	card, exists := s.GetCreditCardByID(cardID)
+	if exists && card.PrimaryCardID != "" {
+		return s.GetCreditCardByID(card.PrimaryCardID)
+	}
+	return card, exists
+}
@@ -0,0 +1,101 @@
+package refund
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"bankapp-microservices/internal/ledger"
+	"bankapp-microservices/internal/models"
+	"bankapp-microservices/internal/rewards"
+	"bankapp-microservices/internal/store"
+)
+
+// buy posts an approved dining purchase of amount on a new Visa Platinum
+// card, with the points it earns, and returns the card and the purchase
+func buy(t *testing.T, s store.Store, amount float64, now time.Time) (*models.CreditCard, *models.Transaction) {
+	t.Helper()
+	card := &models.CreditCard{ID: models.GenerateID(), UserID: "testuser", CardType: "Visa Platinum", TotalCredit: 100000, Status: models.CardStatusActive}
+	card.LedgerAccountID = ledger.CreditCardAccountID(card.ID)
+	s.CreateLedgerAccount(&models.LedgerAccount{ID: card.LedgerAccountID, Type: ledger.TypeCreditLine, Currency: ledger.Currency, UserID: card.UserID})
+	s.UpdateCreditCard(card)
+
+	txn := &models.Transaction{ID: models.GenerateID(), CardID: card.ID, Amount: amount, Merchant: "Bistro", Category: rewards.CategoryDining, Date: now, Type: models.TransactionTypePurchase, Status: models.TransactionStatusApproved}
+	if err := s.PostJournalEntry(ledger.Transfer(card.LedgerAccountID, ledger.AccountMerchantSettlement, ledger.ToMinor(amount), "Bistro", txn.ID, now)); err != nil {
+		t.Fatal(err)
+	}
+	s.AddTransaction(txn)
+	rewards.Accrue(s, card, txn)
+	return card, txn
+}
+
+func TestSettle(t *testing.T) {
+	s := store.NewMemoryStore()
+	now := time.Now()
+	card, txn := buy(t, s, 1000, now)
+
+	first, err := Settle(s, card.ID, txn.ID, 300, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.Type != models.TransactionTypeRefund || first.Amount != 300 || first.OriginalTransactionID != txn.ID {
+		t.Errorf("refund = %+v", first)
+	}
+	if stored, _ := s.GetCreditCardByID(card.ID); stored.OutstandingBalance != 700 || stored.RewardsPoints != 35 {
+		t.Errorf("after 300 back: outstanding %.2f and %d points, want 700 and 35", stored.OutstandingBalance, stored.RewardsPoints)
+	}
+
+	// No amount refunds whatever is left, taking back the rest of the points
+	rest, err := Settle(s, card.ID, txn.ID, 0, now)
+	if err != nil || rest.Amount != 700 {
+		t.Fatalf("refund of the rest = %+v, %v", rest, err)
+	}
+	if stored, _ := s.GetCreditCardByID(card.ID); stored.OutstandingBalance != 0 || stored.RewardsPoints != 0 {
+		t.Errorf("after a full refund: outstanding %.2f and %d points, want 0 and 0", stored.OutstandingBalance, stored.RewardsPoints)
+	}
+	if _, err := Settle(s, card.ID, txn.ID, 0, now); !errors.Is(err, ErrFullyRefunded) {
+		t.Errorf("refunding again = %v, want %v", err, ErrFullyRefunded)
+	}
+
+	refunds := 0
+	for _, recorded := range s.GetTransactionsByCardID(card.ID) {
+		if recorded.OriginalTransactionID == txn.ID {
+			refunds++
+		}
+	}
+	if refunds != 2 {
+		t.Errorf("%d refund transactions recorded, want 2", refunds)
+	}
+}
+
+func TestSettleRejects(t *testing.T) {
+	s := store.NewMemoryStore()
+	now := time.Now()
+	card, txn := buy(t, s, 1000, now)
+	declined := &models.Transaction{ID: models.GenerateID(), CardID: card.ID, Amount: 50, Date: now, Type: models.TransactionTypePurchase, Status: models.TransactionStatusDeclined}
+	s.AddTransaction(declined)
+
+	tests := []struct {
+		name          string
+		cardID, txnID string
+		amount        float64
+		want          error
+	}{
+		{"unknown card", "missing", txn.ID, 0, ErrCardNotFound},
+		{"unknown transaction", card.ID, "missing", 0, ErrTransactionNotFound},
+		{"declined purchase", card.ID, declined.ID, 0, ErrNotRefundable},
+		{"negative amount", card.ID, txn.ID, -5, ErrInvalidAmount},
+		{"less than a paisa", card.ID, txn.ID, 0.004, ErrInvalidAmount},
+		{"more than the purchase", card.ID, txn.ID, 1000.01, ErrExceedsRemaining},
+	}
+	for _, tt := range tests {
+		if _, err := Settle(s, tt.cardID, tt.txnID, tt.amount, now); !errors.Is(err, tt.want) {
+			t.Errorf("%s: err = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+
+	s.SetEMIPlan(&models.EMIPlan{ID: models.GenerateID(), CardID: card.ID, TransactionID: txn.ID, Status: models.EMIStatusActive, CreatedAt: now})
+	if _, err := Settle(s, card.ID, txn.ID, 0, now); !errors.Is(err, ErrConvertedToEMI) {
+		t.Errorf("purchase converted to EMI: err = %v, want %v", err, ErrConvertedToEMI)
+	}
+}
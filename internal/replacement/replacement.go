@@ -0,0 +1,184 @@
+// Package replacement reissues lost, stolen and damaged credit and debit
+// cards. The old card is retired and a new card with a new number and expiry
+// is issued Inactive on the same account, keeping the old card's limits,
+// autopay and default card settings, and its dispatch is tracked by package
+// issuance.
+package replacement
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"bankapp-microservices/internal/cardstatus"
+	"bankapp-microservices/internal/issuance"
+	"bankapp-microservices/internal/models"
+	"bankapp-microservices/internal/store"
+)
+
+var (
+	ErrInvalidReason = errors.New("reason must be LOST, STOLEN or DAMAGED")
+	ErrCardClosed    = errors.New("card is closed")
+)
+
+// replacing serializes replacements so a card is never replaced twice
+var replacing sync.Mutex
+
+// ReplaceCreditCard retires card and issues its replacement on the same
+// credit line. The replacement takes over the card's statements, EMI plans,
+// rewards points, payments, autopay and add-on cards.
+func ReplaceCreditCard(s store.Store, card *models.CreditCard, req *models.ReplaceCardRequest, now time.Time) (*models.CreditCard, *models.CardDispatch, error) {
+	replacing.Lock()
+	defer replacing.Unlock()
+
+	reason, err := parseReason(req.Reason)
+	if err != nil {
+		return nil, nil, err
+	}
+	if cardstatus.Current(card.Status, card.ExpiryMonth, card.ExpiryYear, now) == models.CardStatusClosed {
+		return nil, nil, ErrCardClosed
+	}
+
+	replacement := *card
+	replacement.ID = models.GenerateID()
+	replacement.CardNumber = issuance.CardNumber(card.CardNumber)
+	replacement.CVV = issuance.CVV()
+	replacement.ExpiryMonth, replacement.ExpiryYear = issuance.Expiry(now)
+	replacement.RewardsPoints = 0
+	replacement.Status = models.CardStatusInactive
+	replacement.StatusReason = ""
+	replacement.StatusChangedAt = nil
+	replacement.ReplacesID = card.ID
+	replacement.ReplacedByID = ""
+	replacement.Activation = nil
+	replacement.PIN = nil
+	if card.Addon != nil {
+		details := *card.Addon
+		replacement.Addon = &details
+	}
+	issued := &replacement
+
+	if err := retire(s, card.ID, reason, issued.CardNumber, now); err != nil {
+		return nil, nil, err
+	}
+	// Link the retired card as it was left by the status change
+	if retired, exists := s.GetCreditCardByID(card.ID); exists {
+		retired.ReplacedByID = issued.ID
+		s.UpdateCreditCard(retired)
+	}
+	s.UpdateCreditCard(issued)
+	s.MoveCreditCardRecords(card.ID, issued.ID)
+	for _, addon := range s.GetCreditCardsByUserID(card.UserID) {
+		if addon.PrimaryCardID == card.ID {
+			addon.PrimaryCardID = issued.ID
+			s.UpdateCreditCard(addon)
+		}
+	}
+
+	carryOverLimits(s, card.ID, issued.ID)
+	if settings, exists := s.GetCardSettings(card.UserID); exists && settings.DefaultCreditCardID == card.ID {
+		settings.DefaultCreditCardID = issued.ID
+		s.UpdateCardSettings(settings)
+	}
+
+	return issued, dispatch(s, issued.ID, card.ID, card.UserID, reason, now), nil
+}
+
+// ReplaceDebitCard retires card and issues its replacement on the same bank
+// account. Autopay debiting the account through the old card moves to the
+// new one.
+func ReplaceDebitCard(s store.Store, card *models.DebitCard, req *models.ReplaceCardRequest, now time.Time) (*models.DebitCard, *models.CardDispatch, error) {
+	replacing.Lock()
+	defer replacing.Unlock()
+
+	reason, err := parseReason(req.Reason)
+	if err != nil {
+		return nil, nil, err
+	}
+	if cardstatus.Current(card.Status, card.ExpiryMonth, card.ExpiryYear, now) == models.CardStatusClosed {
+		return nil, nil, ErrCardClosed
+	}
+
+	replacement := *card
+	replacement.ID = models.GenerateID()
+	replacement.CardNumber = issuance.CardNumber(card.CardNumber)
+	replacement.CVV = issuance.CVV()
+	replacement.ExpiryMonth, replacement.ExpiryYear = issuance.Expiry(now)
+	replacement.Status = models.CardStatusInactive
+	replacement.StatusReason = ""
+	replacement.StatusChangedAt = nil
+	replacement.ReplacesID = card.ID
+	replacement.ReplacedByID = ""
+	replacement.Activation = nil
+	replacement.PIN = nil
+	issued := &replacement
+
+	if err := retire(s, card.ID, reason, issued.CardNumber, now); err != nil {
+		return nil, nil, err
+	}
+	if retired, exists := s.GetDebitCardByID(card.ID); exists {
+		retired.ReplacedByID = issued.ID
+		s.UpdateDebitCard(retired)
+	}
+	s.UpdateDebitCard(issued)
+
+	carryOverLimits(s, card.ID, issued.ID)
+	if settings, exists := s.GetCardSettings(card.UserID); exists && settings.DefaultDebitCardID == card.ID {
+		settings.DefaultDebitCardID = issued.ID
+		s.UpdateCardSettings(settings)
+	}
+	for _, autopay := range s.GetAllAutopays() {
+		if autopay.LinkedAccountID == card.ID {
+			autopay.LinkedAccountID = issued.ID
+			s.SetAutopay(autopay)
+		}
+	}
+
+	return issued, dispatch(s, issued.ID, card.ID, card.UserID, reason, now), nil
+}
+
+func parseReason(reason string) (string, error) {
+	switch reason = strings.ToUpper(strings.TrimSpace(reason)); reason {
+	case models.ReplaceLost, models.ReplaceStolen, models.ReplaceDamaged:
+		return reason, nil
+	}
+	return "", ErrInvalidReason
+}
+
+// retire closes the old card. Lost and stolen cards are hotlisted first so
+// the history shows why they were blocked.
+func retire(s store.Store, cardID, reason, newCardNumber string, now time.Time) error {
+	if reason != models.ReplaceDamaged {
+		_, err := cardstatus.Change(s, cardID, &models.StatusRequest{
+			Status: models.CardStatusPermanentlyBlocked,
+			Reason: "Reported " + strings.ToLower(reason),
+		}, now)
+		var transition *cardstatus.TransitionError
+		if err != nil && !errors.Is(err, cardstatus.ErrUnchanged) && !errors.As(err, &transition) {
+			return err
+		}
+	}
+	_, err := cardstatus.Retire(s, cardID, "Replaced by "+issuance.Describe(newCardNumber), now)
+	return err
+}
+
+// carryOverLimits copies the old card's channel limits to the new card
+func carryOverLimits(s store.Store, fromCardID, toCardID string) {
+	limits, exists := s.GetCardLimits(fromCardID)
+	if !exists {
+		return
+	}
+	copied := *limits
+	copied.DomesticLimits = append([]models.TransactionLimit(nil), limits.DomesticLimits...)
+	copied.InternationalLimits = append([]models.TransactionLimit(nil), limits.InternationalLimits...)
+	s.SetCardLimits(toCardID, &copied)
+}
+
+func dispatch(s store.Store, cardID, replacesCardID, userID, reason string, now time.Time) *models.CardDispatch {
+	d := issuance.NewDispatch(cardID, userID, now)
+	d.ReplacesCardID = replacesCardID
+	d.Reason = reason
+	s.SetCardDispatch(d)
+	return d
+}
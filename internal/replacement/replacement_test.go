@@ -0,0 +1,100 @@
+package replacement
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"bankapp-microservices/internal/ledger"
+	"bankapp-microservices/internal/models"
+	"bankapp-microservices/internal/statement"
+	"bankapp-microservices/internal/store"
+)
+
+func TestReplaceCreditCard(t *testing.T) {
+	s := store.NewMemoryStore()
+	now := time.Now()
+	card := s.GetCreditCardsByUserID("testuser")[0]
+	if err := s.PostJournalEntry(ledger.Transfer(card.LedgerAccountID, ledger.AccountMerchantSettlement, 10000, "Purchase", "", now)); err != nil {
+		t.Fatal(err)
+	}
+	statement.CloseCycles(s, card, now, time.UTC)
+	issuedStatements := s.GetStatementsByCardID(card.ID)
+	if len(issuedStatements) == 0 {
+		t.Fatal("the card has no statements to carry over")
+	}
+
+	if _, _, err := ReplaceCreditCard(s, card, &models.ReplaceCardRequest{Reason: "BORED"}, now); !errors.Is(err, ErrInvalidReason) {
+		t.Errorf("unknown reason = %v, want ErrInvalidReason", err)
+	}
+
+	issued, dispatch, err := ReplaceCreditCard(s, card, &models.ReplaceCardRequest{Reason: "stolen"}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if issued.Status != models.CardStatusInactive || issued.ReplacesID != card.ID || issued.CardNumber == card.CardNumber || issued.LedgerAccountID != card.LedgerAccountID {
+		t.Errorf("replacement = %+v", issued)
+	}
+	if dispatch == nil || dispatch.ReplacesCardID != card.ID {
+		t.Errorf("dispatch = %+v", dispatch)
+	}
+
+	// A stolen card owing money is hotlisted and closed all the same; the
+	// balance stays on the shared credit line
+	retired, _ := s.GetCreditCardByID(card.ID)
+	if retired.Status != models.CardStatusClosed || retired.ReplacedByID != issued.ID {
+		t.Errorf("old card = %s replaced by %q", retired.Status, retired.ReplacedByID)
+	}
+	changes := s.GetCardStatusChangesByCardID(card.ID)
+	if len(changes) != 2 || changes[0].To != models.CardStatusPermanentlyBlocked {
+		t.Errorf("old card status history = %+v", changes)
+	}
+
+	// Issued statements are never rewritten, but the new card sees them
+	for _, stmt := range s.GetStatementsByCardID(card.ID) {
+		if stmt.CardID != card.ID {
+			t.Errorf("statement %s moved to card %s", stmt.ID, stmt.CardID)
+		}
+	}
+	if len(s.GetStatementsByCardID(card.ID)) != len(issuedStatements) {
+		t.Error("statements were taken off the old card")
+	}
+	if history := statement.History(s, issued); len(history) != len(issuedStatements) {
+		t.Errorf("new card history has %d statements, want %d", len(history), len(issuedStatements))
+	}
+	latest, exists := statement.Latest(s, issued)
+	if !exists || latest.ID != issuedStatements[len(issuedStatements)-1].ID || !statement.IssuedTo(s, latest, issued) {
+		t.Errorf("latest statement of the new card = %+v", latest)
+	}
+	// The new card carries on the cycle instead of billing it again
+	if closed := statement.CloseCycles(s, issued, now, time.UTC); len(closed) != 0 {
+		t.Errorf("replacement closed %d cycles that were already billed", len(closed))
+	}
+
+	if _, _, err := ReplaceCreditCard(s, retired, &models.ReplaceCardRequest{Reason: models.ReplaceLost}, now); !errors.Is(err, ErrCardClosed) {
+		t.Errorf("replacing a closed card = %v, want ErrCardClosed", err)
+	}
+}
+
+func TestReplaceDebitCard(t *testing.T) {
+	s := store.NewMemoryStore()
+	now := time.Now()
+	card := s.GetDebitCardsByUserID("testuser")[0]
+	credit := s.GetCreditCardsByUserID("testuser")[0]
+	s.SetAutopay(&models.Autopay{CardID: credit.ID, UserID: "testuser", AmountOption: models.AutopayTotalDue, LinkedAccountID: card.ID, AutoPayEnabled: true})
+
+	issued, _, err := ReplaceDebitCard(s, card, &models.ReplaceCardRequest{Reason: models.ReplaceDamaged}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if issued.AccountNumber != card.AccountNumber || issued.LedgerAccountID != card.LedgerAccountID || issued.Status != models.CardStatusInactive {
+		t.Errorf("replacement = %+v", issued)
+	}
+	// A damaged card is closed without being hotlisted
+	if changes := s.GetCardStatusChangesByCardID(card.ID); len(changes) != 1 || changes[0].To != models.CardStatusClosed {
+		t.Errorf("old card status history = %+v", changes)
+	}
+	if autopay, _ := s.GetAutopayByCardID(credit.ID); autopay.LinkedAccountID != issued.ID {
+		t.Errorf("autopay still pays from %s", autopay.LinkedAccountID)
+	}
+}
@@ -0,0 +1,389 @@
+// Package rewards runs the credit card rewards points programme. Approved
+// purchases earn points at a rate set per card type and merchant category,
+// refunds take them back, and points expire a set number of months after
+// they are earned. Points can be redeemed as statement credit or for catalog
+// vouchers. Every movement is a rewards entry and a card's points balance is
+// the sum of its entries.
+package rewards
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"bankapp-microservices/internal/ledger"
+	"bankapp-microservices/internal/models"
+	"bankapp-microservices/internal/store"
+)
+
+// Merchant categories with their own earn rates. Purchases in any other
+// category earn the programme's base rate.
+const (
+	CategoryDining  = "DINING"
+	CategoryTravel  = "TRAVEL"
+	CategoryGrocery = "GROCERY"
+	CategoryFuel    = "FUEL"
+)
+
+// Programs are keyed by card type
+var Programs = map[string]*models.RewardsProgram{
+	"Visa Platinum": {
+		Name:     "Visa Platinum Rewards",
+		EarnRate: 2,
+		CategoryRates: map[string]float64{
+			CategoryDining:  5,
+			CategoryTravel:  4,
+			CategoryGrocery: 3,
+			CategoryFuel:    0,
+		},
+		ExpiryMonths: 24,
+		PointValue:   0.25,
+	},
+	"Mastercard World": {
+		Name:     "World Miles",
+		EarnRate: 3,
+		CategoryRates: map[string]float64{
+			CategoryTravel: 6,
+			CategoryDining: 4,
+			CategoryFuel:   0,
+		},
+		ExpiryMonths: 36,
+		PointValue:   0.3,
+	},
+}
+
+// DefaultProgram applies to card types missing from Programs
+var DefaultProgram = &models.RewardsProgram{
+	Name:          "Standard Rewards",
+	EarnRate:      1,
+	CategoryRates: map[string]float64{CategoryFuel: 0},
+	ExpiryMonths:  12,
+	PointValue:    0.25,
+}
+
+// Catalog lists the vouchers points can be redeemed for
+var Catalog = []*models.RewardsVoucher{
+	{ID: "swiggy-250", Name: "Swiggy ₹250 voucher", Points: 1000, Value: 250},
+	{ID: "amazon-500", Name: "Amazon Pay ₹500 gift card", Points: 2000, Value: 500},
+	{ID: "flipkart-1000", Name: "Flipkart ₹1000 gift voucher", Points: 4000, Value: 1000},
+	{ID: "makemytrip-2500", Name: "MakeMyTrip ₹2500 holiday voucher", Points: 9000, Value: 2500},
+}
+
+// MinimumRedemption is the fewest points that can be redeemed as statement credit
+const MinimumRedemption = 100
+
+var (
+	ErrInvalidType        = errors.New("redemption type must be STATEMENT_CREDIT or VOUCHER")
+	ErrBelowMinimum       = fmt.Errorf("at least %d points must be redeemed", MinimumRedemption)
+	ErrUnknownVoucher     = errors.New("unknown voucher")
+	ErrInsufficientPoints = errors.New("not enough points")
+)
+
+// ForCard returns the programme a card earns points under
+func ForCard(card *models.CreditCard) *models.RewardsProgram {
+	if program, exists := Programs[card.CardType]; exists {
+		return program
+	}
+	return DefaultProgram
+}
+
+// EarnRate returns the points earned per ₹100 spent in category
+func EarnRate(program *models.RewardsProgram, category string) float64 {
+	if rate, exists := program.CategoryRates[category]; exists {
+		return rate
+	}
+	return program.EarnRate
+}
+
+// Points returns the points a transaction earns. Only purchases earn points.
+func Points(program *models.RewardsProgram, txn *models.Transaction) int {
+	if txn.Type != models.TransactionTypePurchase || txn.Status != models.TransactionStatusApproved {
+		return 0
+	}
+	return int(math.Floor(txn.Amount * EarnRate(program, txn.Category) / 100))
+}
+
+// Accrue credits the points a settled transaction earns to the card and
+// returns the entry, or nil if it earns none
+func Accrue(s store.Store, card *models.CreditCard, txn *models.Transaction) *models.RewardsEntry {
+	program := ForCard(card)
+	points := Points(program, txn)
+	if points <= 0 {
+		return nil
+	}
+	expiresAt := txn.Date.AddDate(0, program.ExpiryMonths, 0)
+	entry := &models.RewardsEntry{
+		ID:            models.GenerateID(),
+		CardID:        card.ID,
+		UserID:        card.UserID,
+		Type:          models.RewardsEarn,
+		Points:        points,
+		Description:   describe(txn),
+		Date:          txn.Date,
+		ExpiresAt:     &expiresAt,
+		TransactionID: txn.ID,
+		Reference:     "earn:" + txn.ID,
+	}
+	if !s.AddRewardsEntry(entry) {
+		return nil
+	}
+	return entry
+}
+
+// Reverse takes back the points earned on original in proportion to what has
+// been refunded, refunded being the total including refund. It returns the
+// entry, or nil if there is nothing to take back. refund.Settle calls it when
+// a merchant refund is settled.
+func Reverse(s store.Store, card *models.CreditCard, original, refund *models.Transaction, refunded float64) *models.RewardsEntry {
+	spending.Lock()
+	defer spending.Unlock()
+
+	earned, exists := s.GetRewardsEntryByReference("earn:" + original.ID)
+	if !exists || original.Amount <= 0 {
+		return nil
+	}
+
+	// Work from the running total so partial refunds add up to the points earned
+	reversed := 0
+	for _, entry := range s.GetRewardsEntriesByCardID(card.ID) {
+		if entry.Type == models.RewardsReversal && entry.EarnEntryID == earned.ID {
+			reversed -= entry.Points
+		}
+	}
+	target := int(math.Round(float64(earned.Points) * math.Min(refunded/original.Amount, 1)))
+	points := target - reversed
+	if points <= 0 {
+		return nil
+	}
+
+	entry := &models.RewardsEntry{
+		ID:            models.GenerateID(),
+		CardID:        card.ID,
+		UserID:        card.UserID,
+		Type:          models.RewardsReversal,
+		Points:        -points,
+		Description:   "Refund: " + describe(original),
+		Date:          refund.Date,
+		TransactionID: original.ID,
+		EarnEntryID:   earned.ID,
+		Reference:     "reversal:" + refund.ID,
+	}
+	if !s.AddRewardsEntry(entry) {
+		return nil
+	}
+	return entry
+}
+
+func describe(txn *models.Transaction) string {
+	if txn.Merchant != "" {
+		return txn.Merchant
+	}
+	return txn.Type
+}
+
+// Redeem spends the card's points on statement credit or a catalog voucher
+// and returns the redemption entry
+func Redeem(s store.Store, card *models.CreditCard, req *models.RedeemRequest, now time.Time) (*models.RewardsEntry, error) {
+	spending.Lock()
+	defer spending.Unlock()
+
+	expire(s, card, now)
+
+	entry := &models.RewardsEntry{
+		ID:     models.GenerateID(),
+		CardID: card.ID,
+		UserID: card.UserID,
+		Type:   models.RewardsRedeem,
+		Date:   now,
+	}
+	entry.Reference = "redeem:" + entry.ID
+
+	var voucher *models.RewardsVoucher
+	switch strings.ToUpper(strings.TrimSpace(req.Type)) {
+	case models.RedeemStatementCredit:
+		if req.Points < MinimumRedemption {
+			return nil, ErrBelowMinimum
+		}
+		entry.Points = -req.Points
+		entry.Value = math.Round(float64(req.Points)*ForCard(card).PointValue*100) / 100
+		entry.Description = "Statement credit"
+	case models.RedeemVoucher:
+		for _, v := range Catalog {
+			if v.ID == req.VoucherID {
+				voucher = v
+			}
+		}
+		if voucher == nil {
+			return nil, ErrUnknownVoucher
+		}
+		entry.Points = -voucher.Points
+		entry.Value = voucher.Value
+		entry.Description = voucher.Name
+	default:
+		return nil, ErrInvalidType
+	}
+
+	if Balance(s.GetRewardsEntriesByCardID(card.ID)) < -entry.Points {
+		return nil, ErrInsufficientPoints
+	}
+
+	if voucher != nil {
+		entry.VoucherCode = voucherCode()
+	} else {
+		credit := ledger.Transfer(ledger.AccountRewards, card.LedgerAccountID, ledger.ToMinor(entry.Value), "Rewards statement credit", "rewards:"+entry.ID, now)
+		if err := s.PostJournalEntry(credit); err != nil {
+			return nil, fmt.Errorf("post statement credit: %w", err)
+		}
+		entry.JournalEntryID = credit.ID
+	}
+	s.AddRewardsEntry(entry)
+	return entry, nil
+}
+
+// voucherCode generates the code a redeemed voucher is claimed with
+func voucherCode() string {
+	return "RWD-" + strings.ToUpper(strings.ReplaceAll(models.GenerateID(), "-", "")[:12])
+}
+
+// Balance returns the points balance of a card's entries
+func Balance(entries []*models.RewardsEntry) int {
+	balance := 0
+	for _, entry := range entries {
+		balance += entry.Points
+	}
+	return balance
+}
+
+// lot is what is left of the points of one earn entry
+type lot struct {
+	entry     *models.RewardsEntry
+	remaining int
+}
+
+// lots replays a card's entries and returns what is left of each earn entry.
+// Reversals and expiries take points from their own earn entry first; any
+// other spending takes the points that expire soonest. Points spent beyond
+// the balance are taken from the next points earned.
+func lots(entries []*models.RewardsEntry) []*lot {
+	sorted := append([]*models.RewardsEntry(nil), entries...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Date.Before(sorted[j].Date) })
+
+	var open []*lot
+	byID := make(map[string]*lot)
+	deficit := 0
+	take := func(l *lot, points int) int {
+		taken := min(l.remaining, points)
+		l.remaining -= taken
+		return points - taken
+	}
+
+	for _, entry := range sorted {
+		if entry.Points > 0 {
+			l := &lot{entry: entry, remaining: entry.Points}
+			deficit = take(l, deficit)
+			open = append(open, l)
+			byID[entry.ID] = l
+			continue
+		}
+
+		points := -entry.Points
+		if l, exists := byID[entry.EarnEntryID]; exists {
+			points = take(l, points)
+		}
+		sort.SliceStable(open, func(i, j int) bool { return expiry(open[i]).Before(expiry(open[j])) })
+		for _, l := range open {
+			if points == 0 {
+				break
+			}
+			points = take(l, points)
+		}
+		deficit += points
+	}
+	return open
+}
+
+// expiry returns when a lot's points expire; points without an expiry date sort last
+func expiry(l *lot) time.Time {
+	if l.entry.ExpiresAt == nil {
+		return time.Unix(1<<62, 0)
+	}
+	return *l.entry.ExpiresAt
+}
+
+// Expiring returns the points that expire before t
+func Expiring(entries []*models.RewardsEntry, t time.Time) int {
+	points := 0
+	for _, l := range lots(entries) {
+		if l.remaining > 0 && expiry(l).Before(t) {
+			points += l.remaining
+		}
+	}
+	return points
+}
+
+// spending serializes everything that takes points away, so points are
+// never spent or expired twice
+var spending sync.Mutex
+
+// Expire removes the card's points that have expired by now and returns how
+// many expired
+func Expire(s store.Store, card *models.CreditCard, now time.Time) int {
+	spending.Lock()
+	defer spending.Unlock()
+	return expire(s, card, now)
+}
+
+func expire(s store.Store, card *models.CreditCard, now time.Time) int {
+	expired := 0
+	for _, l := range lots(s.GetRewardsEntriesByCardID(card.ID)) {
+		if l.remaining <= 0 || expiry(l).After(now) {
+			continue
+		}
+		entry := &models.RewardsEntry{
+			ID:          models.GenerateID(),
+			CardID:      card.ID,
+			UserID:      card.UserID,
+			Type:        models.RewardsExpire,
+			Points:      -l.remaining,
+			Description: "Points expired",
+			Date:        expiry(l),
+			EarnEntryID: l.entry.ID,
+			Reference:   "expire:" + l.entry.ID,
+		}
+		if s.AddRewardsEntry(entry) {
+			expired += l.remaining
+		}
+	}
+	return expired
+}
+
+// ExpireAll expires points on every credit card and returns how many expired
+func ExpireAll(s store.Store, now time.Time) int {
+	expired := 0
+	for _, card := range s.GetAllCreditCards() {
+		expired += Expire(s, card, now)
+	}
+	return expired
+}
+
+// Schedule expires points now and then every interval until stop is closed
+func Schedule(s store.Store, interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if expired := ExpireAll(s, time.Now()); expired > 0 {
+			log.Printf("rewards: expired %d points", expired)
+		}
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return
+		}
+	}
+}
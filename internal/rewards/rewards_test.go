@@ -0,0 +1,144 @@
+package rewards
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"bankapp-microservices/internal/ledger"
+	"bankapp-microservices/internal/models"
+	"bankapp-microservices/internal/store"
+)
+
+func newCard(s store.Store) *models.CreditCard {
+	card := &models.CreditCard{ID: models.GenerateID(), UserID: "testuser", CardType: "Visa Platinum", TotalCredit: 100000, Status: models.CardStatusActive}
+	card.LedgerAccountID = ledger.CreditCardAccountID(card.ID)
+	s.CreateLedgerAccount(&models.LedgerAccount{ID: card.LedgerAccountID, Type: ledger.TypeCreditLine, Currency: ledger.Currency, UserID: card.UserID})
+	s.UpdateCreditCard(card)
+	return card
+}
+
+func purchase(cardID string, amount float64, category string, at time.Time) *models.Transaction {
+	return &models.Transaction{ID: models.GenerateID(), CardID: cardID, Amount: amount, Category: category, Date: at, Type: models.TransactionTypePurchase, Status: models.TransactionStatusApproved}
+}
+
+func TestPoints(t *testing.T) {
+	program := Programs["Visa Platinum"]
+	now := time.Now()
+	tests := []struct {
+		txn  *models.Transaction
+		want int
+	}{
+		{purchase("c", 1000, "", now), 20},
+		{purchase("c", 1000, CategoryDining, now), 50},
+		{purchase("c", 1000, CategoryFuel, now), 0},
+		{purchase("c", 99, "", now), 1},
+		{&models.Transaction{Amount: 1000, Type: models.TransactionTypeCashWithdrawal, Status: models.TransactionStatusApproved}, 0},
+		{&models.Transaction{Amount: 1000, Type: models.TransactionTypePurchase, Status: models.TransactionStatusDeclined}, 0},
+	}
+	for _, tt := range tests {
+		if got := Points(program, tt.txn); got != tt.want {
+			t.Errorf("Points(%s %v %s) = %d, want %d", tt.txn.Type, tt.txn.Amount, tt.txn.Category, got, tt.want)
+		}
+	}
+	if ForCard(&models.CreditCard{CardType: "Unknown"}) != DefaultProgram {
+		t.Error("unknown card types do not use the default programme")
+	}
+}
+
+func TestAccrueAndReverse(t *testing.T) {
+	s := store.NewMemoryStore()
+	card := newCard(s)
+	now := time.Now()
+	txn := purchase(card.ID, 1000, CategoryDining, now)
+
+	earned := Accrue(s, card, txn)
+	if earned == nil || earned.Points != 50 || !earned.ExpiresAt.Equal(now.AddDate(0, 24, 0)) {
+		t.Fatalf("Accrue = %+v", earned)
+	}
+	if Accrue(s, card, txn) != nil {
+		t.Error("a transaction earned points twice")
+	}
+
+	// Two partial refunds of 30% and 70% take back all 50 points between them
+	first := Reverse(s, card, txn, &models.Transaction{ID: "refund-1", Date: now}, 300)
+	second := Reverse(s, card, txn, &models.Transaction{ID: "refund-2", Date: now}, 1000)
+	if first == nil || first.Points != -15 || second == nil || second.Points != -35 {
+		t.Fatalf("reversals = %+v, %+v", first, second)
+	}
+	if Reverse(s, card, txn, &models.Transaction{ID: "refund-3", Date: now}, 1200) != nil {
+		t.Error("refunding more than the purchase took back more points")
+	}
+	if got := Balance(s.GetRewardsEntriesByCardID(card.ID)); got != 0 {
+		t.Errorf("balance after a full refund = %d, want 0", got)
+	}
+}
+
+func TestRedeem(t *testing.T) {
+	s := store.NewMemoryStore()
+	card := newCard(s)
+	now := time.Now()
+	Accrue(s, card, purchase(card.ID, 100000, CategoryDining, now))
+
+	tests := []struct {
+		req  models.RedeemRequest
+		want error
+	}{
+		{models.RedeemRequest{Type: "CASH", Points: 1000}, ErrInvalidType},
+		{models.RedeemRequest{Type: models.RedeemStatementCredit, Points: MinimumRedemption - 1}, ErrBelowMinimum},
+		{models.RedeemRequest{Type: models.RedeemVoucher, VoucherID: "nope"}, ErrUnknownVoucher},
+		{models.RedeemRequest{Type: models.RedeemStatementCredit, Points: 5001}, ErrInsufficientPoints},
+	}
+	for _, tt := range tests {
+		if _, err := Redeem(s, card, &tt.req, now); !errors.Is(err, tt.want) {
+			t.Errorf("Redeem(%+v) = %v, want %v", tt.req, err, tt.want)
+		}
+	}
+
+	entry, err := Redeem(s, card, &models.RedeemRequest{Type: "statement_credit", Points: 1000}, now)
+	if err != nil || entry.Value != 250 {
+		t.Fatalf("statement credit = %+v, %v", entry, err)
+	}
+	if got := s.GetAccountBalance(card.LedgerAccountID); got != 25000 {
+		t.Errorf("card credited %d, want 25000", got)
+	}
+
+	voucher, err := Redeem(s, card, &models.RedeemRequest{Type: models.RedeemVoucher, VoucherID: "amazon-500"}, now)
+	if err != nil || voucher.VoucherCode == "" || voucher.Points != -2000 {
+		t.Fatalf("voucher = %+v, %v", voucher, err)
+	}
+	if got := Balance(s.GetRewardsEntriesByCardID(card.ID)); got != 2000 {
+		t.Errorf("balance = %d, want 2000", got)
+	}
+}
+
+func TestExpireSpendsSoonestExpiringFirst(t *testing.T) {
+	s := store.NewMemoryStore()
+	card := newCard(s)
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// 200 points earned in January expire in January 2028, 300 earned in
+	// March expire in March 2028
+	Accrue(s, card, purchase(card.ID, 10000, "", start))
+	Accrue(s, card, purchase(card.ID, 15000, "", start.AddDate(0, 2, 0)))
+	if _, err := Redeem(s, card, &models.RedeemRequest{Type: models.RedeemStatementCredit, Points: 150}, start.AddDate(0, 3, 0)); err != nil {
+		t.Fatal(err)
+	}
+
+	entries := s.GetRewardsEntriesByCardID(card.ID)
+	if got := Expiring(entries, start.AddDate(2, 1, 0)); got != 50 {
+		t.Errorf("expiring by February 2028 = %d, want the 50 left of January", got)
+	}
+	if got := Expire(s, card, start.AddDate(2, 1, 0)); got != 50 {
+		t.Errorf("Expire = %d, want 50", got)
+	}
+	if got := Expire(s, card, start.AddDate(2, 1, 0)); got != 0 {
+		t.Errorf("expiring again = %d, want 0", got)
+	}
+	if got := ExpireAll(s, start.AddDate(3, 0, 0)); got < 300 {
+		t.Errorf("ExpireAll = %d, want at least the 300 March points", got)
+	}
+	if got := Balance(s.GetRewardsEntriesByCardID(card.ID)); got != 0 {
+		t.Errorf("balance after everything expired = %d, want 0", got)
+	}
+}
@@ -0,0 +1,166 @@
+package statement
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"bankapp-microservices/internal/models"
+)
+
+// Download formats
+const (
+	FormatPDF = "pdf"
+	FormatCSV = "csv"
+	FormatOFX = "ofx"
+	FormatQIF = "qif"
+)
+
+var ErrUnknownFormat = errors.New("unknown statement format")
+
+// File is a rendered statement ready to be downloaded
+type File struct {
+	Name        string
+	ContentType string
+	Data        []byte
+}
+
+// Export renders a statement in one of the download formats. Dates are shown
+// in loc and the card number is always masked.
+func Export(stmt *models.Statement, card *models.CreditCard, format string, loc *time.Location) (*File, error) {
+	var (
+		data        []byte
+		contentType string
+		err         error
+	)
+	switch format {
+	case FormatPDF:
+		data, contentType = renderPDF(stmt, card, loc), "application/pdf"
+	case FormatCSV:
+		data, err = renderCSV(stmt, loc)
+		contentType = "text/csv; charset=utf-8"
+	case FormatOFX:
+		data, contentType = renderOFX(stmt, card, loc), "application/x-ofx"
+	case FormatQIF:
+		data, contentType = renderQIF(stmt, loc), "application/qif"
+	default:
+		return nil, ErrUnknownFormat
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	statementDate := stmt.PeriodEnd.In(loc)
+	return &File{
+		Name:        fmt.Sprintf("statement-%s-%s.%s", lastFour(card.CardNumber), statementDate.Format("2006-01-02"), format),
+		ContentType: contentType,
+		Data:        data,
+	}, nil
+}
+
+// MaskCardNumber hides all but the last four digits of a card number
+func MaskCardNumber(number string) string {
+	return "XXXX XXXX XXXX " + lastFour(number)
+}
+
+func lastFour(number string) string {
+	if len(number) < 4 {
+		return number
+	}
+	return number[len(number)-4:]
+}
+
+// lastDay returns the last day covered by a statement; PeriodEnd itself is
+// the exclusive midnight the cycle closed at
+func lastDay(stmt *models.Statement, loc *time.Location) time.Time {
+	return stmt.PeriodEnd.In(loc).AddDate(0, 0, -1)
+}
+
+func renderCSV(stmt *models.Statement, loc *time.Location) ([]byte, error) {
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+	writer.Write([]string{"Date", "Description", "Reference", "Amount"})
+	for _, line := range stmt.Lines {
+		writer.Write([]string{
+			line.Date.In(loc).Format("2006-01-02"),
+			line.Description,
+			line.Reference,
+			fmt.Sprintf("%.2f", line.Amount),
+		})
+	}
+	writer.Flush()
+	return buf.Bytes(), writer.Error()
+}
+
+// renderOFX writes an OFX 1.02 credit card statement. Amounts are from the
+// cardholder's point of view, so charges are negative.
+func renderOFX(stmt *models.Statement, card *models.CreditCard, loc *time.Location) []byte {
+	const ofxTime = "20060102150405"
+	var b strings.Builder
+	b.WriteString("OFXHEADER:100\r\nDATA:OFXSGML\r\nVERSION:102\r\nSECURITY:NONE\r\nENCODING:USASCII\r\nCHARSET:1252\r\nCOMPRESSION:NONE\r\nOLDFILEUID:NONE\r\nNEWFILEUID:NONE\r\n\r\n")
+	b.WriteString("<OFX>\r\n")
+	fmt.Fprintf(&b, "<SIGNONMSGSRSV1><SONRS><STATUS><CODE>0</CODE><SEVERITY>INFO</SEVERITY></STATUS><DTSERVER>%s</DTSERVER><LANGUAGE>ENG</LANGUAGE></SONRS></SIGNONMSGSRSV1>\r\n",
+		stmt.GeneratedAt.UTC().Format(ofxTime))
+	b.WriteString("<CREDITCARDMSGSRSV1><CCSTMTTRNRS>\r\n")
+	fmt.Fprintf(&b, "<TRNUID>%s</TRNUID><STATUS><CODE>0</CODE><SEVERITY>INFO</SEVERITY></STATUS>\r\n", stmt.ID)
+	b.WriteString("<CCSTMTRS><CURDEF>INR</CURDEF>\r\n")
+	fmt.Fprintf(&b, "<CCACCTFROM><ACCTID>%s</ACCTID></CCACCTFROM>\r\n", "XXXXXXXXXXXX"+lastFour(card.CardNumber))
+	fmt.Fprintf(&b, "<BANKTRANLIST><DTSTART>%s</DTSTART><DTEND>%s</DTEND>\r\n",
+		stmt.PeriodStart.UTC().Format(ofxTime), stmt.PeriodEnd.UTC().Format(ofxTime))
+	for _, line := range stmt.Lines {
+		trnType := "DEBIT"
+		if line.Amount < 0 {
+			trnType = "CREDIT"
+		}
+		fmt.Fprintf(&b, "<STMTTRN><TRNTYPE>%s</TRNTYPE><DTPOSTED>%s</DTPOSTED><TRNAMT>%.2f</TRNAMT><FITID>%s</FITID><NAME>%s</NAME></STMTTRN>\r\n",
+			trnType, line.Date.UTC().Format(ofxTime), -line.Amount, line.EntryID, ofxText(line.Description, 32))
+	}
+	b.WriteString("</BANKTRANLIST>\r\n")
+	fmt.Fprintf(&b, "<LEDGERBAL><BALAMT>%.2f</BALAMT><DTASOF>%s</DTASOF></LEDGERBAL>\r\n",
+		-stmt.ClosingBalance, stmt.PeriodEnd.UTC().Format(ofxTime))
+	b.WriteString("</CCSTMTRS></CCSTMTTRNRS></CREDITCARDMSGSRSV1>\r\n</OFX>\r\n")
+	return []byte(b.String())
+}
+
+// ofxText escapes SGML markup characters and truncates to the field's limit
+func ofxText(s string, limit int) string {
+	s = asciiOnly(s)
+	if len(s) > limit {
+		s = s[:limit]
+	}
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(s)
+}
+
+// renderQIF writes a Quicken interchange file. Like OFX, charges are negative.
+func renderQIF(stmt *models.Statement, loc *time.Location) []byte {
+	var b strings.Builder
+	b.WriteString("!Type:CCard\n")
+	for _, line := range stmt.Lines {
+		fmt.Fprintf(&b, "D%s\nT%.2f\nP%s\n", line.Date.In(loc).Format("01/02/2006"), -line.Amount, oneLine(line.Description))
+		if line.Reference != "" {
+			fmt.Fprintf(&b, "N%s\n", line.Reference)
+		}
+		b.WriteString("^\n")
+	}
+	return []byte(b.String())
+}
+
+func oneLine(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// asciiOnly replaces characters the plain text formats cannot carry
+func asciiOnly(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r < 0x20 {
+			return ' '
+		}
+		if r > 0x7e {
+			return '?'
+		}
+		return r
+	}, s)
+}
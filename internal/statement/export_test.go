@@ -0,0 +1,82 @@
+package statement
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"bankapp-microservices/internal/models"
+)
+
+func exportFixture() (*models.Statement, *models.CreditCard) {
+	card := &models.CreditCard{CardNumber: "4532123456789012", CardType: "Visa Platinum", CardholderName: "Bruce Wayne"}
+	end := time.Date(2026, 2, 5, 0, 0, 0, 0, time.UTC)
+	stmt := &models.Statement{
+		ID:             "stmt-1",
+		PeriodStart:    end.AddDate(0, -1, 0),
+		PeriodEnd:      end,
+		GeneratedAt:    end,
+		DueDate:        end.AddDate(0, 0, PaymentDueDays),
+		ClosingBalance: 1400,
+		Lines: []models.StatementLine{
+			{EntryID: "e1", Date: end.AddDate(0, 0, -10), Description: "Café <Bar> & Grill", Reference: "r1", Amount: 1500},
+			{EntryID: "e2", Date: end.AddDate(0, 0, -5), Description: "Card payment", Amount: -100},
+		},
+	}
+	return stmt, card
+}
+
+func TestExportFormats(t *testing.T) {
+	stmt, card := exportFixture()
+	for _, format := range []string{FormatPDF, FormatCSV, FormatOFX, FormatQIF} {
+		file, err := Export(stmt, card, format, time.UTC)
+		if err != nil {
+			t.Fatalf("Export(%s): %v", format, err)
+		}
+		if want := "statement-9012-2026-02-05." + format; file.Name != want {
+			t.Errorf("%s file name = %q, want %q", format, file.Name, want)
+		}
+		if bytes.Contains(file.Data, []byte(card.CardNumber)) {
+			t.Errorf("%s export contains the full card number", format)
+		}
+	}
+
+	if _, err := Export(stmt, card, "xls", time.UTC); !errors.Is(err, ErrUnknownFormat) {
+		t.Errorf("Export(xls) = %v, want ErrUnknownFormat", err)
+	}
+}
+
+func TestExportContents(t *testing.T) {
+	stmt, card := exportFixture()
+
+	file, _ := Export(stmt, card, FormatCSV, time.UTC)
+	rows, err := csv.NewReader(bytes.NewReader(file.Data)).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 3 || rows[1][1] != "Café <Bar> & Grill" || rows[2][3] != "-100.00" {
+		t.Errorf("CSV rows = %q", rows)
+	}
+
+	// OFX and QIF show charges as negative amounts
+	file, _ = Export(stmt, card, FormatOFX, time.UTC)
+	ofx := string(file.Data)
+	for _, want := range []string{"<TRNAMT>-1500.00</TRNAMT>", "<TRNAMT>100.00</TRNAMT>", "<NAME>Caf? &lt;Bar&gt; &amp; Grill</NAME>", "<ACCTID>XXXXXXXXXXXX9012</ACCTID>", "<BALAMT>-1400.00</BALAMT>"} {
+		if !strings.Contains(ofx, want) {
+			t.Errorf("OFX is missing %s", want)
+		}
+	}
+
+	file, _ = Export(stmt, card, FormatQIF, time.UTC)
+	if qif := string(file.Data); !strings.HasPrefix(qif, "!Type:CCard\n") || !strings.Contains(qif, "D01/26/2026\nT-1500.00\n") {
+		t.Errorf("QIF = %q", qif)
+	}
+
+	file, _ = Export(stmt, card, FormatPDF, time.UTC)
+	if !bytes.HasPrefix(file.Data, []byte("%PDF-")) || !bytes.Contains(file.Data, []byte("XXXX XXXX XXXX 9012")) {
+		t.Error("PDF is malformed or does not show the masked card number")
+	}
+}
@@ -0,0 +1,136 @@
+package statement
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+
+	"bankapp-microservices/internal/models"
+)
+
+// A4 page geometry in points
+const (
+	pageWidth  = 595
+	pageHeight = 842
+	pageMargin = 50
+	lineHeight = 14
+)
+
+// PDF fonts. Only the standard 14 fonts are used so nothing needs embedding.
+const (
+	fontBold    = "F1" // Helvetica-Bold
+	fontRegular = "F2" // Helvetica
+	fontMono    = "F3" // Courier, used for aligned tables
+)
+
+// pdfWriter lays out lines of text on A4 pages
+type pdfWriter struct {
+	pages []*bytes.Buffer
+	y     float64
+}
+
+func (p *pdfWriter) text(font string, size float64, x float64, s string) {
+	if len(p.pages) == 0 || p.y < pageMargin {
+		p.pages = append(p.pages, &bytes.Buffer{})
+		p.y = pageHeight - pageMargin
+	}
+	fmt.Fprintf(p.pages[len(p.pages)-1], "BT /%s %.0f Tf %.0f %.0f Td (%s) Tj ET\n", font, size, x, p.y, pdfEscape(s))
+}
+
+func (p *pdfWriter) line(font string, size float64, s string) {
+	p.text(font, size, pageMargin, s)
+	p.y -= lineHeight
+}
+
+func (p *pdfWriter) gap() {
+	p.y -= lineHeight / 2
+}
+
+// bytes assembles the document, recording each object's offset for the xref table
+func (p *pdfWriter) bytes() []byte {
+	var out bytes.Buffer
+	var offsets []int
+	object := func(body string) {
+		offsets = append(offsets, out.Len())
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	out.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+
+	// Objects 1-5 are fixed; each page then takes a page and a content object
+	kids := make([]string, len(p.pages))
+	for i := range p.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 6+2*i)
+	}
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(p.pages)))
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Courier /Encoding /WinAnsiEncoding >>")
+	for i, content := range p.pages {
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %d %d] /Resources << /Font << /%s 3 0 R /%s 4 0 R /%s 5 0 R >> >> /Contents %d 0 R >>",
+			pageWidth, pageHeight, fontBold, fontRegular, fontMono, 7+2*i))
+		object(fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", content.Len(), content.String()))
+	}
+
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+	return out.Bytes()
+}
+
+// pdfEscape makes s safe inside a PDF string literal
+func pdfEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "(", `\(`, ")", `\)`).Replace(asciiOnly(s))
+}
+
+func renderPDF(stmt *models.Statement, card *models.CreditCard, loc *time.Location) []byte {
+	const date = "02 Jan 2006"
+	p := &pdfWriter{}
+
+	p.line(fontBold, 16, "BankApp Credit Card Statement")
+	p.gap()
+	p.line(fontRegular, 10, fmt.Sprintf("%s  %s", card.CardType, MaskCardNumber(card.CardNumber)))
+	p.line(fontRegular, 10, "Cardholder: "+card.CardholderName)
+	p.line(fontRegular, 10, fmt.Sprintf("Statement period: %s to %s", stmt.PeriodStart.In(loc).Format(date), lastDay(stmt, loc).Format(date)))
+	p.line(fontRegular, 10, "Payment due date: "+stmt.DueDate.In(loc).Format(date))
+	p.gap()
+
+	p.line(fontBold, 11, "Summary (INR)")
+	for _, row := range []struct {
+		label  string
+		amount float64
+	}{
+		{"Opening balance", stmt.OpeningBalance},
+		{"Charges", stmt.TotalDebits},
+		{"Payments and credits", -stmt.TotalCredits},
+		{"Closing balance", stmt.ClosingBalance},
+		{"Total amount due", stmt.TotalDue},
+		{"Minimum amount due", stmt.MinimumDue},
+	} {
+		p.line(fontMono, 9, fmt.Sprintf("%-30s %15.2f", row.label, row.amount))
+	}
+	p.gap()
+
+	p.line(fontBold, 11, "Transactions")
+	p.line(fontMono, 9, fmt.Sprintf("%-12s %-44s %15s", "Date", "Description", "Amount (INR)"))
+	if len(stmt.Lines) == 0 {
+		p.line(fontMono, 9, "No transactions in this period")
+	}
+	for _, line := range stmt.Lines {
+		description := asciiOnly(line.Description)
+		if len(description) > 44 {
+			description = description[:41] + "..."
+		}
+		p.line(fontMono, 9, fmt.Sprintf("%-12s %-44s %15.2f", line.Date.In(loc).Format(date), description, line.Amount))
+	}
+
+	p.gap()
+	p.line(fontRegular, 8, fmt.Sprintf("Statement %s generated %s. Payments and credits are shown as negative amounts.",
+		stmt.ID, stmt.GeneratedAt.In(loc).Format(date)))
+	return p.bytes()
+}
@@ -0,0 +1,374 @@
+// Package statement closes credit card billing cycles. A cycle runs from
+// midnight on the card's statement day to midnight on the same day of the
+// next month, in the bank's time zone. Closing a cycle posts its interest,
+// EMI installments, over-limit and annual fees, then builds the statement
+// from the journal entries posted to the card's credit line during the cycle.
+// Late fees are posted on the due date of a statement whose minimum was not
+// paid.
+package statement
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"bankapp-microservices/internal/emi"
+	"bankapp-microservices/internal/ledger"
+	"bankapp-microservices/internal/models"
+	"bankapp-microservices/internal/pricing"
+	"bankapp-microservices/internal/store"
+)
+
+const (
+	// DefaultStatementDay is used for cards without a statement day
+	DefaultStatementDay = 1
+	// PaymentDueDays is the time between the statement date and the due date
+	PaymentDueDays = 20
+	// MinimumDuePercent of the closing balance excluding interest, fees and
+	// EMI installments is due by the due date, plus all of those and any
+	// amount over the credit limit, but never less than MinimumDueFloor
+	// unless the whole balance is smaller
+	MinimumDuePercent = 5
+	MinimumDueFloor   = 200
+)
+
+// StatementDay returns the card's statement day clamped to 1-28 so every
+// month has one
+func StatementDay(card *models.CreditCard) int {
+	if card.StatementDay < 1 || card.StatementDay > 28 {
+		return DefaultStatementDay
+	}
+	return card.StatementDay
+}
+
+// NextClose returns the first cycle close strictly after t
+func NextClose(t time.Time, day int, loc *time.Location) time.Time {
+	local := t.In(loc)
+	end := time.Date(local.Year(), local.Month(), day, 0, 0, 0, 0, loc)
+	if !end.After(t) {
+		end = end.AddDate(0, 1, 0)
+	}
+	return end
+}
+
+// Build computes the statement for the cycle [start, end) from the journal
+// entries of the card's credit line
+func Build(card *models.CreditCard, entries []*models.JournalEntry, start, end, now time.Time) *models.Statement {
+	// The credit line balance is minus what is owed
+	var opening, debits, credits, interest, fees, installments int64
+	var lines []models.StatementLine
+	for _, entry := range sortedByDate(entries) {
+		var owed int64
+		for _, posting := range entry.Postings {
+			if posting.AccountID == card.LedgerAccountID {
+				owed -= posting.Amount
+			}
+		}
+		switch {
+		case entry.Date.Before(start):
+			opening += owed
+			continue
+		case !entry.Date.Before(end) || owed == 0:
+			continue
+		case owed > 0:
+			debits += owed
+			switch pricing.ChargeKind(entry) {
+			case pricing.KindInterest:
+				interest += owed
+			case pricing.KindFee:
+				fees += owed
+			case pricing.KindInstallment:
+				installments += owed
+			}
+		default:
+			credits -= owed
+		}
+		lines = append(lines, models.StatementLine{
+			EntryID:     entry.ID,
+			Date:        entry.Date,
+			Description: entry.Description,
+			Reference:   entry.Reference,
+			Amount:      ledger.ToMajor(owed),
+		})
+	}
+	closing := opening + debits - credits
+
+	return &models.Statement{
+		ID:                  models.GenerateID(),
+		CardID:              card.ID,
+		UserID:              card.UserID,
+		PeriodStart:         start,
+		PeriodEnd:           end,
+		GeneratedAt:         now,
+		OpeningBalance:      ledger.ToMajor(opening),
+		TotalDebits:         ledger.ToMajor(debits),
+		TotalCredits:        ledger.ToMajor(credits),
+		InterestCharged:     ledger.ToMajor(interest),
+		FeesCharged:         ledger.ToMajor(fees),
+		InstallmentsCharged: ledger.ToMajor(installments),
+		ClosingBalance:      ledger.ToMajor(closing),
+		TotalDue:            ledger.ToMajor(max(closing, 0)),
+		MinimumDue:          ledger.ToMajor(MinimumDue(closing, interest+fees+installments, closing-ledger.ToMinor(card.TotalCredit))),
+		DueDate:             end.AddDate(0, 0, PaymentDueDays),
+		Lines:               lines,
+	}
+}
+
+// MinimumDue returns the minimum payment in minor units for a closing
+// balance that includes charges of interest, fees and EMI installments and
+// is overLimit above the credit limit
+func MinimumDue(closing, charges, overLimit int64) int64 {
+	if closing <= 0 {
+		return 0
+	}
+	principal := max(closing-charges, 0)
+	minimum := int64(math.Ceil(float64(principal)*MinimumDuePercent/100)) + charges + max(overLimit, 0)
+	minimum = max(minimum, ledger.ToMinor(MinimumDueFloor))
+	return min(minimum, closing)
+}
+
+// sortedByDate returns entries ordered by date. Charges are posted when a
+// cycle closes but dated inside it, so posting order is not date order.
+func sortedByDate(entries []*models.JournalEntry) []*models.JournalEntry {
+	sorted := append([]*models.JournalEntry(nil), entries...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Date.Before(sorted[j].Date) })
+	return sorted
+}
+
+// lineage returns the IDs of card and of the cards it replaced, newest first.
+// A replacement carries on its predecessor's billing, but statements stay
+// with the card they were issued for.
+func lineage(s store.Store, card *models.CreditCard) []string {
+	ids := []string{card.ID}
+	for id := card.ReplacesID; id != "" && !containsID(ids, id); {
+		ids = append(ids, id)
+		previous, exists := s.GetCreditCardByID(id)
+		if !exists {
+			break
+		}
+		id = previous.ReplacesID
+	}
+	return ids
+}
+
+func containsID(ids []string, id string) bool {
+	for _, existing := range ids {
+		if existing == id {
+			return true
+		}
+	}
+	return false
+}
+
+// History returns the statements of card and the cards it replaced, oldest first
+func History(s store.Store, card *models.CreditCard) []*models.Statement {
+	var history []*models.Statement
+	for _, id := range lineage(s, card) {
+		history = append(s.GetStatementsByCardID(id), history...)
+	}
+	return history
+}
+
+// Latest returns the newest statement of card or the cards it replaced
+func Latest(s store.Store, card *models.CreditCard) (*models.Statement, bool) {
+	for _, id := range lineage(s, card) {
+		if stmt, exists := s.GetLatestStatement(id); exists {
+			return stmt, true
+		}
+	}
+	return nil, false
+}
+
+// IssuedTo reports whether stmt was issued to card or a card it replaced
+func IssuedTo(s store.Store, stmt *models.Statement, card *models.CreditCard) bool {
+	return containsID(lineage(s, card), stmt.CardID)
+}
+
+// Summary reports where a card stands against its latest statement. Cards
+// that have not had a statement yet only report accrued interest.
+func Summary(s store.Store, card *models.CreditCard, now time.Time, loc *time.Location) *models.BillingSummary {
+	entries := s.GetJournalEntriesByAccountID(card.LedgerAccountID)
+	latest, _ := Latest(s, card)
+
+	summary := &models.BillingSummary{InGracePeriod: InGracePeriod(card, latest, entries)}
+	cycleStart := card.OpenedAt
+	if latest != nil {
+		cycleStart = latest.PeriodEnd
+		summary.StatementID = latest.ID
+		summary.StatementDate = latest.PeriodEnd
+		summary.DueDate = latest.DueDate
+		summary.TotalDue = latest.TotalDue
+		summary.MinimumDue = latest.MinimumDue
+		summary.InterestCharged = latest.InterestCharged
+		summary.FeesCharged = latest.FeesCharged
+		summary.PaidSinceStatement = ledger.ToMajor(pricing.Credits(card.LedgerAccountID, entries, latest.PeriodEnd, now.Add(time.Nanosecond)))
+	}
+	if !cycleStart.IsZero() {
+		interest := pricing.Interest(pricing.ForCard(card), card.LedgerAccountID, entries, cycleStart, now, loc, summary.InGracePeriod)
+		summary.AccruedInterest = ledger.ToMajor(interest)
+	}
+	return summary
+}
+
+// closing serializes cycle closing so charges are never posted twice
+var closing sync.Mutex
+
+// CloseCycles generates the statements of every cycle of the card that has
+// closed by now and returns them. It is safe to call concurrently.
+func CloseCycles(s store.Store, card *models.CreditCard, now time.Time, loc *time.Location) []*models.Statement {
+	// Charges are checked for and posted in separate steps
+	closing.Lock()
+	defer closing.Unlock()
+
+	// A replaced card's credit line is billed on its replacement, and an
+	// add-on's on its primary card
+	if card.ReplacedByID != "" || card.PrimaryCardID != "" {
+		return nil
+	}
+
+	start := card.OpenedAt
+	previous, exists := Latest(s, card)
+	if exists {
+		start = previous.PeriodEnd
+	}
+	if start.IsZero() {
+		return nil
+	}
+
+	var closed []*models.Statement
+	day := StatementDay(card)
+	for end := NextClose(start, day, loc); !end.After(now); start, end = end, NextClose(end, day, loc) {
+		if previous != nil && !PaymentDeadline(previous).After(end) {
+			assessLateFee(s, card, previous, now)
+		}
+		chargeCycle(s, card, previous, start, end, loc)
+
+		statement := Build(card, s.GetJournalEntriesByAccountID(card.LedgerAccountID), start, end, now)
+		if !s.AddStatement(statement) {
+			// Another caller closed this cycle first
+			break
+		}
+		closed = append(closed, statement)
+		previous = statement
+	}
+	if previous != nil {
+		assessLateFee(s, card, previous, now)
+	}
+	return closed
+}
+
+// chargeCycle posts the interest, fees and EMI installments of the cycle
+// [start, end), dated just before the cycle closes so they appear on its
+// statement. Every charge has a reference unique to the card and cycle, so it
+// is posted only once.
+func chargeCycle(s store.Store, card *models.CreditCard, previous *models.Statement, start, end time.Time, loc *time.Location) {
+	product := pricing.ForCard(card)
+	at := end.Add(-time.Nanosecond)
+	cycle := card.ID + ":" + end.In(loc).Format("2006-01-02")
+	entries := s.GetJournalEntriesByAccountID(card.LedgerAccountID)
+
+	graced := InGracePeriod(card, previous, entries)
+	if interest := pricing.Interest(product, card.LedgerAccountID, entries, start, end, loc, graced); interest > 0 {
+		charge(s, card, ledger.AccountInterestIncome, interest, "Interest charges", "interest:"+cycle, at)
+	}
+
+	if !card.OpenedAt.IsZero() {
+		for years := 1; ; years++ {
+			anniversary := card.OpenedAt.AddDate(years, 0, 0)
+			if !anniversary.Before(end) {
+				break
+			}
+			if !anniversary.Before(start) {
+				charge(s, card, ledger.AccountFeeIncome, ledger.ToMinor(product.AnnualFee), "Annual fee", fmt.Sprintf("annual-fee:%s:%d", card.ID, years), at)
+			}
+		}
+	}
+
+	if err := emi.Bill(s, card, start, end, at); err != nil {
+		log.Printf("statement: failed to bill installments for card %s: %v", card.ID, err)
+	}
+
+	// Checked last so the cycle's own interest, fees and installments count
+	// towards the limit, as does principal still held on EMI
+	entries = s.GetJournalEntriesByAccountID(card.LedgerAccountID)
+	owed := pricing.Owed(card.LedgerAccountID, entries, end)
+	if card.EMIAccountID != "" {
+		owed += pricing.Owed(card.EMIAccountID, s.GetJournalEntriesByAccountID(card.EMIAccountID), end)
+	}
+	if owed > ledger.ToMinor(card.TotalCredit) {
+		charge(s, card, ledger.AccountFeeIncome, ledger.ToMinor(product.OverLimitFee), "Over-limit fee", "over-limit-fee:"+cycle, at)
+	}
+}
+
+// PaymentDeadline is the end of a statement's due date, the moment payments
+// stop counting towards it
+func PaymentDeadline(stmt *models.Statement) time.Time {
+	return stmt.DueDate.AddDate(0, 0, 1)
+}
+
+// assessLateFee posts the late fee of a statement whose due date has passed
+// without its minimum being paid
+func assessLateFee(s store.Store, card *models.CreditCard, stmt *models.Statement, now time.Time) {
+	deadline := PaymentDeadline(stmt)
+	if stmt.MinimumDue <= 0 || now.Before(deadline) {
+		return
+	}
+	paid := pricing.Credits(card.LedgerAccountID, s.GetJournalEntriesByAccountID(card.LedgerAccountID), stmt.PeriodEnd, deadline)
+	if paid >= ledger.ToMinor(stmt.MinimumDue) {
+		return
+	}
+	charge(s, card, ledger.AccountFeeIncome, ledger.ToMinor(pricing.ForCard(card).LateFee), "Late payment fee", "late-fee:"+stmt.ID, deadline)
+}
+
+// InGracePeriod reports whether purchases are interest free this cycle: the
+// previous statement, if any, must have been paid in full by its due date
+func InGracePeriod(card *models.CreditCard, previous *models.Statement, entries []*models.JournalEntry) bool {
+	if previous == nil || previous.TotalDue <= 0 {
+		return true
+	}
+	return pricing.Credits(card.LedgerAccountID, entries, previous.PeriodEnd, PaymentDeadline(previous)) >= ledger.ToMinor(previous.TotalDue)
+}
+
+// charge posts a charge to the card's credit line unless one with the same
+// reference was already posted
+func charge(s store.Store, card *models.CreditCard, income string, amount int64, description, reference string, at time.Time) {
+	if amount <= 0 {
+		return
+	}
+	if _, exists := s.GetJournalEntryByReference(reference); exists {
+		return
+	}
+	if err := s.PostJournalEntry(ledger.Transfer(card.LedgerAccountID, income, amount, description, reference, at)); err != nil {
+		log.Printf("statement: failed to post %s for card %s: %v", reference, card.ID, err)
+	}
+}
+
+// CloseAllCycles closes due cycles for every credit card
+func CloseAllCycles(s store.Store, now time.Time, loc *time.Location) int {
+	closed := 0
+	for _, card := range s.GetAllCreditCards() {
+		closed += len(CloseCycles(s, card, now, loc))
+	}
+	return closed
+}
+
+// Schedule closes due billing cycles now and then every interval until stop
+// is closed
+func Schedule(s store.Store, interval time.Duration, loc *time.Location, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if closed := CloseAllCycles(s, time.Now(), loc); closed > 0 {
+			log.Printf("statement: generated %d statements", closed)
+		}
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package statement
+
+import (
+	"testing"
+	"time"
+
+	"bankapp-microservices/internal/ledger"
+	"bankapp-microservices/internal/models"
+	"bankapp-microservices/internal/store"
+)
+
+// newCard stores a credit card opened at openedAt with its own credit line
+func newCard(t *testing.T, s store.Store, openedAt time.Time) *models.CreditCard {
+	t.Helper()
+	card := &models.CreditCard{
+		ID:           models.GenerateID(),
+		CardNumber:   "4532000000001234",
+		CardType:     "Visa Platinum",
+		UserID:       "testuser",
+		TotalCredit:  10000,
+		StatementDay: 5,
+		OpenedAt:     openedAt,
+		Status:       models.CardStatusActive,
+	}
+	card.LedgerAccountID = ledger.CreditCardAccountID(card.ID)
+	s.CreateLedgerAccount(&models.LedgerAccount{ID: card.LedgerAccountID, Type: ledger.TypeCreditLine, Currency: ledger.Currency, UserID: card.UserID})
+	s.UpdateCreditCard(card)
+	return card
+}
+
+func TestNextClose(t *testing.T) {
+	kolkata, err := time.LoadLocation("Asia/Kolkata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		t    time.Time
+		want time.Time
+	}{
+		{time.Date(2026, 1, 3, 12, 0, 0, 0, kolkata), time.Date(2026, 1, 5, 0, 0, 0, 0, kolkata)},
+		{time.Date(2026, 1, 5, 0, 0, 0, 0, kolkata), time.Date(2026, 2, 5, 0, 0, 0, 0, kolkata)},
+		{time.Date(2026, 12, 20, 0, 0, 0, 0, kolkata), time.Date(2027, 1, 5, 0, 0, 0, 0, kolkata)},
+		// 20:00 UTC on 4 January is already 5 January in Kolkata
+		{time.Date(2026, 1, 4, 20, 0, 0, 0, time.UTC), time.Date(2026, 2, 5, 0, 0, 0, 0, kolkata)},
+	}
+	for _, tt := range tests {
+		if got := NextClose(tt.t, 5, kolkata); !got.Equal(tt.want) {
+			t.Errorf("NextClose(%v) = %v, want %v", tt.t, got, tt.want)
+		}
+	}
+}
+
+func TestMinimumDue(t *testing.T) {
+	tests := []struct {
+		name                        string
+		closing, charges, overLimit int64
+		want                        int64
+	}{
+		{"nothing owed", -500, 0, 0, 0},
+		{"small balance is due in full", 15000, 0, 0, 15000},
+		{"floor", 100000, 0, 0, 20000},
+		{"percentage", 1000000, 0, 0, 50000},
+		{"charges are due in full", 1000000, 30000, 0, 48500 + 30000},
+		{"over the limit", 1000000, 0, 100000, 150000},
+	}
+	for _, tt := range tests {
+		if got := MinimumDue(tt.closing, tt.charges, tt.overLimit); got != tt.want {
+			t.Errorf("%s: MinimumDue = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCloseCycles(t *testing.T) {
+	s := store.NewMemoryStore()
+	opened := time.Date(2026, 1, 5, 0, 0, 0, 0, time.UTC)
+	card := newCard(t, s, opened)
+	purchase := ledger.Transfer(card.LedgerAccountID, ledger.AccountMerchantSettlement, 250000, "Electronics", "purchase-1", opened.AddDate(0, 0, 3))
+	if err := s.PostJournalEntry(purchase); err != nil {
+		t.Fatal(err)
+	}
+
+	if closed := CloseCycles(s, card, opened.AddDate(0, 0, 20), time.UTC); len(closed) != 0 {
+		t.Fatalf("closed %d statements before the cycle ended", len(closed))
+	}
+
+	now := time.Date(2026, 2, 10, 0, 0, 0, 0, time.UTC)
+	closed := CloseCycles(s, card, now, time.UTC)
+	if len(closed) != 1 {
+		t.Fatalf("closed %d statements, want 1", len(closed))
+	}
+	stmt := closed[0]
+	if !stmt.PeriodStart.Equal(opened) || !stmt.PeriodEnd.Equal(opened.AddDate(0, 1, 0)) {
+		t.Errorf("period = %v - %v", stmt.PeriodStart, stmt.PeriodEnd)
+	}
+	// The first cycle is in the grace period, so the purchase is interest free
+	if stmt.ClosingBalance != 2500 || stmt.InterestCharged != 0 || len(stmt.Lines) != 1 {
+		t.Errorf("statement = closing %.2f, interest %.2f, %d lines; want 2500, 0, 1", stmt.ClosingBalance, stmt.InterestCharged, len(stmt.Lines))
+	}
+	if !stmt.DueDate.Equal(stmt.PeriodEnd.AddDate(0, 0, PaymentDueDays)) {
+		t.Errorf("due date = %v", stmt.DueDate)
+	}
+
+	if again := CloseCycles(s, card, now, time.UTC); len(again) != 0 {
+		t.Errorf("closing again generated %d more statements", len(again))
+	}
+
+	// Missing the minimum payment costs a late fee once the due date has passed
+	CloseCycles(s, card, PaymentDeadline(stmt).Add(time.Hour), time.UTC)
+	if _, charged := s.GetJournalEntryByReference("late-fee:" + stmt.ID); !charged {
+		t.Error("no late fee after the due date passed unpaid")
+	}
+}
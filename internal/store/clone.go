@@ -0,0 +1,171 @@
+package store
+
+import (
+	"time"
+
+	"bankapp-microservices/internal/models"
+)
+
+// The store hands out copies and keeps copies of what it is given, so callers
+// can change the records they hold without racing with other requests or
+// changing stored data behind the store's back. Records without reference
+// fields are copied with clonePtr; the others have their own clone function.
+
+func clonePtr[T any](v *T) *T {
+	if v == nil {
+		return nil
+	}
+	copied := *v
+	return &copied
+}
+
+func cloneTime(t *time.Time) *time.Time {
+	return clonePtr(t)
+}
+
+func cloneSlice[T any](values []T) []T {
+	if values == nil {
+		return nil
+	}
+	return append(make([]T, 0, len(values)), values...)
+}
+
+func cloneMap[K comparable, V any](values map[K]V) map[K]V {
+	if values == nil {
+		return nil
+	}
+	copied := make(map[K]V, len(values))
+	for k, v := range values {
+		copied[k] = v
+	}
+	return copied
+}
+
+// cloneAll copies each record of a list with clone
+func cloneAll[T any](values []*T, clone func(*T) *T) []*T {
+	copied := make([]*T, len(values))
+	for i, v := range values {
+		copied[i] = clone(v)
+	}
+	return copied
+}
+
+func cloneChallenge(c *models.LoginChallenge) *models.LoginChallenge {
+	copied := clonePtr(c)
+	copied.Methods = cloneSlice(c.Methods)
+	return copied
+}
+
+func cloneActivation(a *models.CardActivation) *models.CardActivation {
+	if a == nil {
+		return nil
+	}
+	copied := clonePtr(a)
+	copied.ActivatedAt = cloneTime(a.ActivatedAt)
+	copied.Attempts = cloneSlice(a.Attempts)
+	return copied
+}
+
+func cloneCardPIN(pin *models.CardPIN) *models.CardPIN {
+	if pin == nil {
+		return nil
+	}
+	copied := clonePtr(pin)
+	copied.BlockedAt = cloneTime(pin.BlockedAt)
+	return copied
+}
+
+func cloneCreditCard(card *models.CreditCard) *models.CreditCard {
+	copied := clonePtr(card)
+	copied.StatusChangedAt = cloneTime(card.StatusChangedAt)
+	copied.Activation = cloneActivation(card.Activation)
+	copied.PIN = cloneCardPIN(card.PIN)
+	copied.Addon = clonePtr(card.Addon)
+	return copied
+}
+
+func cloneDebitCard(card *models.DebitCard) *models.DebitCard {
+	copied := clonePtr(card)
+	copied.StatusChangedAt = cloneTime(card.StatusChangedAt)
+	copied.Activation = cloneActivation(card.Activation)
+	copied.PIN = cloneCardPIN(card.PIN)
+	return copied
+}
+
+func cloneVirtualCard(card *models.VirtualCard) *models.VirtualCard {
+	copied := clonePtr(card)
+	copied.StatusChangedAt = cloneTime(card.StatusChangedAt)
+	return copied
+}
+
+func cloneDispatch(d *models.CardDispatch) *models.CardDispatch {
+	copied := clonePtr(d)
+	copied.PrintedAt = cloneTime(d.PrintedAt)
+	copied.ShippedAt = cloneTime(d.ShippedAt)
+	copied.DeliveredAt = cloneTime(d.DeliveredAt)
+	copied.ActivatedAt = cloneTime(d.ActivatedAt)
+	return copied
+}
+
+func cloneAutopayExecution(e *models.AutopayExecution) *models.AutopayExecution {
+	copied := clonePtr(e)
+	copied.NextRetryAt = cloneTime(e.NextRetryAt)
+	return copied
+}
+
+func cloneLimits(limits *models.LimitsRequest) *models.LimitsRequest {
+	copied := clonePtr(limits)
+	copied.DomesticLimits = cloneTransactionLimits(limits.DomesticLimits)
+	copied.InternationalLimits = cloneTransactionLimits(limits.InternationalLimits)
+	return copied
+}
+
+func cloneTransactionLimits(limits []models.TransactionLimit) []models.TransactionLimit {
+	copied := cloneSlice(limits)
+	for i := range copied {
+		copied[i].Used = clonePtr(copied[i].Used)
+		copied[i].Remaining = clonePtr(copied[i].Remaining)
+	}
+	return copied
+}
+
+func cloneUsage(usage *models.CardUsage) *models.CardUsage {
+	copied := clonePtr(usage)
+	copied.Daily = cloneMap(usage.Daily)
+	copied.Monthly = cloneMap(usage.Monthly)
+	return copied
+}
+
+func cloneSettings(settings *models.CardSettings) *models.CardSettings {
+	copied := clonePtr(settings)
+	copied.NotificationPreferences = cloneSlice(settings.NotificationPreferences)
+	return copied
+}
+
+func cloneStatement(statement *models.Statement) *models.Statement {
+	copied := clonePtr(statement)
+	copied.Lines = cloneSlice(statement.Lines)
+	return copied
+}
+
+func cloneEMIPlan(plan *models.EMIPlan) *models.EMIPlan {
+	copied := clonePtr(plan)
+	copied.ClosedAt = cloneTime(plan.ClosedAt)
+	copied.Installments = cloneSlice(plan.Installments)
+	for i := range copied.Installments {
+		copied.Installments[i].BilledAt = cloneTime(copied.Installments[i].BilledAt)
+	}
+	return copied
+}
+
+func cloneRewardsEntry(entry *models.RewardsEntry) *models.RewardsEntry {
+	copied := clonePtr(entry)
+	copied.ExpiresAt = cloneTime(entry.ExpiresAt)
+	return copied
+}
+
+func cloneJournalEntry(entry *models.JournalEntry) *models.JournalEntry {
+	copied := clonePtr(entry)
+	copied.Postings = cloneSlice(entry.Postings)
+	return copied
+}
@@ -0,0 +1,315 @@
+package store
+
+import (
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"bankapp-microservices/internal/models"
+)
+
+// FileStore is a durable Store that keeps its data in memory. Every mutation
+// is appended to a journal next to the snapshot file; the journal is folded
+// into a new snapshot when the store is opened and every compactEvery
+// mutations, so writes do not get slower as the data grows.
+type FileStore struct {
+	*MemoryStore
+	path string
+
+	// Journal state, guarded by the MemoryStore write lock
+	journal *os.File
+	writer  *journalWriter
+	seq     uint64
+	pending int
+}
+
+// compactEvery is how many mutations are journaled before a new snapshot is written
+const compactEvery = 10000
+
+// snapshot is the on-disk representation of the store. gob is used instead of
+// JSON because several model fields (UserID, Password) are hidden from JSON.
+type snapshot struct {
+	// Seq is the last journaled mutation the snapshot includes
+	Seq uint64
+
+	Users         map[string]*models.User
+	AccessTokens  map[string]*models.AccessToken
+	RefreshTokens map[string]*models.RefreshToken
+	Sessions      map[string]*models.Session
+	Challenges    map[string]*models.LoginChallenge
+	CreditCards   map[string]*models.CreditCard
+	DebitCards    map[string]*models.DebitCard
+	VirtualCards  map[string]*models.VirtualCard
+	StatusChanges map[string][]*models.CardStatusChange
+	Dispatches    map[string]*models.CardDispatch
+	Autopays      map[string]*models.Autopay
+	AutopayRuns   map[string][]*models.AutopayExecution
+	Payments      map[string][]*models.CardPayment
+	CardLimits    map[string]*models.LimitsRequest
+	CardUsage     map[string]*models.CardUsage
+	CardSettings  map[string]*models.CardSettings
+	Transactions  map[string][]*models.Transaction
+
+	LedgerAccounts map[string]*models.LedgerAccount
+	Journal        []*models.JournalEntry
+	Statements     map[string]*models.Statement
+	EMIPlans       map[string]*models.EMIPlan
+	Rewards        map[string][]*models.RewardsEntry
+}
+
+// NewFileStore opens the store file at path, seeding it with default data if
+// it does not exist yet, and replays the mutations journaled since it was
+// last written
+func NewFileStore(path string) (*FileStore, error) {
+	fs := &FileStore{
+		MemoryStore: newMemoryStore(),
+		path:        path,
+	}
+
+	if err := fs.load(); err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("load store file %s: %w", path, err)
+		}
+		fs.initDefaultData()
+	}
+	if err := fs.replayJournal(); err != nil {
+		return nil, fmt.Errorf("replay journal %s: %w", fs.journalPath(), err)
+	}
+
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if err := fs.compact(); err != nil {
+		return nil, fmt.Errorf("write store file %s: %w", path, err)
+	}
+	fs.onChange = func(m *mutation) {
+		if err := fs.record(m); err != nil {
+			log.Printf("store: failed to persist %s: %v", fs.path, err)
+		}
+	}
+	return fs, nil
+}
+
+// Close flushes the journal to disk and closes it. The store must not be
+// used afterwards.
+func (fs *FileStore) Close() error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	fs.onChange = nil
+	if err := fs.journal.Sync(); err != nil {
+		fs.journal.Close()
+		return err
+	}
+	return fs.journal.Close()
+}
+
+func (fs *FileStore) journalPath() string {
+	return fs.path + ".journal"
+}
+
+// record appends a mutation to the journal, compacting it once it is long
+// enough. Callers must hold the write lock.
+func (fs *FileStore) record(m *mutation) error {
+	fs.seq++
+	m.Seq = fs.seq
+	if err := fs.writer.write(m); err != nil {
+		return err
+	}
+	if err := fs.journal.Sync(); err != nil {
+		return err
+	}
+	if fs.pending++; fs.pending >= compactEvery {
+		return fs.compact()
+	}
+	return nil
+}
+
+// compact writes a snapshot of the current state and starts an empty
+// journal. Callers must hold the write lock.
+func (fs *FileStore) compact() error {
+	if err := fs.save(); err != nil {
+		return err
+	}
+	if fs.journal != nil {
+		fs.journal.Close()
+	}
+	// Mutations left in the journal by a crash after the snapshot was renamed
+	// are skipped on replay, because the snapshot's Seq covers them
+	journal, err := os.OpenFile(fs.journalPath(), os.O_CREATE|os.O_TRUNC|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	fs.journal = journal
+	fs.writer = newJournalWriter(journal)
+	fs.pending = 0
+	return nil
+}
+
+// replayJournal applies the mutations journaled after the snapshot was
+// written. A frame torn by a crash ends the journal.
+func (fs *FileStore) replayJournal() error {
+	f, err := os.Open(fs.journalPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	mutations, err := readJournal(f)
+	if err != nil {
+		return err
+	}
+	for _, m := range mutations {
+		if m.Seq <= fs.seq {
+			continue
+		}
+		if err := fs.MemoryStore.replay(m); err != nil {
+			return err
+		}
+		fs.seq = m.Seq
+	}
+	return nil
+}
+
+// load replaces the in-memory maps with the contents of the store file
+func (fs *FileStore) load() error {
+	f, err := os.Open(fs.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var snap snapshot
+	if err := gob.NewDecoder(f).Decode(&snap); err != nil {
+		return err
+	}
+
+	s := fs.MemoryStore
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fs.seq = snap.Seq
+	copyMap(s.users, snap.Users)
+	copyMap(s.accessTokens, snap.AccessTokens)
+	copyMap(s.refreshTokens, snap.RefreshTokens)
+	copyMap(s.sessions, snap.Sessions)
+	copyMap(s.loginChallenges, snap.Challenges)
+	copyMap(s.creditCards, snap.CreditCards)
+	copyMap(s.debitCards, snap.DebitCards)
+	copyMap(s.virtualCards, snap.VirtualCards)
+	copyMap(s.statusChanges, snap.StatusChanges)
+	copyMap(s.dispatches, snap.Dispatches)
+	// Cards saved before they had a status are active
+	for _, card := range s.creditCards {
+		if card.Status == "" {
+			card.Status = models.CardStatusActive
+		}
+	}
+	for _, card := range s.debitCards {
+		if card.Status == "" {
+			card.Status = models.CardStatusActive
+		}
+	}
+	copyMap(s.autopays, snap.Autopays)
+	copyMap(s.autopayRuns, snap.AutopayRuns)
+	for _, payments := range snap.Payments {
+		for _, payment := range payments {
+			s.indexCardPayment(payment)
+		}
+	}
+	copyMap(s.cardLimits, snap.CardLimits)
+	copyMap(s.cardUsage, snap.CardUsage)
+	copyMap(s.cardSettings, snap.CardSettings)
+	copyMap(s.transactions, snap.Transactions)
+	sortTransactionIndex(s.transactions)
+	copyMap(s.ledgerAccounts, snap.LedgerAccounts)
+
+	// Balances are derived, so rebuild them from the journal
+	for _, entry := range snap.Journal {
+		s.apply(entry)
+	}
+	s.projectAll()
+
+	copyMap(s.statements, snap.Statements)
+	for _, statement := range snap.Statements {
+		s.statementsByCard[statement.CardID] = append(s.statementsByCard[statement.CardID], statement)
+	}
+	for _, statements := range s.statementsByCard {
+		sort.Slice(statements, func(i, j int) bool { return statements[i].PeriodEnd.Before(statements[j].PeriodEnd) })
+	}
+
+	copyMap(s.emiPlans, snap.EMIPlans)
+
+	// Points balances are derived, so rebuild them from the rewards entries
+	for _, card := range s.creditCards {
+		card.RewardsPoints = 0
+	}
+	for _, entries := range snap.Rewards {
+		for _, entry := range entries {
+			s.indexRewardsEntry(entry)
+		}
+	}
+	return nil
+}
+
+// save writes the current state to a temporary file and atomically renames it
+// over the store file. Callers must hold the write lock.
+func (fs *FileStore) save() error {
+	s := fs.MemoryStore
+	snap := snapshot{
+		Seq: fs.seq,
+
+		Users:         s.users,
+		AccessTokens:  s.accessTokens,
+		RefreshTokens: s.refreshTokens,
+		Sessions:      s.sessions,
+		Challenges:    s.loginChallenges,
+		CreditCards:   s.creditCards,
+		DebitCards:    s.debitCards,
+		VirtualCards:  s.virtualCards,
+		StatusChanges: s.statusChanges,
+		Dispatches:    s.dispatches,
+		Autopays:      s.autopays,
+		AutopayRuns:   s.autopayRuns,
+		Payments:      s.payments,
+		CardLimits:    s.cardLimits,
+		CardUsage:     s.cardUsage,
+		CardSettings:  s.cardSettings,
+		Transactions:  s.transactions,
+
+		LedgerAccounts: s.ledgerAccounts,
+		Journal:        s.journal,
+		Statements:     s.statements,
+		EMIPlans:       s.emiPlans,
+		Rewards:        s.rewards,
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(fs.path), filepath.Base(fs.path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := gob.NewEncoder(tmp).Encode(&snap); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), fs.path)
+}
+
+func copyMap[K comparable, V any](dst, src map[K]V) {
+	for k, v := range src {
+		dst[k] = v
+	}
+}
@@ -0,0 +1,337 @@
+package store
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"time"
+
+	"bankapp-microservices/internal/models"
+)
+
+// mutation is one successful change to the store. FileStore appends every
+// mutation to its journal and replays them on top of the last snapshot when
+// it is opened again, so the store methods must be deterministic given the
+// same mutations in the same order.
+type mutation struct {
+	// Seq orders mutations; a snapshot records the last Seq it includes
+	Seq  uint64
+	Op   string
+	Keys []string
+	Time time.Time
+	// Value is the record stored by the mutation, if any
+	Value interface{}
+}
+
+// Mutation operations, named after the store method that made them
+const (
+	opCreateUser            = "CreateUser"
+	opUpdateUser            = "UpdateUser"
+	opSetAccessToken        = "SetAccessToken"
+	opSetRefreshToken       = "SetRefreshToken"
+	opUseRefreshToken       = "UseRefreshToken"
+	opDeleteExpiredTokens   = "DeleteExpiredTokens"
+	opSetLoginChallenge     = "SetLoginChallenge"
+	opDeleteLoginChallenge  = "DeleteLoginChallenge"
+	opSetSession            = "SetSession"
+	opTouchSession          = "TouchSession"
+	opDeleteSession         = "DeleteSession"
+	opUpdateCreditCard      = "UpdateCreditCard"
+	opMoveCreditCardRecords = "MoveCreditCardRecords"
+	opUpdateDebitCard       = "UpdateDebitCard"
+	opUpdateCardPIN         = "UpdateCardPIN"
+	opCreateVirtualCard     = "CreateVirtualCard"
+	opUpdateVirtualCard     = "UpdateVirtualCard"
+	opDeleteVirtualCard     = "DeleteVirtualCard"
+	opAddCardStatusChange   = "AddCardStatusChange"
+	opSetCardDispatch       = "SetCardDispatch"
+	opSetAutopay            = "SetAutopay"
+	opDeleteAutopay         = "DeleteAutopay"
+	opAddAutopayExecution   = "AddAutopayExecution"
+	opAddCardPayment        = "AddCardPayment"
+	opSetCardLimits         = "SetCardLimits"
+	opSetCardUsage          = "SetCardUsage"
+	opUpdateCardSettings    = "UpdateCardSettings"
+	opAddTransaction        = "AddTransaction"
+	opAddStatement          = "AddStatement"
+	opSetEMIPlan            = "SetEMIPlan"
+	opAddRewardsEntry       = "AddRewardsEntry"
+	opCreateLedgerAccount   = "CreateLedgerAccount"
+	opPostJournalEntry      = "PostJournalEntry"
+)
+
+func init() {
+	gob.Register(&models.User{})
+	gob.Register(&models.AccessToken{})
+	gob.Register(&models.RefreshToken{})
+	gob.Register(&models.LoginChallenge{})
+	gob.Register(&models.Session{})
+	gob.Register(&models.CreditCard{})
+	gob.Register(&models.DebitCard{})
+	gob.Register(&models.CardPIN{})
+	gob.Register(&models.VirtualCard{})
+	gob.Register(&models.CardStatusChange{})
+	gob.Register(&models.CardDispatch{})
+	gob.Register(&models.Autopay{})
+	gob.Register(&models.AutopayExecution{})
+	gob.Register(&models.CardPayment{})
+	gob.Register(&models.LimitsRequest{})
+	gob.Register(&models.CardUsage{})
+	gob.Register(&models.CardSettings{})
+	gob.Register(&models.Transaction{})
+	gob.Register(&models.Statement{})
+	gob.Register(&models.EMIPlan{})
+	gob.Register(&models.RewardsEntry{})
+	gob.Register(&models.LedgerAccount{})
+	gob.Register(&models.JournalEntry{})
+}
+
+// replay applies a journaled mutation through the method that made it
+func (s *MemoryStore) replay(m *mutation) error {
+	var ok bool
+	switch m.Op {
+	case opCreateUser:
+		var user *models.User
+		if user, ok = m.Value.(*models.User); ok {
+			s.CreateUser(user)
+		}
+	case opUpdateUser:
+		var user *models.User
+		if user, ok = m.Value.(*models.User); ok {
+			s.UpdateUser(user)
+		}
+	case opSetAccessToken:
+		var token *models.AccessToken
+		if token, ok = m.Value.(*models.AccessToken); ok {
+			s.SetAccessToken(token)
+		}
+	case opSetRefreshToken:
+		var token *models.RefreshToken
+		if token, ok = m.Value.(*models.RefreshToken); ok {
+			s.SetRefreshToken(token)
+		}
+	case opUseRefreshToken:
+		if ok = len(m.Keys) == 1; ok {
+			s.UseRefreshToken(m.Keys[0])
+		}
+	case opDeleteExpiredTokens:
+		s.DeleteExpiredTokens(m.Time)
+		ok = true
+	case opSetLoginChallenge:
+		var challenge *models.LoginChallenge
+		if challenge, ok = m.Value.(*models.LoginChallenge); ok {
+			s.SetLoginChallenge(challenge)
+		}
+	case opDeleteLoginChallenge:
+		if ok = len(m.Keys) == 1; ok {
+			s.DeleteLoginChallenge(m.Keys[0])
+		}
+	case opSetSession:
+		var session *models.Session
+		if session, ok = m.Value.(*models.Session); ok {
+			s.SetSession(session)
+		}
+	case opTouchSession:
+		if ok = len(m.Keys) == 1; ok {
+			s.TouchSession(m.Keys[0], m.Time)
+		}
+	case opDeleteSession:
+		if ok = len(m.Keys) == 1; ok {
+			s.DeleteSession(m.Keys[0])
+		}
+	case opUpdateCreditCard:
+		var card *models.CreditCard
+		if card, ok = m.Value.(*models.CreditCard); ok {
+			s.UpdateCreditCard(card)
+		}
+	case opMoveCreditCardRecords:
+		if ok = len(m.Keys) == 2; ok {
+			s.MoveCreditCardRecords(m.Keys[0], m.Keys[1])
+		}
+	case opUpdateDebitCard:
+		var card *models.DebitCard
+		if card, ok = m.Value.(*models.DebitCard); ok {
+			s.UpdateDebitCard(card)
+		}
+	case opUpdateCardPIN:
+		if ok = len(m.Keys) == 1; ok {
+			pin, _ := m.Value.(*models.CardPIN)
+			s.UpdateCardPIN(m.Keys[0], func(stored **models.CardPIN) { *stored = pin })
+		}
+	case opCreateVirtualCard:
+		var card *models.VirtualCard
+		if card, ok = m.Value.(*models.VirtualCard); ok {
+			s.CreateVirtualCard(card)
+		}
+	case opUpdateVirtualCard:
+		var card *models.VirtualCard
+		if card, ok = m.Value.(*models.VirtualCard); ok {
+			s.UpdateVirtualCard(card)
+		}
+	case opDeleteVirtualCard:
+		if ok = len(m.Keys) == 1; ok {
+			s.DeleteVirtualCard(m.Keys[0])
+		}
+	case opAddCardStatusChange:
+		var change *models.CardStatusChange
+		if change, ok = m.Value.(*models.CardStatusChange); ok {
+			s.AddCardStatusChange(change)
+		}
+	case opSetCardDispatch:
+		var dispatch *models.CardDispatch
+		if dispatch, ok = m.Value.(*models.CardDispatch); ok {
+			s.SetCardDispatch(dispatch)
+		}
+	case opSetAutopay:
+		var autopay *models.Autopay
+		if autopay, ok = m.Value.(*models.Autopay); ok {
+			s.SetAutopay(autopay)
+		}
+	case opDeleteAutopay:
+		if ok = len(m.Keys) == 1; ok {
+			s.DeleteAutopay(m.Keys[0])
+		}
+	case opAddAutopayExecution:
+		var execution *models.AutopayExecution
+		if execution, ok = m.Value.(*models.AutopayExecution); ok {
+			s.AddAutopayExecution(execution)
+		}
+	case opAddCardPayment:
+		var payment *models.CardPayment
+		if payment, ok = m.Value.(*models.CardPayment); ok {
+			s.AddCardPayment(payment)
+		}
+	case opSetCardLimits:
+		var limits *models.LimitsRequest
+		limits, ok = m.Value.(*models.LimitsRequest)
+		if ok = ok && len(m.Keys) == 1; ok {
+			s.SetCardLimits(m.Keys[0], limits)
+		}
+	case opSetCardUsage:
+		var usage *models.CardUsage
+		if usage, ok = m.Value.(*models.CardUsage); ok {
+			s.SetCardUsage(usage)
+		}
+	case opUpdateCardSettings:
+		var settings *models.CardSettings
+		if settings, ok = m.Value.(*models.CardSettings); ok {
+			s.UpdateCardSettings(settings)
+		}
+	case opAddTransaction:
+		var transaction *models.Transaction
+		if transaction, ok = m.Value.(*models.Transaction); ok {
+			s.AddTransaction(transaction)
+		}
+	case opAddStatement:
+		var statement *models.Statement
+		if statement, ok = m.Value.(*models.Statement); ok {
+			s.AddStatement(statement)
+		}
+	case opSetEMIPlan:
+		var plan *models.EMIPlan
+		if plan, ok = m.Value.(*models.EMIPlan); ok {
+			s.SetEMIPlan(plan)
+		}
+	case opAddRewardsEntry:
+		var entry *models.RewardsEntry
+		if entry, ok = m.Value.(*models.RewardsEntry); ok {
+			s.AddRewardsEntry(entry)
+		}
+	case opCreateLedgerAccount:
+		var account *models.LedgerAccount
+		if account, ok = m.Value.(*models.LedgerAccount); ok {
+			s.CreateLedgerAccount(account)
+		}
+	case opPostJournalEntry:
+		var entry *models.JournalEntry
+		if entry, ok = m.Value.(*models.JournalEntry); ok {
+			if err := s.PostJournalEntry(entry); err != nil {
+				return fmt.Errorf("mutation %d: %w", m.Seq, err)
+			}
+		}
+	}
+	if !ok {
+		return fmt.Errorf("mutation %d: malformed %q record", m.Seq, m.Op)
+	}
+	return nil
+}
+
+// The journal is a single gob stream split into frames, one per mutation.
+// Each frame is the payload length and its CRC-32 followed by the payload, so
+// a frame torn by a crash while it was written is detected and dropped.
+const (
+	frameHeaderSize = 8
+	maxFrameSize    = 64 << 20
+)
+
+// journalWriter encodes mutations into frames
+type journalWriter struct {
+	w   io.Writer
+	buf bytes.Buffer
+	enc *gob.Encoder
+}
+
+func newJournalWriter(w io.Writer) *journalWriter {
+	jw := &journalWriter{w: w}
+	jw.enc = gob.NewEncoder(&jw.buf)
+	return jw
+}
+
+func (jw *journalWriter) write(m *mutation) error {
+	jw.buf.Reset()
+	if err := jw.enc.Encode(m); err != nil {
+		return err
+	}
+	frame := make([]byte, frameHeaderSize, frameHeaderSize+jw.buf.Len())
+	binary.BigEndian.PutUint32(frame[0:4], uint32(jw.buf.Len()))
+	binary.BigEndian.PutUint32(frame[4:8], crc32.ChecksumIEEE(jw.buf.Bytes()))
+	frame = append(frame, jw.buf.Bytes()...)
+	_, err := jw.w.Write(frame)
+	return err
+}
+
+// readJournal decodes the mutations in r, stopping at the first torn or
+// corrupt frame
+func readJournal(r io.Reader) ([]*mutation, error) {
+	var payload bytes.Buffer
+	frames := 0
+	br := bufio.NewReader(r)
+	header := make([]byte, frameHeaderSize)
+	for {
+		if _, err := io.ReadFull(br, header); err != nil {
+			break
+		}
+		size := binary.BigEndian.Uint32(header[0:4])
+		if size > maxFrameSize {
+			break
+		}
+		body := make([]byte, size)
+		if _, err := io.ReadFull(br, body); err != nil {
+			break
+		}
+		if crc32.ChecksumIEEE(body) != binary.BigEndian.Uint32(header[4:8]) {
+			break
+		}
+		payload.Write(body)
+		frames++
+	}
+
+	dec := gob.NewDecoder(&payload)
+	mutations := make([]*mutation, 0, frames)
+	for i := 0; i < frames; i++ {
+		var m mutation
+		if err := dec.Decode(&m); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, err
+		}
+		mutations = append(mutations, &m)
+	}
+	return mutations, nil
+}
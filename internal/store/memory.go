@@ -0,0 +1,1219 @@
+package store
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"bankapp-microservices/internal/ledger"
+	"bankapp-microservices/internal/models"
+	"bankapp-microservices/internal/password"
+)
+
+// MemoryStore is the map-backed Store implementation
+type MemoryStore struct {
+	mu              sync.RWMutex
+	users           map[string]*models.User
+	accessTokens    map[string]*models.AccessToken
+	refreshTokens   map[string]*models.RefreshToken
+	sessions        map[string]*models.Session
+	loginChallenges map[string]*models.LoginChallenge
+	creditCards     map[string]*models.CreditCard
+	debitCards      map[string]*models.DebitCard
+	virtualCards    map[string]*models.VirtualCard
+	statusChanges   map[string][]*models.CardStatusChange // cardID -> status changes, oldest first
+	dispatches      map[string]*models.CardDispatch       // cardID -> dispatch of the physical card
+	autopays        map[string]*models.Autopay            // cardID -> autopay
+	autopayRuns     map[string][]*models.AutopayExecution // cardID -> executions, oldest first
+	payments        map[string][]*models.CardPayment      // cardID -> payments, oldest first
+	paymentsByKey   map[string]*models.CardPayment        // userID and idempotency key -> payment
+	cardLimits      map[string]*models.LimitsRequest      // cardID -> limits
+	cardUsage       map[string]*models.CardUsage          // cardID -> limit usage
+	cardSettings    map[string]*models.CardSettings       // userID -> settings
+	transactions    map[string][]*models.Transaction      // cardID -> transactions ordered by date and ID
+
+	// Ledger. balances is derived from journal and rebuilt when loading.
+	ledgerAccounts   map[string]*models.LedgerAccount
+	journal          []*models.JournalEntry
+	journalByAccount map[string][]*models.JournalEntry
+	journalByRef     map[string]*models.JournalEntry // first entry per reference
+	balances         map[string]int64
+
+	statements       map[string]*models.Statement
+	statementsByCard map[string][]*models.Statement // cardID -> statements ordered by period
+
+	emiPlans map[string]*models.EMIPlan
+
+	// Rewards points. Card RewardsPoints are derived from the entries.
+	rewards      map[string][]*models.RewardsEntry // cardID -> entries, oldest first
+	rewardsByRef map[string]*models.RewardsEntry
+
+	// onChange is called with the write lock held after every mutation
+	onChange func(m *mutation)
+}
+
+// NewMemoryStore creates a new in-memory store seeded with default data
+func NewMemoryStore() *MemoryStore {
+	store := newMemoryStore()
+	store.initDefaultData()
+	return store
+}
+
+func newMemoryStore() *MemoryStore {
+	s := &MemoryStore{
+		users:           make(map[string]*models.User),
+		accessTokens:    make(map[string]*models.AccessToken),
+		refreshTokens:   make(map[string]*models.RefreshToken),
+		sessions:        make(map[string]*models.Session),
+		loginChallenges: make(map[string]*models.LoginChallenge),
+		creditCards:     make(map[string]*models.CreditCard),
+		debitCards:      make(map[string]*models.DebitCard),
+		virtualCards:    make(map[string]*models.VirtualCard),
+		statusChanges:   make(map[string][]*models.CardStatusChange),
+		dispatches:      make(map[string]*models.CardDispatch),
+		autopays:        make(map[string]*models.Autopay),
+		autopayRuns:     make(map[string][]*models.AutopayExecution),
+		payments:        make(map[string][]*models.CardPayment),
+		paymentsByKey:   make(map[string]*models.CardPayment),
+		cardLimits:      make(map[string]*models.LimitsRequest),
+		cardUsage:       make(map[string]*models.CardUsage),
+		cardSettings:    make(map[string]*models.CardSettings),
+		transactions:    make(map[string][]*models.Transaction),
+
+		ledgerAccounts:   make(map[string]*models.LedgerAccount),
+		journalByAccount: make(map[string][]*models.JournalEntry),
+		journalByRef:     make(map[string]*models.JournalEntry),
+		balances:         make(map[string]int64),
+
+		statements:       make(map[string]*models.Statement),
+		statementsByCard: make(map[string][]*models.Statement),
+
+		emiPlans: make(map[string]*models.EMIPlan),
+
+		rewards:      make(map[string][]*models.RewardsEntry),
+		rewardsByRef: make(map[string]*models.RewardsEntry),
+	}
+	for _, account := range ledger.SystemAccounts {
+		copied := *account
+		s.ledgerAccounts[account.ID] = &copied
+	}
+	return s
+}
+
+// initDefaultData initializes default test data
+func (s *MemoryStore) initDefaultData() {
+	// Create default user
+	user := &models.User{
+		UserID:       "testuser",
+		PasswordHash: password.MustHash("password123"),
+		CreatedAt:    time.Now(),
+		FullName:     "Bruce Wayne",
+		Email:        "bruce.wayne@example.com",
+		DateOfBirth:  "1972-02-19",
+		RequiresPIN:  false,
+		RequiresOTP:  false,
+	}
+	s.users[user.UserID] = user
+
+	// Create default credit card 1
+	// Credit cards opened a few months ago so they have statements to show
+	openedAt := time.Now().AddDate(0, -3, 0)
+	creditCard1 := &models.CreditCard{
+		ID:             models.GenerateID(),
+		CardNumber:     "4532123456789012",
+		CVV:            "***",
+		ExpiryMonth:    12,
+		ExpiryYear:     2026,
+		CardholderName: "Bruce Wayne",
+		CardType:       "Visa Platinum",
+		TotalCredit:    1000000.0,
+		StatementDay:   5,
+		OpenedAt:       openedAt,
+		UserID:         user.UserID,
+		Status:         models.CardStatusActive,
+	}
+	creditCard1.LedgerAccountID = s.openAccount(ledger.CreditCardAccountID(creditCard1.ID), ledger.TypeCreditLine, "Visa Platinum credit line", user.UserID)
+	s.creditCards[creditCard1.ID] = creditCard1
+
+	// Create default credit card 2
+	creditCard2 := &models.CreditCard{
+		ID:             models.GenerateID(),
+		CardNumber:     "5412751234567890",
+		CVV:            "***",
+		ExpiryMonth:    06,
+		ExpiryYear:     2029,
+		CardholderName: "Bruce Wayne",
+		CardType:       "Mastercard World",
+		TotalCredit:    500000.0,
+		StatementDay:   18,
+		OpenedAt:       openedAt,
+		UserID:         user.UserID,
+		Status:         models.CardStatusActive,
+	}
+	creditCard2.LedgerAccountID = s.openAccount(ledger.CreditCardAccountID(creditCard2.ID), ledger.TypeCreditLine, "Mastercard World credit line", user.UserID)
+	s.creditCards[creditCard2.ID] = creditCard2
+
+	// Create default debit card
+	debitCard := &models.DebitCard{
+		ID:             models.GenerateID(),
+		CardNumber:     "6529251234567890",
+		CVV:            "***",
+		ExpiryMonth:    10,
+		ExpiryYear:     2028,
+		CardholderName: "Bruce Wayne",
+		CardType:       "Rupay",
+		AccountNumber:  "50123456789012",
+		BankName:       "HDFC Bank",
+		UserID:         user.UserID,
+		Status:         models.CardStatusActive,
+	}
+	debitCard.LedgerAccountID = s.openAccount(ledger.DepositAccountID(debitCard.AccountNumber), ledger.TypeDeposit, "HDFC Bank savings", user.UserID)
+	s.debitCards[debitCard.ID] = debitCard
+
+	// Create default virtual card
+	virtualCard := &models.VirtualCard{
+		ID:              models.GenerateID(),
+		CardNumber:      "4532123456789012",
+		CVV:             "***",
+		ExpiryMonth:     3,
+		ExpiryYear:      2025,
+		CardholderName:  "Bruce Wayne",
+		CardType:        "Visa",
+		Nickname:        "Netflix Subscription",
+		SpendingLimit:   5000.0,
+		CreatedAt:       time.Now(),
+		Status:          models.CardStatusActive,
+		LinkedAccountID: "account-uuid",
+		UserID:          user.UserID,
+	}
+	virtualCard.LedgerAccountID = s.openAccount(ledger.VirtualCardAccountID(virtualCard.ID), ledger.TypeAllowance, "Netflix Subscription allowance", user.UserID)
+	s.virtualCards[virtualCard.ID] = virtualCard
+
+	// Opening balances
+	now := time.Now()
+	s.mustPost(ledger.Transfer(ledger.AccountFunding, debitCard.LedgerAccountID, ledger.ToMinor(50000), "Opening balance", "", now))
+	s.mustPost(ledger.Transfer(ledger.AccountVirtualAllowance, virtualCard.LedgerAccountID, ledger.ToMinor(5000), "Spending limit", "", now))
+	s.mustPost(ledger.Transfer(virtualCard.LedgerAccountID, ledger.AccountMerchantSettlement, ledger.ToMinor(1800), "Opening spend", "", now))
+	s.projectAll()
+
+	// Opening rewards points, valid for a year
+	expiresAt := now.AddDate(1, 0, 0)
+	s.indexRewardsEntry(&models.RewardsEntry{ID: models.GenerateID(), CardID: creditCard1.ID, UserID: user.UserID, Type: models.RewardsEarn, Points: 5000, Description: "Opening balance", Date: now, ExpiresAt: &expiresAt})
+	s.indexRewardsEntry(&models.RewardsEntry{ID: models.GenerateID(), CardID: creditCard2.ID, UserID: user.UserID, Type: models.RewardsEarn, Points: 2500, Description: "Opening balance", Date: now, ExpiresAt: &expiresAt})
+
+	// Create default card settings
+	settings := &models.CardSettings{
+		DefaultCreditCardID:               creditCard1.ID,
+		DefaultDebitCardID:                debitCard.ID,
+		DefaultVirtualCardID:              virtualCard.ID,
+		TransactionNotificationsEnabled:   true,
+		NotificationPreferences:           []string{"Push Notification", "Email"},
+		TransactionAmountThreshold:        1000.0,
+		InternationalTransactionAlerts:    true,
+		ContactlessPaymentsEnabled:        true,
+		InternationalUsageEnabled:         true,
+		OnlineTransactionsEnabled:         true,
+		ATMWithdrawalsEnabled:             true,
+		DefaultDailyLimit:                 50000.0,
+		DefaultMonthlyLimit:               200000.0,
+		StatementDelivery:                 "Email",
+		StatementFrequency:                "Monthly",
+		EStatementEnabled:                 true,
+		BiometricAuthenticationEnabled:    true,
+		TwoFactorAuthenticationEnabled:    false,
+		TransactionAuthenticationRequired: true,
+		PINForContactlessEnabled:          false,
+		UserID:                            user.UserID,
+	}
+	s.cardSettings[user.UserID] = settings
+}
+
+// GetUserByID gets user by ID
+func (s *MemoryStore) GetUserByID(userID string) (*models.User, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	user, exists := s.users[userID]
+	if !exists {
+		return nil, false
+	}
+	return clonePtr(user), true
+}
+
+// GetUserByEmail gets user by email address, ignoring case
+func (s *MemoryStore) GetUserByEmail(email string) (*models.User, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, user := range s.users {
+		if strings.EqualFold(user.Email, email) {
+			return clonePtr(user), true
+		}
+	}
+	return nil, false
+}
+
+// CreateUser adds a new user, returning false if the user ID is already taken
+func (s *MemoryStore) CreateUser(user *models.User) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.users[user.UserID]; exists {
+		return false
+	}
+	s.users[user.UserID] = clonePtr(user)
+	s.changed(&mutation{Op: opCreateUser, Value: s.users[user.UserID]})
+	return true
+}
+
+// UpdateUser updates user
+func (s *MemoryStore) UpdateUser(user *models.User) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.users[user.UserID] = clonePtr(user)
+	s.changed(&mutation{Op: opUpdateUser, Value: s.users[user.UserID]})
+}
+
+// GetUserByToken gets user by an unexpired access token
+func (s *MemoryStore) GetUserByToken(token string) (*models.User, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	accessToken, exists := s.accessTokens[token]
+	if !exists || !time.Now().Before(accessToken.ExpiresAt) {
+		return nil, false
+	}
+	user, exists := s.users[accessToken.UserID]
+	if !exists {
+		return nil, false
+	}
+	return clonePtr(user), true
+}
+
+// GetAccessToken gets access token
+func (s *MemoryStore) GetAccessToken(token string) (*models.AccessToken, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	accessToken, exists := s.accessTokens[token]
+	if !exists {
+		return nil, false
+	}
+	return clonePtr(accessToken), true
+}
+
+// SetAccessToken stores an access token
+func (s *MemoryStore) SetAccessToken(token *models.AccessToken) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.accessTokens[token.Token] = clonePtr(token)
+	s.changed(&mutation{Op: opSetAccessToken, Value: s.accessTokens[token.Token]})
+}
+
+// GetRefreshToken gets refresh token
+func (s *MemoryStore) GetRefreshToken(token string) (*models.RefreshToken, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	refreshToken, exists := s.refreshTokens[token]
+	if !exists {
+		return nil, false
+	}
+	return clonePtr(refreshToken), true
+}
+
+// SetRefreshToken stores a refresh token
+func (s *MemoryStore) SetRefreshToken(token *models.RefreshToken) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.refreshTokens[token.Token] = clonePtr(token)
+	s.changed(&mutation{Op: opSetRefreshToken, Value: s.refreshTokens[token.Token]})
+}
+
+// UseRefreshToken atomically marks a refresh token as used and returns its
+// state from before the call, so a returned token with Used set means reuse
+func (s *MemoryStore) UseRefreshToken(token string) (*models.RefreshToken, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	refreshToken, exists := s.refreshTokens[token]
+	if !exists {
+		return nil, false
+	}
+	previous := *refreshToken
+	refreshToken.Used = true
+	s.changed(&mutation{Op: opUseRefreshToken, Keys: []string{token}})
+	return &previous, true
+}
+
+// DeleteExpiredTokens purges expired tokens, sessions and login challenges and returns how many entries were removed
+func (s *MemoryStore) DeleteExpiredTokens(now time.Time) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	removed := 0
+	for token, accessToken := range s.accessTokens {
+		if !now.Before(accessToken.ExpiresAt) {
+			delete(s.accessTokens, token)
+			removed++
+		}
+	}
+	for token, refreshToken := range s.refreshTokens {
+		if !now.Before(refreshToken.ExpiresAt) {
+			delete(s.refreshTokens, token)
+			removed++
+		}
+	}
+	for sessionID, session := range s.sessions {
+		if !now.Before(session.ExpiresAt) {
+			delete(s.sessions, sessionID)
+			removed++
+		}
+	}
+	for challengeID, challenge := range s.loginChallenges {
+		if !now.Before(challenge.ExpiresAt) {
+			delete(s.loginChallenges, challengeID)
+			removed++
+		}
+	}
+	if removed > 0 {
+		s.changed(&mutation{Op: opDeleteExpiredTokens, Time: now})
+	}
+	return removed
+}
+
+// GetLoginChallenge gets login challenge by ID
+func (s *MemoryStore) GetLoginChallenge(challengeID string) (*models.LoginChallenge, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	challenge, exists := s.loginChallenges[challengeID]
+	if !exists {
+		return nil, false
+	}
+	return cloneChallenge(challenge), true
+}
+
+// SetLoginChallenge creates or updates a login challenge
+func (s *MemoryStore) SetLoginChallenge(challenge *models.LoginChallenge) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.loginChallenges[challenge.ID] = cloneChallenge(challenge)
+	s.changed(&mutation{Op: opSetLoginChallenge, Value: s.loginChallenges[challenge.ID]})
+}
+
+// DeleteLoginChallenge deletes a login challenge
+func (s *MemoryStore) DeleteLoginChallenge(challengeID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.loginChallenges, challengeID)
+	s.changed(&mutation{Op: opDeleteLoginChallenge, Keys: []string{challengeID}})
+}
+
+// GetSessionByID gets session by ID
+func (s *MemoryStore) GetSessionByID(sessionID string) (*models.Session, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	session, exists := s.sessions[sessionID]
+	if !exists {
+		return nil, false
+	}
+	return clonePtr(session), true
+}
+
+// GetSessionsByUserID gets all sessions for a user
+func (s *MemoryStore) GetSessionsByUserID(userID string) []*models.Session {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var sessions []*models.Session
+	for _, session := range s.sessions {
+		if session.UserID == userID {
+			sessions = append(sessions, clonePtr(session))
+		}
+	}
+	return sessions
+}
+
+// SetSession creates or updates a session
+func (s *MemoryStore) SetSession(session *models.Session) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sessions[session.ID] = clonePtr(session)
+	s.changed(&mutation{Op: opSetSession, Value: s.sessions[session.ID]})
+}
+
+// TouchSession records the last time a session was used
+func (s *MemoryStore) TouchSession(sessionID string, at time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if session, exists := s.sessions[sessionID]; exists {
+		session.LastUsedAt = at
+		s.changed(&mutation{Op: opTouchSession, Keys: []string{sessionID}, Time: at})
+	}
+}
+
+// DeleteSession deletes a session together with all of its access and refresh tokens
+func (s *MemoryStore) DeleteSession(sessionID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.sessions, sessionID)
+	for token, accessToken := range s.accessTokens {
+		if accessToken.SessionID == sessionID {
+			delete(s.accessTokens, token)
+		}
+	}
+	for token, refreshToken := range s.refreshTokens {
+		if refreshToken.SessionID == sessionID {
+			delete(s.refreshTokens, token)
+		}
+	}
+	s.changed(&mutation{Op: opDeleteSession, Keys: []string{sessionID}})
+}
+
+// GetCreditCardsByUserID gets all credit cards for a user
+func (s *MemoryStore) GetCreditCardsByUserID(userID string) []*models.CreditCard {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var cards []*models.CreditCard
+	for _, card := range s.creditCards {
+		if card.UserID == userID {
+			cards = append(cards, cloneCreditCard(card))
+		}
+	}
+	return cards
+}
+
+// GetAllCreditCards gets the credit cards of every user
+func (s *MemoryStore) GetAllCreditCards() []*models.CreditCard {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	cards := make([]*models.CreditCard, 0, len(s.creditCards))
+	for _, card := range s.creditCards {
+		cards = append(cards, cloneCreditCard(card))
+	}
+	return cards
+}
+
+// GetCreditCardByID gets credit card by ID
+func (s *MemoryStore) GetCreditCardByID(cardID string) (*models.CreditCard, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	card, exists := s.creditCards[cardID]
+	if !exists {
+		return nil, false
+	}
+	return cloneCreditCard(card), true
+}
+
+// UpdateCreditCard creates or updates a credit card. Its balances and
+// rewards points are derived by the store, so the values on card are ignored.
+func (s *MemoryStore) UpdateCreditCard(card *models.CreditCard) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored := cloneCreditCard(card)
+	stored.RewardsPoints = 0
+	for _, entry := range s.rewards[stored.ID] {
+		stored.RewardsPoints += entry.Points
+	}
+	s.creditCards[stored.ID] = stored
+	s.project(s.creditLine(stored).LedgerAccountID)
+	s.changed(&mutation{Op: opUpdateCreditCard, Value: stored})
+}
+
+// GetDebitCardsByUserID gets all debit cards for a user
+func (s *MemoryStore) GetDebitCardsByUserID(userID string) []*models.DebitCard {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var cards []*models.DebitCard
+	for _, card := range s.debitCards {
+		if card.UserID == userID {
+			cards = append(cards, cloneDebitCard(card))
+		}
+	}
+	return cards
+}
+
+// GetDebitCardByID gets debit card by ID
+func (s *MemoryStore) GetDebitCardByID(cardID string) (*models.DebitCard, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	card, exists := s.debitCards[cardID]
+	if !exists {
+		return nil, false
+	}
+	return cloneDebitCard(card), true
+}
+
+// UpdateDebitCard creates or updates a debit card. Its balance is derived
+// by the store, so the value on card is ignored.
+func (s *MemoryStore) UpdateDebitCard(card *models.DebitCard) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored := cloneDebitCard(card)
+	s.debitCards[stored.ID] = stored
+	s.project(stored.LedgerAccountID)
+	s.changed(&mutation{Op: opUpdateDebitCard, Value: stored})
+}
+
+// UpdateCardPIN calls update with the PIN of the credit or debit card cardID
+// while holding the write lock, then saves the PIN update leaves behind, so
+// concurrent PIN checks each see the attempts counted before them. Only the
+// PIN is written; the rest of the card is left as it is. It returns false if
+// there is no such card.
+func (s *MemoryStore) UpdateCardPIN(cardID string, update func(pin **models.CardPIN)) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var stored **models.CardPIN
+	if card, exists := s.creditCards[cardID]; exists {
+		stored = &card.PIN
+	} else if card, exists := s.debitCards[cardID]; exists {
+		stored = &card.PIN
+	} else {
+		return false
+	}
+	pin := cloneCardPIN(*stored)
+	update(&pin)
+	*stored = cloneCardPIN(pin)
+	s.changed(&mutation{Op: opUpdateCardPIN, Keys: []string{cardID}, Value: *stored})
+	return true
+}
+
+// MoveCreditCardRecords hands the billing records of one credit card to
+// another on the same credit line: EMI plans, rewards points, payments and
+// autopay. Issued statements and transactions stay with the card they
+// belong to.
+func (s *MemoryStore) MoveCreditCardRecords(fromCardID, toCardID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, plan := range s.emiPlans {
+		if plan.CardID == fromCardID {
+			plan.CardID = toCardID
+		}
+	}
+
+	from, to := s.creditCards[fromCardID], s.creditCards[toCardID]
+	for _, entry := range s.rewards[fromCardID] {
+		entry.CardID = toCardID
+		from.RewardsPoints -= entry.Points
+		to.RewardsPoints += entry.Points
+	}
+	s.rewards[toCardID] = append(s.rewards[toCardID], s.rewards[fromCardID]...)
+	delete(s.rewards, fromCardID)
+
+	for _, payment := range s.payments[fromCardID] {
+		payment.CardID = toCardID
+	}
+	s.payments[toCardID] = append(s.payments[toCardID], s.payments[fromCardID]...)
+	delete(s.payments, fromCardID)
+
+	if autopay, exists := s.autopays[fromCardID]; exists {
+		autopay.CardID = toCardID
+		s.autopays[toCardID] = autopay
+		delete(s.autopays, fromCardID)
+	}
+	for _, execution := range s.autopayRuns[fromCardID] {
+		execution.CardID = toCardID
+	}
+	s.autopayRuns[toCardID] = append(s.autopayRuns[toCardID], s.autopayRuns[fromCardID]...)
+	delete(s.autopayRuns, fromCardID)
+	s.changed(&mutation{Op: opMoveCreditCardRecords, Keys: []string{fromCardID, toCardID}})
+}
+
+// GetVirtualCardsByUserID gets all virtual cards for a user
+func (s *MemoryStore) GetVirtualCardsByUserID(userID string) []*models.VirtualCard {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var cards []*models.VirtualCard
+	for _, card := range s.virtualCards {
+		if card.UserID == userID {
+			cards = append(cards, cloneVirtualCard(card))
+		}
+	}
+	return cards
+}
+
+// GetVirtualCardByID gets virtual card by ID
+func (s *MemoryStore) GetVirtualCardByID(cardID string) (*models.VirtualCard, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	card, exists := s.virtualCards[cardID]
+	if !exists {
+		return nil, false
+	}
+	return cloneVirtualCard(card), true
+}
+
+// CreateVirtualCard creates a new virtual card
+func (s *MemoryStore) CreateVirtualCard(card *models.VirtualCard) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.putVirtualCard(card)
+	s.changed(&mutation{Op: opCreateVirtualCard, Value: s.virtualCards[card.ID]})
+}
+
+// UpdateVirtualCard updates virtual card. Its remaining balance is derived by
+// the store, so the value on card is ignored.
+func (s *MemoryStore) UpdateVirtualCard(card *models.VirtualCard) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.putVirtualCard(card)
+	s.changed(&mutation{Op: opUpdateVirtualCard, Value: s.virtualCards[card.ID]})
+}
+
+func (s *MemoryStore) putVirtualCard(card *models.VirtualCard) {
+	stored := cloneVirtualCard(card)
+	s.virtualCards[stored.ID] = stored
+	s.project(stored.LedgerAccountID)
+}
+
+// DeleteVirtualCard deletes virtual card
+func (s *MemoryStore) DeleteVirtualCard(cardID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.virtualCards, cardID)
+	s.changed(&mutation{Op: opDeleteVirtualCard, Keys: []string{cardID}})
+}
+
+// GetCardDispatch gets the dispatch of a card
+func (s *MemoryStore) GetCardDispatch(cardID string) (*models.CardDispatch, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	dispatch, exists := s.dispatches[cardID]
+	if !exists {
+		return nil, false
+	}
+	return cloneDispatch(dispatch), true
+}
+
+// SetCardDispatch sets the dispatch of a card
+func (s *MemoryStore) SetCardDispatch(dispatch *models.CardDispatch) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dispatches[dispatch.CardID] = cloneDispatch(dispatch)
+	s.changed(&mutation{Op: opSetCardDispatch, Value: s.dispatches[dispatch.CardID]})
+}
+
+// AddCardStatusChange records a card status change
+func (s *MemoryStore) AddCardStatusChange(change *models.CardStatusChange) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored := clonePtr(change)
+	s.statusChanges[change.CardID] = append(s.statusChanges[change.CardID], stored)
+	s.changed(&mutation{Op: opAddCardStatusChange, Value: stored})
+}
+
+// GetCardStatusChangesByCardID gets the status changes of a card, oldest first
+func (s *MemoryStore) GetCardStatusChangesByCardID(cardID string) []*models.CardStatusChange {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return cloneAll(s.statusChanges[cardID], clonePtr[models.CardStatusChange])
+}
+
+// GetAutopayByCardID gets autopay by card ID
+func (s *MemoryStore) GetAutopayByCardID(cardID string) (*models.Autopay, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	autopay, exists := s.autopays[cardID]
+	if !exists {
+		return nil, false
+	}
+	return clonePtr(autopay), true
+}
+
+// SetAutopay sets autopay for a card
+func (s *MemoryStore) SetAutopay(autopay *models.Autopay) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.autopays[autopay.CardID] = clonePtr(autopay)
+	s.changed(&mutation{Op: opSetAutopay, Value: s.autopays[autopay.CardID]})
+}
+
+// GetAllAutopays gets the autopay settings of every card
+func (s *MemoryStore) GetAllAutopays() []*models.Autopay {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	autopays := make([]*models.Autopay, 0, len(s.autopays))
+	for _, autopay := range s.autopays {
+		autopays = append(autopays, clonePtr(autopay))
+	}
+	return autopays
+}
+
+// AddAutopayExecution records an autopay attempt
+func (s *MemoryStore) AddAutopayExecution(execution *models.AutopayExecution) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored := cloneAutopayExecution(execution)
+	s.autopayRuns[execution.CardID] = append(s.autopayRuns[execution.CardID], stored)
+	s.changed(&mutation{Op: opAddAutopayExecution, Value: stored})
+}
+
+// GetAutopayExecutionsByCardID gets the autopay attempts of a card, oldest first
+func (s *MemoryStore) GetAutopayExecutionsByCardID(cardID string) []*models.AutopayExecution {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return cloneAll(s.autopayRuns[cardID], cloneAutopayExecution)
+}
+
+// AddCardPayment records a credit card payment
+func (s *MemoryStore) AddCardPayment(payment *models.CardPayment) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored := clonePtr(payment)
+	s.indexCardPayment(stored)
+	s.changed(&mutation{Op: opAddCardPayment, Value: stored})
+}
+
+// GetCardPaymentsByCardID gets the payments made towards a card, oldest first
+func (s *MemoryStore) GetCardPaymentsByCardID(cardID string) []*models.CardPayment {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return cloneAll(s.payments[cardID], clonePtr[models.CardPayment])
+}
+
+// GetCardPaymentByIdempotencyKey gets the payment a user made with an idempotency key
+func (s *MemoryStore) GetCardPaymentByIdempotencyKey(userID, key string) (*models.CardPayment, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	payment, exists := s.paymentsByKey[paymentKey(userID, key)]
+	if !exists {
+		return nil, false
+	}
+	return clonePtr(payment), true
+}
+
+func (s *MemoryStore) indexCardPayment(payment *models.CardPayment) {
+	s.payments[payment.CardID] = append(s.payments[payment.CardID], payment)
+	if payment.IdempotencyKey != "" {
+		s.paymentsByKey[paymentKey(payment.UserID, payment.IdempotencyKey)] = payment
+	}
+}
+
+// paymentKey scopes idempotency keys to the user who sent them
+func paymentKey(userID, key string) string {
+	return userID + "\x00" + key
+}
+
+// DeleteAutopay deletes autopay for a card
+func (s *MemoryStore) DeleteAutopay(cardID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.autopays, cardID)
+	s.changed(&mutation{Op: opDeleteAutopay, Keys: []string{cardID}})
+}
+
+// GetCardLimits gets card limits
+func (s *MemoryStore) GetCardLimits(cardID string) (*models.LimitsRequest, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	limits, exists := s.cardLimits[cardID]
+	if !exists {
+		return nil, false
+	}
+	return cloneLimits(limits), true
+}
+
+// SetCardLimits sets card limits
+func (s *MemoryStore) SetCardLimits(cardID string, limits *models.LimitsRequest) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cardLimits[cardID] = cloneLimits(limits)
+	s.changed(&mutation{Op: opSetCardLimits, Keys: []string{cardID}, Value: s.cardLimits[cardID]})
+}
+
+// GetCardUsage gets limit usage counters for a card
+func (s *MemoryStore) GetCardUsage(cardID string) (*models.CardUsage, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	usage, exists := s.cardUsage[cardID]
+	if !exists {
+		return nil, false
+	}
+	return cloneUsage(usage), true
+}
+
+// SetCardUsage sets limit usage counters for a card
+func (s *MemoryStore) SetCardUsage(usage *models.CardUsage) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cardUsage[usage.CardID] = cloneUsage(usage)
+	s.changed(&mutation{Op: opSetCardUsage, Value: s.cardUsage[usage.CardID]})
+}
+
+// GetCardSettings gets card settings for user
+func (s *MemoryStore) GetCardSettings(userID string) (*models.CardSettings, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	settings, exists := s.cardSettings[userID]
+	if !exists {
+		return nil, false
+	}
+	return cloneSettings(settings), true
+}
+
+// UpdateCardSettings updates card settings
+func (s *MemoryStore) UpdateCardSettings(settings *models.CardSettings) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cardSettings[settings.UserID] = cloneSettings(settings)
+	s.changed(&mutation{Op: opUpdateCardSettings, Value: s.cardSettings[settings.UserID]})
+}
+
+// GetTransactionsByCardID gets transactions for a card, oldest first
+func (s *MemoryStore) GetTransactionsByCardID(cardID string) []*models.Transaction {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return cloneAll(s.transactions[cardID], clonePtr[models.Transaction])
+}
+
+// AddTransaction adds a transaction to its card's time-ordered index
+func (s *MemoryStore) AddTransaction(transaction *models.Transaction) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored := clonePtr(transaction)
+	s.transactions[stored.CardID] = insertTransaction(s.transactions[stored.CardID], stored)
+	s.changed(&mutation{Op: opAddTransaction, Value: stored})
+}
+
+// AddStatement stores a statement, returning false if the card already has
+// a statement for this or a later cycle
+func (s *MemoryStore) AddStatement(statement *models.Statement) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	existing := s.statementsByCard[statement.CardID]
+	if len(existing) > 0 && !existing[len(existing)-1].PeriodEnd.Before(statement.PeriodEnd) {
+		return false
+	}
+	stored := cloneStatement(statement)
+	s.statements[stored.ID] = stored
+	s.statementsByCard[stored.CardID] = append(existing, stored)
+	s.changed(&mutation{Op: opAddStatement, Value: stored})
+	return true
+}
+
+// GetStatementByID gets statement by ID
+func (s *MemoryStore) GetStatementByID(statementID string) (*models.Statement, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	statement, exists := s.statements[statementID]
+	if !exists {
+		return nil, false
+	}
+	return cloneStatement(statement), true
+}
+
+// GetStatementsByCardID gets the statements of a card, oldest first
+func (s *MemoryStore) GetStatementsByCardID(cardID string) []*models.Statement {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return cloneAll(s.statementsByCard[cardID], cloneStatement)
+}
+
+// GetLatestStatement gets the most recent statement of a card
+func (s *MemoryStore) GetLatestStatement(cardID string) (*models.Statement, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	statements := s.statementsByCard[cardID]
+	if len(statements) == 0 {
+		return nil, false
+	}
+	return cloneStatement(statements[len(statements)-1]), true
+}
+
+// GetEMIPlan gets an EMI plan by ID
+func (s *MemoryStore) GetEMIPlan(planID string) (*models.EMIPlan, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	plan, exists := s.emiPlans[planID]
+	if !exists {
+		return nil, false
+	}
+	return cloneEMIPlan(plan), true
+}
+
+// GetEMIPlansByCardID gets the EMI plans of a card, oldest first
+func (s *MemoryStore) GetEMIPlansByCardID(cardID string) []*models.EMIPlan {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var plans []*models.EMIPlan
+	for _, plan := range s.emiPlans {
+		if plan.CardID == cardID {
+			plans = append(plans, cloneEMIPlan(plan))
+		}
+	}
+	sort.Slice(plans, func(i, j int) bool { return plans[i].CreatedAt.Before(plans[j].CreatedAt) })
+	return plans
+}
+
+// SetEMIPlan creates or replaces an EMI plan
+func (s *MemoryStore) SetEMIPlan(plan *models.EMIPlan) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.emiPlans[plan.ID] = cloneEMIPlan(plan)
+	s.changed(&mutation{Op: opSetEMIPlan, Value: s.emiPlans[plan.ID]})
+}
+
+// AddRewardsEntry records a rewards points movement and updates the card's
+// points balance. It returns false if an entry with the same reference exists.
+func (s *MemoryStore) AddRewardsEntry(entry *models.RewardsEntry) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.rewardsByRef[entry.Reference]; exists && entry.Reference != "" {
+		return false
+	}
+	stored := cloneRewardsEntry(entry)
+	s.indexRewardsEntry(stored)
+	s.changed(&mutation{Op: opAddRewardsEntry, Value: stored})
+	return true
+}
+
+// GetRewardsEntriesByCardID gets a card's rewards points entries, oldest first
+func (s *MemoryStore) GetRewardsEntriesByCardID(cardID string) []*models.RewardsEntry {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return cloneAll(s.rewards[cardID], cloneRewardsEntry)
+}
+
+// GetRewardsEntryByReference gets the rewards entry recorded for a reference
+func (s *MemoryStore) GetRewardsEntryByReference(reference string) (*models.RewardsEntry, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	entry, exists := s.rewardsByRef[reference]
+	if !exists {
+		return nil, false
+	}
+	return cloneRewardsEntry(entry), true
+}
+
+// indexRewardsEntry adds an entry and its points to the card. Callers must
+// hold the write lock.
+func (s *MemoryStore) indexRewardsEntry(entry *models.RewardsEntry) {
+	s.rewards[entry.CardID] = append(s.rewards[entry.CardID], entry)
+	if entry.Reference != "" {
+		s.rewardsByRef[entry.Reference] = entry
+	}
+	if card, exists := s.creditCards[entry.CardID]; exists {
+		card.RewardsPoints += entry.Points
+	}
+}
+
+// CreateLedgerAccount adds a ledger account, returning false if the ID is already taken
+func (s *MemoryStore) CreateLedgerAccount(account *models.LedgerAccount) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.ledgerAccounts[account.ID]; exists {
+		return false
+	}
+	s.ledgerAccounts[account.ID] = clonePtr(account)
+	s.changed(&mutation{Op: opCreateLedgerAccount, Value: s.ledgerAccounts[account.ID]})
+	return true
+}
+
+// GetLedgerAccount gets ledger account by ID
+func (s *MemoryStore) GetLedgerAccount(accountID string) (*models.LedgerAccount, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	account, exists := s.ledgerAccounts[accountID]
+	if !exists {
+		return nil, false
+	}
+	return clonePtr(account), true
+}
+
+// GetLedgerAccountsByUserID gets all ledger accounts of a user
+func (s *MemoryStore) GetLedgerAccountsByUserID(userID string) []*models.LedgerAccount {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var accounts []*models.LedgerAccount
+	for _, account := range s.ledgerAccounts {
+		if account.UserID == userID {
+			accounts = append(accounts, clonePtr(account))
+		}
+	}
+	return accounts
+}
+
+// PostJournalEntry validates and appends a journal entry, then refreshes the
+// balances of every card backed by an affected account
+func (s *MemoryStore) PostJournalEntry(entry *models.JournalEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored := cloneJournalEntry(entry)
+	if err := s.post(stored); err != nil {
+		return err
+	}
+	for _, posting := range stored.Postings {
+		s.project(posting.AccountID)
+	}
+	s.changed(&mutation{Op: opPostJournalEntry, Value: stored})
+	return nil
+}
+
+// GetJournalEntriesByAccountID gets the journal entries touching an account, oldest first
+func (s *MemoryStore) GetJournalEntriesByAccountID(accountID string) []*models.JournalEntry {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return cloneAll(s.journalByAccount[accountID], cloneJournalEntry)
+}
+
+// GetJournalEntryByReference gets the first journal entry posted with a reference
+func (s *MemoryStore) GetJournalEntryByReference(reference string) (*models.JournalEntry, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	entry, exists := s.journalByRef[reference]
+	if !exists {
+		return nil, false
+	}
+	return cloneJournalEntry(entry), true
+}
+
+// GetAccountBalance gets the balance of a ledger account in minor units
+func (s *MemoryStore) GetAccountBalance(accountID string) int64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.balances[accountID]
+}
+
+// openAccount creates a customer ledger account during seeding and returns its ID
+func (s *MemoryStore) openAccount(id, accountType, name, userID string) string {
+	s.ledgerAccounts[id] = &models.LedgerAccount{
+		ID:       id,
+		Type:     accountType,
+		Name:     name,
+		Currency: ledger.Currency,
+		UserID:   userID,
+	}
+	return id
+}
+
+// post validates and applies an entry. Callers must hold the write lock.
+func (s *MemoryStore) post(entry *models.JournalEntry) error {
+	if err := ledger.Validate(entry); err != nil {
+		return err
+	}
+	for _, posting := range entry.Postings {
+		if _, exists := s.ledgerAccounts[posting.AccountID]; !exists {
+			return fmt.Errorf("%w: %s", ledger.ErrUnknownAccount, posting.AccountID)
+		}
+	}
+	if err := s.checkFunds(entry); err != nil {
+		return err
+	}
+	s.apply(entry)
+	return nil
+}
+
+// checkFunds refuses entries that would take a deposit or allowance account
+// below zero, or a credit line and its EMI loans past the card's credit limit.
+// Checking under the store's lock means concurrent postings from different
+// handlers cannot overspend an account between a balance check and the post.
+// Callers must hold the write lock.
+func (s *MemoryStore) checkFunds(entry *models.JournalEntry) error {
+	if ledger.IsCharge(entry) {
+		return nil
+	}
+	changes := make(map[string]int64)
+	for _, posting := range entry.Postings {
+		changes[posting.AccountID] += posting.Amount
+	}
+
+	touchesCredit := false
+	for accountID, change := range changes {
+		switch s.ledgerAccounts[accountID].Type {
+		case ledger.TypeDeposit, ledger.TypeAllowance:
+			if change < 0 && s.balances[accountID]+change < 0 {
+				return fmt.Errorf("%w: %s", ledger.ErrInsufficientFunds, accountID)
+			}
+		case ledger.TypeCreditLine, ledger.TypeEMILoan:
+			touchesCredit = true
+		}
+	}
+	if !touchesCredit {
+		return nil
+	}
+
+	for _, card := range s.creditCards {
+		// Add-on cards spend from their primary card's credit line
+		if card.PrimaryCardID != "" {
+			continue
+		}
+		change := changes[card.LedgerAccountID]
+		if card.EMIAccountID != "" {
+			change += changes[card.EMIAccountID]
+		}
+		if change >= 0 {
+			continue
+		}
+		used := -(s.balances[card.LedgerAccountID] + s.balances[card.EMIAccountID]) - change
+		if used > ledger.ToMinor(card.TotalCredit) {
+			return fmt.Errorf("%w: %s", ledger.ErrInsufficientFunds, card.LedgerAccountID)
+		}
+	}
+	return nil
+}
+
+// mustPost posts a seed entry, panicking if it is invalid
+func (s *MemoryStore) mustPost(entry *models.JournalEntry) {
+	if err := s.post(entry); err != nil {
+		panic(err)
+	}
+}
+
+// apply appends an already validated entry to the journal and its indexes
+func (s *MemoryStore) apply(entry *models.JournalEntry) {
+	s.journal = append(s.journal, entry)
+	if _, exists := s.journalByRef[entry.Reference]; !exists && entry.Reference != "" {
+		s.journalByRef[entry.Reference] = entry
+	}
+	seen := make(map[string]bool)
+	for _, posting := range entry.Postings {
+		s.balances[posting.AccountID] += posting.Amount
+		if !seen[posting.AccountID] {
+			seen[posting.AccountID] = true
+			s.journalByAccount[posting.AccountID] = append(s.journalByAccount[posting.AccountID], entry)
+		}
+	}
+}
+
+// creditLine returns the card whose credit line card spends from: the primary
+// card for add-ons and the card itself otherwise
+func (s *MemoryStore) creditLine(card *models.CreditCard) *models.CreditCard {
+	if primary, exists := s.creditCards[card.PrimaryCardID]; exists {
+		return primary
+	}
+	return card
+}
+
+// project copies the balance of a ledger account onto the cards backed by it.
+// Callers must hold the write lock.
+func (s *MemoryStore) project(accountID string) {
+	balance := s.balances[accountID]
+	for _, card := range s.creditCards {
+		// Add-on cards show the balances of their primary card's credit line
+		line := s.creditLine(card)
+		if line.LedgerAccountID == accountID || (line.EMIAccountID != "" && line.EMIAccountID == accountID) {
+			// Unbilled EMI principal still uses up the credit limit
+			card.OutstandingBalance = ledger.ToMajor(-s.balances[line.LedgerAccountID])
+			card.EMIOutstanding = ledger.ToMajor(-s.balances[line.EMIAccountID])
+			card.AvailableCredit = line.TotalCredit - card.OutstandingBalance - card.EMIOutstanding
+		}
+	}
+	for _, card := range s.debitCards {
+		if card.LedgerAccountID == accountID {
+			card.AccountBalance = ledger.ToMajor(balance)
+		}
+	}
+	for _, card := range s.virtualCards {
+		if card.LedgerAccountID == accountID {
+			card.RemainingBalance = ledger.ToMajor(balance)
+		}
+	}
+}
+
+// projectAll refreshes the balances of every card. Callers must hold the write lock.
+func (s *MemoryStore) projectAll() {
+	for accountID := range s.ledgerAccounts {
+		s.project(accountID)
+	}
+}
+
+// changed notifies the registered observer of a mutation. Callers must hold the write lock.
+func (s *MemoryStore) changed(m *mutation) {
+	if s.onChange != nil {
+		s.onChange(m)
+	}
+}
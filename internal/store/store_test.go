@@ -0,0 +1,493 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"bankapp-microservices/internal/ledger"
+	"bankapp-microservices/internal/models"
+)
+
+// backends opens every Store implementation so the same behaviour can be
+// checked against each
+var backends = []struct {
+	name string
+	open func(t *testing.T) Store
+}{
+	{"memory", func(t *testing.T) Store { return NewMemoryStore() }},
+	{"file", func(t *testing.T) Store { return openFileStore(t, filepath.Join(t.TempDir(), "store.db")) }},
+}
+
+func openFileStore(t *testing.T, path string) *FileStore {
+	t.Helper()
+	fs, err := NewFileStore(path)
+	if err != nil {
+		t.Fatalf("NewFileStore: %v", err)
+	}
+	t.Cleanup(func() { fs.Close() })
+	return fs
+}
+
+var conformance = []struct {
+	name string
+	run  func(t *testing.T, s Store)
+}{
+	{"records are copied in and out", testCopies},
+	{"create user rejects taken IDs", testCreateUser},
+	{"refresh tokens are used once", testUseRefreshToken},
+	{"deleting a session revokes its tokens", testDeleteSession},
+	{"expired tokens are purged", testDeleteExpiredTokens},
+	{"card balances are derived from the ledger", testCardBalances},
+	{"unbalanced journal entries are rejected", testUnbalancedEntry},
+	{"accounts cannot be overdrawn", testOverdraft},
+	{"transactions are listed in key order", testListTransactions},
+	{"statements only move forward", testStatements},
+	{"rewards points follow their entries", testRewardsPoints},
+	{"payments are found by idempotency key", testPayments},
+	{"concurrent updates do not share records", testConcurrentUpdates},
+	{"PIN updates only touch the PIN", testUpdateCardPIN},
+}
+
+func TestStoreConformance(t *testing.T) {
+	for _, backend := range backends {
+		for _, tc := range conformance {
+			t.Run(backend.name+"/"+tc.name, func(t *testing.T) {
+				tc.run(t, backend.open(t))
+			})
+		}
+	}
+}
+
+// newCreditCard stores a credit card with its own credit line
+func newCreditCard(t *testing.T, s Store, userID string, totalCredit float64) *models.CreditCard {
+	t.Helper()
+	card := &models.CreditCard{
+		ID:          models.GenerateID(),
+		CardNumber:  "4532000000000000",
+		UserID:      userID,
+		TotalCredit: totalCredit,
+		Status:      models.CardStatusActive,
+	}
+	card.LedgerAccountID = ledger.CreditCardAccountID(card.ID)
+	if !s.CreateLedgerAccount(&models.LedgerAccount{ID: card.LedgerAccountID, Type: ledger.TypeCreditLine, Currency: ledger.Currency, UserID: userID}) {
+		t.Fatalf("CreateLedgerAccount(%s) = false", card.LedgerAccountID)
+	}
+	s.UpdateCreditCard(card)
+	return card
+}
+
+func testCopies(t *testing.T, s Store) {
+	user, exists := s.GetUserByID("testuser")
+	if !exists {
+		t.Fatal("seeded user missing")
+	}
+	user.FullName = "Changed"
+	if stored, _ := s.GetUserByID("testuser"); stored.FullName == "Changed" {
+		t.Error("changing a returned user changed the stored user")
+	}
+
+	user.FullName = "Saved"
+	s.UpdateUser(user)
+	user.FullName = "Changed after saving"
+	if stored, _ := s.GetUserByID("testuser"); stored.FullName != "Saved" {
+		t.Errorf("FullName = %q, want %q", stored.FullName, "Saved")
+	}
+
+	card := newCreditCard(t, s, "testuser", 1000)
+	card.PIN = &models.CardPIN{Hash: "hash"}
+	s.UpdateCreditCard(card)
+	card.PIN.FailedAttempts = 3
+	if stored, _ := s.GetCreditCardByID(card.ID); stored.PIN.FailedAttempts != 0 {
+		t.Error("changing a saved card's PIN changed the stored card")
+	}
+
+	settings, _ := s.GetCardSettings("testuser")
+	settings.NotificationPreferences[0] = "Changed"
+	if stored, _ := s.GetCardSettings("testuser"); stored.NotificationPreferences[0] == "Changed" {
+		t.Error("changing returned settings changed the stored settings")
+	}
+}
+
+func testCreateUser(t *testing.T, s Store) {
+	if s.CreateUser(&models.User{UserID: "testuser"}) {
+		t.Error("CreateUser accepted a taken user ID")
+	}
+	if !s.CreateUser(&models.User{UserID: "alice", Email: "Alice@Example.com"}) {
+		t.Fatal("CreateUser rejected a new user ID")
+	}
+	if user, exists := s.GetUserByEmail("alice@example.com"); !exists || user.UserID != "alice" {
+		t.Errorf("GetUserByEmail = %v, %v; want alice", user, exists)
+	}
+}
+
+func testUseRefreshToken(t *testing.T, s Store) {
+	s.SetRefreshToken(&models.RefreshToken{Token: "refresh", UserID: "testuser", SessionID: "session", ExpiresAt: time.Now().Add(time.Hour)})
+	first, exists := s.UseRefreshToken("refresh")
+	if !exists || first.Used {
+		t.Fatalf("first use = %+v, %v; want unused token", first, exists)
+	}
+	second, exists := s.UseRefreshToken("refresh")
+	if !exists || !second.Used {
+		t.Fatalf("second use = %+v, %v; want used token", second, exists)
+	}
+	if _, exists := s.UseRefreshToken("unknown"); exists {
+		t.Error("UseRefreshToken found an unknown token")
+	}
+}
+
+func testDeleteSession(t *testing.T, s Store) {
+	expires := time.Now().Add(time.Hour)
+	s.SetSession(&models.Session{ID: "session", UserID: "testuser", ExpiresAt: expires})
+	s.SetAccessToken(&models.AccessToken{Token: "access", UserID: "testuser", SessionID: "session", ExpiresAt: expires})
+	s.SetRefreshToken(&models.RefreshToken{Token: "refresh", UserID: "testuser", SessionID: "session", ExpiresAt: expires})
+	if _, exists := s.GetUserByToken("access"); !exists {
+		t.Fatal("GetUserByToken did not find the access token's user")
+	}
+
+	s.DeleteSession("session")
+	if _, exists := s.GetSessionByID("session"); exists {
+		t.Error("session still exists")
+	}
+	if _, exists := s.GetAccessToken("access"); exists {
+		t.Error("access token still exists")
+	}
+	if _, exists := s.GetRefreshToken("refresh"); exists {
+		t.Error("refresh token still exists")
+	}
+}
+
+func testDeleteExpiredTokens(t *testing.T, s Store) {
+	now := time.Now()
+	s.SetAccessToken(&models.AccessToken{Token: "expired", ExpiresAt: now.Add(-time.Second)})
+	s.SetAccessToken(&models.AccessToken{Token: "live", ExpiresAt: now.Add(time.Hour)})
+	s.SetLoginChallenge(&models.LoginChallenge{ID: "challenge", ExpiresAt: now})
+	if removed := s.DeleteExpiredTokens(now); removed != 2 {
+		t.Errorf("DeleteExpiredTokens removed %d entries, want 2", removed)
+	}
+	if _, exists := s.GetAccessToken("live"); !exists {
+		t.Error("live token was purged")
+	}
+	if _, exists := s.GetUserByToken("expired"); exists {
+		t.Error("expired token still authenticates")
+	}
+}
+
+func testCardBalances(t *testing.T, s Store) {
+	card := newCreditCard(t, s, "testuser", 1000)
+	stale, _ := s.GetCreditCardByID(card.ID)
+
+	purchase := ledger.Transfer(card.LedgerAccountID, ledger.AccountMerchantSettlement, ledger.ToMinor(250.50), "Purchase", "purchase-1", time.Now())
+	if err := s.PostJournalEntry(purchase); err != nil {
+		t.Fatalf("PostJournalEntry: %v", err)
+	}
+	if balance := s.GetAccountBalance(card.LedgerAccountID); balance != -25050 {
+		t.Errorf("balance = %d, want -25050", balance)
+	}
+
+	// Saving a copy read before the purchase must not roll its balance back
+	stale.CardType = "Renamed"
+	s.UpdateCreditCard(stale)
+	got, _ := s.GetCreditCardByID(card.ID)
+	if got.OutstandingBalance != 250.50 || got.AvailableCredit != 749.50 || got.CardType != "Renamed" {
+		t.Errorf("card = outstanding %.2f, available %.2f, type %q; want 250.50, 749.50, Renamed",
+			got.OutstandingBalance, got.AvailableCredit, got.CardType)
+	}
+
+	if entry, exists := s.GetJournalEntryByReference("purchase-1"); !exists || entry.ID != purchase.ID {
+		t.Errorf("GetJournalEntryByReference = %v, %v; want the purchase", entry, exists)
+	}
+	if entries := s.GetJournalEntriesByAccountID(card.LedgerAccountID); len(entries) != 1 {
+		t.Errorf("account has %d entries, want 1", len(entries))
+	}
+}
+
+func testUnbalancedEntry(t *testing.T, s Store) {
+	entry := ledger.NewEntry("Unbalanced", "", time.Now(),
+		models.Posting{AccountID: ledger.AccountFunding, Amount: 100},
+		models.Posting{AccountID: ledger.AccountFeeIncome, Amount: -99},
+	)
+	if err := s.PostJournalEntry(entry); !errors.Is(err, ledger.ErrUnbalanced) {
+		t.Errorf("PostJournalEntry = %v, want ErrUnbalanced", err)
+	}
+	unknown := ledger.Transfer(ledger.AccountFunding, "deposit:unknown", 100, "Unknown", "", time.Now())
+	if err := s.PostJournalEntry(unknown); !errors.Is(err, ledger.ErrUnknownAccount) {
+		t.Errorf("PostJournalEntry = %v, want ErrUnknownAccount", err)
+	}
+	if balance := s.GetAccountBalance(ledger.AccountFeeIncome); balance != 0 {
+		t.Errorf("rejected entry changed a balance to %d", balance)
+	}
+}
+
+func testOverdraft(t *testing.T, s Store) {
+	deposit := ledger.DepositAccountID("overdraft-test")
+	s.CreateLedgerAccount(&models.LedgerAccount{ID: deposit, Type: ledger.TypeDeposit, Currency: ledger.Currency, UserID: "testuser"})
+	if err := s.PostJournalEntry(ledger.Transfer(ledger.AccountFunding, deposit, 1000, "Deposit", "", time.Now())); err != nil {
+		t.Fatal(err)
+	}
+
+	// Concurrent withdrawals from different handlers are serialized by the store
+	var wg sync.WaitGroup
+	var approved sync.Map
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			err := s.PostJournalEntry(ledger.Transfer(deposit, ledger.AccountATMCash, 100, "Withdrawal", "", time.Now()))
+			if err == nil {
+				approved.Store(i, true)
+			} else if !errors.Is(err, ledger.ErrInsufficientFunds) {
+				t.Errorf("PostJournalEntry = %v, want ErrInsufficientFunds", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	count := 0
+	approved.Range(func(_, _ interface{}) bool { count++; return true })
+	if balance := s.GetAccountBalance(deposit); balance != 0 || count != 10 {
+		t.Errorf("balance = %d after %d withdrawals, want 0 after 10", balance, count)
+	}
+
+	card := newCreditCard(t, s, "testuser", 10)
+	if err := s.PostJournalEntry(ledger.Transfer(card.LedgerAccountID, ledger.AccountMerchantSettlement, 1001, "Purchase", "", time.Now())); !errors.Is(err, ledger.ErrInsufficientFunds) {
+		t.Errorf("purchase over the credit limit = %v, want ErrInsufficientFunds", err)
+	}
+	if err := s.PostJournalEntry(ledger.Transfer(card.LedgerAccountID, ledger.AccountMerchantSettlement, 1000, "Purchase", "", time.Now())); err != nil {
+		t.Errorf("purchase up to the credit limit = %v", err)
+	}
+	if err := s.PostJournalEntry(ledger.Transfer(card.LedgerAccountID, ledger.AccountFeeIncome, 500, "Over-limit fee", "", time.Now())); err != nil {
+		t.Errorf("fee over the credit limit = %v, want it charged", err)
+	}
+}
+
+func testListTransactions(t *testing.T, s Store) {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	// Added out of order, including two at the same time
+	for _, i := range []int{3, 0, 4, 1, 2} {
+		s.AddTransaction(&models.Transaction{ID: fmt.Sprintf("a%d", i), CardID: "card-a", Date: start.Add(time.Duration(i) * time.Hour)})
+	}
+	s.AddTransaction(&models.Transaction{ID: "b2", CardID: "card-b", Date: start.Add(2 * time.Hour)})
+
+	page, more := s.ListTransactions(TransactionQuery{CardIDs: []string{"card-a", "card-b"}, Limit: 4})
+	if want := []string{"a0", "a1", "a2", "b2"}; !sameIDs(page, want) || !more {
+		t.Errorf("first page = %v, more %v; want %v, true", ids(page), more, want)
+	}
+	after := KeyOf(page[len(page)-1])
+	page, more = s.ListTransactions(TransactionQuery{CardIDs: []string{"card-a", "card-b"}, After: &after, Limit: 4})
+	if want := []string{"a3", "a4"}; !sameIDs(page, want) || more {
+		t.Errorf("second page = %v, more %v; want %v, false", ids(page), more, want)
+	}
+
+	page, _ = s.ListTransactions(TransactionQuery{CardIDs: []string{"card-a"}, Descending: true, From: start.Add(time.Hour), To: start.Add(4 * time.Hour), Limit: 10})
+	if want := []string{"a3", "a2", "a1"}; !sameIDs(page, want) {
+		t.Errorf("descending range = %v, want %v", ids(page), want)
+	}
+
+	page[0].Amount = 99
+	if txns := s.GetTransactionsByCardID("card-a"); txns[3].Amount != 0 {
+		t.Error("changing a listed transaction changed the stored transaction")
+	}
+}
+
+func ids(txns []*models.Transaction) []string {
+	var result []string
+	for _, txn := range txns {
+		result = append(result, txn.ID)
+	}
+	return result
+}
+
+func sameIDs(txns []*models.Transaction, want []string) bool {
+	return fmt.Sprint(ids(txns)) == fmt.Sprint(want)
+}
+
+func testStatements(t *testing.T, s Store) {
+	end := time.Date(2025, 2, 5, 0, 0, 0, 0, time.UTC)
+	if !s.AddStatement(&models.Statement{ID: "feb", CardID: "card", PeriodEnd: end}) {
+		t.Fatal("AddStatement rejected the first statement")
+	}
+	if s.AddStatement(&models.Statement{ID: "jan", CardID: "card", PeriodEnd: end.AddDate(0, -1, 0)}) {
+		t.Error("AddStatement accepted an earlier cycle")
+	}
+	if !s.AddStatement(&models.Statement{ID: "mar", CardID: "card", PeriodEnd: end.AddDate(0, 1, 0)}) {
+		t.Fatal("AddStatement rejected a later cycle")
+	}
+	if latest, _ := s.GetLatestStatement("card"); latest.ID != "mar" {
+		t.Errorf("latest statement = %s, want mar", latest.ID)
+	}
+	if statements := s.GetStatementsByCardID("card"); len(statements) != 2 {
+		t.Errorf("card has %d statements, want 2", len(statements))
+	}
+}
+
+func testRewardsPoints(t *testing.T, s Store) {
+	card := newCreditCard(t, s, "testuser", 1000)
+	if !s.AddRewardsEntry(&models.RewardsEntry{ID: "earn", CardID: card.ID, Type: models.RewardsEarn, Points: 120, Reference: "earn:1"}) {
+		t.Fatal("AddRewardsEntry rejected a new reference")
+	}
+	if s.AddRewardsEntry(&models.RewardsEntry{ID: "again", CardID: card.ID, Type: models.RewardsEarn, Points: 120, Reference: "earn:1"}) {
+		t.Error("AddRewardsEntry accepted a duplicate reference")
+	}
+	s.AddRewardsEntry(&models.RewardsEntry{ID: "redeem", CardID: card.ID, Type: models.RewardsRedeem, Points: -20, Reference: "redeem:1"})
+
+	// The points on a saved card are ignored in favour of the entries
+	card.RewardsPoints = 5000
+	s.UpdateCreditCard(card)
+	if got, _ := s.GetCreditCardByID(card.ID); got.RewardsPoints != 100 {
+		t.Errorf("RewardsPoints = %d, want 100", got.RewardsPoints)
+	}
+}
+
+func testPayments(t *testing.T, s Store) {
+	s.AddCardPayment(&models.CardPayment{ID: "p1", CardID: "card", UserID: "testuser", Amount: 10, IdempotencyKey: "key"})
+	s.AddCardPayment(&models.CardPayment{ID: "p2", CardID: "card", UserID: "testuser", Amount: 20})
+	if payment, exists := s.GetCardPaymentByIdempotencyKey("testuser", "key"); !exists || payment.ID != "p1" {
+		t.Errorf("GetCardPaymentByIdempotencyKey = %v, %v; want p1", payment, exists)
+	}
+	if _, exists := s.GetCardPaymentByIdempotencyKey("someone-else", "key"); exists {
+		t.Error("idempotency keys are shared between users")
+	}
+	if payments := s.GetCardPaymentsByCardID("card"); len(payments) != 2 {
+		t.Errorf("card has %d payments, want 2", len(payments))
+	}
+}
+
+// testConcurrentUpdates changes copies of the same card from many goroutines;
+// run with -race to check that no record is shared
+func testConcurrentUpdates(t *testing.T, s Store) {
+	card := newCreditCard(t, s, "testuser", 1000)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				c, _ := s.GetCreditCardByID(card.ID)
+				c.Activation = &models.CardActivation{FailedAttempts: i}
+				c.StatusReason = fmt.Sprint(j)
+				s.UpdateCreditCard(c)
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func testUpdateCardPIN(t *testing.T, s Store) {
+	card := newCreditCard(t, s, "testuser", 1000)
+	card.PIN = &models.CardPIN{Hash: "hash"}
+	s.UpdateCreditCard(card)
+
+	// A status change saved after the card was loaded survives the PIN update
+	changed := *card
+	changed.Status = models.CardStatusTemporarilyBlocked
+	s.UpdateCreditCard(&changed)
+	if !s.UpdateCardPIN(card.ID, func(pin **models.CardPIN) { (*pin).FailedAttempts++ }) {
+		t.Fatal("UpdateCardPIN did not find the credit card")
+	}
+	stored, _ := s.GetCreditCardByID(card.ID)
+	if stored.Status != models.CardStatusTemporarilyBlocked || stored.PIN.FailedAttempts != 1 {
+		t.Errorf("card = %s with %d failed attempts, want TemporarilyBlocked with 1", stored.Status, stored.PIN.FailedAttempts)
+	}
+
+	debit := s.GetDebitCardsByUserID("testuser")[0]
+	if !s.UpdateCardPIN(debit.ID, func(pin **models.CardPIN) { *pin = &models.CardPIN{Hash: "debit"} }) {
+		t.Fatal("UpdateCardPIN did not find the debit card")
+	}
+	if stored, _ := s.GetDebitCardByID(debit.ID); stored.PIN == nil || stored.PIN.Hash != "debit" {
+		t.Errorf("debit card PIN = %+v", stored.PIN)
+	}
+	if s.UpdateCardPIN("missing", func(pin **models.CardPIN) {}) {
+		t.Error("UpdateCardPIN found a card that does not exist")
+	}
+}
+
+func TestFileStoreReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "store.db")
+	fs := openFileStore(t, path)
+	card := newCreditCard(t, fs, "testuser", 1000)
+	if err := fs.PostJournalEntry(ledger.Transfer(card.LedgerAccountID, ledger.AccountMerchantSettlement, 12345, "Purchase", "", time.Now())); err != nil {
+		t.Fatalf("PostJournalEntry: %v", err)
+	}
+	fs.AddRewardsEntry(&models.RewardsEntry{ID: "earn", CardID: card.ID, Points: 12, Reference: "earn"})
+	fs.UpdateCardPIN(card.ID, func(pin **models.CardPIN) { *pin = &models.CardPIN{Hash: "hash", FailedAttempts: 2} })
+	fs.SetSession(&models.Session{ID: "session", UserID: "testuser", ExpiresAt: time.Now().Add(time.Hour)})
+	fs.DeleteSession("session")
+	if err := fs.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	reopened := openFileStore(t, path)
+	got, exists := reopened.GetCreditCardByID(card.ID)
+	if !exists {
+		t.Fatal("card was not persisted")
+	}
+	if got.OutstandingBalance != 123.45 || got.RewardsPoints != 12 {
+		t.Errorf("card = outstanding %.2f, points %d; want 123.45, 12", got.OutstandingBalance, got.RewardsPoints)
+	}
+	if got.PIN == nil || got.PIN.FailedAttempts != 2 {
+		t.Errorf("card PIN = %+v, want the journaled PIN update", got.PIN)
+	}
+	if _, exists := reopened.GetSessionByID("session"); exists {
+		t.Error("deleted session came back")
+	}
+	if users := len(reopened.GetCreditCardsByUserID("testuser")); users != 3 {
+		t.Errorf("user has %d credit cards, want 3 (reopening must not seed again)", users)
+	}
+}
+
+func TestFileStoreTornJournal(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "store.db")
+	fs := openFileStore(t, path)
+	fs.AddTransaction(&models.Transaction{ID: "kept", CardID: "card", Date: time.Now()})
+	fs.AddTransaction(&models.Transaction{ID: "torn", CardID: "card", Date: time.Now()})
+	fs.Close()
+
+	// Cut the last frame short, as a crash while writing it would
+	info, err := os.Stat(path + ".journal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Truncate(path+".journal", info.Size()-3); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened := openFileStore(t, path)
+	if txns := reopened.GetTransactionsByCardID("card"); !sameIDs(txns, []string{"kept"}) {
+		t.Errorf("transactions = %v, want [kept]", ids(txns))
+	}
+	// The journal is usable again after recovery
+	reopened.AddTransaction(&models.Transaction{ID: "later", CardID: "card", Date: time.Now()})
+	reopened.Close()
+	if txns := openFileStore(t, path).GetTransactionsByCardID("card"); len(txns) != 2 {
+		t.Errorf("card has %d transactions after recovery, want 2", len(txns))
+	}
+}
+
+func TestFileStoreLargeLoad(t *testing.T) {
+	if testing.Short() {
+		t.Skip("writes 100k rows")
+	}
+	const rows = 100000
+	path := filepath.Join(t.TempDir(), "store.db")
+	fs := openFileStore(t, path)
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	began := time.Now()
+	for i := 0; i < rows; i++ {
+		fs.AddTransaction(&models.Transaction{ID: fmt.Sprintf("txn-%06d", i), CardID: "card", Amount: 1, Date: start.Add(time.Duration(i) * time.Second)})
+	}
+	t.Logf("wrote %d rows in %s", rows, time.Since(began))
+	fs.Close()
+
+	reopened := openFileStore(t, path)
+	page, more := reopened.ListTransactions(TransactionQuery{CardIDs: []string{"card"}, Descending: true, Limit: 1})
+	if len(page) != 1 || page[0].ID != fmt.Sprintf("txn-%06d", rows-1) || !more {
+		t.Errorf("latest transaction = %v, more %v; want txn-%06d", ids(page), more, rows-1)
+	}
+	if txns := reopened.GetTransactionsByCardID("card"); len(txns) != rows {
+		t.Errorf("card has %d transactions, want %d", len(txns), rows)
+	}
+}
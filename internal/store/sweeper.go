@@ -0,0 +1,23 @@
+package store
+
+import (
+	"log"
+	"time"
+)
+
+// SweepExpiredTokens periodically purges expired tokens from s until stop is closed
+func SweepExpiredTokens(s Store, interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if removed := s.DeleteExpiredTokens(time.Now()); removed > 0 {
+				log.Printf("store: purged %d expired tokens and sessions", removed)
+			}
+		case <-stop:
+			return
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package store
+
+import (
+	"sort"
+	"time"
+
+	"bankapp-microservices/internal/models"
+)
+
+// TransactionKey is a position in the transaction index. Transactions are
+// ordered by date and then by ID, which makes the order total and stable.
+type TransactionKey struct {
+	Date time.Time
+	ID   string
+}
+
+// KeyOf returns the index position of a transaction
+func KeyOf(txn *models.Transaction) TransactionKey {
+	return TransactionKey{Date: txn.Date, ID: txn.ID}
+}
+
+// Less reports whether k sorts before other
+func (k TransactionKey) Less(other TransactionKey) bool {
+	if !k.Date.Equal(other.Date) {
+		return k.Date.Before(other.Date)
+	}
+	return k.ID < other.ID
+}
+
+// TransactionQuery selects one page of transactions from a set of cards
+type TransactionQuery struct {
+	CardIDs []string
+	// Descending orders newest first
+	Descending bool
+	// After returns the transactions following this key in the query order;
+	// Before returns the ones preceding it. At most one may be set.
+	After  *TransactionKey
+	Before *TransactionKey
+	// From and To bound the date range as [From, To); zero values are unbounded
+	From time.Time
+	To   time.Time
+	// Match filters on anything else; nil matches everything
+	Match func(*models.Transaction) bool
+	Limit int
+}
+
+// ListTransactions returns up to q.Limit matching transactions in query order
+// and whether more exist beyond them in the direction that was read. Each
+// card's transactions are kept sorted, so the date range and cursor are found
+// by binary search and only the rows that are returned or rejected by Match
+// are visited.
+func (s *MemoryStore) ListTransactions(q TransactionQuery) ([]*models.Transaction, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	// Reading backwards from a Before key walks against the query order
+	ascending := !q.Descending
+	cursor := q.After
+	if q.Before != nil {
+		ascending = !ascending
+		cursor = q.Before
+	}
+
+	// Narrow every card's index to the half-open window [lo, hi)
+	type window struct {
+		txns   []*models.Transaction
+		lo, hi int
+	}
+	windows := make([]*window, 0, len(q.CardIDs))
+	for _, cardID := range q.CardIDs {
+		txns := s.transactions[cardID]
+		lo, hi := 0, len(txns)
+		if !q.From.IsZero() {
+			lo = sort.Search(len(txns), func(i int) bool { return !txns[i].Date.Before(q.From) })
+		}
+		if !q.To.IsZero() {
+			hi = sort.Search(len(txns), func(i int) bool { return !txns[i].Date.Before(q.To) })
+		}
+		if cursor != nil {
+			if ascending {
+				lo = max(lo, sort.Search(len(txns), func(i int) bool { return cursor.Less(KeyOf(txns[i])) }))
+			} else {
+				hi = min(hi, sort.Search(len(txns), func(i int) bool { return !KeyOf(txns[i]).Less(*cursor) }))
+			}
+		}
+		if lo < hi {
+			windows = append(windows, &window{txns: txns, lo: lo, hi: hi})
+		}
+	}
+
+	// Merge the windows, taking the next transaction in reading order each step
+	var page []*models.Transaction
+	for {
+		var next *window
+		for _, w := range windows {
+			if w.lo >= w.hi {
+				continue
+			}
+			if next == nil {
+				next = w
+				continue
+			}
+			if ascending && KeyOf(w.txns[w.lo]).Less(KeyOf(next.txns[next.lo])) ||
+				!ascending && KeyOf(next.txns[next.hi-1]).Less(KeyOf(w.txns[w.hi-1])) {
+				next = w
+			}
+		}
+		if next == nil {
+			break
+		}
+
+		var txn *models.Transaction
+		if ascending {
+			txn = next.txns[next.lo]
+			next.lo++
+		} else {
+			next.hi--
+			txn = next.txns[next.hi]
+		}
+		if q.Match != nil && !q.Match(txn) {
+			continue
+		}
+		if len(page) == q.Limit {
+			return orderPage(page, q.Before != nil), true
+		}
+		page = append(page, clonePtr(txn))
+	}
+	return orderPage(page, q.Before != nil), false
+}
+
+// orderPage puts a page read backwards from a Before key back in query order
+func orderPage(page []*models.Transaction, reversed bool) []*models.Transaction {
+	if reversed {
+		for i, j := 0, len(page)-1; i < j; i, j = i+1, j-1 {
+			page[i], page[j] = page[j], page[i]
+		}
+	}
+	return page
+}
+
+// insertTransaction adds txn to a card's index, keeping it sorted. New
+// transactions are almost always the latest, so this is usually an append.
+func insertTransaction(txns []*models.Transaction, txn *models.Transaction) []*models.Transaction {
+	key := KeyOf(txn)
+	i := sort.Search(len(txns), func(i int) bool { return key.Less(KeyOf(txns[i])) })
+	txns = append(txns, nil)
+	copy(txns[i+1:], txns[i:])
+	txns[i] = txn
+	return txns
+}
+
+// sortTransactionIndex sorts every card's transactions, for data loaded from
+// snapshots written before the index existed
+func sortTransactionIndex(index map[string][]*models.Transaction) {
+	for _, txns := range index {
+		sort.SliceStable(txns, func(i, j int) bool { return KeyOf(txns[i]).Less(KeyOf(txns[j])) })
+	}
+}
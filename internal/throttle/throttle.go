@@ -0,0 +1,102 @@
+// Package throttle tracks failed attempts per key and imposes exponentially
+// growing lockouts once a number of free attempts has been used up.
+package throttle
+
+import (
+	"sync"
+	"time"
+)
+
+// maxEntries bounds the number of tracked keys before stale entries are purged
+const maxEntries = 10000
+
+// Throttle counts failures per key. It is safe for concurrent use.
+type Throttle struct {
+	mu      sync.Mutex
+	entries map[string]*entry
+
+	freeAttempts int
+	baseDelay    time.Duration
+	maxDelay     time.Duration
+	resetAfter   time.Duration
+}
+
+type entry struct {
+	failures    int
+	lastFailure time.Time
+	lockedUntil time.Time
+}
+
+// New creates a throttle that allows freeAttempts failures, then locks the key
+// for baseDelay, doubling on every further failure up to maxDelay. Failures are
+// forgotten after resetAfter without a new one.
+func New(freeAttempts int, baseDelay, maxDelay, resetAfter time.Duration) *Throttle {
+	return &Throttle{
+		entries:      make(map[string]*entry),
+		freeAttempts: freeAttempts,
+		baseDelay:    baseDelay,
+		maxDelay:     maxDelay,
+		resetAfter:   resetAfter,
+	}
+}
+
+// Check returns the time until key is unlocked, or zero if it is not locked
+func (t *Throttle) Check(key string, now time.Time) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	e, exists := t.entries[key]
+	if !exists || !now.Before(e.lockedUntil) {
+		return 0
+	}
+	return e.lockedUntil.Sub(now)
+}
+
+// Fail records a failed attempt for key and returns the resulting lockout, or
+// zero if the key still has free attempts left
+func (t *Throttle) Fail(key string, now time.Time) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if len(t.entries) >= maxEntries {
+		t.purge(now)
+	}
+
+	e, exists := t.entries[key]
+	if !exists || now.Sub(e.lastFailure) > t.resetAfter {
+		e = &entry{}
+		t.entries[key] = e
+	}
+	e.failures++
+	e.lastFailure = now
+
+	if e.failures < t.freeAttempts {
+		return 0
+	}
+
+	delay := t.baseDelay
+	for i := t.freeAttempts; i < e.failures && delay < t.maxDelay; i++ {
+		delay *= 2
+	}
+	if delay > t.maxDelay {
+		delay = t.maxDelay
+	}
+	e.lockedUntil = now.Add(delay)
+	return delay
+}
+
+// Reset forgets all failures of key
+func (t *Throttle) Reset(key string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.entries, key)
+}
+
+// purge drops entries that are unlocked and whose failures have expired.
+// Callers must hold the lock.
+func (t *Throttle) purge(now time.Time) {
+	for key, e := range t.entries {
+		if !now.Before(e.lockedUntil) && now.Sub(e.lastFailure) > t.resetAfter {
+			delete(t.entries, key)
+		}
+	}
+}
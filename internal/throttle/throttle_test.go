@@ -0,0 +1,47 @@
+package throttle
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLockoutDoubles(t *testing.T) {
+	th := New(3, time.Second, 5*time.Second, time.Hour)
+	now := time.Unix(1700000000, 0)
+
+	for i := 1; i < 3; i++ {
+		if lockout := th.Fail("k", now); lockout != 0 {
+			t.Fatalf("failure %d locked for %v, want free attempt", i, lockout)
+		}
+	}
+	for _, want := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second} {
+		if lockout := th.Fail("k", now); lockout != want {
+			t.Fatalf("lockout = %v, want %v", lockout, want)
+		}
+	}
+	if got := th.Check("k", now.Add(time.Second)); got != 4*time.Second {
+		t.Errorf("Check = %v, want 4s", got)
+	}
+	if got := th.Check("k", now.Add(5*time.Second)); got != 0 {
+		t.Errorf("Check after lockout = %v, want 0", got)
+	}
+	if got := th.Check("other", now); got != 0 {
+		t.Errorf("unrelated key locked for %v", got)
+	}
+}
+
+func TestFailuresExpireAndReset(t *testing.T) {
+	th := New(2, time.Second, time.Minute, time.Hour)
+	now := time.Unix(1700000000, 0)
+
+	th.Fail("k", now)
+	if lockout := th.Fail("k", now.Add(2*time.Hour)); lockout != 0 {
+		t.Errorf("failure after the reset window locked for %v", lockout)
+	}
+
+	th.Fail("k", now)
+	th.Reset("k")
+	if lockout := th.Fail("k", now); lockout != 0 {
+		t.Errorf("failure after Reset locked for %v", lockout)
+	}
+}
@@ -0,0 +1,79 @@
+package totp
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA1 test key of RFC 6238 appendix B, base32 encoded
+var rfcSecret = encoding.EncodeToString([]byte("12345678901234567890"))
+
+func TestCodeMatchesRFC6238(t *testing.T) {
+	// The RFC lists 8 digit codes; ours are their last 6 digits
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+	for _, tt := range tests {
+		code, err := Code(rfcSecret, Counter(time.Unix(tt.unix, 0)))
+		if err != nil {
+			t.Fatalf("Code: %v", err)
+		}
+		if code != tt.code {
+			t.Errorf("code at %d = %s, want %s", tt.unix, code, tt.code)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+	code, _ := Code(rfcSecret, Counter(now))
+
+	tests := []struct {
+		name string
+		code string
+		at   time.Time
+		ok   bool
+	}{
+		{"current step", code, now, true},
+		{"one step of drift", code, now.Add(Period * time.Second), true},
+		{"too much drift", code, now.Add(2 * Period * time.Second), false},
+		{"wrong code", "000000", now, false},
+		{"wrong length", code[:5], now, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			counter, ok := Validate(rfcSecret, tt.code, tt.at)
+			if ok != tt.ok {
+				t.Fatalf("Validate = %v, want %v", ok, tt.ok)
+			}
+			if ok && counter != Counter(now) {
+				t.Errorf("counter = %d, want %d so replays can be rejected", counter, Counter(now))
+			}
+		})
+	}
+}
+
+func TestSecretsAreUniqueAndUsable(t *testing.T) {
+	first, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, _ := GenerateSecret()
+	if first == second {
+		t.Error("GenerateSecret returned the same secret twice")
+	}
+	if _, err := Code(strings.ToLower(first), 1); err != nil {
+		t.Errorf("generated secret is not usable: %v", err)
+	}
+	if uri := URI("BankApp", "bruce@example.com", first); !strings.Contains(uri, "secret="+first) || !strings.HasPrefix(uri, "otpauth://totp/BankApp:") {
+		t.Errorf("URI = %s", uri)
+	}
+}
@@ -0,0 +1,84 @@
+// Package usage maintains per-card limit consumption counters that reset on
+// calendar day and month boundaries in a configurable time zone.
+package usage
+
+import (
+	"time"
+
+	"bankapp-microservices/internal/models"
+)
+
+const (
+	dayLayout   = "2006-01-02"
+	monthLayout = "2006-01"
+)
+
+// Key returns the counter key for a limit type in the domestic or international scope
+func Key(limitType string, international bool) string {
+	if international {
+		return "international:" + limitType
+	}
+	return "domestic:" + limitType
+}
+
+// Current returns the card's counters for the day and month containing now,
+// discarding counters left over from earlier periods. u may be nil.
+func Current(u *models.CardUsage, cardID string, now time.Time, loc *time.Location) *models.CardUsage {
+	local := now.In(loc)
+	day := local.Format(dayLayout)
+	month := local.Format(monthLayout)
+
+	current := &models.CardUsage{
+		CardID:  cardID,
+		Day:     day,
+		Month:   month,
+		Daily:   make(map[string]float64),
+		Monthly: make(map[string]float64),
+	}
+	if u == nil {
+		return current
+	}
+	if u.Day == day {
+		for key, amount := range u.Daily {
+			current.Daily[key] = amount
+		}
+	}
+	if u.Month == month {
+		for key, amount := range u.Monthly {
+			current.Monthly[key] = amount
+		}
+	}
+	return current
+}
+
+// Record adds amount to the daily and monthly counters of key
+func Record(u *models.CardUsage, key string, amount float64) {
+	u.Daily[key] += amount
+	u.Monthly[key] += amount
+}
+
+// DailyTotal returns the amount used today across all channels
+func DailyTotal(u *models.CardUsage) float64 {
+	return total(u.Daily)
+}
+
+// MonthlyTotal returns the amount used this month across all channels
+func MonthlyTotal(u *models.CardUsage) float64 {
+	return total(u.Monthly)
+}
+
+func total(counters map[string]float64) float64 {
+	sum := 0.0
+	for _, amount := range counters {
+		sum += amount
+	}
+	return sum
+}
+
+// Remaining returns how much of limit is left after used, never below zero
+func Remaining(limit, used float64) float64 {
+	if used >= limit {
+		return 0
+	}
+	return limit - used
+}
@@ -0,0 +1,59 @@
+package usage
+
+import (
+	"testing"
+	"time"
+
+	"bankapp-microservices/internal/models"
+)
+
+func TestCurrentResetsInLocalTime(t *testing.T) {
+	kolkata, err := time.LoadLocation("Asia/Kolkata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := Key(models.LimitTypeOnline, false)
+
+	// 20:00 UTC on 31 January is already 1 February in Kolkata
+	evening := time.Date(2026, 1, 31, 17, 0, 0, 0, time.UTC)
+	u := Current(nil, "card", evening, kolkata)
+	Record(u, key, 300)
+	if u.Day != "2026-01-31" || u.Month != "2026-01" {
+		t.Fatalf("period = %s %s, want 2026-01-31 2026-01", u.Day, u.Month)
+	}
+
+	sameDay := Current(u, "card", evening.Add(time.Hour), kolkata)
+	if sameDay.Daily[key] != 300 || sameDay.Monthly[key] != 300 {
+		t.Errorf("same day counters = %v %v, want 300", sameDay.Daily, sameDay.Monthly)
+	}
+
+	nextMonth := Current(u, "card", time.Date(2026, 1, 31, 20, 0, 0, 0, time.UTC), kolkata)
+	if nextMonth.Day != "2026-02-01" || nextMonth.Daily[key] != 0 || nextMonth.Monthly[key] != 0 {
+		t.Errorf("after local midnight = %s %v %v, want fresh counters", nextMonth.Day, nextMonth.Daily, nextMonth.Monthly)
+	}
+
+	Record(u, Key(models.LimitTypeATM, true), 200)
+	otherDay := Current(u, "card", time.Date(2026, 1, 20, 12, 0, 0, 0, time.UTC), kolkata)
+	if DailyTotal(otherDay) != 0 || MonthlyTotal(otherDay) != 500 {
+		t.Errorf("another day of the month = daily %v monthly %v, want only the monthly counters", otherDay.Daily, otherDay.Monthly)
+	}
+}
+
+func TestCurrentDoesNotShareCounters(t *testing.T) {
+	now := time.Now()
+	u := Current(nil, "card", now, time.UTC)
+	current := Current(u, "card", now, time.UTC)
+	Record(current, "k", 1)
+	if u.Daily["k"] != 0 {
+		t.Error("recording on the current counters changed the stored ones")
+	}
+}
+
+func TestRemaining(t *testing.T) {
+	if got := Remaining(1000, 250); got != 750 {
+		t.Errorf("Remaining(1000, 250) = %v", got)
+	}
+	if got := Remaining(1000, 1200); got != 0 {
+		t.Errorf("Remaining(1000, 1200) = %v, want 0", got)
+	}
+}